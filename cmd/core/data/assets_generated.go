@@ -21,21 +21,21 @@ var Assets = func() http.FileSystem {
 	fs := vfsgen۰FS{
 		"/": &vfsgen۰DirInfo{
 			name:    "/",
-			modTime: time.Date(2020, 4, 15, 14, 1, 39, 744241768, time.UTC),
+			modTime: time.Date(2026, 10, 19, 0, 26, 27, 244729084, time.UTC),
 		},
 		"/default-config.toml": &vfsgen۰CompressedFileInfo{
 			name:             "default-config.toml",
-			modTime:          time.Date(2020, 4, 15, 14, 1, 39, 736241741, time.UTC),
-			uncompressedSize: 2231,
+			modTime:          time.Date(2026, 10, 19, 0, 26, 27, 244729084, time.UTC),
+			uncompressedSize: 14219,
 
-			compressedContent: []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\xac\x54\x4d\x6f\xdb\x38\x10\xbd\xeb\x57\x0c\xe4\x4b\x02\x04\xb1\x93\x34\x81\xd7\x80\x0f\x59\x34\xd8\xbd\x34\x28\xd6\x7b\x0b\x0a\x81\x26\x47\x16\x63\x89\xc3\xf2\xc3\xae\xfe\xfd\x62\x48\x29\x96\xd3\x1e\xba\x45\x73\x89\x39\x1f\xef\x3d\xbe\x19\xb1\xa5\x5d\xd5\xe2\x01\x5b\x58\x43\xa9\x4d\x4d\x65\xc1\xa1\x9a\x5c\x27\x02\xc7\x02\x7e\x0b\x25\xcc\x80\x62\xb0\x31\x40\x4b\x3b\x18\x92\x17\x3d\x45\x90\xc2\x40\xf4\x08\x5c\x06\xe4\xe0\xd5\x93\xb9\x2c\x8e\xbe\xb2\xe4\xb8\xff\x8f\xc5\x62\x51\xc8\x06\xe5\xbe\x8a\x56\x89\x80\x1e\xd6\x10\x5c\xc4\x42\xc4\x40\x95\xa2\xa3\x69\x49\xa8\x49\xb2\x16\xad\x47\x80\x19\xe8\x3a\x15\x82\x47\x77\xd0\x12\xe1\xa8\xdb\x16\xc6\x06\xc8\x0d\x20\x8c\x02\xfc\xa6\x43\x51\xbc\x48\x72\xf8\xa5\x00\x00\xd0\x8a\x95\xb3\x6a\xad\x80\x6a\x40\xb5\xc3\x94\x70\x56\x56\x41\x77\x48\x31\xdd\xed\xa6\xe3\x9a\x86\x8e\xd0\x92\xd9\x01\x03\x80\x6f\x28\xb6\x0a\x8e\x42\x07\x70\xe8\x2d\x19\x8f\x50\x3b\xea\x40\x92\x31\x28\x03\x39\xd8\x62\xcd\xa5\x0e\x43\x74\x06\x46\x40\x74\x8e\x5c\x91\x78\x92\x96\x6b\xb5\xcd\x72\xac\x08\x0d\xd3\xf9\x40\x4e\xec\x38\x5e\xa6\xb8\x6c\x51\x98\xca\x07\xbe\xc7\x78\xef\xd9\x28\x40\x9b\x80\xce\x88\x16\x72\x7e\x8b\xb9\x1c\x15\x90\xe1\x98\x4b\x76\x1b\x0a\x53\x46\xd9\x52\x54\x99\x34\xba\x34\xd2\x26\x04\xeb\x57\xf3\xb9\xc2\xc3\xb5\xd3\xbb\x26\xa0\x6c\xae\x35\xcd\x85\xd5\xf3\xc3\x4d\xd6\x31\x83\xd4\x07\xaf\xc7\x00\x42\x4a\xf4\x1e\x02\xed\xd1\x0c\xc9\x4e\x1b\xdd\xb1\x10\x49\xf6\xcd\x9f\x6d\x36\x74\x36\xd4\xfc\xf5\xf4\x2f\x74\xa4\xb0\xf5\xf3\x95\x56\x93\x20\x6d\x5f\x51\x86\x53\x34\x01\xa7\xe9\x4c\x75\x77\x5f\x43\xf8\x32\x74\xe9\x1a\x24\xba\x50\xd5\xba\xcd\xe3\xdd\x63\x5f\x25\x0b\xad\xa3\x83\x56\xa8\xf2\xa0\xd2\x3a\x6c\x31\x6f\x5f\xeb\xc7\xf1\x68\x1a\x75\x6b\x03\xa1\xd1\x1e\xa4\xf0\x08\x9d\xd8\x23\xf8\xe8\x10\x7a\x8a\x2e\xb9\x93\x4d\x3c\xea\xd0\x70\xff\x6a\x3e\x9f\xfa\x96\x23\xef\x5c\x5b\x2d\x97\xcb\xbb\x61\x76\x6f\x12\x87\x4d\xe3\x2b\xa4\xa8\xae\xb5\xe4\x89\xa5\x24\xeb\x4e\xf5\x6f\x97\x98\x96\xef\xb1\x9f\x94\x15\x2f\x1d\xa9\x6d\xf4\xd9\x08\x76\x33\x09\x91\x96\xeb\x5d\x88\xc9\x0c\xe1\xa5\xd6\x20\x5a\x4f\xe0\xa3\xe5\x8f\x0c\xb3\xb1\x42\x29\xc7\xf5\x2d\x49\xd1\x36\xe4\xc3\x6a\xb9\x58\x2c\xca\xc1\xd1\x01\x8d\x51\xc8\x0d\x20\xa1\x41\x87\xa0\xfd\x69\xa4\xa3\x0e\xb2\x32\x8a\x2c\x03\x8d\xb2\xa4\x4d\xfa\x5c\xc8\xca\xeb\x20\xed\x6a\x3e\x3f\x91\x7c\x58\x7e\x58\x94\x43\xa5\x74\xbd\x65\xff\xb9\xf6\x4f\xe1\xb5\xbc\xbd\x7f\xd8\x34\xe2\xf6\xfe\xa1\x4c\x03\x71\xf8\x35\x6a\x87\x8a\x1f\x90\xb1\x1c\x55\xfa\xbe\xd1\x79\x20\xd3\xf6\x57\x67\x9d\xe5\xe4\xf8\xf6\xfb\xe6\x76\xf9\x8f\x17\x37\xf7\xe5\x3b\x03\x46\xc3\x36\x7a\x67\x1e\x8d\x7a\xca\xf8\xcc\x9c\xff\x7e\x96\xff\x99\x0c\x32\x19\xe3\x8c\xff\xa7\x78\xe7\xac\xb9\xb9\xe2\xc1\x33\x39\xff\xbf\xb6\xd8\x95\xff\x93\x35\xad\x46\x20\xe0\xde\xe9\x16\x4d\x39\x78\x5b\xd6\x50\xee\xb1\x3f\x63\xf8\x35\x8e\x3d\xf6\x45\xf1\xe2\x4d\x67\xf3\x9c\x79\x98\xe9\xcd\x5e\x4f\x36\xe8\xe6\x61\x78\x21\x24\x75\x5d\x34\x3a\xf4\xeb\xd2\xc6\x6d\xab\xe5\x84\x3d\xbd\x1f\x63\x1e\x7c\x70\xda\xec\xae\xce\x15\x1d\x6e\x65\xd2\x90\xb0\x58\x91\x26\xb3\x2e\x6f\xcf\x51\x46\xac\x21\xcf\xef\xf6\xe6\xf9\xd3\x67\xb8\x48\x85\xe4\xa0\xbc\x2b\x2f\xcf\x26\x2d\x62\x68\x3e\x3b\x7d\x28\xdf\x21\xa4\x3c\x3f\xfb\xa7\x8d\xbc\x38\x15\x5f\xe5\xc6\x67\x1a\x4f\xcf\x34\x39\x5f\xbe\x97\x7e\x77\x52\xce\x65\x95\x75\x14\x48\x52\x7a\x24\x3e\x7d\xbc\x9f\xee\x57\x3e\xf3\x57\x5a\x6e\xfe\x7e\x9c\x6c\xca\x8f\x31\xe1\x42\xd7\x60\x90\xdf\x5b\xe1\xfa\xcb\x13\xc5\x30\xe8\xef\xdd\x99\xfd\x34\x8e\x75\xfa\x70\x26\xf5\xe3\xd3\xe6\x4c\x6a\x3a\x27\xa9\x8f\xfc\xeb\x17\xa4\x26\x8a\xdf\x20\xd5\xa3\x8c\x4e\x87\xbe\x32\xa2\xc3\xef\xc0\x7e\x8c\x53\xfc\x17\x00\x00\xff\xff\xdb\xd6\xd7\x60\xb7\x08\x00\x00"),
+			compressedContent: []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x02\xff\xc4\x7b\x6d\x6f\x1b\x39\x92\xff\x7b\x7f\x8a\x42\x1b\xf8\x47\xfa\x5f\x5b\x96\x9c\x38\x97\xf1\x45\x73\x97\xc9\x04\x9b\xc1\x6e\x66\x73\xeb\xec\xde\x2e\x02\x43\xa0\xba\xab\x25\x8e\xd9\x64\x87\x64\x4b\xd6\x1a\xfe\xee\x87\x2a\x92\xdd\x2d\xd9\x49\x9c\xd9\x00\x37\x2f\xc6\x6a\x3e\x54\x15\x8b\xc5\x5f\x3d\x90\x51\x66\xb5\x50\xb8\x41\x05\x73\xc8\xa4\xae\x4c\x76\x44\x4d\x95\xb1\xb5\xf0\xd4\xe6\xf1\xc6\x67\x70\x0c\xa6\xf5\x4d\xeb\x41\x99\x15\xc4\xce\xd1\xce\xb4\x50\x08\x0d\xad\x43\xa0\x61\x60\x2c\xfc\xe6\x8c\x1e\x1f\x6d\xdd\xa2\x31\x96\xe6\xff\x30\x9d\x4e\x8f\x8a\x35\x16\xd7\x8b\xb6\x29\x85\x47\x07\x73\xf0\xb6\xc5\x23\xd1\x7a\xb3\x28\xcd\x56\x2b\x23\xca\x41\x67\x25\x94\x43\x80\x63\x90\x15\x0f\x04\x87\x76\x23\x0b\x84\xad\x54\x0a\xd2\x04\x08\x13\x40\xe8\x12\xf0\x46\xfa\xa3\xa3\x8f\x85\xb1\x78\x75\x04\x00\x20\x4b\x92\x9c\xa4\x96\x25\x98\x0a\xb0\x5c\x21\x77\xd8\xa6\x58\x78\x59\xa3\x69\x79\x6d\xb3\x9a\xc6\xac\xcd\x16\x94\xd1\x2b\x20\x02\xe0\xd6\xa6\x55\x25\x6c\x85\xf4\x60\xd1\x35\x46\x3b\x84\xca\x9a\x1a\x0a\xa3\x35\x16\xde\x58\x58\x62\x45\x43\x2d\xfa\xd6\x6a\x48\x04\xd1\x5a\x63\x03\x1b\x8c\x63\x17\x2b\x2b\x0a\x24\x56\x53\xb7\xc7\xca\xe2\xa7\x16\x9d\x77\xe0\x0d\x94\xd2\xc5\xe1\x58\x0e\x98\xb0\x04\xd2\xbb\x9e\x1a\x8c\xa6\x0e\x4e\xa0\x12\x52\x81\xac\x6b\x2c\xa5\xf0\xa8\x76\xe3\x23\x66\xca\xeb\x9f\x94\xcb\xa0\x82\x46\xf8\x35\xf1\x75\xde\x58\xb1\xa2\xf6\x8c\xdb\x0b\x85\x42\x2f\x9c\x27\xdd\x25\x5d\x1f\xa7\x45\x4b\xed\xd1\x6a\xa1\x20\xf4\x2f\x31\x0c\xc7\x12\x8c\xa6\x36\xcb\x5b\xac\x8d\x1f\x72\x2c\x94\x69\xcb\xc0\xb4\xb5\x6c\x46\x6b\xef\x1b\x77\x71\x7a\x5a\xe2\x66\x62\xe5\x6a\xed\xb1\x58\x4f\xa4\x39\x15\x8d\x3c\xdd\xcc\x82\x1c\xc7\xc0\xf3\xe0\xb7\xad\x07\x51\x14\xe8\x48\x15\xd7\xa8\x63\x67\x2d\xb5\xac\x49\x90\xc2\x34\xdd\x9e\x2c\xc3\x26\x1e\x87\xff\xc3\x1f\xde\x7c\x80\xda\x94\xa8\xdc\xe9\x85\x2c\x07\x8d\x66\xf9\x1b\x16\xbe\x6f\x65\xc2\x6c\x11\xfd\xe7\xa2\x92\x0a\x93\x95\xf0\xef\xad\xf4\xeb\x38\xb4\x75\x48\xca\x70\x1e\x05\xdb\x0f\xb7\xe6\x60\xe9\x53\xac\x84\xd4\xb0\x5d\xa3\x06\xe9\x9f\x38\x28\xd6\x42\xaf\x30\x30\x6a\xac\xb9\xd9\x25\xa2\xa4\x85\x91\x1b\x5f\x9c\x9e\x7e\x6c\x1d\xda\x8b\x46\x38\xb7\x35\xb6\xfc\xaf\xab\xb5\x71\xfe\x82\xce\x47\x0e\x6f\x3f\x7c\x78\xbf\x78\xff\x97\x3f\xff\xfd\x1f\x6c\xc9\xf4\x79\x19\xbf\x51\x6f\xa4\x35\xba\x46\xed\x61\x23\xac\x14\x4b\x85\x0e\x96\x3b\x28\xb1\x12\xad\xf2\x61\x3b\xc5\xde\x42\x44\x59\x4a\x2f\x0d\x6d\xe1\xeb\x57\xb0\x6c\x75\xa9\x30\x07\x9c\xac\x26\xf4\x6d\x2a\x68\x94\xd0\x3e\xc8\x19\x74\x31\x38\x0c\xe7\x6c\xa2\xa9\xc5\x54\x60\x34\x82\xf0\x1e\xeb\xc6\x47\xb3\xf6\x56\xf2\x19\x3d\x87\xe3\xee\xcb\x54\xc9\x9a\xc1\x68\xd0\xe8\xb7\xc6\x5e\x87\xc3\x90\xc3\xb3\xe9\x8b\x1c\x9e\x9d\xfd\xc0\xab\x3b\xbf\xb9\x61\xcb\x6a\x1d\x93\x5b\x8a\xe2\xda\x54\xd5\xa2\x96\xbc\x39\x33\x66\x5f\xa2\x12\x3b\x07\x4b\xf4\x5b\x44\x9d\x98\xec\x8f\x17\x37\x34\xfe\xe9\xd4\x65\x43\x3b\xac\x3f\x79\x7f\x15\xad\xc0\x17\xcd\xc5\xe9\x69\x0e\x5e\x91\x1d\xc2\xc8\x39\xc5\xdf\x34\x86\x5a\xc6\x39\x6c\xb9\x87\xc4\xda\x3a\xfe\xd9\x5a\xe5\xc0\xb5\x0d\x6d\x0c\x26\x73\x22\x8b\x26\xc3\x20\x8d\xb8\x62\x8d\x35\xc2\xa8\xdb\xbe\x31\x19\x8a\x23\x26\x20\x2b\x28\xd0\xfa\xb0\x19\x8d\x35\x1b\x59\x46\x1a\xf1\x4c\x78\xf5\xc0\x89\xb8\x78\xf1\xe2\xc5\xd3\x74\x1e\x96\xd6\x5c\xa3\x75\x40\x0b\x26\xeb\x03\x63\x4b\xb4\x60\x74\xc2\x04\x16\x76\x00\x06\x66\x83\xd6\xca\x12\x1d\xf3\x90\x15\x1d\x4c\xa0\xcd\xda\x8d\x23\x49\xde\xf8\x8f\x91\x77\x63\x65\x2d\xec\x2e\xf0\xcc\x93\x44\xa4\xd4\xb6\x09\x8d\xdd\x21\xa6\x2d\xfe\x18\xbe\x12\x90\x0d\x0c\x85\x15\x0f\x00\x70\x8d\xd8\x08\x25\x37\x6c\x7e\xe7\xb1\xb1\x91\x7a\xb5\x87\xb1\x69\xf4\xbd\xbd\xed\x96\x15\x4c\xcc\xe5\xb0\xb2\x66\xeb\x02\xd8\x0e\x8d\xc3\x9b\xe1\xde\x47\x62\xa3\x46\xac\xcd\x40\x1d\xa2\xf2\x68\x13\x4d\x69\x34\x28\xe3\x5c\x00\xad\x48\x72\xe6\xc6\x9f\xb1\xbb\x87\xcc\x6b\x56\x67\x7b\x0a\x48\x52\xc2\x1c\x66\x11\xc9\x6b\xa1\x77\x7c\x5e\x5c\xb7\x79\x4a\x3a\x0f\x32\x6d\x62\x87\x9a\xa3\x29\x9c\x40\xab\xbd\x54\xe0\x5a\x46\xbb\x20\x4a\x38\x0d\x0b\xc6\xdd\x8d\x50\xbd\x4f\x0a\x1d\x44\xc9\x62\xd3\x2e\x95\x74\x6b\x2c\x03\x44\x15\xad\xb5\xa8\x3d\xdb\x32\x8f\x73\x81\xbc\xd1\x6a\xc7\xd6\xc2\x80\xe4\x72\x76\xc5\xc9\x57\x53\x67\xb2\x8a\x67\x30\x7a\xf7\xdf\x1f\x3e\xc0\xd3\xc9\x6c\x32\x1b\x83\xb1\x70\x1e\x7b\x98\xfe\x39\x14\xa6\xae\x83\xad\x45\xf7\x27\x1d\xf4\x42\x78\x13\xbd\x52\xec\xf4\xa6\x91\x05\x8c\x64\x05\x42\xef\xc6\x81\x06\x0d\x28\x8c\xb5\xa8\x04\xef\x45\x29\xbc\x60\xf3\x25\x24\xa4\xf3\xd1\xa0\xf5\x12\x5d\x9e\x0c\xf5\xa6\x91\x16\xcb\x8e\xb3\x74\x6c\xcc\x8e\xd6\xe9\xcd\xc0\x29\x72\xa7\x77\x61\xc2\x8e\xc6\xf5\x7d\x09\x85\x4a\x14\xa5\x92\x1a\x93\xa1\xc4\x55\xd5\xe8\x9c\x58\xa1\x03\x61\x31\x50\xd6\x06\x2a\xe1\x3c\x5a\xf0\x6b\xa1\xe3\x1e\x82\xc5\x02\xc9\xa6\x6b\x71\x23\xeb\xb6\x06\xa1\x94\xd9\xc6\xfd\x6a\xac\xf1\xa6\x30\x6a\xb1\x41\xeb\x68\x61\x73\x78\xc6\x1d\xfd\xe1\x8f\x48\xcc\xbb\x53\x28\x49\x7c\xa8\x53\x56\xb2\x10\x1e\x83\xab\x21\xe7\x1c\x4f\xd0\x6e\x91\x3c\xf5\xe1\xac\x6b\xdc\x1d\x8c\x3e\x00\xfb\x0e\xe1\xc1\x1b\xd8\xa0\x95\xd5\x2e\xad\x61\xc8\x71\xe4\x76\xce\x63\x0d\xaf\x5f\x31\x4c\x0d\x00\x82\x02\x2b\xb4\x0b\x2d\xea\x8e\x26\xff\xfe\x32\x39\x02\x1b\x82\xc0\x03\x62\xb4\xb3\x1d\xa5\x18\x82\x04\x87\x77\xe0\x79\x13\x2b\xde\x02\xe1\xba\x61\x79\x4f\x42\x3a\x0e\xd9\x40\x96\x1d\x93\x30\x5f\x39\x3a\xb5\x03\xed\x67\xb3\xc9\x19\x11\xcb\x66\x93\x29\x81\xda\x6c\x32\x0b\x7f\xce\x32\x30\x96\x7e\x3c\xcd\xba\xa9\x85\x6c\xd6\x68\x03\xb8\xc1\x31\x84\x4f\x70\xad\xf4\xe8\x78\xe5\x2e\x4f\x90\xf9\xe1\x4f\x97\x8b\x37\xaf\x7f\x7e\xfb\x66\xf1\x97\xcb\x57\x8b\xff\xf9\xe5\xc3\xdb\xc5\xab\x37\x97\x8b\xd9\xd9\x8b\xc5\x1f\x5e\xbf\x5b\x5c\xbe\x7d\x75\x76\xfe\x3c\xbb\x82\xd1\xca\x24\x7f\x7c\xa8\x5d\xa9\x1d\x16\xad\xc5\x85\xbb\x96\xcd\x22\x2a\xb4\x0f\xb9\x4a\xa3\x9f\xf8\xcf\xeb\x39\x1a\x6f\x22\x02\x0e\xbd\x97\x7a\x15\xac\xd7\xe2\x6f\x21\x5a\x6c\xb5\x42\xe7\x82\x89\x62\x79\x11\x27\x15\x16\x4b\xd4\x5e\x0a\xe5\x80\x9c\x44\x74\x87\x40\x41\xa5\x63\x3f\xf8\x90\x6c\xf9\x3d\xf5\xbe\x84\xd9\xe4\xac\x1f\x1c\x15\x16\x9c\x31\xb3\x5c\x74\x5d\x71\x5d\x51\x00\x02\xc7\x10\x42\x0e\x91\x23\x89\x97\x89\xd5\xca\xe2\x4a\x78\xcc\xe0\x04\x4a\x53\xb4\x1c\xe3\x04\x70\x0b\xd1\x14\x34\xc2\x8a\x1a\xf9\x68\x9a\x48\x8a\x71\x26\x91\xe0\x7e\x9a\x8e\xa2\x58\x0f\x46\x6f\x84\x6a\x31\x41\x94\xd9\xea\xd0\x95\x30\xca\xa2\x17\x52\x63\x99\x90\x30\x5b\x1a\xbf\xce\x3a\x24\xc6\x05\x85\x93\x30\x1f\x4a\x38\xec\x44\x2f\x06\x1b\x18\xd7\x15\x39\x08\x07\xb7\x19\x73\xcf\x2e\x60\x96\x43\xd6\x6a\xe9\xb3\x0b\xc8\x5e\xb3\xaf\x75\xd4\xfa\x7c\xda\xff\x77\x37\x8c\x2f\x79\x1e\x63\x74\x12\x8c\xb0\x9b\x96\x17\x96\x4e\xa8\x17\x3d\x42\x89\xae\xb0\x72\x89\x25\x88\xa5\xd9\x24\x85\x67\xae\x11\xf6\xba\x51\xed\x8a\x26\x5d\xa6\x0f\xf8\xa9\x47\xbd\x01\xbb\x7b\x44\x47\xe1\xb4\x39\xd0\xa6\xc4\xbc\x87\xd4\x60\x6d\x25\x52\xfa\x15\x11\xb0\x4f\x0c\x59\xc4\xa3\x64\x72\x01\xb8\x5d\xca\x94\xf8\x2b\xaa\x9d\x68\x34\xd6\x90\xd7\xc3\x92\x02\x58\x0a\x10\x93\x1d\x75\x53\x61\xbb\x96\xc5\x1a\xf0\xa6\x40\x2c\x1d\x28\x59\xd3\x16\xae\xd0\xbb\x10\x4b\xc2\x6d\x56\x98\x92\xb4\x7b\xf2\xf4\x6c\xfa\xc3\x79\x0e\x59\x5c\x1b\x69\xf9\x92\xa1\x2c\x8c\x24\x85\x93\xc3\xc9\x2e\xe0\x36\xab\xdd\x8a\xfa\x97\xad\xdb\x65\x77\x77\x07\xe1\xe2\x24\x89\x1d\x62\x9d\x28\x17\xcc\xe1\xc5\xd0\xc3\xa7\x41\x83\x45\xc8\x60\x58\x4a\xa1\xe2\x99\x9f\x5a\x6c\x91\x22\x83\xe9\xf4\xc1\x99\x85\xd0\x21\x9f\xab\x8c\x8d\x6c\x78\x1e\x87\x78\x58\x0e\xad\x2a\xf0\xe8\xa7\xc6\x38\xbc\xdb\x13\xfe\x5a\xee\xf8\x8f\xd4\x20\xac\x95\x14\x39\x30\xa5\x88\x3b\x8b\x4a\x51\x8c\x09\x73\x20\x69\x28\x9e\xf9\x3c\xb5\x7e\x4d\x31\xe5\x94\x7a\x15\xe2\x09\x6d\xc2\x26\x8c\x0f\x83\xec\x49\x67\x6c\x41\x6d\x2b\x6b\xda\x66\x11\x72\x6e\x2b\x8b\x13\x32\xa6\xce\x30\xd8\x04\x1c\x50\xec\xa4\x84\xc7\xb4\xe9\xb7\x34\xe8\x2e\xc6\x37\x4a\x14\xc1\x30\x22\xe8\xe7\x70\xdb\x09\x78\x47\xed\xdd\x17\xa3\x74\x0e\xb7\x7c\xe6\xb8\xab\x3f\xfa\xb2\x3c\x94\x33\xf0\x4e\x71\x6c\xb0\xb2\x81\x8c\xa7\x03\x2e\xa7\xb1\x3f\x23\xd9\xfa\xe6\x3e\xf3\x84\xed\xda\xa8\x14\xec\x70\xc1\x24\xa6\x44\x31\x0a\xfa\x1c\xdd\x34\x60\x00\x24\x7b\x63\xdd\xce\x9d\x72\x6b\xf2\x99\x04\x26\x7b\xc4\x58\x53\xa7\xdc\xe1\x4e\xe3\xca\x53\x44\x9d\x00\x2d\x68\x2e\x9c\x66\xb2\xfa\xf0\x8b\x0c\xdf\x68\x0a\x85\xe8\x48\x90\x5e\x16\xb2\xa4\x46\xfa\x8c\x20\x9f\x3e\xfb\x33\x9f\x5d\xc0\xc7\xdb\x8c\x14\xfd\xd0\xd0\xbb\xab\xbc\xc3\xe0\x68\x3a\x0f\xcc\x08\x2b\xba\x80\xcc\xb6\x5a\x4b\xbd\xa2\xb6\x86\x79\x4f\x73\xc8\x2c\x86\xb0\x3c\x7e\x2a\xe1\xfc\x22\x9c\xdc\x34\x5d\xea\x02\x0f\xd9\xd1\x96\x66\x69\x71\xdc\xdb\x55\x4d\x32\x26\x1a\x3f\x13\x59\x3e\x93\xe5\x63\x78\x74\x2c\x02\xce\x97\xd6\x34\x0d\xcf\xbc\xcd\x94\x29\x84\x8a\x34\x9c\xd4\xd7\x93\x97\xb4\xcc\x1f\x63\xcb\x16\x97\x6b\x63\x0e\x1a\xbd\x2b\x97\xfb\x2d\xa6\x29\x5a\x42\xa3\x69\x04\xa0\x63\x18\xed\x71\x82\xc2\xb4\xda\xbb\x68\x1d\x31\x7e\x87\xd4\xb9\xdc\xc5\xda\x9b\xa3\x30\xd5\x43\x85\x4a\x11\xd0\x4c\xbb\x91\x4b\x5c\x4b\xdd\x39\xb5\x50\x18\x2b\x43\x89\xa2\x3f\x39\xf1\x97\x03\x63\x07\x15\x27\x97\xef\x5b\x4b\x55\xb1\xb9\xf0\xc9\x24\x9d\x71\xd1\x2d\x09\x8d\xf5\x12\xcb\x12\xcb\x14\xae\x30\x38\xcb\xe4\xb9\xb9\x9c\x13\x7b\xc2\x66\xc5\xec\x24\x08\xc2\xdd\x83\xf4\x6c\x6f\xb1\xc3\x6c\xe8\x21\xeb\x8f\x12\x26\x50\xe9\x04\xe9\xf3\x98\xc4\x99\x00\x96\x37\x2d\x86\xd1\xe4\xdc\x28\xa4\x7b\xfb\xee\x97\x71\x4e\x0b\xa7\x32\x0a\x87\x95\xa2\x2c\x2d\x48\x37\x08\x2f\x43\xda\xc5\x0e\x30\x80\xc5\x5e\x12\x14\x91\xcc\x54\xd0\x21\x0c\xbb\xb6\x5a\x92\x59\xa5\xc4\x28\x6e\x2d\x11\x16\x6a\x4b\xe9\x2e\x57\x44\xf3\x43\x3f\xb9\xef\x14\xfd\x1a\xc1\x89\x1a\x61\x2b\x76\x20\xf6\xd1\xbf\xe7\x16\x32\x99\x6e\x6c\x70\x91\xe3\x01\xea\x05\x1d\x04\xc0\xe3\xe5\xc5\x50\x9b\xb2\x52\xd4\x68\xb9\x11\x5d\x0a\x73\xb3\xd9\xd9\xbf\x4f\xa6\x93\xe9\x64\x76\x31\xeb\x0a\x11\xf7\x32\x19\xaf\x5c\x4f\x60\xaf\xce\x41\xea\xa1\x0c\x86\x3f\x1c\xfa\x2e\xa5\xe9\xa6\x0f\x42\x45\xa1\x8d\xde\xd5\xa6\x75\x03\x67\xc7\x3d\xdd\x46\xa5\x3a\x4b\x4a\x03\xbe\x10\x67\x76\x73\x69\x6c\x9f\x42\xf4\x34\xbc\x72\x31\xc5\xd1\xe5\x62\xe0\x9d\xd9\x21\xa6\x90\x28\xb9\x3b\x1a\x44\x7f\xbd\x89\xb2\xe4\xf1\x2f\x48\xb7\x5f\x9d\x95\x55\x28\xfa\x55\xad\x52\xc9\x18\x3f\x0e\x75\x3f\x61\x81\xae\x52\x1d\x2a\x25\x44\xeb\x5a\x26\xc8\x1e\x66\x45\xe9\x77\x6f\xd8\x1b\xb4\x3b\xbf\x26\x61\x64\x17\xd6\x13\x57\xbf\x46\x1b\x23\x34\x10\x85\x02\xdb\x2a\x74\x39\x18\x6a\xdf\x4a\x87\x9c\x2e\xa7\xf1\xd1\x52\x43\xec\xa6\x25\x96\x0f\x4a\x2a\x0a\xd5\xc9\x49\x52\x27\x39\xe1\x18\xb2\xff\x4f\x61\x24\x45\x30\xd4\x31\xf4\xe4\x7b\x87\xf3\x38\xeb\x9a\x2b\xa9\x3c\xda\x1c\xfe\x8d\x8d\x82\x2a\x09\xaa\x2c\x84\x2d\xef\x57\xd4\x62\xb1\x97\xe8\xa0\x28\xb7\x56\x7a\x64\x96\xf4\x95\xc1\xc8\xb5\xcb\x10\xe0\x8e\x09\x5f\x43\xef\x28\x86\xda\x5c\xab\x18\x4c\xbb\x07\x07\x7f\x7e\xff\x1a\xfe\xfa\x2a\xe6\xb5\x30\x5a\x4a\x2d\xec\xae\x4b\xda\x73\x60\x23\x92\x7e\x07\x8d\x51\xb2\xd8\xc1\xaf\x46\x87\xb0\xfb\x00\x1a\x50\x97\x8d\x91\x61\xff\x87\xf0\xc0\xd5\x66\x20\x11\x39\xa5\x76\xbc\x58\x0e\x7f\x82\xb6\x2b\xa3\x4a\xb4\x2e\xef\xa3\x92\xd0\xde\x97\x6f\x47\xda\xcd\x67\xff\xe1\xe6\x2f\x79\x04\xc8\xf2\xc7\x58\x31\x09\xa8\xc1\x89\x40\x57\x15\xe1\x55\x82\x37\x3d\x39\x28\x84\x52\x0e\xa4\x77\xb1\x33\x02\xc5\x00\x03\xd8\xd9\x84\x7d\xed\x96\x11\x4f\x72\x6b\x55\xbc\xb3\x08\x68\x15\x0f\x5e\x42\x03\xd3\x14\x93\x90\x29\xce\x7e\x38\x9b\xcc\x9e\xbf\x20\x5c\x9d\x5e\x3c\x7b\xf1\x6c\x9a\x3d\x06\x52\x12\x37\xda\x6e\x30\x9a\xcc\x31\xdc\x28\x54\xa2\xb8\x5f\xb9\xfe\x1a\x2a\x38\x74\x14\x74\xfc\x2b\xb0\x30\xea\x71\xa1\xab\xf9\x08\x07\x8d\x12\x52\x87\x0b\xab\xa0\xfa\x07\xac\x22\xa0\x6a\x2d\x6e\x16\x9d\x1c\x84\x1f\x70\x0c\xc3\xd0\xf8\x00\x02\x58\xf5\x9f\x41\x00\x57\x88\x52\x3c\x0e\x03\x3a\xe7\x66\xca\x65\xeb\xe0\xc3\xeb\xf7\xe0\x94\xd8\x20\xfb\xb6\xf7\x7f\x7a\x1d\xcc\xee\xed\xbb\x5f\xdc\xd7\x1d\x1a\x1d\x96\xb4\x7a\xbb\xc1\x32\xe4\x67\xc1\xd8\x46\xda\x78\xa8\x05\x07\x19\x16\x57\xd2\x75\xf6\x3a\x1d\xe7\xc1\xbe\x1c\x1b\xdc\xc0\xfe\xee\x5b\xdd\x31\x8c\x68\x48\x4f\xc0\x54\x83\xf1\x83\xf8\xd9\x4a\xef\x51\xa7\xd4\x25\x16\xeb\x86\xde\xab\xe6\xf5\x2e\x78\xad\x8f\xf7\x61\x17\xe7\xd3\xb3\xa0\x57\xca\xb8\x43\x1a\x42\xfb\x44\x5f\x69\xd1\xcb\x5d\xd0\x60\x0e\xd3\x84\x6b\x5a\xfa\x94\xf3\x95\x8b\x50\x69\x9f\x43\xb6\x94\x2b\xe2\x15\xbe\x4d\x05\x75\xab\xbc\xec\xd6\x06\x7e\xd7\xa0\xbb\x80\xa5\x5c\xc1\x68\x2d\x57\x6b\x9e\x0d\x95\xb4\xce\x33\x36\x29\xe9\xbd\xc2\x03\xab\x18\x2e\x6b\xd2\xa9\xa9\x33\x90\x2e\xe2\xa7\x14\x29\x19\x88\xa7\x4d\x65\x40\x36\x8a\x5c\x53\xc6\xa1\x83\x54\xbc\xe1\x85\x45\x8f\x39\xc4\x2e\xe2\x2b\x75\xd3\xfa\x38\x35\xaa\x87\xb4\x90\x88\xed\x1a\xa6\x55\x29\x23\xfc\x53\x2e\x97\x2d\x8d\x51\x30\x22\x8a\x6c\x4b\x89\xe8\x98\x8a\x3d\x7e\xf6\x3c\x87\x36\xfe\x95\xda\x3f\x3d\x0b\x9f\x4f\xb9\x14\xe4\x9f\x3f\x0b\x9f\xf4\x37\x52\x04\x63\xc3\xcf\xe7\xcf\x92\x49\xf4\x87\xbd\x1b\x44\xd6\xab\xdb\x7a\xc9\x00\x29\x75\x6a\x22\x84\x58\xb1\xe1\xe9\x32\xb2\xe5\x76\x12\x11\x85\x76\x29\xac\xdd\xdf\xa8\xa0\x90\x43\xed\x0e\xc6\x0c\xd0\xa6\x57\x4c\xba\x1b\x4b\xd5\xfa\x50\x72\x58\xa1\xef\x83\xaa\xfd\x18\x5c\xb8\xc8\x85\xc3\x2f\x36\xb8\x70\x83\x16\x28\x24\xd9\xba\xe1\x16\x61\xd9\x56\x15\xe7\xf4\x52\xf3\x5c\x28\x97\xc4\x47\x61\x9c\x03\xd2\x41\xab\x2d\xd5\xad\x68\x93\x93\xad\x30\x1b\xca\x30\xdc\x84\x39\x5c\x0d\x2e\xa0\xc8\x38\x18\x97\x39\xb0\xe5\xeb\x27\x8e\xd7\xd8\x52\xfb\xfb\x1a\x56\x1b\x5d\x0e\x53\xcd\x2f\x49\xc6\x10\xbf\xe8\x2f\xc4\xb3\x97\x31\xc9\xfe\xf1\xe4\x25\xb1\x83\x90\xa8\x1c\xa2\xf3\x71\x07\xb7\xf9\xa0\x40\x1b\xef\x41\x63\x1d\x3a\xef\x43\xc1\xbc\xab\x64\xe7\xc3\xaa\xf2\xbd\x92\x62\xf2\x6c\x83\x6a\xec\xc3\xc5\x48\xb6\x86\x03\x90\x27\xed\x76\xfb\x24\x5c\x52\x30\x6f\xce\x67\x63\x94\x98\x40\x1c\xe4\xcd\x9f\x0c\xe3\xf9\x61\x16\xbd\x5f\xc5\xec\x8a\x70\xe1\x3e\x39\x38\x8b\x4a\xa2\x2a\x13\xf8\xdc\xc6\x3a\xe4\x45\x3c\xbd\x94\x2b\x3f\xbe\x04\x98\x43\x46\xc2\x85\x1c\x34\xf1\xac\x94\xf0\xc4\xf3\x36\x50\xbc\x80\x59\xd7\xa5\x5a\x41\x3d\x14\x1e\x35\x1e\x2c\x3a\x3a\x5d\xa3\x58\xe0\x64\xc0\x58\x0b\xd7\x6b\x28\x48\x0a\x22\x64\x20\x39\x38\x6f\x63\x5c\xd9\xdf\xe5\x90\x16\xbb\x70\x83\x83\xc9\x18\x82\xb0\xb2\x51\x53\xc5\x8d\x43\x85\x40\x42\x4b\x05\xb4\x49\x2e\xc5\xd0\xe9\x00\x1c\x56\x05\x63\x6b\x90\x20\x96\xdb\xe3\x97\xa9\xf6\x2e\xa6\x82\xfc\x79\x60\x9b\x33\x2e\xe7\xc0\x31\x49\xb9\x22\x3c\x22\xdf\x72\xcf\x36\xa3\x0a\x38\x86\xa4\x70\x26\x80\xe8\x84\xff\x0f\x93\x09\x3c\x99\x3f\xa1\x3f\xde\x84\x35\x07\x1e\x13\x66\x31\xee\xae\x5b\xf9\x9c\x2e\x9c\xfc\x67\x4a\x0d\xf6\x3b\x62\x30\x30\x87\x8c\x12\xf1\x13\x8a\xec\x9c\xe7\x1b\xea\xfe\x33\x0f\x1f\x5c\xd8\xf2\xc0\x49\xb6\x50\xe8\x0a\x64\x00\x64\x63\x1c\x27\xf8\x89\xcf\x01\xe8\xe6\xca\x58\xdf\xa3\x4f\x63\x9c\x87\xa5\xf0\xc5\x3a\xdc\xa5\x3f\x02\x89\xbe\x09\x75\xc2\x71\x3c\x40\x9d\xb4\xe5\xcc\x97\xfa\x52\xb1\xc1\x68\x78\x46\x96\xf9\x6c\xf6\x94\x8f\xe0\xb3\xb3\xb3\xae\x48\x1c\xec\x83\x8b\x28\xe9\x1a\x82\xaf\x39\xc7\x7b\x18\x16\x6b\x22\x0f\xc3\x58\x7a\x19\x82\x37\xa2\x6e\x14\x52\xfd\xf5\x54\xd2\x22\x7c\xda\x96\x1a\xfd\xda\x30\x5a\xbd\xff\xf3\xe5\x87\xac\x3b\xd7\x0f\x5c\x1c\x65\xaf\x5a\xbf\x36\x56\xfe\x93\xef\x18\x2f\xe0\x27\x14\x16\x2d\xbc\xe4\xc1\x3f\x66\x07\x38\x96\x66\x2f\x85\x93\x05\x88\xe1\xd4\x07\xa2\xb2\x34\xfb\x11\x57\x6e\x51\xc1\x8f\xbb\x72\x3b\xfe\xe2\xb5\x50\x1c\xf2\x95\xe0\xf6\xde\xf5\x0e\x69\x35\x3d\x66\x78\x88\x7c\x52\xe2\x03\x57\xf8\xd1\x04\x06\xc7\x20\x55\x8c\xa3\x71\x49\x3d\x0c\xd7\xd2\xc1\x56\xad\x5b\xef\xdd\x5a\x9f\xef\x3f\x6f\xd2\xc6\x73\x8e\x1c\xa8\x73\xa2\xed\xa0\x36\xb6\xb3\xe7\x8e\xf9\xb7\x3d\x01\x39\xfe\xdc\x2d\xfd\x31\xac\x0c\x87\xf4\xa7\xa9\xd2\xdc\x01\xcd\xd2\x94\xbb\x3c\xdc\x40\x4b\x07\xb7\x6f\xca\x15\xe6\xf0\x0b\xa5\x6f\x54\xb6\x7c\x1f\xe0\xe7\x6f\x01\x7e\xfe\xca\xf0\xf3\xe1\xf2\xee\xaa\x2b\x0a\x06\xb0\x6a\x75\xa8\x5a\x05\x48\x74\x09\xae\xd8\x0b\xc8\x90\x0a\x5a\xa4\x2a\xe8\xbf\xe2\x10\xee\xd2\x69\xe9\xd6\x30\x87\x27\xb7\xc9\x49\xdc\xde\xb2\x28\x13\x5a\xc0\xdd\x5d\x0e\x19\xf3\x1d\x74\xf0\x9a\xee\xee\xee\x9e\x7c\x16\xe1\xbe\x3b\xc4\xf1\x6a\xbf\x74\xfe\x27\x6b\x14\x25\x85\xbb\x71\xcc\xdf\x4f\x5e\x35\xf2\xe4\x8f\xb8\x0b\x87\x6c\x60\x99\x27\x0e\x69\x9b\x79\xa3\x96\xc2\x51\xae\xfc\x8b\xae\x54\x7b\xf3\xf3\x4f\x39\xfc\x4d\x16\xde\x58\x29\xde\x91\x2d\x14\x6e\xfc\xf5\xc8\x4d\x6a\xa0\x4a\x66\x97\xfc\x0f\x5f\xc4\x58\x59\x2c\x48\xa9\x79\x57\x1d\x9d\x87\x30\x32\xa7\xd6\x79\x17\x21\xe5\x9c\xef\xcf\x5f\xf2\x1f\x6e\xa0\x0d\x9c\xbf\xe6\xfd\x99\x9f\xcd\x26\xe7\xfb\xfb\x17\xfe\x4b\x21\x30\xfb\x3b\x76\xb7\x83\x2b\x8a\x7c\x10\xef\xda\x3e\x29\x12\x2e\x84\xc9\x79\x7a\xbb\x16\xe2\x1f\x6b\xc5\xae\xf3\xe0\xd1\x81\x27\x6d\xd3\xea\xbe\x86\xfd\x49\x97\xdf\x01\xfd\x4d\xc5\x30\x13\x13\xc0\x47\xfa\x02\x2e\x85\xef\xf9\x81\xe4\x05\x03\x99\xae\x64\xc0\xa1\xd5\xa7\x16\xed\x8e\x23\xda\x92\xe0\x6c\xf0\x4a\x8e\x76\x2d\x12\xc8\x22\xd8\xf5\xa1\xf0\x8b\xe9\x8b\xe7\xa7\x4c\xef\x3f\xcb\xe5\x9c\x0f\x4b\x6f\x3a\x30\xbb\x6f\x3c\x5f\xa6\xc4\x8f\x14\xcf\x22\x41\x63\x57\x73\x96\xff\xff\x2d\xdb\xe2\x1a\xfd\x3d\xf2\x67\xe3\x7d\x07\xd7\x96\xf7\x48\xfe\xf0\x4d\x4e\xec\x03\x0f\xfa\xae\x3e\xec\x77\xba\x93\xfb\x5e\x63\xf0\x94\xab\x46\xe1\x5a\x8b\x7c\x71\x1f\xc2\xed\x45\xb8\xf6\x0b\xdd\xc1\x8a\x17\x5e\xac\xba\xf0\x2f\x34\x41\x61\x74\x25\x57\x5d\x70\xca\x85\x0e\xe1\x80\x46\x76\x8f\x2f\x9c\xf4\x98\x5d\x7d\xc6\x3f\x25\x07\x15\xec\x3f\xba\x27\xde\xad\xef\xed\x9c\xda\xb2\x59\x34\x62\xc7\xaf\x8d\xe7\x70\x3e\x3b\x8b\x9c\xdb\xb2\xe1\x93\xb5\xb2\xa2\x06\x12\xec\xfb\x3b\xb3\xff\x1b\xe8\xee\x8f\xeb\x84\xf6\xe3\x2a\x5e\x88\xc8\x82\xb7\x67\x80\x3b\x2c\x6c\x87\xde\x0e\x0b\x8b\xde\x81\xd8\x08\xa9\x38\x0f\xa9\xfa\xfb\x26\x63\xb9\xf2\xb7\x42\x7f\x12\xc6\x1d\x84\x12\x84\x49\xfd\x58\xbe\x28\xe7\x67\xb6\xfc\x9a\x2d\x3d\xe2\x88\x1c\xf6\x84\x8d\x6d\xb1\x00\x70\x75\xef\x8c\xf5\x2f\x13\x3a\x39\xf8\xd6\x11\xbb\x6b\x9d\xf8\xc5\xf7\xcb\x16\x61\x34\x7c\x21\x81\xa4\x1e\xdf\xbd\x3d\x77\xe3\x43\x6a\xe1\xf2\xab\x73\x3e\x9d\x59\xc7\x6b\x91\xf4\x00\x3e\x86\xed\x7b\x92\xf7\x12\x1d\x08\x3f\x7c\x09\xd6\x33\x4a\x55\x6c\xea\x4c\x25\xed\x70\xe3\xb6\x77\x2b\x0e\x1a\x85\x0d\x2b\xe9\xf3\xa5\x24\xb6\xb0\xab\xc1\x9b\xce\x63\x40\xbd\x49\xe7\x72\x50\x16\x79\xf0\xc5\x71\x77\x2a\xff\xf8\xe6\x1f\xf3\x10\xcc\x5c\x1d\x1d\x7d\x1c\x4a\x9e\x5e\xcd\xf8\xa2\x21\xd1\xad\x6f\x83\xfb\x72\x85\x94\x20\x94\x33\x07\x97\x00\xa9\xac\x37\x84\xc9\xe9\x34\x8b\x6f\xfe\x23\x35\xa2\x62\x6c\x24\xd2\x5d\x7f\xf4\xf5\xc4\xee\x55\x5c\xff\x6a\x63\x06\x7b\xff\x0d\x1e\x62\x74\xcf\xed\x1f\x7c\xc2\x01\xa3\xe1\x73\x7c\x87\x56\x0a\x15\xec\x3c\x5e\xe1\xf5\xb3\xfa\xc7\x17\xe3\xa3\xa3\x8f\x9f\xa9\xb5\xf7\x85\xf4\x7e\x85\x7d\x15\x1d\x75\x61\x77\x8d\x8f\xef\xd7\x7e\x22\x28\x3f\x3b\x7f\x7e\xb9\x16\xf4\xa2\x2c\xd6\x23\x3e\xb5\xfc\x1c\x92\xce\x51\x1c\x8e\x65\x4c\x34\x1c\x1f\x8d\x7c\x6f\x66\x36\xf8\xec\x7e\xcf\xce\x5e\xfc\xc5\x89\xd9\x79\x76\xa0\xfd\xb4\x5b\x97\x72\xa5\x5f\xe9\xf2\x4d\xa0\x9f\x0d\xd4\xf6\x38\xfe\x54\x26\xcf\xf2\x40\x27\xcb\xef\xd3\xdb\xe7\x1a\x26\x2f\x0a\xb4\xac\x22\xfa\x3b\x69\xb0\xce\xbe\x91\x2b\x9f\x02\x6f\x80\xe6\xde\x7b\x2e\x17\x79\x5c\x87\xe8\xf2\x1a\x77\x7b\x1c\x7e\x1f\x8f\x6b\xdc\x7d\xd9\xca\xbe\xd5\xd8\x8e\x8e\x3e\x3a\x5d\x37\xc1\x6a\xc8\x34\x18\x28\xe6\x83\xc3\x30\x7b\x3e\xcb\xba\x37\x2b\x14\x71\xee\xe6\x19\x97\x6c\x8a\x6c\x9f\x63\xd7\x1f\x43\xc3\x7c\x7f\x7d\x9b\xb3\xa2\x7f\x53\x16\x0b\x70\xf3\xec\x6c\x9f\x4a\xa2\x15\xfb\xc1\x54\x70\xf9\xeb\xbb\xf7\x30\xe2\x81\xc6\x42\xf6\x34\x1b\xef\xd9\x0d\x85\x1d\xef\xad\xdc\x64\x07\x14\xb8\xdf\x54\x43\xfb\x1e\xf5\x83\xf3\x30\xf1\x57\x93\xbe\x7e\x35\x83\xef\xf1\xa1\xe8\x4f\x7b\xc9\x69\xd8\x22\x85\xf1\x24\xc0\xbb\x9f\xcf\x87\xd6\x1a\xbe\x09\x70\xb2\xcb\xb7\xaf\x06\x76\xf7\x30\x4d\x7e\xa9\xac\x91\x36\x46\xd8\xdd\xb8\x67\x11\xcd\x26\x7b\x40\x39\x8f\xa5\xd3\x58\xb9\xd9\x13\xf5\xe7\x37\x97\x7b\xa2\xf2\x37\x8b\xfa\xea\xcd\xe5\xef\x12\x95\x59\x7c\x07\x51\xd3\xa5\xd7\xe0\xf5\xef\x57\xe9\x3c\xe2\x20\x7c\x03\xe6\xb2\xe7\x0f\xd4\xa0\x75\x18\x1c\xbd\xae\x9b\x58\xb3\x26\x7c\x5d\x2a\xbc\x7a\x90\xe9\xef\x84\x76\xa3\xd3\x6b\x46\xde\x04\x57\x08\xed\xbe\x8c\xf1\xd1\x3a\xcc\xa2\xbb\x97\x4e\x0e\x9a\x51\x42\xea\x18\xd7\x4e\x42\x00\x30\x59\xa6\x7f\x48\xc4\xff\x10\xc0\x54\xb0\x54\x78\xd2\xcf\x0d\xaf\xb8\xd8\xcb\x74\x6d\xe9\x1f\x09\x1c\xfd\xef\x00\x30\x8e\x08\xbb\x8b\x37\x00\x00"),
 		},
 		"/min-config.toml": &vfsgen۰CompressedFileInfo{
 			name:             "min-config.toml",
-			modTime:          time.Date(2020, 3, 23, 10, 28, 5, 111560978, time.UTC),
+			modTime:          time.Date(2021, 3, 14, 2, 40, 23, 0, time.UTC),
 			uncompressedSize: 277,
 
-			compressedContent: []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x54\x8e\x41\x6e\x83\x30\x10\x45\xf7\x9c\xe2\x0b\xf6\xed\xbe\x52\x97\x55\x2f\xd0\x5d\x15\x21\x33\x1e\x82\xc1\x66\x08\x1e\x14\x71\xfb\x88\x81\x28\x64\xe7\xf9\xef\xc9\x7a\xff\x24\x33\x5f\x0a\x00\x08\x1e\xdf\x28\x4b\x54\xdb\x4b\x5a\xb0\xbf\x72\x61\xc4\xa4\x0f\x8a\xb2\xf8\x5d\xad\x60\x07\xfa\xbb\xc2\x11\x71\xce\x50\x19\x78\x3c\x60\x0a\x63\x48\x2e\x22\x93\x4c\x8c\xdc\xc9\x12\x3d\x1a\xde\xe9\xe1\xfc\xfe\xfc\x21\x89\xe7\x98\x3f\xbf\x82\x3f\x8d\xd2\xf4\x4c\xfa\x5a\xed\x63\x2b\x3b\xc7\xa4\x9b\xea\xde\x42\x3c\x6b\xdd\x86\xc8\xcf\xfa\x0d\xd9\x1a\xda\x40\x4e\x19\x06\x27\xa7\x9d\xf9\x03\xaf\xf5\x76\xbc\xe9\x03\xaf\x27\xed\x11\x00\x00\xff\xff\x82\x50\x5c\x86\x15\x01\x00\x00"),
+			compressedContent: []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x02\xff\x54\x8e\xc1\x6e\x83\x30\x10\x44\xef\x7c\xc5\x08\xee\xed\xbd\x52\x8f\x55\x7f\xa0\xb7\xaa\x42\x66\xbd\x14\x83\xcd\x12\xbc\x28\xe2\xef\x23\xd6\x89\x42\x2e\x96\x67\xde\xd3\x6a\x7e\x49\x56\xfe\xab\x00\x20\x78\x7c\xa2\xae\xd1\x1c\x3f\xe9\xc1\xfe\x9f\x2b\x23\x26\xbd\x51\x94\xcd\x17\xb5\x81\x05\x8c\x57\x85\x23\xe2\x9c\xa1\x32\xf1\x7c\x87\x29\xcc\x21\xb9\x88\x4c\xb2\x30\xf2\x20\x5b\xf4\xe8\xb8\xd0\xf2\xe2\xfb\xeb\x07\x49\x3c\xc7\xfc\xfe\x11\xfc\xa9\x94\x6e\x64\xd2\x67\x6b\x87\x6d\xd9\x79\x4c\xba\xa8\x96\x2d\xc4\xab\xb6\x7d\x88\xfc\x58\x7f\x20\x6b\x43\x1f\xc8\x29\xc3\xe0\xe2\x74\x30\x7f\xe2\xbd\x3d\xc2\x8b\x3e\xf1\x7e\xd2\x6e\x03\x00\x82\x50\x5c\x86\x15\x01\x00\x00"),
 		},
 	}
 	fs["/"].(*vfsgen۰DirInfo).entries = []os.FileInfo{
@@ -28,5 +28,6 @@ func Setup(version ...string) {
 	config.Init(version)
 
 	viper.Set("ble.ws_path", "/ble")
-	viper.SetDefault("ble.use_plugin", false)
+	viper.SetDefault("ble.workers", 1)
+	viper.SetDefault("ble.auto_subscribe", "") // path of subscriptions list in object.config.ble
 }
@@ -20,7 +20,6 @@ import (
 	"context"
 	"os"
 
-	log "github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
 
 	"github.com/Rightech/ric-edge/internal/app/ble/handler"
@@ -30,40 +29,50 @@ import (
 )
 
 func Start(done <-chan os.Signal) error {
-	usePlugin := viper.GetBool("ble.use_plugin")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var svc *handler.Service
 
-	var (
-		hand jsonrpc.Caller
-		err  error
-	)
+	hand := common.Plugin(ctx, "ble")
+	if hand == nil {
+		var err error
 
-	if !usePlugin {
-		hand, err = handler.New()
+		svc, err = handler.New()
 		if err != nil {
 			return err
 		}
-	} else {
-		hand, err = common.LoadPlugin("ble")
-		if err != nil {
-			log.WithError(err).Error("plugin open error. fallback to default")
-			hand, err = handler.New()
-			if err != nil {
-				return err
-			}
-		} else {
-			log.Debug("use plugin")
-		}
+
+		hand = jsonrpc.WithContext(svc)
 	}
 
+	mw, err := common.Middleware("ble")
+	if err != nil {
+		return err
+	}
+
+	notifications, closeNotifications, err := common.Notifications("ble")
+	if err != nil {
+		return err
+	}
+	defer closeNotifications()
+
 	cli, err := ws.New(viper.GetInt("ws_port"), viper.GetString("version"),
 		viper.GetString("ble.ws_path"))
 	if err != nil {
 		return err
 	}
 
-	ctx, cancel := context.WithCancel(context.Background())
+	go jsonrpc.ServeWithReconnect(ctx, cli, hand,
+		jsonrpc.CatchPanic(viper.GetBool("catch_panic")),
+		jsonrpc.Use(mw...),
+		notifications,
+		jsonrpc.Workers(viper.GetInt("ble.workers")),
+		jsonrpc.SerializeBy(handler.SerializationKey))
 
-	go jsonrpc.ServeWithReconnect(ctx, cli, hand, jsonrpc.CatchPanic(viper.GetBool("catch_panic")))
+	if path := viper.GetString("ble.auto_subscribe"); svc != nil && path != "" {
+		go svc.AutoSubscribe(ctx, path)
+	}
 
 	<-done
 	cancel()
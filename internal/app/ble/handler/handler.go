@@ -20,10 +20,12 @@ import (
 	"context"
 	"encoding/base64"
 	"errors"
+	"sync"
 	"time"
 	"unsafe"
 
 	jsoniter "github.com/json-iterator/go"
+	log "github.com/sirupsen/logrus"
 	"github.com/stretchr/objx"
 
 	"github.com/Rightech/ric-edge/pkg/jsonrpc"
@@ -36,6 +38,8 @@ func init() { // nolint: gochecknoinits
 	jsoniter.RegisterTypeEncoder("ble.UUID", bleUUIDDecoder{})
 }
 
+const defaultDialTimeout = 15 * time.Second
+
 type Service struct {
 	dev ble.Device
 	rpc jsonrpc.RPC
@@ -44,35 +48,174 @@ type Service struct {
 	// so when subscriptions starts we remember client and use it in next calls
 	// when subscription dies client removes from map
 	conns map[string]ble.Client
+	mx    *sync.RWMutex
+	// closed when rpc injected
+	ready  chan struct{}
+	router *jsonrpc.Router
+}
+
+// service is returned as pointer because rpc injected later (see InjectRPC)
+// and methods registered in router should see it
+func newService(dev ble.Device) *Service {
+	s := &Service{
+		dev: dev, conns: make(map[string]ble.Client), mx: new(sync.RWMutex),
+		ready: make(chan struct{}),
+	}
+
+	s.router = jsonrpc.NewRouter().
+		Handle("ble-scan", s.scan).
+		Handle("ble-discover", s.discover).
+		Handle("ble-read", s.read).
+		Handle("ble-write", s.write).
+		Handle("ble-subscribe", s.subscribe).
+		Handle("ble-subscribe-cancel", s.subscribeCancel)
+
+	return s
+}
+
+// SerializationKey used to process requests to one device one by one
+// (all scans also processed one by one)
+func SerializationKey(req jsonrpc.Request) string {
+	if req.Method == "ble-scan" {
+		return "scan"
+	}
+
+	return req.Params.Get("device").Str()
+}
+
+// dial connects to device
+// ctx deadline (sent by core) limits connection time
+// if there is no deadline default timeout used
+func (s Service) dial(ctx context.Context, address string) (ble.Client, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+
+		ctx, cancel = context.WithTimeout(ctx, defaultDialTimeout)
+		defer cancel()
+	}
+
+	return s.dev.Dial(ctx, ble.NewAddr(address))
+}
+
+func (s Service) getConn(address string) (ble.Client, bool) {
+	s.mx.RLock()
+	defer s.mx.RUnlock()
+
+	cli, ok := s.conns[address]
+
+	return cli, ok
+}
+
+func (s Service) setConn(address string, cli ble.Client) {
+	s.mx.Lock()
+	s.conns[address] = cli
+	s.mx.Unlock()
+}
+
+func (s Service) deleteConn(address string) {
+	s.mx.Lock()
+	delete(s.conns, address)
+	s.mx.Unlock()
 }
 
 func (s *Service) InjectRPC(rpc jsonrpc.RPC) {
 	// this method required for lazy initialization of rpc client
 	// this client needs to send notifications (see subscribe)
 	s.rpc = rpc
+	close(s.ready)
+}
+
+// AutoSubscribe loads subscriptions list from ble section of object config (by path)
+// and subscribes to all of them
+// each item of list is the same as ble-subscribe params
+// (device, service_uuid, characteristic_uuid, _parent etc.)
+func (s *Service) AutoSubscribe(ctx context.Context, path string) {
+	select {
+	case <-s.ready:
+	case <-ctx.Done():
+		return
+	}
+
+	var list []map[string]interface{}
+
+	for {
+		err := s.rpc.Call(ctx, "get-object-config", map[string]interface{}{"path": path}, &list)
+		if err == nil {
+			break
+		}
+
+		if !errors.Is(err, jsonrpc.ErrNotConnected) {
+			log.WithError(err).WithField("path", path).Error("auto subscribe: load list")
+			return
+		}
+
+		select {
+		case <-time.After(time.Second):
+		case <-ctx.Done():
+			return
+		}
+	}
+
+	for _, params := range list {
+		_, err := s.autoSubscribe(ctx, params)
+		if err != nil {
+			log.WithError(err).WithField("params", params).Error("auto subscribe")
+			continue
+		}
+
+		log.WithField("device", params["device"]).Info("auto subscribed")
+	}
 }
 
-func (s Service) Call(req jsonrpc.Request) (res interface{}, err error) {
-	switch req.Method {
-	case "ble-scan":
-		res, err = s.scan(req.Params)
-	case "ble-discover":
-		res, err = s.discover(req.Params)
-	case "ble-read":
-		res, err = s.read(req.Params)
-	case "ble-write":
-		res, err = s.write(req.Params)
-	case "ble-subscribe":
-		res, err = s.subscribe(req.Params)
-	case "ble-subscribe-cancel":
-		res, err = s.subscribeCancel(req.Params)
-	default:
-		err = jsonrpc.ErrMethodNotFound.AddData("method", req.Method)
+func (s *Service) CallContext(ctx context.Context, req jsonrpc.Request) (interface{}, error) {
+	return s.router.CallContext(ctx, req)
+}
+
+type scanParams struct {
+	Timeout string `json:"timeout" rpc:"default=5s"`
+}
+
+type deviceParams struct {
+	Device string `json:"device" rpc:"required"`
+}
+
+type charParams struct {
+	deviceParams
+	ServiceUUID        string `json:"service_uuid" rpc:"required"`
+	CharacteristicUUID string `json:"characteristic_uuid" rpc:"required"`
+}
+
+// uuids parses service and characteristic uuids
+func (p charParams) uuids() (srv ble.UUID, ch ble.UUID, err error) {
+	srv, err = ble.Parse(p.ServiceUUID)
+	if err != nil {
+		err = jsonrpc.ErrInvalidParams.AddData("p", "service_uuid").
+			AddData("msg", err.Error())
+		return
+	}
+
+	ch, err = ble.Parse(p.CharacteristicUUID)
+	if err != nil {
+		err = jsonrpc.ErrInvalidParams.AddData("p", "characteristic_uuid").
+			AddData("msg", err.Error())
+		return
 	}
 
 	return
 }
 
+type writeParams struct {
+	charParams
+	// binary value should be sent as jsonrpc.Binary
+	// any string is written as is
+	Value interface{} `json:"value" rpc:"required"`
+}
+
+type subscribeParams struct {
+	charParams
+	Indicator bool `json:"indicator"`
+}
+
 type dev struct {
 	Addr        string  `json:"addr"`
 	RSSI        int     `json:"rssi"`
@@ -82,14 +225,13 @@ type dev struct {
 	Beacon      *beacon `json:"beacon,omitempty"`
 }
 
-func (s Service) scan(params objx.Map) (interface{}, error) {
-	timeout, err := time.ParseDuration(params.Get("timeout").Str("5s"))
-
+func (s *Service) scan(parent context.Context, p *scanParams) (interface{}, error) {
+	timeout, err := time.ParseDuration(p.Timeout)
 	if err != nil {
-		return nil, jsonrpc.ErrInvalidParams.AddData("msg", err.Error())
+		return nil, jsonrpc.ErrInvalidParams.AddData("p", "timeout").AddData("msg", err.Error())
 	}
 
-	ctx := ble.WithSigHandler(context.WithTimeout(context.Background(), timeout))
+	ctx := ble.WithSigHandler(context.WithTimeout(parent, timeout))
 
 	devices := make(map[string]*dev)
 
@@ -132,6 +274,11 @@ func (s Service) scan(params objx.Map) (interface{}, error) {
 		return nil, err
 	}
 
+	// scan timeout is ok but request deadline or cancel is not
+	if err = parent.Err(); err != nil {
+		return nil, err
+	}
+
 	return mapToList(devices), nil
 }
 
@@ -145,20 +292,12 @@ func mapToList(mp map[string]*dev) []dev {
 	return lst
 }
 
-func (s Service) discover(params objx.Map) (interface{}, error) {
-	address := params.Get("device").Str()
-	if address == "" {
-		return nil, jsonrpc.ErrInvalidParams.AddData("msg", "empty device")
-	}
-
-	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
-	defer cancel()
-
+func (s *Service) discover(ctx context.Context, p *deviceParams) (interface{}, error) {
 	var err error
 
-	cli, ok := s.conns[address]
+	cli, ok := s.getConn(p.Device)
 	if !ok {
-		cli, err = s.dev.Dial(ctx, ble.NewAddr(address))
+		cli, err = s.dial(ctx, p.Device)
 		if err != nil {
 			return nil, err
 		}
@@ -173,42 +312,15 @@ func (s Service) discover(params objx.Map) (interface{}, error) {
 	return cli.DiscoverProfile(true)
 }
 
-func parseRequest(params objx.Map) (a string, s ble.UUID, c ble.UUID, err error) {
-	a = params.Get("device").Str()
-	if a == "" {
-		err = jsonrpc.ErrInvalidParams.AddData("msg", "empty device")
-		return
-	}
-
-	s, err = ble.Parse(params.Get("service_uuid").Str())
-	if err != nil {
-		err = jsonrpc.ErrInvalidParams.AddData("p", "service_uuid").
-			AddData("msg", err.Error())
-		return
-	}
-
-	c, err = ble.Parse(params.Get("characteristic_uuid").Str())
-	if err != nil {
-		err = jsonrpc.ErrInvalidParams.AddData("p", "characteristic_uuid").
-			AddData("msg", err.Error())
-		return
-	}
-
-	return
-}
-
-func (s Service) read(params objx.Map) (interface{}, error) {
-	address, srvUUID, chUUID, err := parseRequest(params)
+func (s *Service) read(ctx context.Context, p *charParams) (interface{}, error) {
+	srvUUID, chUUID, err := p.uuids()
 	if err != nil {
 		return nil, err
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
-	defer cancel()
-
-	cli, ok := s.conns[address]
+	cli, ok := s.getConn(p.Device)
 	if !ok {
-		cli, err = s.dev.Dial(ctx, ble.NewAddr(address))
+		cli, err = s.dial(ctx, p.Device)
 		if err != nil {
 			return nil, err
 		}
@@ -230,21 +342,23 @@ func (s Service) read(params objx.Map) (interface{}, error) {
 		return nil, err
 	}
 
-	return cli.ReadCharacteristic(ch[0])
+	data, err := cli.ReadCharacteristic(ch[0])
+	if err != nil {
+		return nil, err
+	}
+
+	return jsonrpc.Binary(data), nil
 }
 
-func (s Service) write(params objx.Map) (interface{}, error) {
-	address, srvUUID, chUUID, err := parseRequest(params)
+func (s *Service) write(ctx context.Context, p *writeParams) (interface{}, error) {
+	srvUUID, chUUID, err := p.uuids()
 	if err != nil {
 		return nil, err
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
-	defer cancel()
-
-	cli, ok := s.conns[address]
+	cli, ok := s.getConn(p.Device)
 	if !ok {
-		cli, err = s.dev.Dial(ctx, ble.NewAddr(address))
+		cli, err = s.dial(ctx, p.Device)
 		if err != nil {
 			return nil, err
 		}
@@ -266,11 +380,19 @@ func (s Service) write(params objx.Map) (interface{}, error) {
 		return nil, err
 	}
 
-	vaL := params.Get("value").Str()
+	// base64 string (as cloud sends it) is decoded, other strings are written as is
+	value, isBinary := jsonrpc.ParseBinary(p.Value)
+	if !isBinary {
+		str, ok := p.Value.(string)
+		if !ok {
+			return nil, jsonrpc.ErrInvalidParams.AddData("p", "value").
+				AddData("msg", "value should be string or binary")
+		}
 
-	value, err := base64.StdEncoding.DecodeString(vaL)
-	if err != nil {
-		value = []byte(vaL)
+		value, err = base64.StdEncoding.DecodeString(str)
+		if err != nil {
+			value = []byte(str)
+		}
 	}
 
 	err = cli.WriteCharacteristic(ch[0], value, false)
@@ -281,18 +403,28 @@ func (s Service) write(params objx.Map) (interface{}, error) {
 	return true, nil
 }
 
-func (s Service) subscribe(params objx.Map) (interface{}, error) {
-	address, srvUUID, chUUID, err := parseRequest(params)
+func (s *Service) subscribe(ctx context.Context, p *subscribeParams) (interface{}, error) {
+	req, _ := jsonrpc.RequestFromContext(ctx)
+
+	return s.doSubscribe(ctx, p, req.Params)
+}
+
+// autoSubscribe subscribes with params loaded from object config
+func (s *Service) autoSubscribe(ctx context.Context, params objx.Map) (interface{}, error) {
+	return s.router.CallContext(ctx, jsonrpc.Request{Method: "ble-subscribe", Params: params})
+}
+
+// doSubscribe subscribes to characteristic
+// params are raw request params (sent back to core with each notification)
+func (s *Service) doSubscribe(ctx context.Context, p *subscribeParams, params objx.Map) (interface{}, error) {
+	srvUUID, chUUID, err := p.uuids()
 	if err != nil {
 		return nil, err
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
-	defer cancel()
-
-	cli, ok := s.conns[address]
+	cli, ok := s.getConn(p.Device)
 	if !ok {
-		cli, err = s.dev.Dial(ctx, ble.NewAddr(address))
+		cli, err = s.dial(ctx, p.Device)
 		if err != nil {
 			return nil, err
 		}
@@ -315,24 +447,22 @@ func (s Service) subscribe(params objx.Map) (interface{}, error) {
 
 	nfSrv := s.rpc.NewNotification(params)
 
-	err = cli.Subscribe(ch[0], params.Get("indicator").Bool(), func(req []byte) {
-		nfSrv.Send(req)
+	err = cli.Subscribe(ch[0], p.Indicator, func(req []byte) {
+		nfSrv.Send(jsonrpc.Binary(req))
 	})
 	if err != nil {
 		return nil, err
 	}
 
 	if !ok {
-		s.conns[address] = cli
+		s.setConn(p.Device, cli)
 	}
 
 	return nfSrv, nil
 }
 
-func (s Service) subscribeCancel(params objx.Map) (interface{}, error) {
-	address := params.Get("device").Str()
-
-	cli, ok := s.conns[address]
+func (s *Service) subscribeCancel(_ context.Context, p *deviceParams) (interface{}, error) {
+	cli, ok := s.getConn(p.Device)
 	if !ok {
 		return nil, jsonrpc.ErrInvalidRequest.AddData("msg", "sub not found")
 	}
@@ -347,7 +477,7 @@ func (s Service) subscribeCancel(params objx.Map) (interface{}, error) {
 		return nil, err
 	}
 
-	delete(s.conns, address)
+	s.deleteConn(p.Device)
 
 	return true, nil
 }
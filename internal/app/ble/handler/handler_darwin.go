@@ -17,15 +17,14 @@
 package handler
 
 import (
-	"github.com/Rightech/ric-edge/third_party/go-ble/ble"
 	"github.com/Rightech/ric-edge/third_party/go-ble/ble/darwin"
 )
 
-func New() (Service, error) {
+func New() (*Service, error) {
 	dev, err := darwin.NewDevice()
 	if err != nil {
-		return Service{}, err
+		return nil, err
 	}
 
-	return Service{dev: dev, conns: make(map[string]ble.Client)}, nil
+	return newService(dev), nil
 }
@@ -1,47 +0,0 @@
-/**
- * Copyright 2019-2020 Rightech IoT. All Rights Reserved.
- *
- * Licensed under the Apache License, Version 2.0 (the "License");
- * you may not use this file except in compliance with the License.
- * You may obtain a copy of the License at
- *
- *      http://www.apache.org/licenses/LICENSE-2.0
- *
- * Unless required by applicable law or agreed to in writing, software
- * distributed under the License is distributed on an "AS IS" BASIS,
- * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
- * See the License for the specific language governing permissions and
- * limitations under the License.
- */
-
-package common
-
-import (
-	"fmt"
-	"os"
-	"path"
-	"plugin"
-
-	"github.com/Rightech/ric-edge/pkg/jsonrpc"
-)
-
-func LoadPlugin(name string) (jsonrpc.Caller, error) {
-	dir, err := os.Getwd()
-	if err != nil {
-		panic(err)
-	}
-
-	p, err := plugin.Open(path.Join(dir, "plugins", name, fmt.Sprintf("%s.so", name)))
-	if err != nil {
-		return nil, err
-	}
-
-	getFn, err := p.Lookup("GetCaller")
-	if err != nil {
-		panic(err)
-	}
-
-	cl := getFn.(func() jsonrpc.Caller)()
-
-	return cl, nil
-}
@@ -0,0 +1,70 @@
+/**
+ * Copyright 2021 Rightech IoT. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package common
+
+import (
+	"io/ioutil"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+
+	"github.com/Rightech/ric-edge/pkg/jsonrpc"
+)
+
+// Middleware builds middleware chain of connector from config
+//
+//	<name>.log_requests - log every request
+//	<name>.metrics      - collect requests metrics (available by rpc-metrics method)
+//	<name>.rate_limit   - max requests per second by method
+//	<name>.schema       - path to json file with params schema by method
+func Middleware(name string) ([]jsonrpc.Middleware, error) {
+	var mw []jsonrpc.Middleware
+
+	if viper.GetBool(name + ".log_requests") {
+		mw = append(mw, jsonrpc.Logging(log.WithField("connector", name)))
+	}
+
+	if viper.GetBool(name + ".metrics") {
+		mw = append(mw, jsonrpc.NewMetrics().Middleware())
+	}
+
+	limits := viper.GetStringMap(name + ".rate_limit")
+	if len(limits) != 0 {
+		rates := make(map[string]float64, len(limits))
+		for method := range limits {
+			rates[method] = viper.GetFloat64(name + ".rate_limit." + method)
+		}
+
+		mw = append(mw, jsonrpc.RateLimit(rates))
+	}
+
+	if path := viper.GetString(name + ".schema"); path != "" {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		schemas, err := jsonrpc.ParseSchemas(data)
+		if err != nil {
+			return nil, err
+		}
+
+		mw = append(mw, jsonrpc.Validate(schemas))
+	}
+
+	return mw, nil
+}
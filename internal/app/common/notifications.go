@@ -0,0 +1,68 @@
+/**
+ * Copyright 2021 Rightech IoT. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package common
+
+import (
+	"time"
+
+	"github.com/spf13/viper"
+	"go.etcd.io/bbolt"
+
+	"github.com/Rightech/ric-edge/pkg/jsonrpc"
+	"github.com/Rightech/ric-edge/pkg/store/queue"
+)
+
+const defaultNotificationsSize = 1000
+
+// Notifications builds buffer of notifications from config
+//
+//	<name>.notifications.size   - max buffered notifications
+//	<name>.notifications.policy - what to do if buffer is full (drop-oldest, drop-latest or coalesce)
+//	<name>.notifications.path   - path to bbolt file (buffer kept in memory if empty)
+//
+// returned func closes buffer file
+func Notifications(name string) (jsonrpc.Option, func(), error) {
+	key := name + ".notifications."
+
+	size := viper.GetInt(key + "size")
+	if size <= 0 {
+		size = defaultNotificationsSize
+	}
+
+	policy, err := queue.ParsePolicy(viper.GetString(key + "policy"))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	path := viper.GetString(key + "path")
+	if path == "" {
+		return jsonrpc.Notifications(queue.NewMemory(size, policy)), func() {}, nil
+	}
+
+	db, err := bbolt.Open(path, 0600, &bbolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	q, err := queue.NewBolt(db, "notifications", size, policy)
+	if err != nil {
+		db.Close()
+		return nil, nil, err
+	}
+
+	return jsonrpc.Notifications(q), func() { db.Close() }, nil
+}
@@ -0,0 +1,254 @@
+/**
+ * Copyright 2021 Rightech IoT. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package common
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"os/exec"
+	"sync"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+
+	"github.com/Rightech/ric-edge/pkg/backoff"
+	"github.com/Rightech/ric-edge/pkg/jsonrpc"
+)
+
+const (
+	pluginMinRestart = time.Second
+	pluginMaxRestart = time.Minute
+	// process which works longer than this is considered healthy
+	// so next restart starts backoff from the beginning
+	pluginHealthyTime = time.Minute
+	// how many requests from plugin (to core) processed in parallel
+	pluginWorkers = 4
+)
+
+var errPluginNotRunning = jsonrpc.ErrServer.AddData("msg", "plugin not running").SetCode(-32096)
+
+// Plugin returns caller which forwards requests to plugin process if <name>.plugin set
+// otherwise it returns nil (connector should use built-in handler)
+//
+//	<name>.plugin      - path to plugin executable
+//	<name>.plugin_args - plugin arguments
+//
+// plugin is any executable which speaks jsonrpc over stdin/stdout (one message per line),
+// see jsonrpc.ServeStdio. it receives the same requests as connector,
+// can send notifications and requests to core (e.g. get-secret)
+// plugin is restarted (with backoff) when it exits and stopped when ctx done
+func Plugin(ctx context.Context, name string) jsonrpc.Caller {
+	path := viper.GetString(name + ".plugin")
+	if path == "" {
+		return nil
+	}
+
+	p := &plugin{
+		path: path,
+		args: viper.GetStringSlice(name + ".plugin_args"),
+		log:  log.WithFields(log.Fields{"connector": name, "plugin": path}),
+		nfs:  make(map[string]jsonrpc.NotificationService),
+	}
+
+	go p.supervise(ctx)
+
+	return jsonrpc.WithContext(p)
+}
+
+type plugin struct {
+	path string
+	args []string
+	log  *log.Entry
+
+	// rpc to core
+	rpc jsonrpc.RPC
+
+	mx sync.RWMutex
+	// rpc to plugin process (nil if process not running)
+	srv *jsonrpc.Service
+	// plugin notification id to notification sent to core
+	nfs map[string]jsonrpc.NotificationService
+}
+
+func (p *plugin) InjectRPC(rpc jsonrpc.RPC) {
+	p.rpc = rpc
+}
+
+func (p *plugin) supervise(ctx context.Context) {
+	b := backoff.New(pluginMinRestart, pluginMaxRestart)
+
+	for ctx.Err() == nil {
+		started := time.Now()
+
+		err := p.run(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+
+		if time.Since(started) > pluginHealthyTime {
+			b.Reset()
+		}
+
+		delay := b.Next()
+		p.log.WithError(err).WithField("restart_in", delay.String()).Error("plugin exited")
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+	}
+}
+
+// run starts plugin process and serves it until exit
+func (p *plugin) run(ctx context.Context) error {
+	cmd := exec.CommandContext(ctx, p.path, p.args...)
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return err
+	}
+
+	err = cmd.Start()
+	if err != nil {
+		return err
+	}
+
+	p.log.WithField("pid", cmd.Process.Pid).Info("plugin started")
+
+	go p.logStderr(stderr)
+
+	srv := jsonrpc.New(jsonrpc.NewStreamTransport(stdout, stdin), jsonrpc.WithContext(pluginCaller{p}),
+		jsonrpc.Workers(pluginWorkers))
+
+	p.mx.Lock()
+	p.srv = &srv
+	p.mx.Unlock()
+
+	err = srv.Serve(ctx)
+
+	p.mx.Lock()
+	p.srv = nil
+	// subscriptions die with process
+	p.nfs = make(map[string]jsonrpc.NotificationService)
+	p.mx.Unlock()
+
+	if !errors.Is(err, io.EOF) {
+		// plugin doesn't read or writes garbage so it should be restarted
+		cmd.Process.Kill() // nolint: errcheck
+	}
+
+	stdin.Close()
+
+	if werr := cmd.Wait(); werr != nil || errors.Is(err, io.EOF) {
+		// exit status is more useful than EOF
+		return werr
+	}
+
+	return err
+}
+
+func (p *plugin) logStderr(r io.Reader) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		p.log.Info(scanner.Text())
+	}
+}
+
+// CallContext forwards request to plugin process
+func (p *plugin) CallContext(ctx context.Context, req jsonrpc.Request) (interface{}, error) {
+	p.mx.RLock()
+	srv := p.srv
+	p.mx.RUnlock()
+
+	if srv == nil {
+		return nil, errPluginNotRunning
+	}
+
+	var res jsoniter.RawMessage
+
+	err := srv.Call(ctx, req.Method, req.Params, &res)
+	if errors.Is(err, jsonrpc.ErrNotConnected) {
+		return nil, errPluginNotRunning
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	// plugin started notifications (subscription)
+	// they are forwarded to core as notifications of this connector
+	if jsoniter.ConfigFastest.Get(res, "notification").ToBool() {
+		nf := p.rpc.NewNotification(req.Params)
+
+		p.mx.Lock()
+		p.nfs[jsoniter.ConfigFastest.Get(res, "process_id").ToString()] = nf
+		p.mx.Unlock()
+
+		return nf, nil
+	}
+
+	return res, nil
+}
+
+// pluginCaller handles messages sent by plugin process
+type pluginCaller struct {
+	p *plugin
+}
+
+func (c pluginCaller) CallContext(ctx context.Context, req jsonrpc.Request) (interface{}, error) {
+	if req.Method == "notification" {
+		id := req.Params.Get("__process_id").Str()
+
+		c.p.mx.RLock()
+		nf, ok := c.p.nfs[id]
+		c.p.mx.RUnlock()
+
+		if !ok {
+			c.p.log.WithField("process_id", id).Warn("notification of unknown process")
+			return false, nil
+		}
+
+		nf.Send(req.Params.Get("value").Data())
+
+		return true, nil
+	}
+
+	// any other request forwarded to core
+	var res jsoniter.RawMessage
+
+	err := c.p.rpc.Call(ctx, req.Method, req.Params, &res)
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
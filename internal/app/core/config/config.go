@@ -28,12 +28,67 @@ func Setup(version ...string) {
 	config.Init(version)
 
 	viper.SetDefault("core.rpc_timeout", "1m")
+	viper.SetDefault("core.reconnect_grace", "0s")
 	viper.SetDefault("core.db.path", "storage.db")
 	viper.SetDefault("core.db.clean_state", false)
 
 	viper.SetDefault("core.mqtt.url", "tls://sandbox.rightech.io:8883")
+	viper.SetDefault("core.mqtt.urls", []string{}) // failover list, overrides url
+	viper.SetDefault("core.mqtt.connect_timeout", "30s")
+	viper.SetDefault("core.mqtt.keepalive", "5s")
+	viper.SetDefault("core.mqtt.ping_timeout", "10s")
+	viper.SetDefault("core.mqtt.backoff_min", "1s")
+	viper.SetDefault("core.mqtt.backoff_max", "1m")
+	viper.SetDefault("core.mqtt.connect_attempts", 1)
+	viper.SetDefault("core.mqtt.status_interval", "1m")
+	viper.SetDefault("core.mqtt.protocol_version", 4) // 4 (3.1.1) or 5
+	viper.SetDefault("core.mqtt.commands.workers", 8)
+	viper.SetDefault("core.mqtt.commands.queue", 100)
+	viper.SetDefault("core.mqtt.commands.ordered", false)
+	viper.SetDefault("core.mqtt.commands.in_flight", 0)
 	viper.SetDefault("core.mqtt.cert_file", "")
 	viper.SetDefault("core.mqtt.key_path", "")
+	viper.SetDefault("core.mqtt.ca_file", "")
+	viper.SetDefault("core.mqtt.server_name", "")
+	viper.SetDefault("core.mqtt.username", "")
+	viper.SetDefault("core.mqtt.password", "")
+	viper.SetDefault("core.mqtt.token", "")
+	viper.SetDefault("core.mqtt.tls_min_version", "1.2")
+	viper.SetDefault("core.mqtt.tls_ciphers", []string{})
+	viper.SetDefault("core.mqtt.insecure_skip_verify", false)
+	viper.SetDefault("core.mqtt.allow_insecure", false)
+
+	// {edge}, {connector} and {param} are replaced in topics
+	viper.SetDefault("core.mqtt.topics.command", "ric-edge/{connector}/command")
+	viper.SetDefault("core.mqtt.topics.response", "ric-edge/{connector}/response")
+	viper.SetDefault("core.mqtt.topics.state", "ric-edge/sys/state")
+	viper.SetDefault("core.mqtt.topics.param", "ric-edge/{edge}/params/{param}")
+	viper.SetDefault("core.mqtt.topics.status", "ric-edge/{edge}/status")
+	viper.SetDefault("core.mqtt.state_mode", "aggregate") // aggregate, param or both
+	viper.SetDefault("core.mqtt.state_meta", false)
+	viper.SetDefault("core.mqtt.format", "json") // json or sparkplug
+	viper.SetDefault("core.mqtt.sparkplug.group_id", "ric-edge")
+	viper.SetDefault("core.broker.addr", "") // embedded broker, disabled if empty
+	viper.SetDefault("core.broker.cert_file", "")
+	viper.SetDefault("core.broker.key_file", "")
+	viper.SetDefault("core.broker.allow_anonymous", false)
+	viper.SetDefault("core.broker.allow_insecure", false)
+	viper.SetDefault("core.broker.send_queue", 1000)
+	viper.SetDefault("core.opcua.endpoint", "") // embedded opcua server, disabled if empty
+	viper.SetDefault("core.opcua.addr", "")
+	viper.SetDefault("core.opcua.allow_anonymous", false)
+	viper.SetDefault("core.opcua.allow_insecure", false)
+	viper.SetDefault("core.opcua.max_sessions", 10)
+	viper.SetDefault("core.modbus_slave.addr", "") // embedded modbus tcp slave, disabled if empty
+	viper.SetDefault("core.modbus_slave.unit_id", 0)
+	viper.SetDefault("core.modbus_slave.word_order", "big")
 
 	viper.SetDefault("core.cloud.url", "https://sandbox.rightech.io/api/v1")
+	viper.SetDefault("core.cloud.token_file", "")
+	viper.SetDefault("core.cloud.proxy", "")
+	viper.SetDefault("core.cloud.ca_file", "")
+	viper.SetDefault("core.cloud.timeout", "15s")
+	viper.SetDefault("core.cloud.retries", 5)
+	viper.SetDefault("core.cloud.backoff_min", "1s")
+	viper.SetDefault("core.cloud.backoff_max", "30s")
 }
@@ -17,18 +17,30 @@
 package entrypoint
 
 import (
+	"errors"
+	"fmt"
 	"os"
+	"path/filepath"
+	"sort"
 	"time"
 
 	"github.com/spf13/viper"
 	"go.etcd.io/bbolt"
 
 	"github.com/Rightech/ric-edge/internal/app/core/rpc"
+	"github.com/Rightech/ric-edge/internal/pkg/core/broker"
 	"github.com/Rightech/ric-edge/internal/pkg/core/cloud"
 	"github.com/Rightech/ric-edge/internal/pkg/core/jobs"
 	"github.com/Rightech/ric-edge/internal/pkg/core/mqtt"
+	"github.com/Rightech/ric-edge/internal/pkg/core/opcua"
+	"github.com/Rightech/ric-edge/internal/pkg/core/slave"
+	"github.com/Rightech/ric-edge/internal/pkg/core/supervisor"
+	"github.com/Rightech/ric-edge/internal/pkg/core/tsdb"
+	"github.com/Rightech/ric-edge/internal/pkg/core/webhook"
 	"github.com/Rightech/ric-edge/internal/pkg/core/ws"
 	"github.com/Rightech/ric-edge/pkg/lua"
+	"github.com/Rightech/ric-edge/pkg/store/queue"
+	"github.com/Rightech/ric-edge/pkg/store/state"
 )
 
 func Start(done <-chan os.Signal) error { // nolint: funlen
@@ -41,11 +53,18 @@ func Start(done <-chan os.Signal) error { // nolint: funlen
 	}
 	defer db.Close()
 
-	api, err := cloud.New(
-		viper.GetString("core.cloud.url"),
-		viper.GetString("core.cloud.token"),
-		viper.GetString("version"),
-	)
+	api, err := cloud.New(cloud.Config{
+		URL:        viper.GetString("core.cloud.url"),
+		Token:      viper.GetString("core.cloud.token"),
+		TokenFile:  viper.GetString("core.cloud.token_file"),
+		Version:    viper.GetString("version"),
+		Proxy:      viper.GetString("core.cloud.proxy"),
+		CAFile:     viper.GetString("core.cloud.ca_file"),
+		Timeout:    viper.GetDuration("core.cloud.timeout"),
+		Retries:    viper.GetInt("core.cloud.retries"),
+		BackoffMin: viper.GetDuration("core.cloud.backoff_min"),
+		BackoffMax: viper.GetDuration("core.cloud.backoff_max"),
+	})
 	if err != nil {
 		return err
 	}
@@ -55,14 +74,17 @@ func Start(done <-chan os.Signal) error { // nolint: funlen
 	requestsCh := make(chan []byte)
 
 	sock, err := ws.New(viper.GetInt("ws_port"),
-		viper.GetString("version"), requestsCh)
+		viper.GetString("version"), viper.GetDuration("core.reconnect_grace"), requestsCh)
 	if err != nil {
 		return err
 	}
 
 	errCh := sock.Start()
 
-	stateCh := make(chan []byte)
+	procs := supervisor.New(connectors(), viper.ConfigFileUsed(), viper.GetInt("ws_port"))
+	defer procs.Close()
+
+	stateCh := make(chan state.Change)
 
 	luaMachine := lua.New()
 
@@ -74,22 +96,211 @@ func Start(done <-chan os.Signal) error { // nolint: funlen
 		viper.GetString("core.id"),
 		viper.GetDuration("core.rpc_timeout"),
 		luaMachine, db, viper.GetBool("core.db.clean_state"),
-		sock, api, jobs.New(), stateCh, requestsCh)
+		sock, api, jobs.New(), stateCh, requestsCh,
+		viper.GetStringMap("core.secrets"))
+	if err != nil {
+		return err
+	}
+
+	// now core ready to process requests from connectors
+	sock.SetHandler(rpcCli)
+
+	sinkConfigs, err := sinks(db)
+	if err != nil {
+		return err
+	}
+
+	hookConfigs, err := webhooks(db)
+	if err != nil {
+		return err
+	}
+
+	brokerConfig, err := localBroker()
+	if err != nil {
+		return err
+	}
+
+	tsdbConfigs, err := tsdbs(db, rpcCli)
+	if err != nil {
+		return err
+	}
+
+	uaConfig, err := opcuaServer()
 	if err != nil {
 		return err
 	}
 
-	mqttCli, err := mqtt.New(
-		viper.GetString("core.mqtt.url"),
-		rpcCli.GetEdgeID(),
-		viper.GetString("core.mqtt.cert_file"),
-		viper.GetString("core.mqtt.key_path"),
-		db, rpcCli, stateCh,
-	)
+	slaveConfig, err := modbusSlave()
 	if err != nil {
 		return err
 	}
 
+	// state changes are sent to main broker, local broker, each sink, webhook and tsdb
+	// and to opcua server. Only main broker may hold connectors back, others drop
+	// oldest changes when they fall behind
+	mqttCh := make(chan state.Change)
+	outs := []state.Output{{Name: "mqtt", Ch: mqttCh}}
+
+	var localCh chan state.Change
+	if brokerConfig.Addr != "" {
+		localCh = make(chan state.Change, 1)
+		outs = append(outs, state.Output{Name: "local", Ch: localCh, Lossy: true})
+	}
+	sinkChs := make(map[string]chan state.Change, len(sinkConfigs))
+
+	for _, c := range sinkConfigs {
+		ch := make(chan state.Change, 1)
+		sinkChs[c.Name] = ch
+		outs = append(outs, state.Output{Name: "sink." + c.Name, Ch: ch, Lossy: true})
+	}
+
+	hookChs := make(map[string]chan state.Change, len(hookConfigs))
+
+	for _, c := range hookConfigs {
+		ch := make(chan state.Change, 1)
+		hookChs[c.Name] = ch
+		outs = append(outs, state.Output{Name: "webhook." + c.Name, Ch: ch, Lossy: true})
+	}
+
+	tsdbChs := make(map[string]chan state.Change, len(tsdbConfigs))
+
+	for _, c := range tsdbConfigs {
+		ch := make(chan state.Change, 1)
+		tsdbChs[c.Name] = ch
+		outs = append(outs, state.Output{Name: "tsdb." + c.Name, Ch: ch, Lossy: true})
+	}
+
+	var uaCh chan state.Change
+	if uaConfig.Endpoint != "" {
+		uaCh = make(chan state.Change, 1)
+		outs = append(outs, state.Output{Name: "opcua", Ch: uaCh, Lossy: true})
+	}
+
+	fanout := state.NewFanout(outs...)
+
+	go fanout.Run(stateCh)
+
+	mqttConfig := mqtt.Config{
+		URLs:     brokers("core.mqtt"),
+		ClientID: rpcCli.GetEdgeID(),
+		Security: security("core.mqtt"),
+		Topics: mqtt.Topics{
+			Command:  viper.GetString("core.mqtt.topics.command"),
+			Response: viper.GetString("core.mqtt.topics.response"),
+			State:    viper.GetString("core.mqtt.topics.state"),
+			Param:    viper.GetString("core.mqtt.topics.param"),
+			Status:   viper.GetString("core.mqtt.topics.status"),
+		},
+		StateMode:  mqtt.StateMode(viper.GetString("core.mqtt.state_mode")),
+		StateMeta:  viper.GetBool("core.mqtt.state_meta"),
+		Version:    viper.GetString("version"),
+		Connectors: sock.Connectors,
+		Processes:  procs.Status,
+		Dropped:    fanout.Dropped,
+
+		ConnectTimeout:  viper.GetDuration("core.mqtt.connect_timeout"),
+		KeepAlive:       viper.GetDuration("core.mqtt.keepalive"),
+		PingTimeout:     viper.GetDuration("core.mqtt.ping_timeout"),
+		BackoffMin:      viper.GetDuration("core.mqtt.backoff_min"),
+		BackoffMax:      viper.GetDuration("core.mqtt.backoff_max"),
+		ConnectAttempts: viper.GetInt("core.mqtt.connect_attempts"),
+		StatusInterval:  viper.GetDuration("core.mqtt.status_interval"),
+
+		ProtocolVersion: viper.GetUint("core.mqtt.protocol_version"),
+		Commands: mqtt.Commands{
+			Workers:  viper.GetInt("core.mqtt.commands.workers"),
+			Queue:    viper.GetInt("core.mqtt.commands.queue"),
+			Ordered:  viper.GetBool("core.mqtt.commands.ordered"),
+			InFlight: viper.GetInt("core.mqtt.commands.in_flight"),
+		},
+
+		Format: mqtt.Format(viper.GetString("core.mqtt.format")),
+		Sparkplug: mqtt.Sparkplug{
+			GroupID: viper.GetString("core.mqtt.sparkplug.group_id"),
+			Params:  rpcCli.Params(),
+		},
+	}
+
+	var local *mqtt.Local
+
+	// local broker is started first so local clients work while cloud broker is unreachable
+	if localCh != nil {
+		b, err := broker.New(brokerConfig)
+		if err != nil {
+			return err
+		}
+
+		defer b.Close()
+
+		local, err = mqtt.NewLocal(b, mqttConfig, rpcCli, localCh)
+		if err != nil {
+			return err
+		}
+
+		defer local.Close()
+
+		// cloud broker connection state is visible to local clients
+		mqttConfig.OnConnState = local.PublishStatus
+	}
+
+	mqttCli, err := mqtt.New(mqttConfig, db, rpcCli, mqttCh)
+	if err != nil {
+		return err
+	}
+
+	for _, c := range sinkConfigs {
+		sink, err := mqtt.NewSink(c, rpcCli.GetEdgeID(), sinkChs[c.Name])
+		if err != nil {
+			return err
+		}
+
+		defer sink.Close()
+	}
+
+	for _, c := range hookConfigs {
+		hook, err := webhook.New(c, rpcCli.GetEdgeID(), hookChs[c.Name])
+		if err != nil {
+			return err
+		}
+
+		defer hook.Close()
+	}
+
+	for _, c := range tsdbConfigs {
+		exp, err := tsdb.New(c, tsdbChs[c.Name])
+		if err != nil {
+			return err
+		}
+
+		defer exp.Close()
+	}
+
+	if uaCh != nil {
+		srv, err := opcua.New(uaConfig, rpcCli.GetEdgeID(), rpcCli.Model(), rpcCli, uaCh)
+		if err != nil {
+			return err
+		}
+
+		defer srv.Close()
+	}
+
+	if slaveConfig.Addr != "" {
+		sl, err := slave.New(slaveConfig, rpcCli.Params(), rpcCli)
+		if err != nil {
+			return err
+		}
+
+		defer sl.Close()
+	}
+
+	sock.OnChange(func() {
+		mqttCli.PublishStatus()
+
+		if local != nil {
+			local.RefreshStatus()
+		}
+	})
+
 	defer func() {
 		mqttCli.Close()
 		sock.Close()
@@ -102,3 +313,354 @@ func Start(done <-chan os.Signal) error { // nolint: funlen
 		return nil
 	}
 }
+
+// brokers returns mqtt brokers urls in failover order
+// (<key>.urls or single <key>.url)
+func brokers(key string) []string {
+	if urls := viper.GetStringSlice(key + ".urls"); len(urls) > 0 {
+		return urls
+	}
+
+	if url := viper.GetString(key + ".url"); url != "" {
+		return []string{url}
+	}
+
+	return nil
+}
+
+// security returns mqtt connection security options of config table
+func security(key string) mqtt.Security {
+	return mqtt.Security{
+		CertFile:           viper.GetString(key + ".cert_file"),
+		KeyPath:            viper.GetString(key + ".key_path"),
+		CAFile:             viper.GetString(key + ".ca_file"),
+		ServerName:         viper.GetString(key + ".server_name"),
+		Username:           viper.GetString(key + ".username"),
+		Password:           viper.GetString(key + ".password"),
+		Token:              viper.GetString(key + ".token"),
+		MinVersion:         viper.GetString(key + ".tls_min_version"),
+		Ciphers:            viper.GetStringSlice(key + ".tls_ciphers"),
+		InsecureSkipVerify: viper.GetBool(key + ".insecure_skip_verify"),
+		AllowInsecure:      viper.GetBool(key + ".allow_insecure"),
+	}
+}
+
+// localBroker returns embedded broker config (core.broker table)
+// broker is disabled if addr is empty
+func localBroker() (broker.Config, error) {
+	c := broker.Config{
+		Addr:           viper.GetString("core.broker.addr"),
+		CertFile:       viper.GetString("core.broker.cert_file"),
+		KeyFile:        viper.GetString("core.broker.key_file"),
+		AllowAnonymous: viper.GetBool("core.broker.allow_anonymous"),
+		AllowInsecure:  viper.GetBool("core.broker.allow_insecure"),
+		SendQueue:      viper.GetInt("core.broker.send_queue"),
+	}
+
+	var err error
+
+	c.Users, err = users("core.broker.users")
+	if err != nil {
+		return c, err
+	}
+
+	// [[core.broker.acl]] tables with user, topic and access
+	err = viper.UnmarshalKey("core.broker.acl", &c.ACL)
+	if err != nil {
+		return c, fmt.Errorf("core.broker.acl: %w", err)
+	}
+
+	for _, r := range c.ACL {
+		switch r.Access {
+		case "read", "write", "readwrite":
+		default:
+			return c, errors.New("core.broker.acl: access should be read, write or readwrite")
+		}
+
+		if r.User == "" || r.Topic == "" {
+			return c, errors.New("core.broker.acl: user and topic required")
+		}
+	}
+
+	return c, nil
+}
+
+// users returns username -> password of [[<key>]] tables with name and password
+// (usernames are case sensitive, so they are not table keys)
+func users(key string) (map[string]string, error) {
+	var list []struct {
+		Name     string
+		Password string
+	}
+
+	err := viper.UnmarshalKey(key, &list)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", key, err)
+	}
+
+	res := make(map[string]string, len(list))
+
+	for _, u := range list {
+		if u.Name == "" {
+			return nil, errors.New(key + ": name required")
+		}
+
+		res[u.Name] = u.Password
+	}
+
+	return res, nil
+}
+
+// opcuaServer returns opcua server config (core.opcua table)
+// server is disabled if endpoint is empty
+func opcuaServer() (opcua.Config, error) {
+	c := opcua.Config{
+		Endpoint:       viper.GetString("core.opcua.endpoint"),
+		Addr:           viper.GetString("core.opcua.addr"),
+		AllowAnonymous: viper.GetBool("core.opcua.allow_anonymous"),
+		AllowInsecure:  viper.GetBool("core.opcua.allow_insecure"),
+		MaxSessions:    viper.GetInt("core.opcua.max_sessions"),
+	}
+
+	var err error
+
+	c.Users, err = users("core.opcua.users")
+
+	return c, err
+}
+
+// modbusSlave returns modbus tcp slave config (core.modbus_slave table)
+// slave is disabled if addr is empty
+func modbusSlave() (slave.Config, error) {
+	c := slave.Config{
+		Addr:   viper.GetString("core.modbus_slave.addr"),
+		UnitID: byte(viper.GetUint("core.modbus_slave.unit_id")),
+	}
+
+	// [[core.modbus_slave.registers]] tables with param, table, address, type and word_order
+	err := viper.UnmarshalKey("core.modbus_slave.registers", &c.Registers)
+	if err != nil {
+		return c, fmt.Errorf("core.modbus_slave.registers: %w", err)
+	}
+
+	for i := range c.Registers {
+		if c.Registers[i].WordOrder == "" {
+			c.Registers[i].WordOrder = viper.GetString("core.modbus_slave.word_order")
+		}
+	}
+
+	return c, nil
+}
+
+// sinks returns additional northbound brokers (core.sinks table)
+// each sink buffer is stored in core db
+func sinks(db *bbolt.DB) ([]mqtt.SinkConfig, error) {
+	names := make([]string, 0)
+	for name := range viper.GetStringMap("core.sinks") {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	list := make([]mqtt.SinkConfig, 0, len(names))
+
+	for _, name := range names {
+		key := "core.sinks." + name
+
+		viper.SetDefault(key+".topic", "ric-edge/{edge}/{param}")
+		viper.SetDefault(key+".qos", 1)
+		viper.SetDefault(key+".buffer_size", 1000)
+
+		policy, err := queue.ParsePolicy(viper.GetString(key + ".buffer_policy"))
+		if err != nil {
+			return nil, err
+		}
+
+		buf, err := queue.NewBolt(db, "sink."+name, viper.GetInt(key+".buffer_size"), policy)
+		if err != nil {
+			return nil, err
+		}
+
+		list = append(list, mqtt.SinkConfig{
+			Name:     name,
+			URLs:     brokers(key),
+			ClientID: viper.GetString(key + ".client_id"),
+			Security: security(key),
+			Topic:    viper.GetString(key + ".topic"),
+			QoS:      byte(viper.GetInt(key + ".qos")),
+			Retained: viper.GetBool(key + ".retained"),
+			Format:   mqtt.PayloadFormat(viper.GetString(key + ".format")),
+			Fields:   viper.GetStringSlice(key + ".fields"),
+			Script:   viper.GetString(key + ".script"),
+			Buffer:   buf,
+		})
+	}
+
+	return list, nil
+}
+
+// webhooks returns http exporters (core.webhooks table)
+// each webhook buffer is stored in core db
+func webhooks(db *bbolt.DB) ([]webhook.Config, error) {
+	names := make([]string, 0)
+	for name := range viper.GetStringMap("core.webhooks") {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	list := make([]webhook.Config, 0, len(names))
+
+	for _, name := range names {
+		key := "core.webhooks." + name
+
+		viper.SetDefault(key+".method", "POST")
+		viper.SetDefault(key+".timeout", "30s")
+		viper.SetDefault(key+".batch_size", 100)
+		viper.SetDefault(key+".flush_interval", "5s")
+		viper.SetDefault(key+".backoff_min", "1s")
+		viper.SetDefault(key+".backoff_max", "1m")
+		viper.SetDefault(key+".buffer_size", 10000)
+
+		policy, err := queue.ParsePolicy(viper.GetString(key + ".buffer_policy"))
+		if err != nil {
+			return nil, err
+		}
+
+		buf, err := queue.NewBolt(db, "webhook."+name, viper.GetInt(key+".buffer_size"), policy)
+		if err != nil {
+			return nil, err
+		}
+
+		list = append(list, webhook.Config{
+			Name:               name,
+			URL:                viper.GetString(key + ".url"),
+			Method:             viper.GetString(key + ".method"),
+			Headers:            viper.GetStringMapString(key + ".headers"),
+			Token:              viper.GetString(key + ".token"),
+			Username:           viper.GetString(key + ".username"),
+			Password:           viper.GetString(key + ".password"),
+			CAFile:             viper.GetString(key + ".ca_file"),
+			InsecureSkipVerify: viper.GetBool(key + ".insecure_skip_verify"),
+			AllowInsecure:      viper.GetBool(key + ".allow_insecure"),
+			Timeout:            viper.GetDuration(key + ".timeout"),
+			BatchSize:          viper.GetInt(key + ".batch_size"),
+			FlushInterval:      viper.GetDuration(key + ".flush_interval"),
+			BackoffMin:         viper.GetDuration(key + ".backoff_min"),
+			BackoffMax:         viper.GetDuration(key + ".backoff_max"),
+			Template:           viper.GetString(key + ".template"),
+			Buffer:             buf,
+		})
+	}
+
+	return list, nil
+}
+
+// tsdbs returns time-series database exporters (core.tsdb table)
+// lines are tagged by edge object and model ids, parameter connector and unit,
+// configured object config fields and static tags
+func tsdbs(db *bbolt.DB, rpcCli rpc.Service) ([]tsdb.Config, error) {
+	names := make([]string, 0)
+	for name := range viper.GetStringMap("core.tsdb") {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	obj := rpcCli.Object()
+
+	params := make(map[string]map[string]string)
+	for _, p := range rpcCli.Params() {
+		params[state.Key(p.ID)] = map[string]string{"connector": p.Connector, "unit": p.Unit}
+	}
+
+	list := make([]tsdb.Config, 0, len(names))
+
+	for _, name := range names {
+		key := "core.tsdb." + name
+
+		viper.SetDefault(key+".measurement", "ric_edge")
+		viper.SetDefault(key+".timeout", "10s")
+		viper.SetDefault(key+".batch_size", 1000)
+		viper.SetDefault(key+".flush_interval", "5s")
+		viper.SetDefault(key+".udp_payload", 512)
+		viper.SetDefault(key+".backoff_min", "1s")
+		viper.SetDefault(key+".backoff_max", "1m")
+		viper.SetDefault(key+".buffer_size", 10000)
+
+		tags := map[string]string{"edge": obj.ID, "model": obj.Models.ID}
+		for _, f := range viper.GetStringSlice(key + ".object_tags") {
+			tags[f] = obj.Config.Get(f).String()
+		}
+
+		for k, v := range viper.GetStringMapString(key + ".tags") {
+			tags[k] = v
+		}
+
+		policy, err := queue.ParsePolicy(viper.GetString(key + ".buffer_policy"))
+		if err != nil {
+			return nil, err
+		}
+
+		buf, err := queue.NewBolt(db, "tsdb."+name, viper.GetInt(key+".buffer_size"), policy)
+		if err != nil {
+			return nil, err
+		}
+
+		list = append(list, tsdb.Config{
+			Name:          name,
+			URL:           viper.GetString(key + ".url"),
+			Token:         viper.GetString(key + ".token"),
+			Username:      viper.GetString(key + ".username"),
+			Password:      viper.GetString(key + ".password"),
+			AllowInsecure: viper.GetBool(key + ".allow_insecure"),
+			Timeout:       viper.GetDuration(key + ".timeout"),
+			BatchSize:     viper.GetInt(key + ".batch_size"),
+			FlushInterval: viper.GetDuration(key + ".flush_interval"),
+			UDPPayload:    viper.GetInt(key + ".udp_payload"),
+			BackoffMin:    viper.GetDuration(key + ".backoff_min"),
+			BackoffMax:    viper.GetDuration(key + ".backoff_max"),
+			Measurement:   viper.GetString(key + ".measurement"),
+			Tags:          tags,
+			Params:        params,
+			Buffer:        buf,
+		})
+	}
+
+	return list, nil
+}
+
+// connectors returns list of connector processes which core should start
+// (core.connectors table, connector binary placed near core by default)
+func connectors() []supervisor.Process {
+	names := make([]string, 0)
+	for name := range viper.GetStringMap("core.connectors") {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	list := make([]supervisor.Process, 0, len(names))
+
+	for _, name := range names {
+		key := "core.connectors." + name
+
+		path := viper.GetString(key + ".path")
+		if path == "" {
+			path = name
+
+			if exe, err := os.Executable(); err == nil {
+				path = filepath.Join(filepath.Dir(exe), name)
+			}
+		}
+
+		list = append(list, supervisor.Process{
+			Name: name,
+			Path: path,
+			Args: viper.GetStringSlice(key + ".args"),
+			Env:  viper.GetStringSlice(key + ".env"),
+		})
+	}
+
+	return list
+}
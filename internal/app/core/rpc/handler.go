@@ -0,0 +1,127 @@
+/**
+ * Copyright 2021 Rightech IoT. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rpc
+
+import (
+	"bytes"
+
+	jsoniter "github.com/json-iterator/go"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/objx"
+
+	"github.com/Rightech/ric-edge/pkg/jsonrpc"
+)
+
+var errSecretNotFound = jsonrpc.ErrInvalidParams.AddData("msg", "secret not found")
+
+// Handle process requests sent by connectors to core
+// supported methods:
+//
+//	get-state         - {"key": "param"} returns current state of param
+//	get-object-config - {"path": "a.b"} returns object.config.<connector> (or its part)
+//	get-secret        - {"name": "token"} returns secret from core.secrets.<connector>
+func (s Service) Handle(connector string, msg []byte) []byte {
+	decoder := jsoniter.ConfigFastest.NewDecoder(bytes.NewReader(msg))
+	decoder.UseNumber()
+
+	var req jsonrpc.Request
+
+	err := decoder.Decode(&req)
+	if err != nil {
+		return jsonrpc.BuildErrResp("", errUnmarshal.AddData("err", err.Error()))
+	}
+
+	var id string
+
+	err = jsoniter.ConfigFastest.Unmarshal(req.ID, &id)
+	if err != nil {
+		return jsonrpc.BuildErrResp("", errBadIDType)
+	}
+
+	log.WithFields(log.Fields{
+		"connector": connector,
+		"method":    req.Method,
+	}).Debug("request from connector")
+
+	var res interface{}
+
+	switch req.Method {
+	case "get-state":
+		res, err = s.getState(req.Params)
+	case "get-object-config":
+		res = s.getObjectConfig(connector, req.Params)
+	case "get-secret":
+		res, err = s.getSecret(connector, req.Params)
+	default:
+		err = jsonrpc.ErrMethodNotFound.AddData("method", req.Method)
+	}
+
+	if err != nil {
+		e, ok := err.(jsonrpc.Error)
+		if !ok {
+			e = jsonrpc.ErrServer.AddData("msg", err.Error())
+		}
+
+		return jsonrpc.BuildErrResp(id, e)
+	}
+
+	data, err := jsoniter.ConfigFastest.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      id,
+		"result":  res,
+	})
+	if err != nil {
+		return jsonrpc.BuildErrResp(id, jsonrpc.ErrInternal.AddData("msg", err.Error()))
+	}
+
+	return data
+}
+
+func (s Service) getState(params objx.Map) (interface{}, error) {
+	key := params.Get("key").Str()
+	if key == "" {
+		return nil, jsonrpc.ErrInvalidParams.AddData("msg", "key required")
+	}
+
+	return s.state.Get(key)[key], nil
+}
+
+func (s Service) getObjectConfig(connector string, params objx.Map) interface{} {
+	// connector has access only to its own section of config
+	path := connector
+
+	if p := params.Get("path").Str(); p != "" {
+		path += "." + p
+	}
+
+	return s.obj.Config.Get(path).Data()
+}
+
+func (s Service) getSecret(connector string, params objx.Map) (interface{}, error) {
+	name := params.Get("name").Str()
+	if name == "" {
+		return nil, jsonrpc.ErrInvalidParams.AddData("msg", "name required")
+	}
+
+	// connector has access only to its own secrets
+	val := s.secrets.Get(connector + "." + name)
+	if !val.IsStr() {
+		return nil, errSecretNotFound.AddData("name", name)
+	}
+
+	return val.Str(), nil
+}
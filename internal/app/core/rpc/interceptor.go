@@ -18,7 +18,6 @@ package rpc
 
 import (
 	"bytes"
-	"encoding/base64"
 	"errors"
 	"fmt"
 	"strings"
@@ -70,11 +69,14 @@ type Service struct {
 	timeout    time.Duration
 	state      stater
 	requestsCh <-chan []byte
-	stateCh    chan<- []byte
+	stateCh    chan<- state.Change
+	// secrets available for connectors (connector -> name -> value)
+	secrets objx.Map
 }
 
 func New(id string, tm time.Duration, ac action, db state.DB, cleanStart bool, r rpcCli,
-	api api, j jober, stateCh chan<- []byte, requestsCh <-chan []byte) (Service, error) {
+	api api, j jober, stateCh chan<- state.Change, requestsCh <-chan []byte,
+	secrets map[string]interface{}) (Service, error) {
 	st, err := state.NewService(db, cleanStart)
 	if err != nil {
 		return Service{}, err
@@ -98,7 +100,7 @@ func New(id string, tm time.Duration, ac action, db state.DB, cleanStart bool, r
 	}
 
 	s := Service{r, api, j, make([]int, 0), ac, object, model, tm, st,
-		requestsCh, stateCh}
+		requestsCh, stateCh, objx.New(secrets)}
 
 	go s.requestsListener()
 
@@ -109,6 +111,27 @@ func (s Service) GetEdgeID() string {
 	return s.obj.ID
 }
 
+// Object returns edge object loaded from cloud
+func (s Service) Object() cloud.Object {
+	return s.obj
+}
+
+// Model returns edge model loaded from cloud
+func (s Service) Model() cloud.Model {
+	return s.model
+}
+
+// Value returns current state value of parameter
+func (s Service) Value(param string) (interface{}, bool) {
+	v, ok := s.state.Get(param)[param]
+	return v, ok
+}
+
+// Params returns parameters of edge model
+func (s Service) Params() []cloud.Param {
+	return s.model.Params()
+}
+
 func (s Service) undoAll() {
 	for _, id := range s.jobs {
 		s.job.Remove(id)
@@ -131,21 +154,12 @@ var (
 )
 
 func (s Service) sendState(parent string, value interface{}) {
-	data := make(objx.Map, 1)
-
-	parent = strings.TrimPrefix(parent, "edge.")
-
-	data.Set(parent, value)
-
-	st, err := jsoniter.ConfigFastest.Marshal(data)
-	if err != nil {
-		log.WithFields(log.Fields{
-			"value": value,
-			"error": err,
-		}).Error("sendState: marshal json")
+	s.stateCh <- state.Change{
+		Param: state.Key(parent),
+		Value: value,
+		Unit:  s.model.Units()[parent],
+		Time:  time.Now(),
 	}
-
-	s.stateCh <- st
 }
 
 func (s Service) requestsListener() { // nolint: funlen
@@ -182,12 +196,7 @@ func (s Service) requestsListener() { // nolint: funlen
 			"value":  request.Get("params.value").Data(),
 		}).Debug("requestsListener: new notification")
 
-		if request.Get("params.value").IsStr() {
-			decoded, err := base64.StdEncoding.DecodeString(request.Get("params.value").Str())
-			if err == nil {
-				request.Set("params.value", decoded)
-			}
-		}
+		request.Set("params.value", jsonrpc.DecodeBinary(request.Get("params.value").Data()))
 
 		res, err := s.action.Execute("read."+parent, request.Get("params.value").Data())
 		if err != nil {
@@ -296,7 +305,7 @@ func (s Service) fillTemplate(data []byte) ([]byte, bool, error) {
 	return res, true, err
 }
 
-func (s Service) prepareRequest(payload []byte) ([]byte, objx.Map, *jsonrpc.Error) {
+func (s Service) prepareRequest(payload []byte, deadline time.Time) ([]byte, objx.Map, *jsonrpc.Error) {
 	payload, changed, err := s.fillTemplate(payload)
 	if err != nil {
 		e := errUnmarshal.AddData("err", err.Error())
@@ -324,6 +333,15 @@ func (s Service) prepareRequest(payload []byte) ([]byte, objx.Map, *jsonrpc.Erro
 		changed = true
 	}
 
+	// connector should not process request after core stop waiting it
+	// (earlier deadline of caller is kept, e.g. mqtt message expiry)
+	dl := deadline.UnixNano() / int64(time.Millisecond)
+	if v, ok := data.Get("params." + jsonrpc.DeadlineParam).Data().(float64); !ok || int64(v) > dl {
+		data.Set("params."+jsonrpc.DeadlineParam, dl)
+
+		changed = true
+	}
+
 	if data.Get("params._type").Str() == "write" {
 		parent := data.Get("params._parent").Str()
 		if parent != "" {
@@ -347,7 +365,7 @@ func (s Service) prepareRequest(payload []byte) ([]byte, objx.Map, *jsonrpc.Erro
 }
 
 func (s Service) Call(name string, payload []byte) []byte {
-	payload, data, err := s.prepareRequest(payload)
+	payload, data, err := s.prepareRequest(payload, time.Now().Add(s.timeout))
 	if err != nil {
 		return jsonrpc.BuildErrResp("", *err)
 	}
@@ -360,20 +378,18 @@ func (s Service) Call(name string, payload []byte) []byte {
 			<-timer.C
 		}
 
-		if data.Get("params._type").Str() == "read" {
-			msg = s.prepareResponse(data, msg)
-		}
-
-		return msg
+		return s.prepareResponse(data, msg)
 	case <-timer.C:
 		return jsonrpc.BuildErrResp(data.Get("id").Str(), errTimeout)
 	}
 }
 
+// prepareResponse updates state with result of read request
+// and converts binary values of connector to base64 strings for cloud
 func (s Service) prepareResponse(req objx.Map, resp []byte) []byte { // nolint: funlen
 	parent := req.Get("params._parent").Str()
-	if parent == "" {
-		return resp
+	if parent == "" || req.Get("params._type").Str() != "read" {
+		return encodeBinary(resp)
 	}
 
 	var result objx.Map
@@ -398,12 +414,7 @@ func (s Service) prepareResponse(req objx.Map, resp []byte) []byte { // nolint:
 		return resp
 	}
 
-	if result.Get("result").IsStr() {
-		decoded, err := base64.StdEncoding.DecodeString(result.Get("result").Str())
-		if err == nil {
-			result.Set("result", decoded)
-		}
-	}
+	result.Set("result", jsonrpc.DecodeBinary(result.Get("result").Data()))
 
 	res, err := s.action.Execute("read."+parent, result.Get("result").Data())
 	if err != nil {
@@ -447,3 +458,31 @@ func (s Service) prepareResponse(req objx.Map, resp []byte) []byte { // nolint:
 
 	return data
 }
+
+// encodeBinary replaces {"$binary": "<base64>"} values of response by base64 strings
+// (cloud doesn't know about binary type of connector link)
+func encodeBinary(resp []byte) []byte {
+	if !bytes.Contains(resp, []byte(jsonrpc.BinaryKey)) {
+		return resp
+	}
+
+	var result objx.Map
+
+	err := jsoniter.ConfigFastest.Unmarshal(resp, &result)
+	if err != nil {
+		return resp
+	}
+
+	// []byte is marshaled as base64 string
+	data, err := jsoniter.ConfigFastest.Marshal(jsonrpc.DecodeBinary(map[string]interface{}(result)))
+	if err != nil {
+		log.WithFields(log.Fields{
+			"value": string(resp),
+			"error": err,
+		}).Error("encodeBinary: marshal result to json")
+
+		return resp
+	}
+
+	return data
+}
@@ -29,6 +29,7 @@ func Setup(version ...string) {
 
 	viper.SetDefault("modbus.mode", "tcp") // rtu also supported
 	viper.SetDefault("modbus.addr", "localhost:8000")
+	viper.SetDefault("modbus.workers", 1)
 
 	viper.Set("modbus.ws_path", "/modbus")
 }
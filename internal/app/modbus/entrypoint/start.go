@@ -24,6 +24,7 @@ import (
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
 
+	"github.com/Rightech/ric-edge/internal/app/common"
 	"github.com/Rightech/ric-edge/internal/app/modbus/handler"
 	"github.com/Rightech/ric-edge/internal/pkg/ws"
 	"github.com/Rightech/ric-edge/pkg/jsonrpc"
@@ -32,9 +33,62 @@ import (
 )
 
 func Start(done <-chan os.Signal) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var (
+		hand  = common.Plugin(ctx, "modbus")
+		keyFn jsonrpc.KeyFunc
+		err   error
+	)
+
+	if hand == nil {
+		hand, keyFn, err = newHandler()
+		if err != nil {
+			return err
+		}
+	}
+
+	mw, err := common.Middleware("modbus")
+	if err != nil {
+		return err
+	}
+
+	notifications, closeNotifications, err := common.Notifications("modbus")
+	if err != nil {
+		return err
+	}
+	defer closeNotifications()
+
+	cli, err := ws.New(viper.GetInt("ws_port"), viper.GetString("version"),
+		viper.GetString("modbus.ws_path"))
+	if err != nil {
+		return err
+	}
+
+	go jsonrpc.ServeWithReconnect(ctx, cli, hand,
+		jsonrpc.CatchPanic(viper.GetBool("catch_panic")),
+		jsonrpc.Use(mw...),
+		notifications,
+		jsonrpc.Workers(viper.GetInt("modbus.workers")),
+		jsonrpc.SerializeBy(keyFn))
+
+	<-done
+	cancel()
+	cli.Close()
+
+	return nil
+}
+
+// newHandler returns built-in modbus handler
+// and serialization key (serial line can't process requests in parallel)
+func newHandler() (jsonrpc.Caller, jsonrpc.KeyFunc, error) {
 	var (
 		transport  modbus.Transporter
 		packagerFn handler.PackagerFn
+		// tcp transporter lock itself on every transaction
+		// but serial line should be locked by us
+		keyFn jsonrpc.KeyFunc
 	)
 
 	mode := viper.GetString("modbus.mode")
@@ -49,29 +103,16 @@ func Start(done <-chan os.Signal) error {
 		hndlr.Logger = logger.New("debug", log.DebugLevel)
 		transport = hndlr
 		packagerFn = func(s byte) modbus.Packager { return modbus.NewRTUPackager(s) }
+		keyFn = jsonrpc.ConstKey(viper.GetString("modbus.addr"))
 	case "ascii":
 		hndlr := modbus.NewASCIITransporter(viper.GetString("modbus.addr"))
 		hndlr.Logger = logger.New("debug", log.DebugLevel)
 		transport = hndlr
 		packagerFn = func(s byte) modbus.Packager { return modbus.NewASCIIPackager(s) }
+		keyFn = jsonrpc.ConstKey(viper.GetString("modbus.addr"))
 	default:
-		return errors.New("modbus.mode should be tcp, rtu or ascii but " + mode + " given")
+		return nil, nil, errors.New("modbus.mode should be tcp, rtu or ascii but " + mode + " given")
 	}
 
-	cli, err := ws.New(viper.GetInt("ws_port"), viper.GetString("version"),
-		viper.GetString("modbus.ws_path"))
-	if err != nil {
-		return err
-	}
-
-	ctx, cancel := context.WithCancel(context.Background())
-
-	go jsonrpc.ServeWithReconnect(ctx, cli, handler.New(transport, packagerFn),
-		jsonrpc.CatchPanic(viper.GetBool("catch_panic")))
-
-	<-done
-	cancel()
-	cli.Close()
-
-	return nil
+	return jsonrpc.WithContext(handler.New(transport, packagerFn)), keyFn, nil
 }
@@ -17,12 +17,10 @@
 package handler
 
 import (
+	"context"
 	"encoding/binary"
-	"encoding/json"
 	"math"
 
-	"github.com/stretchr/objx"
-
 	"github.com/Rightech/ric-edge/pkg/jsonrpc"
 	"github.com/Rightech/ric-edge/third_party/goburrow/modbus"
 )
@@ -32,54 +30,68 @@ type PackagerFn func(byte) modbus.Packager
 type Service struct {
 	transport      modbus.Transporter
 	packagerGetter PackagerFn
+	router         *jsonrpc.Router
 }
 
 func New(transport modbus.Transporter, pGetter PackagerFn) Service {
-	return Service{transport, pGetter}
+	s := Service{transport: transport, packagerGetter: pGetter}
+
+	s.router = jsonrpc.NewRouter().
+		Handle("modbus-read-coil", s.readCoils).
+		Handle("modbus-read-discrete", s.readDiscreteInputs).
+		Handle("modbus-write-coil", s.writeSingleCoil).
+		Handle("modbus-write-multiple-coils", s.writeMultipleCoils).
+		Handle("modbus-read-input", s.readInputRegisters).
+		Handle("modbus-read-holding", s.readHoldingRegisters).
+		Handle("modbus-write-register", s.writeSingleRegister).
+		Handle("modbus-write-multiple-registers", s.writeMultipleRegisters)
+
+	return s
 }
 
 func (s Service) getClient(slaveID byte) modbus.Client {
 	return modbus.NewClient2(s.packagerGetter(slaveID), s.transport)
 }
 
-func (s Service) Call(req jsonrpc.Request) (res interface{}, err error) {
-	switch req.Method {
-	case "modbus-read-coil":
-		res, err = s.readCoils(req.Params)
-	case "modbus-read-discrete":
-		res, err = s.readDiscreteInputs(req.Params)
-	case "modbus-write-coil":
-		res, err = s.writeSingleCoil(req.Params)
-	case "modbus-write-multiple-coils":
-		res, err = s.writeMultipleCoils(req.Params)
-	case "modbus-read-input":
-		res, err = s.readInputRegisters(req.Params)
-	case "modbus-read-holding":
-		res, err = s.readHoldingRegisters(req.Params)
-	case "modbus-write-register":
-		res, err = s.writeSingleRegister(req.Params)
-	case "modbus-write-multiple-registers":
-		res, err = s.writeMultipleRegisters(req.Params)
-	// case "read-write-multiple-registers":
-	// 	res, err = s.h.ReadWriteMultipleRegisters(req.Params)
-	// case "mask-write-register":
-	// 	res, err = s.h.MaskWriteRegister(req.Params)
-	// case "read-fifo-queue":
-	// 	res, err = s.h.ReadFIFOQueue(req.Params)
-	default:
-		err = jsonrpc.ErrMethodNotFound.AddData("method", req.Method)
+func (s Service) CallContext(ctx context.Context, req jsonrpc.Request) (interface{}, error) {
+	// modbus transport can't be interrupted
+	// so we only check request still actual before send it
+	// (it can wait long time in queue to serial line)
+	if err := ctx.Err(); err != nil {
+		return nil, err
 	}
 
-	return
+	return s.router.CallContext(ctx, req)
 }
 
-const (
-	maxUint16 = int64(^uint16(0))
-	minUint16 = int64(0)
+type slaveParams struct {
+	SlaveID byte `json:"slave_id"`
+}
 
-	maxByte = int64(255)
-	minByte = int64(0)
-)
+type readParams struct {
+	slaveParams
+	Address  uint16 `json:"address" rpc:"required"`
+	Quantity uint16 `json:"quantity" rpc:"required"`
+}
+
+type writeParams struct {
+	slaveParams
+	Address uint16 `json:"address" rpc:"required"`
+	Value   uint16 `json:"value" rpc:"required"`
+}
+
+type writeCoilParams struct {
+	slaveParams
+	Address uint16 `json:"address" rpc:"required"`
+	Value   uint16 `json:"value" rpc:"required,enum=0|1"`
+}
+
+type writeMultipleParams struct {
+	slaveParams
+	Address  uint16   `json:"address" rpc:"required"`
+	Quantity uint16   `json:"quantity" rpc:"required"`
+	Value    []uint16 `json:"value" rpc:"required"`
+}
 
 func parseResultByteToBits(b []byte, quantity uint16) []uint16 {
 	// uint16 required here because json encode byte array as base64
@@ -105,147 +117,21 @@ func parseResult(b []byte) []uint16 {
 	return res
 }
 
-func getInt64(params objx.Map, k string, def ...int64) (int64, error) {
-	val := params.Get(k)
-	if val.IsNil() {
-		if len(def) > 0 {
-			return def[0], nil
-		}
-
-		return 0, jsonrpc.ErrInvalidParams.AddData("msg", k+" required")
-	}
-
-	number, ok := val.Data().(json.Number)
-	if !ok {
-		return 0, jsonrpc.ErrInvalidParams.AddData("msg", k+" should be number")
-	}
-
-	var (
-		value int64
-		err   error
-	)
-
-	if value, err = number.Int64(); err != nil {
-		return 0, jsonrpc.ErrInvalidParams.AddData("msg", k+" should be int")
-	}
+func (s Service) readCoils(_ context.Context, p *readParams) (interface{}, error) {
+	cli := s.getClient(p.SlaveID)
 
-	return value, nil
-}
-
-func getSlaveID(params objx.Map) (byte, error) {
-	value, err := getInt64(params, "slave_id", 0)
-	if err != nil {
-		return 0, err
-	}
-
-	if !(minByte <= value && value <= maxByte) {
-		return 0, jsonrpc.ErrInvalidParams.AddData("msg", "slave_id should be byte")
-	}
-
-	return byte(value), nil
-}
-
-func getUint16(params objx.Map, k string, def ...int64) (uint16, error) {
-	value, err := getInt64(params, k, def...)
-	if err != nil {
-		return 0, err
-	}
-
-	if !(minUint16 <= value && value <= maxUint16) {
-		return 0, jsonrpc.ErrInvalidParams.AddData("msg", k+" should be uint16")
-	}
-
-	return uint16(value), nil
-}
-
-func getTwoUint16(params objx.Map, k1, k2 string) (uint16, uint16, error) {
-	v1, err := getUint16(params, k1)
-	if err != nil {
-		return 0, 0, err
-	}
-
-	v2, err := getUint16(params, k2)
-	if err != nil {
-		return 0, 0, err
-	}
-
-	return v1, v2, nil
-}
-
-func getArray(params objx.Map, k string) ([]interface{}, error) {
-	v1 := params.Get(k)
-
-	if !v1.IsInterSlice() {
-		return nil, jsonrpc.ErrInvalidParams.AddData("msg", k+" required and should be array")
-	}
-
-	return v1.InterSlice(), nil
-}
-
-func processIntArrayItem(k string, values []interface{}, callback func(int64) error) error {
-	for _, v := range values {
-		num, ok := v.(json.Number)
-		if !ok {
-			return jsonrpc.ErrInvalidParams.AddData("msg", k+" should be array of numbers")
-		}
-
-		item, err := num.Int64()
-		if err != nil {
-			return jsonrpc.ErrInvalidParams.AddData("msg", k+" should be array of uint16")
-		}
-
-		err = callback(item)
-		if err != nil {
-			return err
-		}
-	}
-
-	return nil
-}
-
-func getAddrAndQuantity(params objx.Map) (uint16, uint16, error) {
-	return getTwoUint16(params, "address", "quantity")
-}
-
-func getAddrAndValue(params objx.Map) (uint16, uint16, error) {
-	return getTwoUint16(params, "address", "value")
-}
-
-func (s Service) readCoils(params objx.Map) (interface{}, error) {
-	addr, quantity, err := getAddrAndQuantity(params)
-	if err != nil {
-		return nil, err
-	}
-
-	slaveID, err := getSlaveID(params)
-	if err != nil {
-		return nil, err
-	}
-
-	cli := s.getClient(slaveID)
-
-	res, err := cli.ReadCoils(addr, quantity)
+	res, err := cli.ReadCoils(p.Address, p.Quantity)
 	if err != nil {
 		return nil, err
 	}
 
-	return parseResultByteToBits(res, quantity), nil
+	return parseResultByteToBits(res, p.Quantity), nil
 }
 
-func (s Service) readDiscreteInputs(params objx.Map) (interface{}, error) {
-	addr, quantity, err := getAddrAndQuantity(params)
-	if err != nil {
-		return nil, err
-	}
-
-	slaveID, err := getSlaveID(params)
-	if err != nil {
-		return nil, err
-	}
+func (s Service) readDiscreteInputs(_ context.Context, p *readParams) (interface{}, error) {
+	cli := s.getClient(p.SlaveID)
 
-	cli := s.getClient(slaveID)
-
-	res, err := cli.ReadDiscreteInputs(addr, quantity)
+	res, err := cli.ReadDiscreteInputs(p.Address, p.Quantity)
 	if err != nil {
 		return nil, err
 	}
@@ -255,30 +141,15 @@ func (s Service) readDiscreteInputs(params objx.Map) (interface{}, error) {
 
 const modbusTrueValue = 0xFF00
 
-func (s Service) writeSingleCoil(params objx.Map) (interface{}, error) {
-	addr, value, err := getAddrAndValue(params)
-	if err != nil {
-		return nil, err
-	}
-
-	if value > 1 {
-		return nil, jsonrpc.ErrInvalidParams.
-			AddData("msg", "bad value. only 0 or 1 allowed").
-			AddData("v", value)
-	}
-
+func (s Service) writeSingleCoil(_ context.Context, p *writeCoilParams) (interface{}, error) {
+	value := p.Value
 	if value == 1 {
 		value = modbusTrueValue
 	}
 
-	slaveID, err := getSlaveID(params)
-	if err != nil {
-		return nil, err
-	}
-
-	cli := s.getClient(slaveID)
+	cli := s.getClient(p.SlaveID)
 
-	res, err := cli.WriteSingleCoil(addr, value)
+	res, err := cli.WriteSingleCoil(p.Address, value)
 	if err != nil {
 		return nil, err
 	}
@@ -292,60 +163,26 @@ func (s Service) writeSingleCoil(params objx.Map) (interface{}, error) {
 	return result[0], nil
 }
 
-func buildProcessCoilsArray(k string, bytes []byte) func(int64) error {
-	i := 0
-	pos := 0
+func (s Service) writeMultipleCoils(_ context.Context, p *writeMultipleParams) (interface{}, error) {
+	if int(p.Quantity) != len(p.Value) {
+		return nil, jsonrpc.ErrInvalidParams.AddData("msg", "wrong quantity")
+	}
 
-	return func(item int64) error {
-		if pos == 8 {
-			pos = 0
-			i++
-		}
+	bytes := make([]byte, int(math.Ceil(float64(p.Quantity)/8.0)))
 
+	for i, item := range p.Value {
 		if item != 0 && item != 1 {
-			return jsonrpc.ErrInvalidParams.AddData("msg", "element of "+k+" should be 1 or 0")
+			return nil, jsonrpc.ErrInvalidParams.AddData("msg", "element of value should be 1 or 0")
 		}
 
 		if item == 1 {
-			bytes[i] |= 1 << pos
+			bytes[i/8] |= 1 << (i % 8)
 		}
-
-		pos++
-
-		return nil
 	}
-}
 
-func (s Service) writeMultipleCoils(params objx.Map) (interface{}, error) {
-	addr, quantity, err := getAddrAndQuantity(params)
-	if err != nil {
-		return nil, err
-	}
+	cli := s.getClient(p.SlaveID)
 
-	values, err := getArray(params, "value")
-	if err != nil {
-		return nil, err
-	}
-
-	if int(quantity) != len(values) {
-		return nil, jsonrpc.ErrInvalidParams.AddData("msg", "wrong quantity")
-	}
-
-	bytes := make([]byte, int(math.Ceil(float64(quantity)/8.0)))
-
-	err = processIntArrayItem("value", values, buildProcessCoilsArray("value", bytes))
-	if err != nil {
-		return nil, err
-	}
-
-	slaveID, err := getSlaveID(params)
-	if err != nil {
-		return nil, err
-	}
-
-	cli := s.getClient(slaveID)
-
-	res, err := cli.WriteMultipleCoils(addr, quantity, bytes)
+	res, err := cli.WriteMultipleCoils(p.Address, p.Quantity, bytes)
 	if err != nil {
 		return nil, err
 	}
@@ -353,20 +190,10 @@ func (s Service) writeMultipleCoils(params objx.Map) (interface{}, error) {
 	return parseResult(res), nil
 }
 
-func (s Service) readInputRegisters(params objx.Map) (interface{}, error) {
-	addr, quantity, err := getAddrAndQuantity(params)
-	if err != nil {
-		return nil, err
-	}
+func (s Service) readInputRegisters(_ context.Context, p *readParams) (interface{}, error) {
+	cli := s.getClient(p.SlaveID)
 
-	slaveID, err := getSlaveID(params)
-	if err != nil {
-		return nil, err
-	}
-
-	cli := s.getClient(slaveID)
-
-	res, err := cli.ReadInputRegisters(addr, quantity)
+	res, err := cli.ReadInputRegisters(p.Address, p.Quantity)
 	if err != nil {
 		return nil, err
 	}
@@ -374,20 +201,10 @@ func (s Service) readInputRegisters(params objx.Map) (interface{}, error) {
 	return parseResult(res), nil
 }
 
-func (s Service) readHoldingRegisters(params objx.Map) (interface{}, error) {
-	addr, quantity, err := getAddrAndQuantity(params)
-	if err != nil {
-		return nil, err
-	}
-
-	slaveID, err := getSlaveID(params)
-	if err != nil {
-		return nil, err
-	}
-
-	cli := s.getClient(slaveID)
+func (s Service) readHoldingRegisters(_ context.Context, p *readParams) (interface{}, error) {
+	cli := s.getClient(p.SlaveID)
 
-	res, err := cli.ReadHoldingRegisters(addr, quantity)
+	res, err := cli.ReadHoldingRegisters(p.Address, p.Quantity)
 	if err != nil {
 		return nil, err
 	}
@@ -395,20 +212,10 @@ func (s Service) readHoldingRegisters(params objx.Map) (interface{}, error) {
 	return parseResult(res), nil
 }
 
-func (s Service) writeSingleRegister(params objx.Map) (interface{}, error) {
-	addr, value, err := getAddrAndValue(params)
-	if err != nil {
-		return nil, err
-	}
-
-	slaveID, err := getSlaveID(params)
-	if err != nil {
-		return nil, err
-	}
-
-	cli := s.getClient(slaveID)
+func (s Service) writeSingleRegister(_ context.Context, p *writeParams) (interface{}, error) {
+	cli := s.getClient(p.SlaveID)
 
-	res, err := cli.WriteSingleRegister(addr, value)
+	res, err := cli.WriteSingleRegister(p.Address, p.Value)
 	if err != nil {
 		return nil, err
 	}
@@ -416,96 +223,23 @@ func (s Service) writeSingleRegister(params objx.Map) (interface{}, error) {
 	return parseResult(res), nil
 }
 
-func buildProcessRegistersArray(k string, bytes []byte) func(int64) error {
-	i := 0
-
-	return func(item int64) error {
-		if !(minUint16 <= item && item <= maxUint16) {
-			return jsonrpc.ErrInvalidParams.AddData("msg", k+" should be array of uint16")
-		}
-
-		binary.BigEndian.PutUint16(bytes[i:i+2], uint16(item))
-		i += 2
-
-		return nil
-	}
-}
-
-func (s Service) writeMultipleRegisters(params objx.Map) (interface{}, error) {
-	addr, quantity, err := getAddrAndQuantity(params)
-	if err != nil {
-		return nil, err
-	}
-
-	values, err := getArray(params, "value")
-	if err != nil {
-		return nil, err
-	}
-
-	if int(quantity) != len(values) {
+func (s Service) writeMultipleRegisters(_ context.Context, p *writeMultipleParams) (interface{}, error) {
+	if int(p.Quantity) != len(p.Value) {
 		return nil, jsonrpc.ErrInvalidParams.AddData("msg", "wrong quantity")
 	}
 
-	bytes := make([]byte, quantity*2)
-
-	err = processIntArrayItem("value", values, buildProcessRegistersArray("value", bytes))
-	if err != nil {
-		return nil, err
-	}
+	bytes := make([]byte, p.Quantity*2)
 
-	slaveID, err := getSlaveID(params)
-	if err != nil {
-		return nil, err
+	for i, item := range p.Value {
+		binary.BigEndian.PutUint16(bytes[i*2:], item)
 	}
 
-	cli := s.getClient(slaveID)
+	cli := s.getClient(p.SlaveID)
 
-	res, err := cli.WriteMultipleRegisters(addr, quantity, bytes)
+	res, err := cli.WriteMultipleRegisters(p.Address, p.Quantity, bytes)
 	if err != nil {
 		return nil, err
 	}
 
 	return parseResult(res), nil
 }
-
-// func (s Service) readWriteMultipleRegisters(params objx.Map) (interface{}, error) {
-// 	readAddr, readQuantity, err := getTwoUint16(params, "read_address", "read_quantity")
-// 	if err != nil {
-// 		return nil, err
-// 	}
-
-// 	writeAddr, writeQuantity, err := getTwoUint16(params, "write_address", "write_quantity")
-// 	if err != nil {
-// 		return nil, err
-// 	}
-
-// 	value, err := getBytes(params, "value")
-// 	if err != nil {
-// 		return nil, err
-// 	}
-
-// 	return s.cli.ReadWriteMultipleRegisters(readAddr, readQuantity, writeAddr, writeQuantity, value)
-// }
-
-// func (s Service) maskWriteRegister(params objx.Map) (interface{}, error) {
-// 	addr, andMask, err := getTwoUint16(params, "address", "and_mask")
-// 	if err != nil {
-// 		return nil, err
-// 	}
-
-// 	orMask, err := getUint16(params, "or_mask")
-// 	if err != nil {
-// 		return nil, err
-// 	}
-
-// 	return s.cli.MaskWriteRegister(addr, andMask, orMask)
-// }
-
-// func (s Service) readFIFOQueue(params objx.Map) (interface{}, error) {
-// 	addr, err := getUint16(params, "address")
-// 	if err != nil {
-// 		return nil, err
-// 	}
-
-// 	return s.cli.ReadFIFOQueue(addr)
-// }
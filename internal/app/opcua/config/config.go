@@ -32,5 +32,6 @@ func Setup(version ...string) {
 	viper.SetDefault("opcua.mode", "None")
 	viper.SetDefault("opcua.server_cert", "")
 	viper.SetDefault("opcua.server_key", "")
+	viper.SetDefault("opcua.workers", 1)
 	viper.Set("opcua.ws_path", "/opcua")
 }
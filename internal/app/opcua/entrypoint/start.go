@@ -22,36 +22,59 @@ import (
 
 	"github.com/spf13/viper"
 
+	"github.com/Rightech/ric-edge/internal/app/common"
 	"github.com/Rightech/ric-edge/internal/app/opcua/handler"
 	"github.com/Rightech/ric-edge/internal/pkg/ws"
 	"github.com/Rightech/ric-edge/pkg/jsonrpc"
 )
 
 func Start(done <-chan os.Signal) error {
-	hand, err := handler.New(
-		viper.GetString("opcua.endpoint"),
-		viper.GetString("opcua.encryption"),
-		viper.GetString("opcua.mode"),
-		viper.GetString("opcua.server_cert"),
-		viper.GetString("opcua.server_key"))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hand := common.Plugin(ctx, "opcua")
+	if hand == nil {
+		svc, err := handler.New(
+			viper.GetString("opcua.endpoint"),
+			viper.GetString("opcua.encryption"),
+			viper.GetString("opcua.mode"),
+			viper.GetString("opcua.server_cert"),
+			viper.GetString("opcua.server_key"))
+		if err != nil {
+			return err
+		}
+
+		defer svc.Close()
+
+		hand = jsonrpc.WithContext(svc)
+	}
+
+	mw, err := common.Middleware("opcua")
 	if err != nil {
 		return err
 	}
 
+	notifications, closeNotifications, err := common.Notifications("opcua")
+	if err != nil {
+		return err
+	}
+	defer closeNotifications()
+
 	cli, err := ws.New(viper.GetInt("ws_port"), viper.GetString("version"),
 		viper.GetString("opcua.ws_path"))
 	if err != nil {
 		return err
 	}
 
-	ctx, cancel := context.WithCancel(context.Background())
-
-	go jsonrpc.ServeWithReconnect(ctx, cli, hand, jsonrpc.CatchPanic(viper.GetBool("catch_panic")))
+	go jsonrpc.ServeWithReconnect(ctx, cli, hand,
+		jsonrpc.CatchPanic(viper.GetBool("catch_panic")),
+		jsonrpc.Use(mw...),
+		notifications,
+		jsonrpc.Workers(viper.GetInt("opcua.workers")))
 
 	<-done
 	cancel()
 	cli.Close()
-	hand.Close()
 
 	return nil
 }
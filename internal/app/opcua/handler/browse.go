@@ -17,6 +17,7 @@
 package handler
 
 import (
+	"context"
 	"fmt"
 	"strconv"
 
@@ -56,11 +57,16 @@ func join(a, b string) string {
 	return a + "." + b
 }
 
-func browse(n *opcua.Node, path string, level int) ([]nodeDef, error) {
+func browse(ctx context.Context, n *opcua.Node, path string, level int) ([]nodeDef, error) {
 	if level > 10 {
 		return nil, nil
 	}
 
+	// browse makes a lot of requests so stop it if nobody waits result
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	attrs, err := n.Attributes(ua.AttributeIDNodeClass,
 		ua.AttributeIDBrowseName, ua.AttributeIDDescription,
 		ua.AttributeIDAccessLevel, ua.AttributeIDDataType)
@@ -79,7 +85,7 @@ func browse(n *opcua.Node, path string, level int) ([]nodeDef, error) {
 
 	def.Path = join(path, def.BrowseName)
 
-	return buildNodeList(def, n, level)
+	return buildNodeList(ctx, def, n, level)
 }
 
 func fillStatus(attrs []*ua.DataValue, def *nodeDef) error {
@@ -163,7 +169,7 @@ func fillDataType(attrs []*ua.DataValue, def *nodeDef) error {
 	return nil
 }
 
-func buildNodeList(def nodeDef, n *opcua.Node, level int) ([]nodeDef, error) {
+func buildNodeList(ctx context.Context, def nodeDef, n *opcua.Node, level int) ([]nodeDef, error) {
 	var nodes []nodeDef
 
 	if def.NodeClass == ua.NodeClassVariable {
@@ -178,7 +184,7 @@ func buildNodeList(def nodeDef, n *opcua.Node, level int) ([]nodeDef, error) {
 		}
 
 		for _, rn := range refs {
-			children, err := browse(rn, def.Path, level+1)
+			children, err := browse(ctx, rn, def.Path, level+1)
 			if err != nil {
 				return fmt.Errorf("browse children: %w", err)
 			}
@@ -26,13 +26,23 @@ import (
 	"github.com/gopcua/opcua"
 	"github.com/gopcua/opcua/id"
 	"github.com/gopcua/opcua/ua"
-	"github.com/stretchr/objx"
 
 	"github.com/Rightech/ric-edge/pkg/jsonrpc"
 )
 
 type Service struct {
-	cli *opcua.Client
+	cli    *opcua.Client
+	router *jsonrpc.Router
+}
+
+type nodeParams struct {
+	NodeID string `json:"node_id" rpc:"required"`
+}
+
+type writeParams struct {
+	NodeID string `json:"node_id" rpc:"required"`
+	// value could be sent as string or as json value
+	Value interface{} `json:"value" rpc:"required"`
 }
 
 func New(endpoint, encryption, mode, serverCert, serverKey string) (Service, error) {
@@ -70,28 +80,29 @@ func New(endpoint, encryption, mode, serverCert, serverKey string) (Service, err
 		return Service{}, err
 	}
 
-	return Service{c}, nil
+	s := Service{cli: c}
+
+	s.router = jsonrpc.NewRouter().
+		Handle("opcua-read", s.read).
+		Handle("opcua-write", s.write).
+		Handle("opcua-browse", s.browse)
+
+	return s, nil
 }
 
-func (s Service) Call(req jsonrpc.Request) (res interface{}, err error) {
-	switch req.Method {
-	case "opcua-read":
-		res, err = s.read(req.Params)
-	case "opcua-write":
-		res, err = s.write(req.Params)
-	case "opcua-browse":
-		res, err = s.browse(req.Params)
-		//	case "opcua-subscribe":
-		//		res, err = s.subscribe(req.Params)
-	default:
-		err = jsonrpc.ErrMethodNotFound.AddData("method", req.Method)
+func (s Service) CallContext(ctx context.Context, req jsonrpc.Request) (interface{}, error) {
+	// gopcua client doesn't accept context per request
+	// (each request limited by client request timeout)
+	// so we check request still actual before send it
+	if err := ctx.Err(); err != nil {
+		return nil, err
 	}
 
-	return
+	return s.router.CallContext(ctx, req)
 }
 
-func (s Service) read(params objx.Map) (interface{}, error) {
-	nodeID, err := ua.ParseNodeID(params.Get("node_id").Str())
+func (s Service) read(_ context.Context, p *nodeParams) (interface{}, error) {
+	nodeID, err := ua.ParseNodeID(p.NodeID)
 	if err != nil {
 		return nil, fmt.Errorf("invalid node id: %w", err)
 	}
@@ -137,8 +148,9 @@ func getType(value string, c *opcua.Client) (ua.TypeID, error) {
 	return resp.Results[0].Value.Type(), nil
 }
 
-func (s Service) write(params objx.Map) (*ua.StatusCode, error) {
-	nodeID := params.Get("node_id").Str()
+func (s Service) write(_ context.Context, p *writeParams) (interface{}, error) {
+	nodeID := p.NodeID
+	value := fmt.Sprint(p.Value)
 
 	ID, err := ua.ParseNodeID(nodeID)
 	if err != nil {
@@ -152,7 +164,7 @@ func (s Service) write(params objx.Map) (*ua.StatusCode, error) {
 
 	switch nodeType {
 	case id.Boolean:
-		input, err := strconv.ParseBool(params.Get("value").Str())
+		input, err := strconv.ParseBool(value)
 		if err != nil {
 			return nil, fmt.Errorf("invalid value: %w", err)
 		}
@@ -183,7 +195,7 @@ func (s Service) write(params objx.Map) (*ua.StatusCode, error) {
 		return &resp.Results[0], nil
 
 	case id.Int32:
-		input, err := strconv.ParseInt(params.Get("value").Str(), 10, 32)
+		input, err := strconv.ParseInt(value, 10, 32)
 		if err != nil {
 			return nil, fmt.Errorf("invalid value: %w", err)
 		}
@@ -216,7 +228,7 @@ func (s Service) write(params objx.Map) (*ua.StatusCode, error) {
 		return &resp.Results[0], nil
 
 	case id.UInt32:
-		input, err := strconv.ParseUint(params.Get("value").Str(), 10, 32)
+		input, err := strconv.ParseUint(value, 10, 32)
 		if err != nil {
 			return nil, fmt.Errorf("invalid value: %w", err)
 		}
@@ -249,7 +261,7 @@ func (s Service) write(params objx.Map) (*ua.StatusCode, error) {
 		return &resp.Results[0], nil
 
 	case id.Int64:
-		input, err := strconv.ParseInt(params.Get("value").Str(), 10, 64)
+		input, err := strconv.ParseInt(value, 10, 64)
 		if err != nil {
 			return nil, fmt.Errorf("invalid value: %w", err)
 		}
@@ -280,7 +292,7 @@ func (s Service) write(params objx.Map) (*ua.StatusCode, error) {
 		return &resp.Results[0], nil
 
 	case id.UInt64:
-		input, err := strconv.ParseUint(params.Get("value").Str(), 10, 64)
+		input, err := strconv.ParseUint(value, 10, 64)
 		if err != nil {
 			return nil, fmt.Errorf("invalid value: %w", err)
 		}
@@ -311,7 +323,7 @@ func (s Service) write(params objx.Map) (*ua.StatusCode, error) {
 		return &resp.Results[0], nil
 
 	case id.Float:
-		input, err := strconv.ParseFloat(params.Get("value").Str(), 32)
+		input, err := strconv.ParseFloat(value, 32)
 		if err != nil {
 			return nil, fmt.Errorf("invalid value: %w", err)
 		}
@@ -344,7 +356,7 @@ func (s Service) write(params objx.Map) (*ua.StatusCode, error) {
 		return &resp.Results[0], nil
 
 	case id.Double:
-		input, err := strconv.ParseFloat(params.Get("value").Str(), 64)
+		input, err := strconv.ParseFloat(value, 64)
 		if err != nil {
 			return nil, fmt.Errorf("invalid value: %w", err)
 		}
@@ -375,7 +387,7 @@ func (s Service) write(params objx.Map) (*ua.StatusCode, error) {
 		return &resp.Results[0], nil
 
 	case id.String:
-		v, err := ua.NewVariant(params.Get("value").Str())
+		v, err := ua.NewVariant(value)
 		if err != nil {
 			return nil, fmt.Errorf("invalid value: %w", err)
 		}
@@ -402,7 +414,7 @@ func (s Service) write(params objx.Map) (*ua.StatusCode, error) {
 	case id.DateTime:
 		layout := "2006-01-02 15:04:05.999999999 +0000 GMT"
 
-		t, err := time.Parse(layout, params.Get("value").Str())
+		t, err := time.Parse(layout, value)
 		if err != nil {
 			return nil, fmt.Errorf("invalid value: %w", err)
 		}
@@ -437,13 +449,13 @@ func (s Service) write(params objx.Map) (*ua.StatusCode, error) {
 	}
 }
 
-func (s Service) browse(params objx.Map) (interface{}, error) {
-	nodeID, err := ua.ParseNodeID(params.Get("node_id").Str())
+func (s Service) browse(ctx context.Context, p *nodeParams) (interface{}, error) {
+	nodeID, err := ua.ParseNodeID(p.NodeID)
 	if err != nil {
 		return nil, fmt.Errorf("invalid node id: %w", err)
 	}
 
-	nodeList, err := browse(s.cli.Node(nodeID), "", 0)
+	nodeList, err := browse(ctx, s.cli.Node(nodeID), "", 0)
 	if err != nil {
 		return nil, err
 	}
@@ -36,6 +36,7 @@ func Setup(version ...string) {
 	viper.SetDefault("snmp.priv_protocol", "")
 	viper.SetDefault("snmp.priv_key", "")
 	viper.SetDefault("snmp.security_name", "")
+	viper.SetDefault("snmp.workers", 1)
 
 	viper.Set("snmp.ws_path", "/snmp")
 }
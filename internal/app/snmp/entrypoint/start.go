@@ -22,40 +22,64 @@ import (
 
 	"github.com/spf13/viper"
 
+	"github.com/Rightech/ric-edge/internal/app/common"
 	"github.com/Rightech/ric-edge/internal/app/snmp/handler"
 	"github.com/Rightech/ric-edge/internal/pkg/ws"
 	"github.com/Rightech/ric-edge/pkg/jsonrpc"
 )
 
 func Start(done <-chan os.Signal) error {
-	hand, err := handler.New(
-		viper.GetString("snmp.host_port"),
-		viper.GetString("snmp.community"),
-		viper.GetString("snmp.version"),
-		viper.GetString("snmp.mode"),
-		viper.GetString("snmp.auth_protocol"),
-		viper.GetString("snmp.auth_key"),
-		viper.GetString("snmp.priv_protocol"),
-		viper.GetString("snmp.priv_key"),
-		viper.GetString("snmp.security_name"))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hand := common.Plugin(ctx, "snmp")
+	if hand == nil {
+		svc, err := handler.New(
+			viper.GetString("snmp.host_port"),
+			viper.GetString("snmp.community"),
+			viper.GetString("snmp.version"),
+			viper.GetString("snmp.mode"),
+			viper.GetString("snmp.auth_protocol"),
+			viper.GetString("snmp.auth_key"),
+			viper.GetString("snmp.priv_protocol"),
+			viper.GetString("snmp.priv_key"),
+			viper.GetString("snmp.security_name"),
+			viper.GetInt("snmp.workers"))
+		if err != nil {
+			return err
+		}
+
+		defer svc.Close()
+
+		hand = jsonrpc.WithContext(svc)
+	}
+
+	mw, err := common.Middleware("snmp")
 	if err != nil {
 		return err
 	}
 
+	notifications, closeNotifications, err := common.Notifications("snmp")
+	if err != nil {
+		return err
+	}
+	defer closeNotifications()
+
 	cli, err := ws.New(viper.GetInt("ws_port"), viper.GetString("version"),
 		viper.GetString("snmp.ws_path"))
 	if err != nil {
 		return err
 	}
 
-	ctx, cancel := context.WithCancel(context.Background())
-
-	go jsonrpc.ServeWithReconnect(ctx, cli, hand, jsonrpc.CatchPanic(viper.GetBool("catch_panic")))
+	go jsonrpc.ServeWithReconnect(ctx, cli, hand,
+		jsonrpc.CatchPanic(viper.GetBool("catch_panic")),
+		jsonrpc.Use(mw...),
+		notifications,
+		jsonrpc.Workers(viper.GetInt("snmp.workers")))
 
 	<-done
 	cancel()
 	cli.Close()
-	hand.Close()
 
 	return nil
 }
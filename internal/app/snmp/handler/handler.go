@@ -17,7 +17,7 @@
 package handler
 
 import (
-	"encoding/json"
+	"context"
 	"errors"
 	"fmt"
 	"strconv"
@@ -26,14 +26,16 @@ import (
 
 	log "github.com/sirupsen/logrus"
 	g "github.com/soniah/gosnmp"
-	"github.com/stretchr/objx"
 
 	"github.com/Rightech/ric-edge/pkg/jsonrpc"
 	"github.com/Rightech/ric-edge/pkg/log/logger"
 )
 
 type Service struct {
-	cli *g.GoSNMP
+	// gosnmp client can't be used concurrently
+	// so each request takes own client from pool
+	pool   chan *g.GoSNMP
+	router *jsonrpc.Router
 }
 
 func versionToVersion(version string) (g.SnmpVersion, error) {
@@ -101,7 +103,7 @@ func privprotToPrivProt(privProtocol string) (g.SnmpV3PrivProtocol, error) {
 }
 
 func New(hostPort, community, version, mode, authProtocol, authKey, privProtocol, privKey,
-	securityName string) (Service, error) {
+	securityName string, poolSize int) (Service, error) {
 	if hostPort == "" {
 		return Service{}, errors.New("snmp.new: empty host_port")
 	}
@@ -139,82 +141,109 @@ func New(hostPort, community, version, mode, authProtocol, authKey, privProtocol
 		return Service{}, err
 	}
 
-	cli := &g.GoSNMP{
-		Target:             target,
-		Port:               uint16(port),
-		Transport:          "udp",
-		Community:          community,
-		Version:            ver,
-		Timeout:            time.Duration(2) * time.Second,
-		Retries:            3,
-		ExponentialTimeout: true,
-		SecurityModel:      g.UserSecurityModel,
-		MaxOids:            g.MaxOids,
-		Logger:             logger.New("info", log.DebugLevel),
-		MsgFlags:           secMod,
-		SecurityParameters: &g.UsmSecurityParameters{UserName: securityName,
-			AuthenticationProtocol:   authProt,
-			AuthenticationPassphrase: authKey,
-			PrivacyProtocol:          privProt,
-			PrivacyPassphrase:        privKey,
-		},
+	newClient := func() *g.GoSNMP {
+		return &g.GoSNMP{
+			Target:             target,
+			Port:               uint16(port),
+			Transport:          "udp",
+			Community:          community,
+			Version:            ver,
+			Timeout:            time.Duration(2) * time.Second,
+			Retries:            3,
+			ExponentialTimeout: true,
+			SecurityModel:      g.UserSecurityModel,
+			MaxOids:            g.MaxOids,
+			Logger:             logger.New("info", log.DebugLevel),
+			MsgFlags:           secMod,
+			SecurityParameters: &g.UsmSecurityParameters{UserName: securityName,
+				AuthenticationProtocol:   authProt,
+				AuthenticationPassphrase: authKey,
+				PrivacyProtocol:          privProt,
+				PrivacyPassphrase:        privKey,
+			},
+		}
 	}
 
-	err = cli.Connect()
-	if err != nil {
-		return Service{}, err
+	if poolSize < 1 {
+		poolSize = 1
 	}
 
-	return Service{cli}, nil
-}
+	s := Service{pool: make(chan *g.GoSNMP, poolSize)}
 
-func (s Service) Call(req jsonrpc.Request) (res interface{}, err error) {
-	switch req.Method {
-	case "snmp-get":
-		res, err = s.get(req.Params)
-	case "snmp-get-next":
-		res, err = s.getNext(req.Params)
-	case "snmp-get-bulk":
-		res, err = s.getBulk(req.Params)
-	case "snmp-walk":
-		res, err = s.walk(req.Params)
-		//	case "snmp-bulk-walk":
-		//		res, err = s.bulkWalk(req.Params)
-	case "snmp-set":
-		res, err = s.set(req.Params)
-	case "snmp-send-trap":
-		res, err = s.sendTrap(req.Params)
-	default:
-		err = jsonrpc.ErrMethodNotFound.AddData("method", req.Method)
+	for i := 0; i < poolSize; i++ {
+		cli := newClient()
+
+		err = cli.Connect()
+		if err != nil {
+			s.Close()
+			return Service{}, err
+		}
+
+		s.pool <- cli
 	}
 
-	return
+	s.router = jsonrpc.NewRouter().
+		Handle("snmp-get", s.get).
+		Handle("snmp-get-next", s.getNext).
+		Handle("snmp-get-bulk", s.getBulk).
+		Handle("snmp-walk", s.walk).
+		Handle("snmp-set", s.set).
+		Handle("snmp-send-trap", s.sendTrap)
+
+	return s, nil
 }
 
-var (
-	errBadOid = jsonrpc.ErrInvalidParams.AddData(
-		"msg", "oid required and should be string array")
-)
+func (s Service) CallContext(ctx context.Context, req jsonrpc.Request) (interface{}, error) {
+	return s.router.CallContext(ctx, req)
+}
 
-func parseOids(params objx.Map) ([]string, error) {
-	val := params.Get("oids")
+// acquire takes client from pool (client should be returned by release)
+func (s Service) acquire(ctx context.Context) *g.GoSNMP {
+	cli := <-s.pool
+	// client used only by this request so we can set context to it
+	cli.Context = ctx
 
-	if !val.IsInterSlice() {
-		return nil, errBadOid
-	}
+	return cli
+}
 
-	oids := make([]string, len(val.InterSlice()))
+func (s Service) release(cli *g.GoSNMP) {
+	s.pool <- cli
+}
 
-	for i, v := range val.InterSlice() {
-		vv, ok := v.(string)
-		if !ok {
-			return nil, errBadOid
-		}
+type oidsParams struct {
+	Oids []string `json:"oids" rpc:"required"`
+}
 
-		oids[i] = vv
-	}
+type bulkParams struct {
+	oidsParams
+	NonRepeaters   uint8 `json:"non_repeaters" rpc:"required"`
+	MaxRepetitions uint8 `json:"max_repetitions" rpc:"required"`
+}
+
+type oidParams struct {
+	Oid string `json:"oid" rpc:"required"`
+}
+
+type setParams struct {
+	Oid  string `json:"oid" rpc:"required"`
+	Type uint8  `json:"type" rpc:"required,enum=2|4|6|64|65|66|67|70"`
+	// value could be sent as string or as json value
+	Value interface{} `json:"value" rpc:"required"`
+}
+
+type pduParams struct {
+	Oid   string      `json:"oid"`
+	Type  uint8       `json:"type"`
+	Value interface{} `json:"value"`
+}
 
-	return oids, nil
+type trapParams struct {
+	Enterprise   string      `json:"enterprise" rpc:"required"`
+	AgentAddress string      `json:"agent_address" rpc:"required"`
+	GenericTrap  int         `json:"generic_trap" rpc:"required"`
+	SpecificTrap int         `json:"specific_trap" rpc:"required"`
+	Timestamp    uint        `json:"timestamp" rpc:"required"`
+	Variables    []pduParams `json:"variables"`
 }
 
 func encodeDataUnit(p g.SnmpPDU) map[string]interface{} {
@@ -235,40 +264,11 @@ func encodeSnmpPacket(p *g.SnmpPacket) interface{} {
 	return result
 }
 
-const (
-	maxUint8 = int64(^uint8(0))
-	minUint8 = int64(0)
-)
-
-func getUint8(params objx.Map, k string) (uint8, error) {
-	number, ok := params.Get(k).Data().(json.Number)
-	if !ok {
-		return 0, jsonrpc.ErrInvalidParams.AddData("msg", k+" required and should be number")
-	}
-
-	var (
-		value int64
-		err   error
-	)
-
-	if value, err = number.Int64(); err != nil {
-		return 0, jsonrpc.ErrInvalidParams.AddData("msg", k+" required and should be number")
-	}
-
-	if !(minUint8 <= value && value <= maxUint8) {
-		return 0, jsonrpc.ErrInvalidParams.AddData("msg", k+" should be uint8")
-	}
-
-	return uint8(value), nil
-}
-
-func (s Service) get(params objx.Map) (interface{}, error) {
-	oids, err := parseOids(params)
-	if err != nil {
-		return nil, err
-	}
+func (s Service) get(ctx context.Context, p *oidsParams) (interface{}, error) {
+	cli := s.acquire(ctx)
+	defer s.release(cli)
 
-	res, err := s.cli.Get(oids)
+	res, err := cli.Get(p.Oids)
 	if err != nil {
 		return nil, err
 	}
@@ -276,13 +276,11 @@ func (s Service) get(params objx.Map) (interface{}, error) {
 	return encodeSnmpPacket(res), nil
 }
 
-func (s Service) getNext(params objx.Map) (interface{}, error) {
-	oids, err := parseOids(params)
-	if err != nil {
-		return nil, err
-	}
+func (s Service) getNext(ctx context.Context, p *oidsParams) (interface{}, error) {
+	cli := s.acquire(ctx)
+	defer s.release(cli)
 
-	res, err := s.cli.GetNext(oids)
+	res, err := cli.GetNext(p.Oids)
 	if err != nil {
 		return nil, err
 	}
@@ -290,23 +288,11 @@ func (s Service) getNext(params objx.Map) (interface{}, error) {
 	return encodeSnmpPacket(res), nil
 }
 
-func (s Service) getBulk(params objx.Map) (interface{}, error) {
-	oids, err := parseOids(params)
-	if err != nil {
-		return nil, err
-	}
-
-	nonRep, err := getUint8(params, "non_repeaters")
-	if err != nil {
-		return nil, err
-	}
-
-	maxRep, err := getUint8(params, "max_repetitions")
-	if err != nil {
-		return nil, err
-	}
+func (s Service) getBulk(ctx context.Context, p *bulkParams) (interface{}, error) {
+	cli := s.acquire(ctx)
+	defer s.release(cli)
 
-	res, err := s.cli.GetBulk(oids, nonRep, maxRep)
+	res, err := cli.GetBulk(p.Oids, p.NonRepeaters, p.MaxRepetitions)
 	if err != nil {
 		return nil, err
 	}
@@ -314,15 +300,13 @@ func (s Service) getBulk(params objx.Map) (interface{}, error) {
 	return encodeSnmpPacket(res), nil
 }
 
-func (s Service) walk(params objx.Map) (interface{}, error) {
-	oidV := params.Get("oid")
-	if !oidV.IsStr() {
-		return nil, jsonrpc.ErrInvalidParams.AddData("msg", "oid required and should be string")
-	}
+func (s Service) walk(ctx context.Context, p *oidParams) (interface{}, error) {
+	cli := s.acquire(ctx)
+	defer s.release(cli)
 
 	result := make([]map[string]interface{}, 0)
 
-	err := s.cli.Walk(oidV.Str(), func(dataUnit g.SnmpPDU) error {
+	err := cli.Walk(p.Oid, func(dataUnit g.SnmpPDU) error {
 		result = append(result, encodeDataUnit(dataUnit))
 		return nil
 	})
@@ -333,15 +317,13 @@ func (s Service) walk(params objx.Map) (interface{}, error) {
 	return result, nil
 }
 
-func (s Service) bulkWalk(params objx.Map) (interface{}, error) {
-	oidV := params.Get("oid")
-	if !oidV.IsStr() {
-		return nil, jsonrpc.ErrInvalidParams.AddData("msg", "oid required and should be string")
-	}
+func (s Service) bulkWalk(ctx context.Context, p *oidParams) (interface{}, error) {
+	cli := s.acquire(ctx)
+	defer s.release(cli)
 
 	result := make([]map[string]interface{}, 0)
 
-	err := s.cli.BulkWalk(oidV.Str(), func(dataUnit g.SnmpPDU) error {
+	err := cli.BulkWalk(p.Oid, func(dataUnit g.SnmpPDU) error {
 		result = append(result, encodeDataUnit(dataUnit))
 		return nil
 	})
@@ -352,33 +334,18 @@ func (s Service) bulkWalk(params objx.Map) (interface{}, error) {
 	return result, nil
 }
 
-func parsePDU(params objx.Map, k string) ([]g.SnmpPDU, error) {
-	v := params.Get(k)
-	if !v.IsObjxMapSlice() {
-		return nil, jsonrpc.ErrInvalidParams.AddData("msg", k+" should be array")
-	}
-
-	data := make([]g.SnmpPDU, len(v.ObjxMapSlice()))
-
-	for i, val := range v.ObjxMapSlice() {
-		oidV := val.Get("oid")
-		if !oidV.IsStr() {
-			return nil, jsonrpc.ErrInvalidParams.AddData("msg", "oid should be string")
-		}
-
-		typ, err := getUint8(params, "type")
-		if err != nil {
-			return nil, err
-		}
+func buildPDU(variables []pduParams) []g.SnmpPDU {
+	data := make([]g.SnmpPDU, len(variables))
 
+	for i, v := range variables {
 		data[i] = g.SnmpPDU{
-			Name:  oidV.Str(),
-			Type:  g.Asn1BER(typ),
-			Value: params.Get("value").Data(),
+			Name:  v.Oid,
+			Type:  g.Asn1BER(v.Type),
+			Value: v.Value,
 		}
 	}
 
-	return data, nil
+	return data
 }
 
 func IPtoHEX(ip string) (string, error) {
@@ -416,23 +383,18 @@ func IPtoHEX(ip string) (string, error) {
 	return h1 + h2 + h3 + h4, nil
 }
 
-func (s Service) set(params objx.Map) (interface{}, error) {
-	oidV := params.Get("oid")
-	if !oidV.IsStr() {
-		return nil, jsonrpc.ErrInvalidParams.AddData("msg", "oid required and should be string")
-	}
+func (s Service) set(ctx context.Context, p *setParams) (interface{}, error) {
+	cli := s.acquire(ctx)
+	defer s.release(cli)
 
-	typ, err := getUint8(params, "type")
-	if err != nil {
-		return nil, err
-	}
+	value := fmt.Sprint(p.Value)
 
-	switch typ {
+	switch p.Type {
 	case 4: // STRING
-		res, err := s.cli.Set([]g.SnmpPDU{{
-			Name:  oidV.Str(),
+		res, err := cli.Set([]g.SnmpPDU{{
+			Name:  p.Oid,
 			Type:  g.OctetString,
-			Value: params.Get("value").Str(),
+			Value: value,
 		}})
 		if err != nil {
 			return nil, err
@@ -441,13 +403,13 @@ func (s Service) set(params objx.Map) (interface{}, error) {
 		return encodeSnmpPacket(res), nil
 
 	case 2: // INTEGER
-		v, err := strconv.Atoi(params.Get("value").Str())
+		v, err := strconv.Atoi(value)
 		if err != nil {
 			return nil, err
 		}
 
-		res, err := s.cli.Set([]g.SnmpPDU{{
-			Name:  oidV.Str(),
+		res, err := cli.Set([]g.SnmpPDU{{
+			Name:  p.Oid,
 			Type:  g.Integer,
 			Value: v,
 		}})
@@ -458,13 +420,13 @@ func (s Service) set(params objx.Map) (interface{}, error) {
 		return encodeSnmpPacket(res), nil
 
 	case 66: // Gauge32
-		v, err := strconv.ParseUint(params.Get("value").Str(), 10, 64)
+		v, err := strconv.ParseUint(value, 10, 64)
 		if err != nil {
 			return nil, err
 		}
 
-		res, err := s.cli.Set([]g.SnmpPDU{{
-			Name:  oidV.Str(),
+		res, err := cli.Set([]g.SnmpPDU{{
+			Name:  p.Oid,
 			Type:  g.Gauge32,
 			Value: uint(v),
 		}})
@@ -475,13 +437,13 @@ func (s Service) set(params objx.Map) (interface{}, error) {
 		return encodeSnmpPacket(res), nil
 
 	case 64: // IPAddress
-		v, err := IPtoHEX(params.Get("value").Str())
+		v, err := IPtoHEX(value)
 		if err != nil {
 			return nil, err
 		}
 
-		res, err := s.cli.Set([]g.SnmpPDU{{
-			Name:  oidV.Str(),
+		res, err := cli.Set([]g.SnmpPDU{{
+			Name:  p.Oid,
 			Type:  g.IPAddress,
 			Value: v,
 		}})
@@ -491,10 +453,10 @@ func (s Service) set(params objx.Map) (interface{}, error) {
 
 		return encodeSnmpPacket(res), nil
 	case 6: // OID
-		res, err := s.cli.Set([]g.SnmpPDU{{
-			Name:  oidV.Str(),
+		res, err := cli.Set([]g.SnmpPDU{{
+			Name:  p.Oid,
 			Type:  g.ObjectIdentifier,
-			Value: params.Get("value").Str(),
+			Value: value,
 		}})
 		if err != nil {
 			return nil, err
@@ -503,13 +465,13 @@ func (s Service) set(params objx.Map) (interface{}, error) {
 		return encodeSnmpPacket(res), nil
 
 	case 67: // Timeticks
-		v, err := strconv.ParseUint(params.Get("value").Str(), 10, 32)
+		v, err := strconv.ParseUint(value, 10, 32)
 		if err != nil {
 			return nil, err
 		}
 
-		res, err := s.cli.Set([]g.SnmpPDU{{
-			Name:  oidV.Str(),
+		res, err := cli.Set([]g.SnmpPDU{{
+			Name:  p.Oid,
 			Type:  g.TimeTicks,
 			Value: uint32(v),
 		}})
@@ -520,13 +482,13 @@ func (s Service) set(params objx.Map) (interface{}, error) {
 		return encodeSnmpPacket(res), nil
 
 	case 65: // Counter32
-		v, err := strconv.ParseUint(params.Get("value").Str(), 10, 64)
+		v, err := strconv.ParseUint(value, 10, 64)
 		if err != nil {
 			return nil, err
 		}
 
-		res, err := s.cli.Set([]g.SnmpPDU{{
-			Name:  oidV.Str(),
+		res, err := cli.Set([]g.SnmpPDU{{
+			Name:  p.Oid,
 			Type:  g.Counter32,
 			Value: uint(v),
 		}})
@@ -537,13 +499,13 @@ func (s Service) set(params objx.Map) (interface{}, error) {
 		return encodeSnmpPacket(res), nil
 
 	case 70: // Counter64
-		v, err := strconv.ParseUint(params.Get("value").Str(), 10, 64)
+		v, err := strconv.ParseUint(value, 10, 64)
 		if err != nil {
 			return nil, err
 		}
 
-		res, err := s.cli.Set([]g.SnmpPDU{{
-			Name:  oidV.Str(),
+		res, err := cli.Set([]g.SnmpPDU{{
+			Name:  p.Oid,
 			Type:  g.Counter64,
 			Value: v,
 		}})
@@ -558,67 +520,20 @@ func (s Service) set(params objx.Map) (interface{}, error) {
 	}
 }
 
-func (s Service) sendTrap(params objx.Map) (interface{}, error) { // nolint: funlen
-	var trap g.SnmpTrap
-
-	enterprise := params.Get("enterprise")
-	if !enterprise.IsStr() {
-		return nil, jsonrpc.ErrInvalidParams.AddData("msg", "enterprise should be string")
-	}
-
-	trap.Enterprise = enterprise.Str()
-
-	agentAddr := params.Get("agent_address")
-	if !agentAddr.IsStr() {
-		return nil, jsonrpc.ErrInvalidParams.AddData("msg", "agent_address should be string")
-	}
-
-	trap.AgentAddress = agentAddr.Str()
+func (s Service) sendTrap(ctx context.Context, p *trapParams) (interface{}, error) {
+	cli := s.acquire(ctx)
+	defer s.release(cli)
 
-	genericTrap, ok := params.Get("generic_trap").Data().(json.Number)
-	if !ok {
-		return nil, jsonrpc.ErrInvalidParams.AddData("msg", "generic_trap should be number")
+	trap := g.SnmpTrap{
+		Enterprise:   p.Enterprise,
+		AgentAddress: p.AgentAddress,
+		GenericTrap:  p.GenericTrap,
+		SpecificTrap: p.SpecificTrap,
+		Timestamp:    p.Timestamp,
+		Variables:    buildPDU(p.Variables),
 	}
 
-	gt, err := genericTrap.Int64()
-	if err != nil {
-		return nil, jsonrpc.ErrInvalidParams.AddData("msg", "generic_trap should be number")
-	}
-
-	trap.GenericTrap = int(gt)
-
-	specificTrap, ok := params.Get("specific_trap").Data().(json.Number)
-	if !ok {
-		return nil, jsonrpc.ErrInvalidParams.AddData("msg", "specific_trap should be number")
-	}
-
-	st, err := specificTrap.Int64()
-	if err != nil {
-		return nil, jsonrpc.ErrInvalidParams.AddData("msg", "specific_trap should be number")
-	}
-
-	trap.SpecificTrap = int(st)
-
-	timestamp, ok := params.Get("timestamp").Data().(json.Number)
-	if !ok {
-		return nil, jsonrpc.ErrInvalidParams.AddData("msg", "timestamp should be number")
-	}
-
-	ts, err := timestamp.Int64()
-	if err != nil {
-		return nil, jsonrpc.ErrInvalidParams.AddData("msg", "timestamp should be number")
-	}
-
-	trap.Timestamp = uint(ts)
-
-	pdus, err := parsePDU(params, "variables")
-	if err != nil {
-		return nil, err
-	}
-
-	trap.Variables = pdus
-
-	res, err := s.cli.SendTrap(trap)
+	res, err := cli.SendTrap(trap)
 	if err != nil {
 		return nil, err
 	}
@@ -627,5 +542,14 @@ func (s Service) sendTrap(params objx.Map) (interface{}, error) { // nolint: fun
 }
 
 func (s Service) Close() error {
-	return s.cli.Conn.Close()
+	var err error
+
+	for len(s.pool) > 0 {
+		cli := <-s.pool
+		if e := cli.Conn.Close(); e != nil {
+			err = e
+		}
+	}
+
+	return err
 }
@@ -25,6 +25,10 @@ import (
 	"github.com/Rightech/ric-edge/pkg/log/formatter"
 )
 
+// WSPortEnv is environment variable which overrides ws_port
+// (core passes its port to connectors started by it)
+const WSPortEnv = "RIC_EDGE_WS_PORT"
+
 func Init(version []string) {
 	cfgPath := flag.String("config", "config.toml", "path to configuration file")
 	flag.Parse()
@@ -42,6 +46,7 @@ func Init(version []string) {
 	viper.SetDefault("log_level", "info")
 	viper.SetDefault("log_format", "text")
 	viper.SetDefault("ws_port", 9000)
+	viper.BindEnv("ws_port", WSPortEnv) // nolint: errcheck
 	viper.SetDefault("check_updates", true)
 	viper.SetDefault("auto_download_updates", false)
 	viper.SetDefault("catch_panic", true)
@@ -0,0 +1,692 @@
+/**
+ * Copyright 2021 Rightech IoT. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package broker implements lightweight MQTT 3.1.1 broker embedded in core
+//
+// Sessions are always clean, QoS 2 is downgraded to QoS 1 for subscribers,
+// messages are not retried (connection is reliable enough for local clients).
+// Each client has bounded send queue, client which doesn't keep up is disconnected.
+package broker
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/eclipse/paho.mqtt.golang/packets"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/Rightech/ric-edge/pkg/nanoid"
+)
+
+// Config of broker
+type Config struct {
+	// listener address, e.g. 127.0.0.1:1883
+	Addr string
+	// tls listener if both set
+	CertFile string
+	KeyFile  string
+	// username -> password
+	Users map[string]string
+	// AllowAnonymous allows clients without username
+	AllowAnonymous bool
+	// passwords over plain tcp are rejected unless allowed
+	AllowInsecure bool
+	// ACL rules, everything is allowed if empty
+	ACL []Rule
+	// SendQueue is how many messages can wait sending to client (DefaultSendQueue if 0)
+	SendQueue int
+}
+
+// DefaultSendQueue is default size of client send queue
+const DefaultSendQueue = 1000
+
+// Rule allows user to read (subscribe) or write (publish) topics matched by filter
+type Rule struct {
+	// username, * means any user (including anonymous)
+	User string
+	// topic filter (+ and # wildcards supported)
+	Topic string
+	// read, write or readwrite
+	Access string
+}
+
+func (r Rule) allows(user, topic, access string) bool {
+	return (r.User == "*" || r.User == user) &&
+		strings.Contains(r.Access, access) && match(r.Topic, topic)
+}
+
+// Handler is called when client publishes message matched by handler filter
+// (it's called from client read loop, so it must not block)
+type Handler func(client string, msg *Message)
+
+type route struct {
+	filter  string
+	handler Handler
+}
+
+type Broker struct {
+	c        Config
+	ln       net.Listener
+	mx       sync.RWMutex
+	clients  map[string]*client
+	retained map[string]*packets.PublishPacket
+	routes   []route
+}
+
+const (
+	connectTimeout = 10 * time.Second
+	writeTimeout   = 10 * time.Second
+)
+
+// New starts broker listener
+func New(c Config) (*Broker, error) {
+	var (
+		ln  net.Listener
+		err error
+	)
+
+	if len(c.Users) > 0 && !c.secure() && !c.AllowInsecure {
+		return nil, errors.New("mqtt broker: passwords without tls not allowed (set allow_insecure)")
+	}
+
+	if c.secure() {
+		var cert tls.Certificate
+
+		cert, err = tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+
+		ln, err = tls.Listen("tcp", c.Addr, &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			MinVersion:   tls.VersionTLS12,
+		})
+	} else {
+		ln, err = net.Listen("tcp", c.Addr)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if c.SendQueue <= 0 {
+		c.SendQueue = DefaultSendQueue
+	}
+
+	b := &Broker{
+		c: c, ln: ln,
+		clients:  make(map[string]*client),
+		retained: make(map[string]*packets.PublishPacket),
+	}
+
+	go b.accept()
+
+	log.WithField("addr", c.Addr).Info("mqtt broker ready")
+
+	return b, nil
+}
+
+// secure reports whether listener is tls
+func (c Config) secure() bool {
+	return c.CertFile != "" && c.KeyFile != ""
+}
+
+// Handle registers handler of messages published by clients
+func (b *Broker) Handle(filter string, h Handler) {
+	b.mx.Lock()
+	b.routes = append(b.routes, route{filter, h})
+	b.mx.Unlock()
+}
+
+// Publish sends message to subscribers (handlers are not called)
+func (b *Broker) Publish(topic string, payload []byte, retained bool) {
+	pub := packets.NewControlPacket(packets.Publish).(*packets.PublishPacket)
+	pub.TopicName = topic
+	pub.Payload = payload
+	pub.Qos = 1
+	pub.Retain = retained
+
+	b.deliver(pub)
+}
+
+func (b *Broker) Close() {
+	b.ln.Close()
+
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	for _, c := range b.clients {
+		c.conn.Close()
+	}
+}
+
+func (b *Broker) accept() {
+	for {
+		conn, err := b.ln.Accept()
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				time.Sleep(100 * time.Millisecond)
+				continue
+			}
+
+			return
+		}
+
+		go b.serve(conn)
+	}
+}
+
+func (b *Broker) allowed(user, topic, access string) bool {
+	if len(b.c.ACL) == 0 {
+		return true
+	}
+
+	for _, r := range b.c.ACL {
+		if r.allows(user, topic, access) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (b *Broker) auth(cp *packets.ConnectPacket) byte {
+	if cp.Username == "" {
+		if b.c.AllowAnonymous {
+			return packets.Accepted
+		}
+
+		return packets.ErrRefusedNotAuthorised
+	}
+
+	// password is sent as plain text without tls
+	if !b.c.secure() && !b.c.AllowInsecure {
+		return packets.ErrRefusedNotAuthorised
+	}
+
+	pass, ok := b.c.Users[cp.Username]
+	if !ok || subtle.ConstantTimeCompare([]byte(pass), cp.Password) != 1 {
+		return packets.ErrRefusedBadUsernameOrPassword
+	}
+
+	return packets.Accepted
+}
+
+func (b *Broker) serve(conn net.Conn) {
+	defer conn.Close()
+
+	_ = conn.SetReadDeadline(time.Now().Add(connectTimeout))
+
+	p, err := packets.ReadPacket(conn)
+	if err != nil {
+		return
+	}
+
+	cp, ok := p.(*packets.ConnectPacket)
+	if !ok {
+		return
+	}
+
+	ack := packets.NewControlPacket(packets.Connack).(*packets.ConnackPacket)
+
+	ack.ReturnCode = cp.Validate()
+	if ack.ReturnCode == packets.Accepted {
+		ack.ReturnCode = b.auth(cp)
+	}
+
+	logger := log.WithFields(log.Fields{
+		"client": cp.ClientIdentifier,
+		"user":   cp.Username,
+		"remote": conn.RemoteAddr().String(),
+	})
+
+	if ack.ReturnCode != packets.Accepted {
+		logger.WithField("code", ack.ReturnCode).Warn("mqtt broker: connection refused")
+
+		_ = ack.Write(conn)
+
+		return
+	}
+
+	if cp.ClientIdentifier == "" {
+		cp.ClientIdentifier = nanoid.New()
+	}
+
+	c := &client{
+		id: cp.ClientIdentifier, user: cp.Username, conn: conn,
+		keepalive: time.Duration(cp.Keepalive) * time.Second,
+		subs:      make(map[string]byte),
+		qos2:      make(map[uint16]struct{}),
+		out:       make(chan *packets.PublishPacket, b.c.SendQueue),
+		done:      make(chan struct{}),
+	}
+
+	if cp.WillFlag {
+		c.will = packets.NewControlPacket(packets.Publish).(*packets.PublishPacket)
+		c.will.TopicName = cp.WillTopic
+		c.will.Payload = cp.WillMessage
+		c.will.Qos = cp.WillQos
+		c.will.Retain = cp.WillRetain
+	}
+
+	b.mx.Lock()
+	if old, ok := b.clients[c.id]; ok {
+		// client takeover
+		old.conn.Close()
+	}
+
+	b.clients[c.id] = c
+	b.mx.Unlock()
+
+	if err := c.write(ack); err != nil {
+		b.remove(c)
+		return
+	}
+
+	logger.Debug("mqtt broker: client connected")
+
+	go c.writer()
+
+	err = b.loop(c)
+
+	logger.WithError(err).Debug("mqtt broker: client disconnected")
+
+	b.remove(c)
+	close(c.done)
+
+	if c.will != nil {
+		b.publish(c, c.will)
+	}
+}
+
+func (b *Broker) remove(c *client) {
+	b.mx.Lock()
+	if b.clients[c.id] == c {
+		delete(b.clients, c.id)
+	}
+	b.mx.Unlock()
+}
+
+func (b *Broker) loop(c *client) error { // nolint: gocyclo
+	for {
+		if c.keepalive > 0 {
+			_ = c.conn.SetReadDeadline(time.Now().Add(c.keepalive * 3 / 2))
+		} else {
+			_ = c.conn.SetReadDeadline(time.Time{})
+		}
+
+		p, err := packets.ReadPacket(c.conn)
+		if err != nil {
+			return err
+		}
+
+		switch p := p.(type) {
+		case *packets.PublishPacket:
+			err = b.received(c, p)
+		case *packets.PubrelPacket:
+			delete(c.qos2, p.MessageID)
+
+			ack := packets.NewControlPacket(packets.Pubcomp).(*packets.PubcompPacket)
+			ack.MessageID = p.MessageID
+			err = c.write(ack)
+		case *packets.SubscribePacket:
+			err = b.subscribe(c, p)
+		case *packets.UnsubscribePacket:
+			b.mx.Lock()
+			for _, t := range p.Topics {
+				delete(c.subs, t)
+			}
+			b.mx.Unlock()
+
+			ack := packets.NewControlPacket(packets.Unsuback).(*packets.UnsubackPacket)
+			ack.MessageID = p.MessageID
+			err = c.write(ack)
+		case *packets.PingreqPacket:
+			err = c.write(packets.NewControlPacket(packets.Pingresp))
+		case *packets.DisconnectPacket:
+			c.will = nil
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// received handles message published by client
+// QoS 2 message is delivered on first PUBLISH, its id is kept until PUBREL
+// so retransmitted PUBLISH is only acknowledged
+func (b *Broker) received(c *client, p *packets.PublishPacket) error {
+	switch p.Qos {
+	case 1:
+		b.publish(c, p)
+
+		ack := packets.NewControlPacket(packets.Puback).(*packets.PubackPacket)
+		ack.MessageID = p.MessageID
+
+		return c.write(ack)
+	case 2:
+		if _, ok := c.qos2[p.MessageID]; !ok {
+			c.qos2[p.MessageID] = struct{}{}
+
+			b.publish(c, p)
+		}
+
+		ack := packets.NewControlPacket(packets.Pubrec).(*packets.PubrecPacket)
+		ack.MessageID = p.MessageID
+
+		return c.write(ack)
+	default:
+		b.publish(c, p)
+	}
+
+	return nil
+}
+
+// publish delivers client message if it's allowed
+// (not allowed message is dropped, MQTT 3.1.1 has no way to tell client)
+func (b *Broker) publish(c *client, p *packets.PublishPacket) {
+	if strings.ContainsAny(p.TopicName, "+#") || !b.allowed(c.user, p.TopicName, "write") {
+		log.WithFields(log.Fields{
+			"client": c.id,
+			"user":   c.user,
+			"topic":  p.TopicName,
+		}).Warn("mqtt broker: publish not allowed")
+
+		return
+	}
+
+	b.deliver(p)
+
+	msg := &Message{topic: p.TopicName, payload: p.Payload, qos: p.Qos, retained: p.Retain}
+
+	b.mx.RLock()
+	routes := b.routes
+	b.mx.RUnlock()
+
+	// handlers are called in order of messages and must not block
+	// (lock is released as handler may publish)
+	for _, r := range routes {
+		if match(r.filter, p.TopicName) {
+			r.handler(c.id, msg)
+		}
+	}
+}
+
+func (b *Broker) subscribe(c *client, p *packets.SubscribePacket) error {
+	ack := packets.NewControlPacket(packets.Suback).(*packets.SubackPacket)
+	ack.MessageID = p.MessageID
+
+	b.mx.Lock()
+
+	for i, t := range p.Topics {
+		qos := p.Qoss[i]
+		if qos > 1 {
+			qos = 1
+		}
+
+		if !valid(t) {
+			qos = 0x80
+		} else {
+			c.subs[t] = qos
+		}
+
+		ack.ReturnCodes = append(ack.ReturnCodes, qos)
+	}
+
+	var retained []*packets.PublishPacket
+
+	for topic, r := range b.retained {
+		for _, t := range p.Topics {
+			if match(t, topic) && b.allowed(c.user, topic, "read") {
+				retained = append(retained, r)
+				break
+			}
+		}
+	}
+
+	b.mx.Unlock()
+
+	err := c.write(ack)
+	if err != nil {
+		return err
+	}
+
+	// client read loop waits while retained messages are queued
+	for _, r := range retained {
+		c.send(r, true, true)
+	}
+
+	return nil
+}
+
+// deliver sends message to subscribers and keeps it if it's retained
+func (b *Broker) deliver(p *packets.PublishPacket) {
+	b.mx.Lock()
+
+	if p.Retain {
+		if len(p.Payload) == 0 {
+			delete(b.retained, p.TopicName)
+		} else {
+			b.retained[p.TopicName] = p
+		}
+	}
+
+	type target struct {
+		c   *client
+		qos byte
+	}
+
+	targets := make([]target, 0)
+
+	for _, c := range b.clients {
+		qos, ok := c.granted(p.TopicName)
+		if !ok || !b.allowed(c.user, p.TopicName, "read") {
+			continue
+		}
+
+		if p.Qos < qos {
+			qos = p.Qos
+		}
+
+		targets = append(targets, target{c, qos})
+	}
+
+	b.mx.Unlock()
+
+	for _, t := range targets {
+		pub := *p
+		pub.Qos = t.qos
+		// retain flag is kept only for retained messages sent on subscribe
+		t.c.send(&pub, false, false)
+	}
+}
+
+type client struct {
+	id        string
+	user      string
+	conn      net.Conn
+	keepalive time.Duration
+	will      *packets.PublishPacket
+	// filter -> qos (guarded by Broker.mx)
+	subs map[string]byte
+	// ids of received QoS 2 messages waiting PUBREL (used by read loop only)
+	qos2 map[uint16]struct{}
+
+	wmx sync.Mutex
+	// messages waiting writer, done is closed when client is removed
+	out      chan *packets.PublishPacket
+	done     chan struct{}
+	overflow sync.Once
+	// last message id (used by writer only)
+	id16 uint16
+}
+
+// granted returns max qos of subscriptions matched topic (Broker.mx should be locked)
+func (c *client) granted(topic string) (byte, bool) {
+	var (
+		qos byte
+		ok  bool
+	)
+
+	for f, q := range c.subs {
+		if match(f, topic) {
+			ok = true
+
+			if q > qos {
+				qos = q
+			}
+		}
+	}
+
+	return qos, ok
+}
+
+func (c *client) write(p packets.ControlPacket) error {
+	c.wmx.Lock()
+	defer c.wmx.Unlock()
+
+	_ = c.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+
+	return p.Write(c.conn)
+}
+
+// send queues message to client, client which queue is full is disconnected
+// (wait blocks until message is queued, it's used by client own goroutine only)
+func (c *client) send(p *packets.PublishPacket, retain, wait bool) {
+	pub := *p
+	pub.Retain = retain
+	pub.Dup = false
+
+	if pub.Qos > 1 {
+		pub.Qos = 1
+	}
+
+	if wait {
+		select {
+		case c.out <- &pub:
+		case <-c.done:
+		}
+
+		return
+	}
+
+	select {
+	case c.out <- &pub:
+	default:
+		c.overflow.Do(func() {
+			log.WithFields(log.Fields{
+				"client": c.id,
+				"user":   c.user,
+			}).Warn("mqtt broker: send queue is full, client disconnected")
+
+			c.conn.Close()
+		})
+	}
+}
+
+// writer sends queued messages until client is removed
+func (c *client) writer() {
+	for {
+		var pub *packets.PublishPacket
+
+		select {
+		case <-c.done:
+			return
+		case pub = <-c.out:
+		}
+
+		if pub.Qos > 0 {
+			c.id16++
+			if c.id16 == 0 {
+				c.id16 = 1
+			}
+
+			pub.MessageID = c.id16
+		}
+
+		if err := c.write(pub); err != nil {
+			c.conn.Close()
+			return
+		}
+	}
+}
+
+// Message published by client, it implements paho.Message
+type Message struct {
+	topic    string
+	payload  []byte
+	qos      byte
+	retained bool
+}
+
+func (m *Message) Duplicate() bool   { return false }
+func (m *Message) Qos() byte         { return m.qos }
+func (m *Message) Retained() bool    { return m.retained }
+func (m *Message) Topic() string     { return m.topic }
+func (m *Message) MessageID() uint16 { return 0 }
+func (m *Message) Payload() []byte   { return m.payload }
+func (m *Message) Ack()              {}
+
+// valid checks topic filter wildcards
+func valid(filter string) bool {
+	if filter == "" {
+		return false
+	}
+
+	levels := strings.Split(filter, "/")
+
+	for i, l := range levels {
+		if strings.Contains(l, "#") && (l != "#" || i != len(levels)-1) {
+			return false
+		}
+
+		if strings.Contains(l, "+") && l != "+" {
+			return false
+		}
+	}
+
+	return true
+}
+
+// match checks topic matches filter with + and # wildcards
+func match(filter, topic string) bool {
+	f := strings.Split(filter, "/")
+	t := strings.Split(topic, "/")
+
+	// wildcards don't match topics started with $
+	if strings.HasPrefix(topic, "$") && (f[0] == "+" || f[0] == "#") {
+		return false
+	}
+
+	for i, level := range f {
+		if level == "#" {
+			return true
+		}
+
+		if i >= len(t) || (level != "+" && level != t[i]) {
+			return false
+		}
+	}
+
+	return len(f) == len(t)
+}
@@ -0,0 +1,300 @@
+/**
+ * Copyright 2021 Rightech IoT. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package broker
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+)
+
+const testTimeout = 5 * time.Second
+
+func newTestBroker(t *testing.T, c Config) *Broker {
+	t.Helper()
+
+	c.Addr = "127.0.0.1:0"
+
+	b, err := New(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return b
+}
+
+func connect(b *Broker, o *paho.ClientOptions) (paho.Client, error) {
+	o.AddBroker("tcp://" + b.ln.Addr().String())
+	o.SetAutoReconnect(false)
+	o.SetConnectTimeout(testTimeout)
+	o.SetProtocolVersion(4)
+
+	cli := paho.NewClient(o)
+
+	token := cli.Connect()
+	if !waitToken(token) {
+		return nil, errors.New("connect timeout")
+	}
+
+	return cli, token.Error()
+}
+
+func mustConnect(t *testing.T, b *Broker, id string) paho.Client {
+	t.Helper()
+
+	cli, err := connect(b, paho.NewClientOptions().SetClientID(id))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return cli
+}
+
+// waitToken waits token for testTimeout
+// (paho WaitTimeout holds token lock, so token with error can't complete while it waits)
+func waitToken(token paho.Token) bool {
+	done := make(chan struct{})
+
+	go func() {
+		token.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(testTimeout):
+		return false
+	}
+}
+
+func wait(t *testing.T, token paho.Token) {
+	t.Helper()
+
+	if !waitToken(token) {
+		t.Fatal("token timeout")
+	}
+
+	if token.Error() != nil {
+		t.Fatal(token.Error())
+	}
+}
+
+func TestConnectAuth(t *testing.T) {
+	_, err := New(Config{Addr: "127.0.0.1:0", Users: map[string]string{"u": "p"}})
+	if err == nil {
+		t.Fatal("passwords without tls are allowed")
+	}
+
+	b := newTestBroker(t, Config{Users: map[string]string{"u": "p"}, AllowInsecure: true})
+	defer b.Close()
+
+	cases := []struct {
+		user, pass string
+		ok         bool
+	}{
+		{"", "", false},
+		{"u", "bad", false},
+		{"x", "p", false},
+		{"u", "p", true},
+	}
+
+	for _, c := range cases {
+		cli, err := connect(b, paho.NewClientOptions().SetClientID("auth").
+			SetUsername(c.user).SetPassword(c.pass))
+		if (err == nil) != c.ok {
+			t.Errorf("user %q password %q: connected %v, want %v (%v)", c.user, c.pass, err == nil, c.ok, err)
+		}
+
+		if err == nil {
+			cli.Disconnect(0)
+		}
+	}
+}
+
+func TestACLDeny(t *testing.T) {
+	b := newTestBroker(t, Config{AllowAnonymous: true, ACL: []Rule{
+		{User: "*", Topic: "pub/#", Access: "write"},
+		{User: "*", Topic: "sub/#", Access: "read"},
+		{User: "*", Topic: "both/#", Access: "readwrite"},
+	}})
+	defer b.Close()
+
+	got := make(chan string, 10)
+
+	sub := mustConnect(t, b, "sub")
+	defer sub.Disconnect(0)
+
+	wait(t, sub.Subscribe("#", 1, func(_ paho.Client, m paho.Message) { got <- m.Topic() }))
+
+	pub := mustConnect(t, b, "pub")
+	defer pub.Disconnect(0)
+
+	// not writable, not readable by subscriber, allowed (messages are delivered in order)
+	for _, topic := range []string{"sub/x", "pub/x", "both/x"} {
+		wait(t, pub.Publish(topic, 1, false, "v"))
+	}
+
+	select {
+	case topic := <-got:
+		if topic != "both/x" {
+			t.Fatalf("got %s, want both/x", topic)
+		}
+	case <-time.After(testTimeout):
+		t.Fatal("allowed message not received")
+	}
+}
+
+func TestRetainedOnSubscribe(t *testing.T) {
+	b := newTestBroker(t, Config{AllowAnonymous: true})
+	defer b.Close()
+
+	b.Publish("r/1", []byte("a"), true)
+	b.Publish("r/2", []byte("b"), true)
+	b.Publish("r/2", nil, true) // clears retained message
+	b.Publish("other", []byte("c"), true)
+
+	got := make(chan paho.Message, 10)
+
+	cli := mustConnect(t, b, "retained")
+	defer cli.Disconnect(0)
+
+	wait(t, cli.Subscribe("r/+", 1, func(_ paho.Client, m paho.Message) { got <- m }))
+
+	// retained messages are queued before suback is handled, so end marker is the last
+	b.Publish("r/end", []byte("x"), false)
+
+	want := []struct {
+		topic    string
+		retained bool
+	}{{"r/1", true}, {"r/end", false}}
+
+	for _, w := range want {
+		select {
+		case m := <-got:
+			if m.Topic() != w.topic || m.Retained() != w.retained {
+				t.Fatalf("got %s (retained %v), want %s (retained %v)", m.Topic(), m.Retained(), w.topic, w.retained)
+			}
+		case <-time.After(testTimeout):
+			t.Fatalf("%s not received", w.topic)
+		}
+	}
+}
+
+func TestTakeover(t *testing.T) {
+	b := newTestBroker(t, Config{AllowAnonymous: true})
+	defer b.Close()
+
+	lost := make(chan struct{}, 1)
+
+	first, err := connect(b, paho.NewClientOptions().SetClientID("same").
+		SetConnectionLostHandler(func(paho.Client, error) { lost <- struct{}{} }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.Disconnect(0)
+
+	second := mustConnect(t, b, "same")
+	defer second.Disconnect(0)
+
+	select {
+	case <-lost:
+	case <-time.After(testTimeout):
+		t.Fatal("first client is not disconnected")
+	}
+
+	wait(t, second.Publish("t", 1, false, "v"))
+}
+
+func TestQoS1Ack(t *testing.T) {
+	b := newTestBroker(t, Config{AllowAnonymous: true})
+	defer b.Close()
+
+	got := make(chan *Message, 10)
+
+	b.Handle("cmd/+", func(client string, msg *Message) {
+		if client == "qos1" {
+			got <- msg
+		}
+	})
+
+	cli := mustConnect(t, b, "qos1")
+	defer cli.Disconnect(0)
+
+	payloads := []string{"1", "2", "3"}
+
+	for _, p := range payloads {
+		// token completes on PUBACK
+		wait(t, cli.Publish("cmd/a", 1, false, p))
+	}
+
+	// handler is called in order of messages
+	for _, p := range payloads {
+		select {
+		case m := <-got:
+			if m.Topic() != "cmd/a" || m.Qos() != 1 || !bytes.Equal(m.Payload(), []byte(p)) {
+				t.Fatalf("got %s %d %s, want cmd/a 1 %s", m.Topic(), m.Qos(), m.Payload(), p)
+			}
+		case <-time.After(testTimeout):
+			t.Fatalf("message %s is not handled", p)
+		}
+	}
+}
+
+func TestQueueOverflow(t *testing.T) {
+	b := newTestBroker(t, Config{AllowAnonymous: true, SendQueue: 1})
+	defer b.Close()
+
+	release := make(chan struct{})
+	defer close(release)
+
+	// client stops reading while handler is blocked
+	// (it isn't disconnected at the end as its goroutines are blocked too)
+	cli, err := connect(b, paho.NewClientOptions().SetClientID("slow").SetKeepAlive(0).SetOrderMatters(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wait(t, cli.Subscribe("big/#", 0, func(paho.Client, paho.Message) { <-release }))
+
+	payload := make([]byte, 64*1024)
+
+	for i := 0; i < 500; i++ {
+		b.Publish("big/x", payload, false)
+	}
+
+	deadline := time.Now().Add(testTimeout)
+
+	for {
+		b.mx.RLock()
+		_, ok := b.clients["slow"]
+		b.mx.RUnlock()
+
+		if !ok {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatal("slow client is not disconnected")
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
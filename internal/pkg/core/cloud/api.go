@@ -19,27 +19,65 @@ package cloud
 import (
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
 
 	jsoniter "github.com/json-iterator/go"
+	log "github.com/sirupsen/logrus"
 )
 
+// Config of cloud api client
+type Config struct {
+	URL string
+	// Token is access token, TokenFile is used instead if set
+	// (file is read again when it's changed)
+	Token     string
+	TokenFile string
+	Version   string
+	// Proxy is http(s) proxy url (HTTP_PROXY and HTTPS_PROXY environment variables are used if empty)
+	Proxy string
+	// CAFile is additional CA bundle
+	CAFile string
+	// Timeout of one attempt
+	Timeout time.Duration
+	// Retries is max retries of failed request (network error, 408, 429 or 5xx status)
+	Retries    int
+	BackoffMin time.Duration
+	BackoffMax time.Duration
+}
+
 type Service struct {
 	baseURL url
 	client  client
 }
 
-func New(baseURL, token, v string) (Service, error) {
-	if baseURL == "" {
+// New returns cloud api client
+// unreachable cloud is only logged, requests are retried later
+func New(c Config) (Service, error) {
+	if c.URL == "" {
 		return Service{}, errors.New("cloud: empty url")
 	}
 
-	s := Service{client: newClient(token, v), baseURL: newURL(baseURL)}
+	cli, err := newClient(c)
+	if err != nil {
+		return Service{}, err
+	}
+
+	s := Service{client: cli, baseURL: newURL(c.URL)}
 
-	return s, s.ping()
+	if err := s.ping(); err != nil {
+		log.WithError(err).Warn("cloud: api is unreachable")
+	}
+
+	return s, nil
 }
 
+// ping checks cloud is reachable (without retries)
 func (s Service) ping() error {
 	resp, err := s.client.head(s.baseURL.Self())
 	if err != nil {
@@ -51,17 +89,55 @@ func (s Service) ping() error {
 	return nil
 }
 
+// statusError is error of not successful response
+type statusError struct {
+	code int
+	msg  string
+}
+
+func (e statusError) Error() string {
+	status := strconv.Itoa(e.code) + " " + http.StatusText(e.code)
+	if e.msg == "" {
+		return "bad status " + status
+	}
+
+	return e.msg + " (status " + status + ")"
+}
+
+const (
+	// maxErrorBody limits error body read to find message
+	maxErrorBody = 64 << 10
+	// maxErrorMessage limits message used in error
+	maxErrorMessage = 512
+)
+
 func errIfBadStatus(resp *http.Response) error {
 	if resp.StatusCode == http.StatusOK {
 		return nil
 	}
 
-	data, err := ioutil.ReadAll(resp.Body)
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
 	if err != nil {
 		return err
 	}
 
-	return errors.New(jsoniter.ConfigFastest.Get(data, "message").ToString())
+	msg := jsoniter.ConfigFastest.Get(data, "message").ToString()
+
+	// plain text body is message too (e.g. proxy error)
+	if msg == "" && strings.HasPrefix(resp.Header.Get("Content-Type"), "text/plain") {
+		msg = strings.TrimSpace(string(data))
+	}
+
+	if len(msg) > maxErrorMessage {
+		n := maxErrorMessage
+		for n > 0 && !utf8.RuneStart(msg[n]) {
+			n--
+		}
+
+		msg = msg[:n] + "..."
+	}
+
+	return statusError{code: resp.StatusCode, msg: msg}
 }
 
 func (s Service) LoadModel(id string) (m Model, err error) {
@@ -17,23 +17,140 @@
 package cloud
 
 import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
 	"net/http"
+	neturl "net/url"
+	"os"
+	"strconv"
+	"sync"
 	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/Rightech/ric-edge/pkg/backoff"
 )
 
-const defaultRequestTimeout = 15 * time.Second
+const (
+	defaultRequestTimeout = 15 * time.Second
+	defaultBackoffMin     = time.Second
+	defaultBackoffMax     = 30 * time.Second
+)
 
 type client struct {
 	http.Client
-	token, userAgent string
+	token     *token
+	userAgent string
+	retries   int
+	min, max  time.Duration
+}
+
+// token is access token from config or token file
+// file is read again when it's changed
+type token struct {
+	mx      sync.Mutex
+	value   string
+	path    string
+	modTime time.Time
+	size    int64
 }
 
-func newClient(token, version string) client {
+func (t *token) get() (string, error) {
+	t.mx.Lock()
+	defer t.mx.Unlock()
+
+	if t.path == "" {
+		return t.value, nil
+	}
+
+	fi, err := os.Stat(t.path)
+	if err != nil {
+		return "", fmt.Errorf("cloud: token file: %w", err)
+	}
+
+	if fi.ModTime().Equal(t.modTime) && fi.Size() == t.size && t.value != "" {
+		return t.value, nil
+	}
+
+	data, err := ioutil.ReadFile(t.path)
+	if err != nil {
+		return "", fmt.Errorf("cloud: token file: %w", err)
+	}
+
+	value := string(bytes.TrimSpace(data))
+	if value == "" {
+		return "", errors.New("cloud: token file is empty")
+	}
+
+	if t.value != "" && t.value != value {
+		log.WithField("path", t.path).Info("cloud: token reloaded")
+	}
+
+	t.value, t.modTime, t.size = value, fi.ModTime(), fi.Size()
+
+	return value, nil
+}
+
+func newClient(c Config) (client, error) {
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+
+	if c.Proxy != "" {
+		u, err := neturl.Parse(c.Proxy)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return client{}, errors.New("cloud: proxy should be http(s)://host:port")
+		}
+
+		tr.Proxy = http.ProxyURL(u)
+	}
+
+	if c.CAFile != "" {
+		pem, err := ioutil.ReadFile(c.CAFile)
+		if err != nil {
+			return client{}, fmt.Errorf("cloud: %w", err)
+		}
+
+		// custom CA is added to system pool, so public cloud is still trusted
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+
+		if !pool.AppendCertsFromPEM(pem) {
+			return client{}, errors.New("cloud: no certificates in " + c.CAFile)
+		}
+
+		tr.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	}
+
+	if c.Timeout <= 0 {
+		c.Timeout = defaultRequestTimeout
+	}
+
+	if c.BackoffMin <= 0 {
+		c.BackoffMin = defaultBackoffMin
+	}
+
+	if c.BackoffMax <= 0 {
+		c.BackoffMax = defaultBackoffMax
+	}
+
 	cli := http.Client{
-		Timeout: defaultRequestTimeout,
+		Timeout:   c.Timeout,
+		Transport: tr,
 	}
 
-	return client{cli, token, "ric-edge/" + version}
+	return client{
+		Client:    cli,
+		token:     &token{value: c.Token, path: c.TokenFile},
+		userAgent: "ric-edge/" + c.Version,
+		retries:   c.Retries,
+		min:       c.BackoffMin,
+		max:       c.BackoffMax,
+	}, nil
 }
 
 func (c *client) head(url string) (*http.Response, error) {
@@ -42,7 +159,7 @@ func (c *client) head(url string) (*http.Response, error) {
 		return nil, err
 	}
 
-	return c.Do(req)
+	return c.send(req)
 }
 
 func (c *client) Get(url string) (*http.Response, error) {
@@ -54,9 +171,75 @@ func (c *client) Get(url string) (*http.Response, error) {
 	return c.Do(req)
 }
 
+// Do sends request with retries on network error, 408, 429 and 5xx status
+// (requests should be without body)
 func (c *client) Do(req *http.Request) (*http.Response, error) {
-	req.Header.Set("Authorization", "Bearer "+c.token)
+	b := backoff.New(c.min, c.max)
+
+	for attempt := 0; ; attempt++ {
+		resp, err := c.send(req)
+		if attempt >= c.retries || !temporary(resp, err) {
+			return resp, err
+		}
+
+		delay := b.Next()
+
+		if resp != nil {
+			if after := retryAfter(resp); after > 0 && after < c.max {
+				delay = after
+			}
+
+			resp.Body.Close()
+		}
+
+		log.WithFields(log.Fields{
+			"url":     req.URL.Path,
+			"attempt": attempt + 1,
+			"delay":   delay.String(),
+		}).WithError(requestError(resp, err)).Warn("cloud: request failed, retrying")
+
+		time.Sleep(delay)
+	}
+}
+
+func (c *client) send(req *http.Request) (*http.Response, error) {
+	tok, err := c.token.get()
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+tok)
 	req.Header.Set("User-Agent", c.userAgent)
 
 	return c.Client.Do(req)
 }
+
+func temporary(resp *http.Response, err error) bool {
+	if err != nil {
+		// token file errors are not retried
+		var ue *neturl.Error
+		return errors.As(err, &ue)
+	}
+
+	return resp.StatusCode == http.StatusRequestTimeout ||
+		resp.StatusCode == http.StatusTooManyRequests ||
+		resp.StatusCode >= http.StatusInternalServerError
+}
+
+// retryAfter returns delay from Retry-After header in seconds
+func retryAfter(resp *http.Response) time.Duration {
+	sec, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || sec < 0 {
+		return 0
+	}
+
+	return time.Duration(sec) * time.Second
+}
+
+func requestError(resp *http.Response, err error) error {
+	if err != nil {
+		return err
+	}
+
+	return statusError{code: resp.StatusCode}
+}
@@ -39,6 +39,7 @@ type Children struct {
 	Name     string
 	Type     string
 	DataType string
+	Unit     string
 	Active   bool
 	Edge     struct {
 		Read struct {
@@ -48,7 +49,8 @@ type Children struct {
 			Expr     string
 		}
 		Write struct {
-			Expr string
+			Command string
+			Expr    string
 		}
 	}
 	Command  string
@@ -63,6 +65,8 @@ type Model struct {
 	}
 	actions map[string]ActionConfig
 	expr    map[string]string
+	units   map[string]string
+	params  []Param
 }
 
 func (m Model) Actions() map[string]ActionConfig {
@@ -73,6 +77,50 @@ func (m Model) Expressions() map[string]string {
 	return m.expr
 }
 
+// Units returns units of parameters by id (parameters without unit skipped)
+func (m Model) Units() map[string]string {
+	return m.units
+}
+
+// Params returns model parameters in model order
+func (m Model) Params() []Param {
+	return m.params
+}
+
+// Param is model parameter
+type Param struct {
+	ID       string
+	Name     string
+	DataType string
+	Unit     string
+	// Connector is subsystem of parameter (empty for parameters without subsystem)
+	Connector string
+	// Write is jsonrpc request to write parameter (nil if parameter is not writable)
+	// value should be set to params.value
+	Write []byte
+}
+
+// WriteRequest returns jsonrpc request which writes value to parameter
+// (value is set to params.value, params._type is write and params._parent is parameter id)
+func (p Param) WriteRequest(value interface{}) ([]byte, error) {
+	if p.Write == nil {
+		return nil, errors.New("cloud: parameter " + p.ID + " is not writable")
+	}
+
+	var req objx.Map
+
+	err := jsoniter.ConfigFastest.Unmarshal(p.Write, &req)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Set("params.value", value)
+	req.Set("params._type", "write")
+	req.Set("params._parent", p.ID)
+
+	return jsoniter.ConfigFastest.Marshal(req)
+}
+
 type command struct {
 	Command string
 	Params  map[string]interface{}
@@ -89,13 +137,20 @@ type ActionConfig struct {
 func (m *Model) prepare() error {
 	m.actions = make(map[string]ActionConfig)
 	m.expr = make(map[string]string)
+	m.units = make(map[string]string)
 
 	commands := make(map[string]Children)
 	actionCommand := make(map[string]command)
+	writeCommand := make(map[string]command)
+
+	m.walk(nil, commands, actionCommand, writeCommand, m.Data.Children)
 
-	m.walk(nil, commands, actionCommand, m.Data.Children)
+	err := m.afterWalk(commands, actionCommand)
+	if err != nil {
+		return err
+	}
 
-	return m.afterWalk(commands, actionCommand)
+	return m.fillWrites(commands, writeCommand)
 }
 
 type params struct {
@@ -169,8 +224,59 @@ func (m *Model) afterWalk(commands map[string]Children, acmd map[string]command)
 	return nil
 }
 
+// fillWrites prepares write requests of parameters with write command
+func (m *Model) fillWrites(commands map[string]Children, wcmd map[string]command) error {
+	for i, p := range m.params {
+		cmd, ok := wcmd[p.ID]
+		if !ok {
+			continue
+		}
+
+		vv, ok := commands[cmd.Command]
+		if !ok {
+			return errors.New("prepare: write command not found in commands")
+		}
+
+		payload, ok := vv.Params["payload"].(string)
+		if !ok {
+			return errors.New("prepare: payload should be string")
+		}
+
+		data := make(map[string]interface{}, len(cmd.Params)+2)
+		for k, v := range cmd.Params {
+			data[k] = v
+		}
+
+		data["node.parent.id"] = p.ID
+
+		// value is set on write
+		if _, ok := data["value"]; !ok {
+			data["value"] = nil
+		}
+
+		res, err := fillPayload(payload, data)
+		if err != nil {
+			return err
+		}
+
+		m.params[i].Write = res
+	}
+
+	return nil
+}
+
+func childCommand(c Children, id string) (command, bool) {
+	for _, cc := range c.Children {
+		if cc.ID == id {
+			return command{Command: cc.Command, Params: cc.Params}, true
+		}
+	}
+
+	return command{}, false
+}
+
 func (m *Model) walk(path []string, commands map[string]Children,
-	acmd map[string]command, children []Children) {
+	acmd, wcmd map[string]command, children []Children) { // nolint: funlen
 	for _, c := range children {
 		if !c.Active {
 			continue
@@ -189,6 +295,10 @@ func (m *Model) walk(path []string, commands map[string]Children,
 			continue
 		}
 
+		if c.Unit != "" {
+			m.units[c.ID] = c.Unit
+		}
+
 		if c.Edge.Read.Expr != "" {
 			m.expr["read."+c.ID] = c.Edge.Read.Expr
 		}
@@ -197,6 +307,23 @@ func (m *Model) walk(path []string, commands map[string]Children,
 			m.expr["write."+c.ID] = c.Edge.Write.Expr
 		}
 
+		// parameter is node with read or write command or without children
+		if c.Type != "subsystem" &&
+			(c.Edge.Read.Command != "" || c.Edge.Write.Command != "" || len(c.Children) == 0) {
+			p := Param{ID: c.ID, Name: c.Name, DataType: c.DataType, Unit: c.Unit}
+			if len(path) > 0 {
+				p.Connector = path[len(path)-1]
+			}
+
+			m.params = append(m.params, p)
+
+			if c.Edge.Write.Command != "" {
+				if cmd, ok := childCommand(c, c.Edge.Write.Command); ok {
+					wcmd[c.ID] = cmd
+				}
+			}
+		}
+
 		if c.Edge.Read.Command != "" {
 			ac := ActionConfig{
 				ID:        c.ID,
@@ -219,7 +346,12 @@ func (m *Model) walk(path []string, commands map[string]Children,
 			continue
 		}
 
-		m.walk(path, commands, acmd, c.Children)
+		// children of write only parameter are its commands
+		if c.Edge.Write.Command != "" {
+			continue
+		}
+
+		m.walk(path, commands, acmd, wcmd, c.Children)
 		n := len(path) - 1
 
 		if n > -1 {
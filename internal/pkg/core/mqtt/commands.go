@@ -0,0 +1,176 @@
+/**
+ * Copyright 2021 Rightech IoT. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mqtt
+
+import (
+	"sync"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+)
+
+// Commands configures processing of commands from command topic
+type Commands struct {
+	// Workers is how many commands are processed in parallel
+	Workers int
+	// Queue is how many commands can wait for worker
+	Queue int
+	// Ordered processes commands of one connector one by one in arrival order
+	Ordered bool
+	// InFlight limits commands of one connector processed or waiting (0 means no limit)
+	InFlight int
+}
+
+type command struct {
+	connector string
+	msg       paho.Message
+	// sparkplug NCMD or DCMD (connector is DCMD device)
+	sparkplug bool
+}
+
+// dispatcher processes commands by bounded pool of workers
+// command which exceeds limits is rejected with busy error
+type dispatcher struct {
+	mx       sync.Mutex
+	c        Commands
+	jobs     chan command
+	closed   bool
+	queued   int
+	inflight map[string]int
+	// ordered mode: connectors processed by worker and their waiting commands
+	active  map[string]bool
+	waiting map[string][]command
+	handle  func(command)
+}
+
+func newDispatcher(c Commands, handle func(command)) *dispatcher {
+	if c.Workers <= 0 {
+		c.Workers = 1
+	}
+
+	if c.Queue <= 0 {
+		c.Queue = 1
+	}
+
+	d := &dispatcher{
+		c:        c,
+		jobs:     make(chan command, c.Queue),
+		inflight: make(map[string]int),
+		active:   make(map[string]bool),
+		waiting:  make(map[string][]command),
+		handle:   handle,
+	}
+
+	for i := 0; i < c.Workers; i++ {
+		go d.worker()
+	}
+
+	return d
+}
+
+// submit returns false if command is rejected
+func (d *dispatcher) submit(cmd command) bool {
+	d.mx.Lock()
+	defer d.mx.Unlock()
+
+	if d.closed || d.queued >= d.c.Queue {
+		return false
+	}
+
+	if d.c.InFlight > 0 && d.inflight[cmd.connector] >= d.c.InFlight {
+		return false
+	}
+
+	if d.c.Ordered && d.active[cmd.connector] {
+		d.waiting[cmd.connector] = append(d.waiting[cmd.connector], cmd)
+	} else {
+		select {
+		case d.jobs <- cmd:
+		default:
+			return false
+		}
+
+		if d.c.Ordered {
+			d.active[cmd.connector] = true
+		}
+	}
+
+	d.queued++
+	d.inflight[cmd.connector]++
+
+	return true
+}
+
+func (d *dispatcher) worker() {
+	for cmd := range d.jobs {
+		d.mx.Lock()
+		d.queued--
+		d.mx.Unlock()
+
+		for {
+			d.handle(cmd)
+
+			var ok bool
+
+			cmd, ok = d.done(cmd.connector)
+			if !ok {
+				break
+			}
+		}
+	}
+}
+
+// done releases connector and returns its next waiting command (ordered mode)
+// worker processes it itself to keep order
+func (d *dispatcher) done(connector string) (command, bool) {
+	d.mx.Lock()
+	defer d.mx.Unlock()
+
+	d.inflight[connector]--
+	if d.inflight[connector] <= 0 {
+		delete(d.inflight, connector)
+	}
+
+	if !d.c.Ordered {
+		return command{}, false
+	}
+
+	w := d.waiting[connector]
+	if len(w) == 0 {
+		delete(d.active, connector)
+		return command{}, false
+	}
+
+	if len(w) == 1 {
+		delete(d.waiting, connector)
+	} else {
+		d.waiting[connector] = w[1:]
+	}
+
+	d.queued--
+
+	return w[0], true
+}
+
+func (d *dispatcher) close() {
+	d.mx.Lock()
+	defer d.mx.Unlock()
+
+	if !d.closed {
+		d.closed = true
+		close(d.jobs)
+	}
+}
@@ -0,0 +1,113 @@
+/**
+ * Copyright 2021 Rightech IoT. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mqtt
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+)
+
+// seqMessage is command message with sequence number
+type seqMessage struct {
+	paho.Message
+	n int
+}
+
+func TestDispatcherOrdered(t *testing.T) {
+	var (
+		mx  sync.Mutex
+		got []int
+	)
+
+	release := make(chan struct{})
+	done := make(chan struct{}, 5)
+
+	d := newDispatcher(Commands{Workers: 4, Queue: 10, Ordered: true}, func(cmd command) {
+		<-release
+
+		mx.Lock()
+		got = append(got, cmd.msg.(seqMessage).n)
+		mx.Unlock()
+
+		done <- struct{}{}
+	})
+	defer d.close()
+
+	for i := 0; i < 5; i++ {
+		if !d.submit(command{connector: "a", msg: seqMessage{n: i}}) {
+			t.Fatalf("command %d rejected", i)
+		}
+	}
+
+	close(release)
+
+	for i := 0; i < 5; i++ {
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("commands not processed")
+		}
+	}
+
+	for i, n := range got {
+		if n != i {
+			t.Fatalf("commands of connector should be processed in order, got %v", got)
+		}
+	}
+}
+
+func TestDispatcherLimits(t *testing.T) {
+	cases := []struct {
+		name string
+		c    Commands
+		// connectors of submitted commands while the first one is processed
+		connectors []string
+		accepted   []bool
+	}{
+		{"queue", Commands{Workers: 1, Queue: 2}, []string{"a", "b", "c"}, []bool{true, true, false}},
+		{"in flight", Commands{Workers: 1, Queue: 10, InFlight: 2}, []string{"a", "a", "b"}, []bool{true, false, true}},
+		{"ordered", Commands{Workers: 1, Queue: 2, Ordered: true}, []string{"a", "a", "a"}, []bool{true, true, false}},
+	}
+
+	for _, c := range cases {
+		started := make(chan struct{}, 10)
+		release := make(chan struct{})
+
+		d := newDispatcher(c.c, func(command) {
+			started <- struct{}{}
+			<-release
+		})
+
+		if !d.submit(command{connector: "a"}) {
+			t.Fatalf("%s: first command rejected", c.name)
+		}
+
+		<-started
+
+		for i, conn := range c.connectors {
+			if ok := d.submit(command{connector: conn}); ok != c.accepted[i] {
+				t.Errorf("%s: command %d to %s: want accepted %v got %v", c.name, i, conn, c.accepted[i], ok)
+			}
+		}
+
+		close(release)
+		d.close()
+	}
+}
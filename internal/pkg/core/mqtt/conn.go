@@ -0,0 +1,176 @@
+/**
+ * Copyright 2021 Rightech IoT. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mqtt
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/Rightech/ric-edge/pkg/backoff"
+)
+
+var errSubscribeTimeout = errors.New("mqtt: subscribe timeout")
+
+// ConnState is state of broker connection
+type ConnState string
+
+const (
+	ConnConnecting   ConnState = "connecting"
+	ConnConnected    ConnState = "connected"
+	ConnReconnecting ConnState = "reconnecting"
+	ConnDisconnected ConnState = "disconnected"
+)
+
+// Stats of broker connection
+type Stats struct {
+	State ConnState `json:"state"`
+	// how many times connection was restored after loss
+	Reconnects uint64 `json:"reconnects"`
+	// outgoing messages not acknowledged by broker yet
+	Queued    int    `json:"queued"`
+	LastError string `json:"last_error,omitempty"`
+	// when connection moved to current state
+	Since time.Time `json:"since"`
+}
+
+type queued interface {
+	Queued() int
+}
+
+// conn tracks broker connection state
+type conn struct {
+	mx        sync.Mutex
+	stats     Stats
+	connected bool // connected at least once
+	store     queued
+	onChange  func(Stats)
+}
+
+func newConn(store queued, onChange func(Stats)) *conn {
+	return &conn{
+		stats:    Stats{State: ConnConnecting, Since: time.Now()},
+		store:    store,
+		onChange: onChange,
+	}
+}
+
+// set moves connection to new state and returns true if it is reconnect
+func (c *conn) set(st ConnState, err error) bool {
+	c.mx.Lock()
+
+	reconnect := st == ConnConnected && c.connected
+	if reconnect {
+		c.stats.Reconnects++
+	}
+
+	if st == ConnConnected {
+		c.connected = true
+	}
+
+	c.stats.State = st
+	c.stats.Since = time.Now()
+
+	if err != nil {
+		c.stats.LastError = err.Error()
+	}
+
+	c.mx.Unlock()
+
+	stats := c.Stats()
+
+	entry := log.WithFields(log.Fields{
+		"state":      stats.State,
+		"reconnects": stats.Reconnects,
+		"queued":     stats.Queued,
+	})
+
+	if err != nil {
+		entry.WithError(err).Warn("mqtt connection")
+	} else {
+		entry.Info("mqtt connection")
+	}
+
+	if c.onChange != nil {
+		c.onChange(stats)
+	}
+
+	return reconnect
+}
+
+func (c *conn) Stats() Stats {
+	c.mx.Lock()
+	stats := c.stats
+	c.mx.Unlock()
+
+	stats.Queued = c.store.Queued()
+
+	return stats
+}
+
+// Stats returns broker connection state and counters
+func (s Service) Stats() Stats {
+	return s.conn.Stats()
+}
+
+// subscribe subscribes to command topics
+func (s Service) subscribe(cli paho.Client) error {
+	handlers := map[string]paho.MessageHandler{s.topics.command: s.rpcCallback}
+
+	if s.spb != nil {
+		for _, topic := range s.spb.subscriptions() {
+			handlers[topic] = s.spbCallback
+		}
+	}
+
+	for topic, h := range handlers {
+		err := errSubscribeTimeout
+
+		token := cli.Subscribe(topic, qos, h)
+		if token.WaitTimeout(time.Minute) {
+			err = token.Error()
+		}
+
+		if err != nil {
+			return fmt.Errorf("subscribe %s: %w", topic, err)
+		}
+	}
+
+	return nil
+}
+
+// resubscribe makes sure command subscriptions exist after reconnect
+// (broker could lose session or failover broker could not have it)
+func (s Service) resubscribe(cli paho.Client) {
+	b := backoff.New(time.Second, time.Minute)
+
+	for cli.IsConnected() {
+		err := s.subscribe(cli)
+		if err == nil {
+			log.Debug("mqtt command subscriptions restored")
+			return
+		}
+
+		log.WithError(err).Error("err subscribe command topic")
+
+		time.Sleep(b.Next())
+	}
+}
@@ -0,0 +1,145 @@
+/**
+ * Copyright 2021 Rightech IoT. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mqtt
+
+import (
+	"errors"
+	"sync"
+
+	jsoniter "github.com/json-iterator/go"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/Rightech/ric-edge/internal/pkg/core/broker"
+	"github.com/Rightech/ric-edge/pkg/jsonrpc"
+	"github.com/Rightech/ric-edge/pkg/store/state"
+)
+
+// Local mirrors state and command topics to embedded broker
+// so local clients can work while cloud broker is unreachable
+//
+// topics, state mode and commands limits are the same as of cloud broker
+// (state is always published as json)
+type Local struct {
+	b      *broker.Broker
+	rpc    rpc
+	topics topics
+	mode   StateMode
+	meta   bool
+	cmds   *dispatcher
+	status status
+
+	mx sync.Mutex
+	// last cloud broker stats (nil until cloud connection state is known)
+	stats *Stats
+}
+
+// NewLocal starts mirroring of state changes from in to broker b
+func NewLocal(b *broker.Broker, c Config, cli rpc, in <-chan state.Change) (*Local, error) {
+	topics, err := c.Topics.compile(c.ClientID)
+	if err != nil {
+		return nil, err
+	}
+
+	switch c.StateMode {
+	case "":
+		c.StateMode = StateAggregate
+	case StateAggregate, StateParam, StateBoth:
+	default:
+		return nil, errors.New("mqtt: unknown state mode " + string(c.StateMode))
+	}
+
+	l := &Local{
+		b: b, rpc: cli, topics: topics, mode: c.StateMode, meta: c.StateMeta,
+		status: status{
+			topic: topics.status, edge: c.ClientID, version: c.Version, connectors: c.Connectors,
+			processes: c.Processes, dropped: c.Dropped,
+		},
+	}
+	l.cmds = newDispatcher(c.Commands, l.handleCommand)
+
+	b.Handle(topics.command, l.rpcCallback)
+
+	go l.publishListener(in)
+
+	return l, nil
+}
+
+func (l *Local) publishListener(in <-chan state.Change) {
+	for c := range in {
+		for _, m := range stateMessages(l.topics, l.mode, l.meta, c) {
+			l.b.Publish(m.topic, m.payload, m.retained)
+		}
+	}
+}
+
+func (l *Local) rpcCallback(client string, msg *broker.Message) {
+	cmd := command{connector: l.topics.connector(msg.Topic()), msg: msg}
+
+	log.WithFields(log.Fields{
+		"client":    client,
+		"connector": cmd.connector,
+	}).Debug("local mqtt command")
+
+	if !l.cmds.submit(cmd) {
+		log.WithFields(log.Fields{
+			"client":    client,
+			"connector": cmd.connector,
+			"request":   string(msg.Payload()),
+		}).Warn("local mqtt command rejected: busy")
+
+		l.respond(cmd, jsonrpc.BuildErrResp(jsoniter.ConfigFastest.Get(msg.Payload(), "id").ToString(), errBusy))
+	}
+}
+
+func (l *Local) handleCommand(cmd command) {
+	l.respond(cmd, l.rpc.Call(cmd.connector, cmd.msg.Payload()))
+}
+
+// respond doesn't wait (broker queues message for each client),
+// so it's also used for busy reply inside broker handler
+func (l *Local) respond(cmd command, resp []byte) {
+	l.b.Publish(l.topics.responseTopic(cmd.connector), resp, false)
+}
+
+// PublishStatus publishes retained edge status with cloud broker connection stats
+// (it's cloud Config.OnConnState, so local clients see when cloud broker is unreachable)
+func (l *Local) PublishStatus(stats Stats) {
+	l.mx.Lock()
+	l.stats = &stats
+	l.mx.Unlock()
+
+	l.RefreshStatus()
+}
+
+// RefreshStatus publishes retained edge status with current connectors
+// and last cloud broker stats (it should be called when connector connected or disconnected)
+func (l *Local) RefreshStatus() {
+	st := l.status
+
+	l.mx.Lock()
+	if l.stats != nil {
+		stats := *l.stats
+		st.stats = func() Stats { return stats }
+	}
+	l.mx.Unlock()
+
+	l.b.Publish(st.topic, st.payload(statusOnline), true)
+}
+
+func (l *Local) Close() {
+	l.cmds.close()
+}
@@ -17,23 +17,95 @@
 package mqtt
 
 import (
-	"crypto/tls"
+	"errors"
 	"fmt"
 	"net/url"
-	"strings"
 	"time"
 
 	paho "github.com/eclipse/paho.mqtt.golang"
+	jsoniter "github.com/json-iterator/go"
 	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/objx"
 
+	"github.com/Rightech/ric-edge/internal/pkg/core/supervisor"
+	"github.com/Rightech/ric-edge/internal/pkg/core/ws"
+	"github.com/Rightech/ric-edge/pkg/backoff"
+	"github.com/Rightech/ric-edge/pkg/jsonrpc"
 	"github.com/Rightech/ric-edge/pkg/log/logger"
+	"github.com/Rightech/ric-edge/pkg/mqtt5"
+	"github.com/Rightech/ric-edge/pkg/sparkplug"
 	"github.com/Rightech/ric-edge/pkg/store/mqtt"
+	"github.com/Rightech/ric-edge/pkg/store/state"
 )
 
 type Service struct {
 	cli    paho.Client
 	rpc    rpc
-	toSend <-chan []byte
+	toSend <-chan state.Change
+	topics topics
+	mode   StateMode
+	meta   bool
+	status status
+	conn   *conn
+	cmds   *dispatcher
+	// nil if format is json
+	spb  *sparkplugNode
+	stop chan struct{}
+}
+
+// StateMode defines how state is published
+type StateMode string
+
+const (
+	// StateAggregate publishes document with changed parameter to state topic
+	StateAggregate StateMode = "aggregate"
+	// StateParam publishes each parameter to own retained topic
+	StateParam StateMode = "param"
+	// StateBoth publishes both
+	StateBoth StateMode = "both"
+)
+
+// Config of mqtt service
+type Config struct {
+	// brokers urls in failover order
+	URLs []string
+	// edge id used as client id
+	ClientID string
+	Security Security
+	Topics   Topics
+	// empty mode means StateAggregate
+	StateMode StateMode
+	// StateMeta adds unit and timestamp to parameter payload (StateParam only)
+	StateMeta bool
+	// core version, connected connectors and connector processes are published in birth message
+	Version    string
+	Connectors func() []ws.ConnectorInfo
+	Processes  func() []supervisor.Status
+	// count of state changes dropped by lossy state outputs (published in birth message)
+	Dropped func() map[string]uint64
+
+	ConnectTimeout time.Duration
+	KeepAlive      time.Duration
+	PingTimeout    time.Duration
+	// delays between connect attempts (max is also used for reconnects)
+	BackoffMin time.Duration
+	BackoffMax time.Duration
+	// how many times brokers list is tried on start (0 means until success)
+	ConnectAttempts int
+	// OnConnState is called when broker connection state changed
+	OnConnState func(Stats)
+	// birth message is republished with current stats every StatusInterval (0 disables, json format only)
+	StatusInterval time.Duration
+
+	// 4 (MQTT 3.1.1, default) or 5
+	// with MQTT 5 command response topic, correlation data, user properties and expiry are honoured
+	ProtocolVersion uint
+
+	Commands Commands
+
+	// empty format means FormatJSON
+	Format    Format
+	Sparkplug Sparkplug
 }
 
 type SendPayload struct {
@@ -42,113 +114,335 @@ type SendPayload struct {
 }
 
 const (
-	requestTopic  = "ric-edge/+/command" // + - connector type
-	responseTopic = "ric-edge/%s/response"
-	stateTopic    = "ric-edge/sys/state"
-	qos           = 1
+	qos = 1
 )
 
 type rpc interface {
 	Call(string, []byte) []byte
 }
 
-func prepareURL(u *url.URL, tls bool) *url.URL {
-	if u.Host == "" {
-		u.Host = u.Scheme + ":" + u.Opaque
-		u.Opaque = ""
+func New(c Config, db mqtt.DB, cli rpc, sCh <-chan state.Change) (Service, error) {
+	if len(c.URLs) == 0 {
+		return Service{}, errors.New("mqtt: no broker url")
 	}
 
-	if tls {
-		u.Scheme = "tls"
-	} else {
-		u.Scheme = "tcp"
+	topics, err := c.Topics.compile(c.ClientID)
+	if err != nil {
+		return Service{}, err
 	}
 
-	return u
-}
+	switch c.StateMode {
+	case "":
+		c.StateMode = StateAggregate
+	case StateAggregate, StateParam, StateBoth:
+	default:
+		return Service{}, errors.New("mqtt: unknown state mode " + string(c.StateMode))
+	}
 
-func setupTLS(o *paho.ClientOptions, cert, key string) (*paho.ClientOptions, bool, error) {
-	if cert == "" || key == "" {
-		return o, false, nil
+	store := mqtt.NewStore(db)
+
+	var spb *sparkplugNode
+
+	switch c.Format {
+	case "", FormatJSON:
+	case FormatSparkplug:
+		spb = newSparkplug(c, db, cli)
+	default:
+		return Service{}, errors.New("mqtt: unknown format " + string(c.Format))
+	}
+
+	s := Service{
+		rpc: cli, toSend: sCh, topics: topics, mode: c.StateMode, meta: c.StateMeta,
+		conn: newConn(store, c.OnConnState), spb: spb, stop: make(chan struct{}),
+	}
+
+	s.status = status{
+		topic: topics.status, edge: c.ClientID, version: c.Version, connectors: c.Connectors,
+		processes: c.Processes, dropped: c.Dropped,
+		stats: s.Stats,
 	}
 
-	pair, err := tls.LoadX509KeyPair(cert, key)
+	paho.CRITICAL = logger.New("critical", log.ErrorLevel)
+	paho.ERROR = logger.New("error", log.DebugLevel)
+	paho.WARN = logger.New("warn", log.DebugLevel)
+
+	opts, err := s.options(c, store)
 	if err != nil {
-		return nil, false, err
+		return Service{}, err
 	}
 
-	o = o.SetTLSConfig(&tls.Config{
-		Certificates:       []tls.Certificate{pair},
-		InsecureSkipVerify: true,
-	})
+	var newClient func(*paho.ClientOptions) paho.Client
 
-	log.Debug("mqtt tls enabled")
+	switch c.ProtocolVersion {
+	case 0, 4:
+		newClient = func(o *paho.ClientOptions) paho.Client { return paho.NewClient(o) }
+	case 5:
+		newClient = func(o *paho.ClientOptions) paho.Client { return mqtt5.NewClient(o) }
+	default:
+		return Service{}, fmt.Errorf("mqtt: unsupported protocol version %d", c.ProtocolVersion)
+	}
 
-	return o, true, nil
-}
+	if spb != nil {
+		s.cli = &spbClient{newClient: func() paho.Client {
+			will, err := spb.nextSession()
+			if err != nil {
+				log.WithError(err).Error("err store sparkplug bdSeq")
+			} else {
+				opts.SetBinaryWill(spb.topic(sparkplug.NDEATH, ""), will, qos, false)
+			}
+
+			return newClient(opts)
+		}}
+	} else {
+		s.cli = newClient(opts)
+	}
+
+	s.cmds = newDispatcher(c.Commands, s.handleCommand)
 
-func New(u, clientID, cert, key string, db mqtt.DB, cli rpc, sCh <-chan []byte) (Service, error) {
-	parsedURL, err := url.Parse(u)
+	err = s.connect(c)
 	if err != nil {
 		return Service{}, err
 	}
 
-	paho.CRITICAL = logger.New("critical", log.ErrorLevel)
-	paho.ERROR = logger.New("error", log.DebugLevel)
-	paho.WARN = logger.New("warn", log.DebugLevel)
+	err = s.subscribe(s.cli)
+	if err != nil {
+		return Service{}, err
+	}
+
+	go s.publishListener()
+
+	if c.StatusInterval > 0 && s.spb == nil {
+		go s.republish(c.StatusInterval)
+	}
+
+	log.Info("mqtt ready")
+
+	return s, nil
+}
 
+func (s *Service) options(c Config, store mqtt.Service) (*paho.ClientOptions, error) {
 	opts := paho.NewClientOptions().
-		SetClientID(clientID).
+		SetClientID(c.ClientID).
 		SetAutoReconnect(true).
-		SetStore(mqtt.NewStore(db)).
+		SetStore(store).
 		SetCleanSession(false).
-		SetKeepAlive(5 * time.Second).
-		SetOrderMatters(false)
+		SetKeepAlive(c.KeepAlive).
+		// callbacks don't block (commands are processed by workers)
+		// so messages can be delivered in order for ordered commands
+		SetOrderMatters(c.Commands.Ordered)
 
-	opts, enabled, err := setupTLS(opts, cert, key)
-	if err != nil {
-		return Service{}, err
+	if c.ConnectTimeout > 0 {
+		opts.SetConnectTimeout(c.ConnectTimeout)
 	}
 
-	parsedURL = prepareURL(parsedURL, enabled)
+	if c.PingTimeout > 0 {
+		opts.SetPingTimeout(c.PingTimeout)
+	}
 
-	opts = opts.AddBroker(parsedURL.String())
+	if c.BackoffMax > 0 {
+		opts.SetMaxReconnectInterval(c.BackoffMax)
+	}
 
-	client := paho.NewClient(opts)
+	// sparkplug will is set before each connect (it has bdSeq of session)
+	if s.spb == nil {
+		opts.SetBinaryWill(s.topics.status, s.status.payload(statusOffline), qos, true)
+	} else {
+		opts.SetAutoReconnect(false)
+	}
 
-	token := client.Connect()
-	if token.Wait() && token.Error() != nil {
-		return Service{}, token.Error()
+	opts.SetOnConnectHandler(s.onConnect)
+	opts.SetConnectionLostHandler(func(_ paho.Client, err error) {
+		s.conn.set(ConnReconnecting, err)
+
+		if s.spb != nil {
+			go s.reconnect(c)
+		}
+	})
+
+	for _, raw := range c.URLs {
+		u, err := url.Parse(raw)
+		if err != nil {
+			return nil, err
+		}
+
+		u, err = prepareURL(u, c.Security.CertFile != "")
+		if err != nil {
+			return nil, err
+		}
+
+		err = setupSecurity(opts, u, c.ClientID, c.Security)
+		if err != nil {
+			return nil, err
+		}
+
+		opts.AddBroker(u.String())
 	}
 
-	s := Service{client, cli, sCh}
+	return opts, nil
+}
+
+// connect tries brokers in order until connected or attempts are over
+func (s Service) connect(c Config) error {
+	b := backoff.New(c.BackoffMin, c.BackoffMax)
 
-	token = client.Subscribe(requestTopic, qos, s.rpcCallback)
-	if token.Wait() && token.Error() != nil {
-		return Service{}, token.Error()
+	for i := 1; ; i++ {
+		token := s.cli.Connect()
+		if token.Wait() && token.Error() == nil {
+			return nil
+		}
+
+		s.conn.set(ConnDisconnected, token.Error())
+
+		if c.ConnectAttempts > 0 && i >= c.ConnectAttempts {
+			return token.Error()
+		}
+
+		time.Sleep(b.Next())
 	}
+}
 
-	go s.publishListener()
+// reconnect connects sparkplug client (with new session) after connection is lost
+func (s *Service) reconnect(c Config) {
+	b := backoff.New(c.BackoffMin, c.BackoffMax)
 
-	log.Info("mqtt ready")
+	for {
+		select {
+		case <-s.stop:
+			return
+		default:
+		}
 
-	return s, nil
+		token := s.cli.Connect()
+		if token.Wait() && token.Error() == nil {
+			select {
+			case <-s.stop:
+				// closed while connecting
+				s.cli.Disconnect(uint(time.Second / time.Millisecond))
+			default:
+			}
+
+			return
+		}
+
+		s.conn.set(ConnReconnecting, token.Error())
+
+		select {
+		case <-s.stop:
+			return
+		case <-time.After(b.Next()):
+		}
+	}
+}
+
+// onConnect publishes birth message on every (re)connect
+// because last will could be published by broker while edge was offline
+func (s *Service) onConnect(cli paho.Client) {
+	reconnect := s.conn.set(ConnConnected, nil)
+
+	if s.spb != nil {
+		go s.spb.birth(cli)
+	} else {
+		go s.status.publishOnline(cli)
+	}
+
+	if reconnect {
+		go s.resubscribe(cli)
+	}
+}
+
+// republish refreshes birth message with current stats while connected
+func (s Service) republish(every time.Duration) {
+	tick := time.NewTicker(every)
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-tick.C:
+		}
+
+		if s.cli.IsConnectionOpen() {
+			s.status.publishOnline(s.cli)
+		}
+	}
 }
 
 func (s Service) publishListener() {
-	for p := range s.toSend {
-		err := s.publish(stateTopic, p)
+	for c := range s.toSend {
+		if s.spb != nil {
+			s.spb.change(s.cli, c)
+			continue
+		}
+
+		for _, m := range stateMessages(s.topics, s.mode, s.meta, c) {
+			err := s.publish(m.topic, m.payload, m.retained)
+			if err != nil {
+				log.WithFields(log.Fields{
+					"param": c.Param,
+					"value": c.Value,
+					"topic": m.topic,
+					"error": err,
+				}).Error("err publish state")
+			}
+		}
+	}
+}
+
+type outMessage struct {
+	topic    string
+	payload  []byte
+	retained bool
+}
+
+type paramPayload struct {
+	Value interface{} `json:"value"`
+	Unit  string      `json:"unit,omitempty"`
+	// unix time in milliseconds
+	TS int64 `json:"ts"`
+}
+
+// stateMessages builds state messages of change by state mode
+// parameter value is published to its own topic (retained) so subscriber gets last value immediately
+func stateMessages(t topics, mode StateMode, meta bool, c state.Change) []outMessage {
+	res := make([]outMessage, 0, 2)
+
+	if mode != StateParam {
+		p, err := c.Document()
 		if err != nil {
 			log.WithFields(log.Fields{
-				"payload": string(p),
-				"error":   err,
-			}).Error("err publish state")
+				"param": c.Param,
+				"value": c.Value,
+				"error": err,
+			}).Error("err build state")
+		} else {
+			res = append(res, outMessage{t.state, p, false})
 		}
 	}
+
+	if mode != StateAggregate {
+		var v interface{} = c.Value
+		if meta {
+			v = paramPayload{c.Value, c.Unit, c.Time.UnixNano() / int64(time.Millisecond)}
+		}
+
+		p, err := jsoniter.ConfigFastest.Marshal(v)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"param": c.Param,
+				"value": c.Value,
+				"error": err,
+			}).Error("err build param")
+		} else {
+			res = append(res, outMessage{t.paramTopic(c.Param), p, true})
+		}
+	}
+
+	return res
 }
 
-func (s Service) publish(topic string, payload []byte) error {
-	token := s.cli.Publish(topic, qos, false, payload)
+func (s Service) publish(topic string, payload []byte, retained bool) error {
+	token := s.cli.Publish(topic, qos, retained, payload)
 	if token.WaitTimeout(time.Minute) && token.Error() != nil {
 		return token.Error()
 	}
@@ -156,23 +450,162 @@ func (s Service) publish(topic string, payload []byte) error {
 	return nil
 }
 
+var errBusy = jsonrpc.ErrServer.AddData("msg", "busy").SetCode(-32095)
+
+// rpcCallback passes command to workers (paho callback should not block)
 func (s Service) rpcCallback(_ paho.Client, msg paho.Message) {
-	connectorID := strings.Split(msg.Topic(), "/")[1]
+	cmd := command{connector: s.topics.connector(msg.Topic()), msg: msg}
 
-	resp := s.rpc.Call(connectorID, msg.Payload())
+	if !s.cmds.submit(cmd) {
+		log.WithFields(log.Fields{
+			"connector": cmd.connector,
+			"request":   string(msg.Payload()),
+		}).Warn("mqtt command rejected: busy")
+
+		// handler must not wait for token (mqtt5 client and ordered paho client
+		// call it from reading goroutine), so busy reply is published without waiting
+		resp := jsonrpc.BuildErrResp(jsoniter.ConfigFastest.Get(msg.Payload(), "id").ToString(), errBusy)
+		token := s.publishResponse(cmd, resp)
+
+		go func() {
+			if token.WaitTimeout(time.Minute) && token.Error() != nil {
+				log.WithFields(log.Fields{
+					"connector": cmd.connector,
+					"error":     token.Error(),
+				}).Error("err publish busy response")
+			}
+		}()
+	}
+}
 
-	err := s.publish(fmt.Sprintf(responseTopic, connectorID), resp)
-	if err != nil {
+// spbCallback submits sparkplug command, it's dropped if dispatcher is busy
+// (sparkplug has no response topic to report error)
+func (s Service) spbCallback(_ paho.Client, msg paho.Message) {
+	cmd := command{connector: commandDevice(msg.Topic()), msg: msg, sparkplug: true}
+
+	if !s.cmds.submit(cmd) {
+		log.WithFields(log.Fields{
+			"topic":  msg.Topic(),
+			"device": cmd.connector,
+		}).Warn("sparkplug command rejected: busy")
+	}
+}
+
+func (s Service) handleCommand(cmd command) {
+	if cmd.sparkplug {
+		s.spb.command(s.cli, cmd.connector, cmd.msg)
+		return
+	}
+
+	var resp []byte
+
+	if m, ok := cmd.msg.(*mqtt5.Message); ok {
+		resp = s.callV5(cmd.connector, m)
+	} else {
+		resp = s.rpc.Call(cmd.connector, cmd.msg.Payload())
+	}
+
+	s.respond(cmd, resp)
+}
+
+// respond publishes response to connector and waits until it's sent
+func (s Service) respond(cmd command, resp []byte) {
+	token := s.publishResponse(cmd, resp)
+	if token.WaitTimeout(time.Minute) && token.Error() != nil {
 		log.WithFields(log.Fields{
 			"response":  string(resp),
-			"connector": connectorID,
-			"request":   string(msg.Payload()),
-			"error":     err,
+			"connector": cmd.connector,
+			"request":   string(cmd.msg.Payload()),
+			"error":     token.Error(),
 		}).Error("err publish response")
 	}
 }
 
+// publishResponse publishes response to response topic of connector
+// (or to response topic of MQTT 5 command with its correlation data)
+func (s Service) publishResponse(cmd command, resp []byte) paho.Token {
+	topic := s.topics.responseTopic(cmd.connector)
+
+	base := s.cli
+	if c, ok := base.(*spbClient); ok {
+		base = c.client()
+	}
+
+	cli, ok := base.(*mqtt5.Client)
+	if !ok {
+		return s.cli.Publish(topic, qos, false, resp)
+	}
+
+	var props mqtt5.Properties
+
+	if m, ok := cmd.msg.(*mqtt5.Message); ok {
+		p := m.Properties()
+		if p.ResponseTopic != "" {
+			topic = p.ResponseTopic
+		}
+
+		props = mqtt5.Properties{CorrelationData: p.CorrelationData, User: p.User}
+	}
+
+	return cli.PublishWithProperties(topic, qos, false, resp, props)
+}
+
+var errExpired = jsonrpc.ErrServer.AddData("msg", "message expired")
+
+// callV5 calls connector with MQTT 5 command
+// expired command is not sent, expiry is passed to connector as request deadline
+func (s Service) callV5(connectorID string, m *mqtt5.Message) []byte {
+	fields := log.Fields{"connector": connectorID, "topic": m.Topic()}
+	for _, u := range m.Properties().User {
+		fields[u.Key] = u.Value
+	}
+
+	log.WithFields(fields).Debug("mqtt command")
+
+	payload := m.Payload()
+
+	exp := m.Expires()
+	if exp.IsZero() {
+		return s.rpc.Call(connectorID, payload)
+	}
+
+	if time.Now().After(exp) {
+		log.WithFields(fields).Warn("mqtt command expired")
+
+		return jsonrpc.BuildErrResp(jsoniter.ConfigFastest.Get(payload, "id").ToString(), errExpired)
+	}
+
+	var req objx.Map
+
+	// rpc returns parse error itself
+	if jsoniter.ConfigFastest.Unmarshal(payload, &req) == nil {
+		req.Set("params."+jsonrpc.DeadlineParam, exp.UnixNano()/int64(time.Millisecond))
+
+		if data, err := jsoniter.ConfigFastest.Marshal(req); err == nil {
+			payload = data
+		}
+	}
+
+	return s.rpc.Call(connectorID, payload)
+}
+
 func (s Service) Close() error {
+	// broker doesn't publish last will on normal disconnect
+	var err error
+	if s.spb != nil {
+		err = s.publish(s.spb.topic(sparkplug.NDEATH, ""), s.spb.death(), false)
+	} else {
+		err = s.publish(s.status.topic, s.status.payload(statusOffline), true)
+	}
+
+	if err != nil {
+		log.WithError(err).Error("err publish status")
+	}
+
+	close(s.stop)
 	s.cli.Disconnect(uint(time.Second / time.Millisecond))
+	s.cmds.close()
+	s.conn.set(ConnDisconnected, nil)
+
 	return nil
 }
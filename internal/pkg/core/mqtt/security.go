@@ -0,0 +1,224 @@
+/**
+ * Copyright 2021 Rightech IoT. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mqtt
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	log "github.com/sirupsen/logrus"
+)
+
+// Security options of broker connection
+type Security struct {
+	// client certificate
+	CertFile string
+	KeyPath  string
+	// CA bundle to verify broker certificate (system pool if empty)
+	CAFile string
+	// name to verify broker certificate (host of url if empty)
+	ServerName string
+	Username   string
+	Password   string
+	// Token is sent as password (username is edge id if it's empty)
+	Token string
+	// TLS minimum version: 1.0, 1.1, 1.2 (default) or 1.3
+	MinVersion string
+	// TLS cipher suites names (go defaults if empty)
+	Ciphers []string
+	// InsecureSkipVerify disables broker certificate verification
+	InsecureSkipVerify bool
+	// AllowInsecure allows insecure settings:
+	// credentials over plain connection, InsecureSkipVerify, TLS < 1.2 and insecure ciphers
+	AllowInsecure bool
+}
+
+var tlsVersions = map[string]uint16{ // nolint: gochecknoglobals
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// prepareURL normalizes broker url scheme
+// url without scheme (host:port) uses tls if client certificate set
+func prepareURL(u *url.URL, certSet bool) (*url.URL, error) {
+	if u.Host == "" {
+		u.Host = u.Scheme + ":" + u.Opaque
+		u.Opaque = ""
+		u.Scheme = "tcp"
+
+		if certSet {
+			u.Scheme = "tls"
+		}
+	}
+
+	switch u.Scheme {
+	case "tcp", "mqtt":
+		u.Scheme = "tcp"
+	case "tls", "ssl", "tcps", "mqtts":
+		u.Scheme = "tls"
+	case "ws", "wss":
+	default:
+		return nil, errors.New("mqtt: unsupported url scheme " + u.Scheme)
+	}
+
+	return u, nil
+}
+
+func isSecure(u *url.URL) bool {
+	return u.Scheme == "tls" || u.Scheme == "wss"
+}
+
+// setupSecurity set credentials and tls config of broker connection
+func setupSecurity(o *paho.ClientOptions, u *url.URL, edge string, sec Security) error {
+	if sec.Token != "" {
+		sec.Password = sec.Token
+
+		if sec.Username == "" {
+			sec.Username = edge
+		}
+	}
+
+	if sec.Username != "" {
+		o.SetUsername(sec.Username)
+		o.SetPassword(sec.Password)
+	}
+
+	if !isSecure(u) {
+		if sec.CertFile != "" {
+			return errors.New("mqtt: client certificate requires tls:// or wss:// url")
+		}
+
+		if sec.Password != "" && !sec.AllowInsecure {
+			return errors.New("mqtt: credentials over insecure connection are not allowed")
+		}
+
+		return nil
+	}
+
+	cfg, err := tlsConfig(sec)
+	if err != nil {
+		return err
+	}
+
+	o.SetTLSConfig(cfg)
+
+	log.Debug("mqtt tls enabled")
+
+	return nil
+}
+
+func tlsConfig(sec Security) (*tls.Config, error) {
+	cfg := &tls.Config{
+		ServerName:         sec.ServerName,
+		InsecureSkipVerify: sec.InsecureSkipVerify, // nolint: gosec
+		MinVersion:         tls.VersionTLS12,
+	}
+
+	if sec.InsecureSkipVerify && !sec.AllowInsecure {
+		return nil, errors.New("mqtt: insecure_skip_verify requires allow_insecure")
+	}
+
+	if sec.MinVersion != "" {
+		v, ok := tlsVersions[sec.MinVersion]
+		if !ok {
+			return nil, errors.New("mqtt: unknown tls version " + sec.MinVersion)
+		}
+
+		if v < tls.VersionTLS12 && !sec.AllowInsecure {
+			return nil, errors.New("mqtt: tls version lower than 1.2 requires allow_insecure")
+		}
+
+		cfg.MinVersion = v
+	}
+
+	ciphers, err := cipherSuites(sec.Ciphers, sec.AllowInsecure)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.CipherSuites = ciphers
+
+	if sec.CAFile != "" {
+		data, err := ioutil.ReadFile(sec.CAFile)
+		if err != nil {
+			return nil, err
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, errors.New("mqtt: no certificates found in " + sec.CAFile)
+		}
+
+		cfg.RootCAs = pool
+	}
+
+	if sec.CertFile != "" || sec.KeyPath != "" {
+		pair, err := tls.LoadX509KeyPair(sec.CertFile, sec.KeyPath)
+		if err != nil {
+			return nil, err
+		}
+
+		cfg.Certificates = []tls.Certificate{pair}
+	}
+
+	return cfg, nil
+}
+
+func cipherSuites(names []string, allowInsecure bool) ([]uint16, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	secure := make(map[string]uint16)
+	for _, c := range tls.CipherSuites() {
+		secure[c.Name] = c.ID
+	}
+
+	insecure := make(map[string]uint16)
+	for _, c := range tls.InsecureCipherSuites() {
+		insecure[c.Name] = c.ID
+	}
+
+	res := make([]uint16, 0, len(names))
+
+	for _, name := range names {
+		if id, ok := secure[name]; ok {
+			res = append(res, id)
+			continue
+		}
+
+		id, ok := insecure[name]
+		if !ok {
+			return nil, fmt.Errorf("mqtt: unknown cipher suite %s", name)
+		}
+
+		if !allowInsecure {
+			return nil, fmt.Errorf("mqtt: insecure cipher suite %s requires allow_insecure", name)
+		}
+
+		res = append(res, id)
+	}
+
+	return res, nil
+}
@@ -0,0 +1,301 @@
+/**
+ * Copyright 2021 Rightech IoT. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mqtt
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	jsoniter "github.com/json-iterator/go"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/Rightech/ric-edge/pkg/backoff"
+	"github.com/Rightech/ric-edge/pkg/lua"
+	"github.com/Rightech/ric-edge/pkg/store/queue"
+	"github.com/Rightech/ric-edge/pkg/store/state"
+)
+
+// PayloadFormat of sink messages
+type PayloadFormat string
+
+const (
+	// PayloadJSON is object with configured fields, e.g. {"param": "temp", "value": 1}
+	PayloadJSON PayloadFormat = "json"
+	// PayloadFlat is object with single key, e.g. {"temp": 1}
+	PayloadFlat PayloadFormat = "flat"
+	// PayloadLua is result of lua script
+	PayloadLua PayloadFormat = "lua"
+)
+
+// SinkConfig of additional northbound broker
+type SinkConfig struct {
+	Name string
+	// brokers urls in failover order
+	URLs     []string
+	ClientID string
+	Security Security
+	// topic template, {edge} and {param} are replaced
+	Topic    string
+	QoS      byte
+	Retained bool
+	Format   PayloadFormat
+	// fields of json payload: param, value, unit, ts, edge (all if empty)
+	Fields []string
+	// lua script gets param table (with fields above) and returns payload
+	// string is published as is, other values are encoded to json, nil skips message
+	Script string
+	// offline buffer
+	Buffer *queue.Queue
+}
+
+// Sink publishes state changes to additional broker
+// changes are buffered while broker is unreachable
+type Sink struct {
+	c    SinkConfig
+	edge string
+	cli  paho.Client
+	lua  lua.Service
+	d    *queue.Deliverer
+	done chan struct{}
+}
+
+var (
+	errNotConnected = errors.New("mqtt: not connected")
+	errPublishTime  = errors.New("mqtt: publish timeout")
+)
+
+var sinkFields = []string{"param", "value", "unit", "ts", "edge"} // nolint: gochecknoglobals
+
+// NewSink starts sink which publishes changes from in
+// connection is established in background so unreachable broker doesn't stop core
+func NewSink(c SinkConfig, edge string, in <-chan state.Change) (*Sink, error) {
+	if len(c.URLs) == 0 {
+		return nil, errors.New("mqtt: sink " + c.Name + ": no broker url")
+	}
+
+	if c.ClientID == "" {
+		c.ClientID = edge + "-" + c.Name
+	}
+
+	if len(c.Fields) == 0 {
+		c.Fields = sinkFields
+	}
+
+	s := &Sink{c: c, edge: edge, done: make(chan struct{})}
+
+	switch c.Format {
+	case "":
+		s.c.Format = PayloadJSON
+	case PayloadJSON, PayloadFlat:
+	case PayloadLua:
+		s.lua = lua.New()
+
+		err := s.lua.Add(c.Name, c.Script)
+		if err != nil {
+			return nil, fmt.Errorf("mqtt: sink %s: %w", c.Name, err)
+		}
+	default:
+		return nil, errors.New("mqtt: sink " + c.Name + ": unknown format " + string(c.Format))
+	}
+
+	opts := paho.NewClientOptions().
+		SetClientID(c.ClientID).
+		SetAutoReconnect(true).
+		SetMaxReconnectInterval(time.Minute)
+
+	for _, raw := range c.URLs {
+		u, err := url.Parse(raw)
+		if err != nil {
+			return nil, err
+		}
+
+		u, err = prepareURL(u, c.Security.CertFile != "")
+		if err != nil {
+			return nil, err
+		}
+
+		err = setupSecurity(opts, u, edge, c.Security)
+		if err != nil {
+			return nil, fmt.Errorf("sink %s: %w", c.Name, err)
+		}
+
+		opts.AddBroker(u.String())
+	}
+
+	opts.SetOnConnectHandler(func(paho.Client) {
+		log.WithField("sink", c.Name).Info("mqtt sink connected")
+	})
+	opts.SetConnectionLostHandler(func(_ paho.Client, err error) {
+		log.WithField("sink", c.Name).WithError(err).Warn("mqtt sink connection lost")
+	})
+
+	s.cli = paho.NewClient(opts)
+
+	go s.connect()
+
+	s.d = queue.NewDeliverer(c.Buffer, queue.Delivery{
+		BackoffMin: time.Second,
+		BackoffMax: time.Minute,
+		Encode:     s.encode,
+		Send:       s.send,
+		Log:        log.WithField("sink", c.Name),
+	}, in)
+
+	return s, nil
+}
+
+// connect tries to connect until success (then paho reconnects itself)
+func (s *Sink) connect() {
+	b := backoff.New(time.Second, time.Minute)
+
+	for {
+		token := s.cli.Connect()
+		if token.Wait() && token.Error() == nil {
+			return
+		}
+
+		log.WithFields(log.Fields{
+			"sink":  s.c.Name,
+			"error": token.Error(),
+		}).Warn("mqtt sink connect")
+
+		select {
+		case <-time.After(b.Next()):
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// encode renders change to buffered message (key is topic)
+func (s *Sink) encode(c state.Change) (string, []byte, error) {
+	topic, payload, err := s.render(c)
+	if err != nil || payload == nil {
+		return "", nil, err
+	}
+
+	return topic, encodeMessage(topic, payload), nil
+}
+
+func (s *Sink) render(c state.Change) (string, []byte, error) {
+	topic := strings.NewReplacer("{edge}", s.edge, "{param}", c.Param).Replace(s.c.Topic)
+
+	fields := map[string]interface{}{
+		"param": c.Param,
+		"value": c.Value,
+		"unit":  c.Unit,
+		"ts":    c.Time.UnixNano() / int64(time.Millisecond),
+		"edge":  s.edge,
+	}
+
+	var v interface{}
+
+	switch s.c.Format {
+	case PayloadFlat:
+		v = map[string]interface{}{c.Param: c.Value}
+	case PayloadLua:
+		res, err := s.lua.Execute(s.c.Name, fields)
+		if err != nil {
+			return "", nil, err
+		}
+
+		if str, ok := res.(string); ok {
+			return topic, []byte(str), nil
+		}
+
+		if res == nil {
+			return topic, nil, nil
+		}
+
+		v = res
+	default:
+		obj := make(map[string]interface{}, len(s.c.Fields))
+		for _, f := range s.c.Fields {
+			obj[f] = fields[f]
+		}
+
+		v = obj
+	}
+
+	payload, err := jsoniter.ConfigFastest.Marshal(v)
+
+	return topic, payload, err
+}
+
+// send publishes buffered messages in order
+func (s *Sink) send(batch []queue.Item) error {
+	for _, it := range batch {
+		topic, payload, err := decodeMessage(it.Data)
+		if err != nil {
+			return queue.Permanent(err)
+		}
+
+		err = s.publish(topic, payload)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *Sink) publish(topic string, payload []byte) error {
+	if !s.cli.IsConnectionOpen() {
+		return errNotConnected
+	}
+
+	token := s.cli.Publish(topic, s.c.QoS, s.c.Retained, payload)
+	if !token.WaitTimeout(time.Minute) {
+		return errPublishTime
+	}
+
+	return token.Error()
+}
+
+func (s *Sink) Close() {
+	s.d.Close()
+	close(s.done)
+	s.cli.Disconnect(uint(time.Second / time.Millisecond))
+}
+
+// encodeMessage packs topic and payload to buffer item
+func encodeMessage(topic string, payload []byte) []byte {
+	buf := make([]byte, 2, 2+len(topic)+len(payload))
+	binary.BigEndian.PutUint16(buf, uint16(len(topic)))
+
+	buf = append(buf, topic...)
+
+	return append(buf, payload...)
+}
+
+func decodeMessage(data []byte) (string, []byte, error) {
+	if len(data) < 2 {
+		return "", nil, errors.New("mqtt: bad buffered message")
+	}
+
+	n := int(binary.BigEndian.Uint16(data))
+	if len(data) < 2+n {
+		return "", nil, errors.New("mqtt: bad buffered message")
+	}
+
+	return string(data[2 : 2+n]), data[2+n:], nil
+}
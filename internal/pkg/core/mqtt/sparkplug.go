@@ -0,0 +1,482 @@
+/**
+ * Copyright 2021 Rightech IoT. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mqtt
+
+import (
+	"encoding/binary"
+	"strings"
+	"sync"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	jsoniter "github.com/json-iterator/go"
+	log "github.com/sirupsen/logrus"
+	"go.etcd.io/bbolt"
+
+	"github.com/Rightech/ric-edge/internal/pkg/core/cloud"
+	"github.com/Rightech/ric-edge/internal/pkg/core/ws"
+	"github.com/Rightech/ric-edge/pkg/sparkplug"
+	"github.com/Rightech/ric-edge/pkg/store/mqtt"
+	"github.com/Rightech/ric-edge/pkg/store/state"
+)
+
+// Format of northbound messages
+type Format string
+
+const (
+	// FormatJSON publishes json state and status (default)
+	FormatJSON Format = "json"
+	// FormatSparkplug publishes Sparkplug B messages
+	// edge is node and connectors are devices
+	FormatSparkplug Format = "sparkplug"
+)
+
+// Sparkplug config
+type Sparkplug struct {
+	GroupID string
+	// model parameters published as metrics
+	Params []cloud.Param
+}
+
+const (
+	rebirthMetric   = "Node Control/Rebirth"
+	bdSeqMetric     = "bdSeq"
+	sparkplugBucket = "sparkplug"
+)
+
+type spbMetric struct {
+	param    cloud.Param
+	dataType sparkplug.DataType
+}
+
+// sparkplugNode publishes Sparkplug B messages
+// NBIRTH and DBIRTH are published on every connect and rebirth command,
+// DBIRTH and DDEATH when connector connects or disconnects
+type sparkplugNode struct {
+	mx    sync.Mutex
+	group string
+	node  string
+	bdSeq uint64
+	seq   uint64
+	// metric name is parameter id (without edge. prefix)
+	metrics map[string]spbMetric
+	// device (connector) -> metric names ("" is node itself)
+	devices    map[string][]string
+	values     map[string]state.Change
+	born       map[string]bool
+	connectors func() []ws.ConnectorInfo
+	rpc        rpc
+	// bdSeq is stored to be different after restart
+	db mqtt.DB
+}
+
+func newSparkplug(c Config, db mqtt.DB, cli rpc) *sparkplugNode {
+	n := &sparkplugNode{
+		group:      c.Sparkplug.GroupID,
+		node:       c.ClientID,
+		db:         db,
+		metrics:    make(map[string]spbMetric),
+		devices:    make(map[string][]string),
+		values:     make(map[string]state.Change),
+		born:       make(map[string]bool),
+		connectors: c.Connectors,
+		rpc:        cli,
+	}
+
+	for _, p := range c.Sparkplug.Params {
+		name := state.Key(p.ID)
+
+		n.metrics[name] = spbMetric{p, dataType(p.DataType)}
+		n.devices[p.Connector] = append(n.devices[p.Connector], name)
+	}
+
+	return n
+}
+
+// nextSession increments bdSeq before connect and returns NDEATH (last will) of new session
+func (n *sparkplugNode) nextSession() ([]byte, error) {
+	seq, err := nextBdSeq(n.db)
+	if err != nil {
+		return nil, err
+	}
+
+	n.mx.Lock()
+	n.bdSeq = seq
+	n.mx.Unlock()
+
+	return n.death(), nil
+}
+
+// nextBdSeq returns stored birth/death sequence number incremented
+func nextBdSeq(db mqtt.DB) (uint64, error) {
+	var seq uint64
+
+	err := db.Update(func(tx *bbolt.Tx) error {
+		bk, err := tx.CreateBucketIfNotExists([]byte(sparkplugBucket))
+		if err != nil {
+			return err
+		}
+
+		if v := bk.Get([]byte(bdSeqMetric)); len(v) == 8 {
+			seq = (binary.BigEndian.Uint64(v) + 1) % 256
+		}
+
+		buf := make([]byte, 8)
+		binary.BigEndian.PutUint64(buf, seq)
+
+		return bk.Put([]byte(bdSeqMetric), buf)
+	})
+
+	return seq, err
+}
+
+func dataType(t string) sparkplug.DataType {
+	switch strings.ToLower(t) {
+	case "", "number", "double", "float":
+		return sparkplug.Double
+	case "integer", "int":
+		return sparkplug.Int64
+	case "boolean", "bool":
+		return sparkplug.Boolean
+	default:
+		return sparkplug.String
+	}
+}
+
+func now() uint64 {
+	return uint64(time.Now().UnixNano() / int64(time.Millisecond))
+}
+
+func (n *sparkplugNode) topic(kind, device string) string {
+	t := sparkplug.Namespace + "/" + n.group + "/" + kind + "/" + n.node
+	if device != "" {
+		t += "/" + device
+	}
+
+	return t
+}
+
+// subscriptions are NCMD and DCMD topics
+// (their messages are processed by commands dispatcher like json commands)
+func (n *sparkplugNode) subscriptions() []string {
+	return []string{n.topic(sparkplug.NCMD, ""), n.topic(sparkplug.DCMD, "+")}
+}
+
+// death is NDEATH payload of current session (last will)
+func (n *sparkplugNode) death() []byte {
+	n.mx.Lock()
+	bdSeq := n.bdSeq
+	n.mx.Unlock()
+
+	data, err := sparkplug.Marshal(sparkplug.Payload{
+		Timestamp: now(),
+		Metrics:   []sparkplug.Metric{{Name: bdSeqMetric, DataType: sparkplug.UInt64, Value: bdSeq}},
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	return data
+}
+
+func (n *sparkplugNode) metric(name string) sparkplug.Metric {
+	m := sparkplug.Metric{Name: name, DataType: n.metrics[name].dataType}
+
+	if c, ok := n.values[name]; ok {
+		m.Value = c.Value
+		m.Timestamp = uint64(c.Time.UnixNano() / int64(time.Millisecond))
+	}
+
+	return m
+}
+
+func (n *sparkplugNode) deviceMetrics(device string) []sparkplug.Metric {
+	names := n.devices[device]
+	res := make([]sparkplug.Metric, 0, len(names))
+
+	for _, name := range names {
+		res = append(res, n.metric(name))
+	}
+
+	return res
+}
+
+// send publishes message with next sequence number (mx should be locked)
+func (n *sparkplugNode) send(cli paho.Client, kind, device string, metrics []sparkplug.Metric) paho.Token {
+	p := sparkplug.Payload{Timestamp: now(), Metrics: metrics, HasSeq: true, Seq: n.seq}
+	n.seq = (n.seq + 1) % 256
+
+	data, err := sparkplug.Marshal(p)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"type":   kind,
+			"device": device,
+			"error":  err,
+		}).Error("err encode sparkplug payload")
+
+		return nil
+	}
+
+	return cli.Publish(n.topic(kind, device), qos, false, data)
+}
+
+func wait(tokens ...paho.Token) {
+	for _, t := range tokens {
+		if t != nil && t.WaitTimeout(time.Minute) && t.Error() != nil {
+			log.WithError(t.Error()).Error("err publish sparkplug message")
+		}
+	}
+}
+
+// online returns devices which connector is connected
+func (n *sparkplugNode) online() map[string]bool {
+	res := make(map[string]bool)
+
+	if n.connectors == nil {
+		for d := range n.devices {
+			res[d] = true
+		}
+
+		return res
+	}
+
+	for _, c := range n.connectors() {
+		if _, ok := n.devices[c.Name]; ok {
+			res[c.Name] = true
+		}
+	}
+
+	return res
+}
+
+// birth publishes NBIRTH and DBIRTH of online devices
+func (n *sparkplugNode) birth(cli paho.Client) {
+	n.mx.Lock()
+
+	n.seq = 0
+	n.born = make(map[string]bool)
+
+	metrics := append([]sparkplug.Metric{
+		{Name: bdSeqMetric, DataType: sparkplug.UInt64, Value: n.bdSeq},
+		{Name: rebirthMetric, DataType: sparkplug.Boolean, Value: false},
+	}, n.deviceMetrics("")...)
+
+	tokens := []paho.Token{n.send(cli, sparkplug.NBIRTH, "", metrics)}
+	tokens = append(tokens, n.updateDevices(cli)...)
+
+	n.mx.Unlock()
+
+	go wait(tokens...)
+}
+
+// updateDevices publishes DBIRTH and DDEATH on connectors change (mx should be locked)
+func (n *sparkplugNode) updateDevices(cli paho.Client) []paho.Token {
+	online := n.online()
+
+	var tokens []paho.Token
+
+	for d := range n.born {
+		if !online[d] {
+			delete(n.born, d)
+			tokens = append(tokens, n.send(cli, sparkplug.DDEATH, d, nil))
+		}
+	}
+
+	for d := range online {
+		if d != "" && !n.born[d] {
+			n.born[d] = true
+			tokens = append(tokens, n.send(cli, sparkplug.DBIRTH, d, n.deviceMetrics(d)))
+		}
+	}
+
+	return tokens
+}
+
+func (n *sparkplugNode) devicesChanged(cli paho.Client) {
+	if !cli.IsConnectionOpen() {
+		return
+	}
+
+	n.mx.Lock()
+	tokens := n.updateDevices(cli)
+	n.mx.Unlock()
+
+	go wait(tokens...)
+}
+
+// change publishes NDATA or DDATA with changed metric
+// changes while connection is lost are not sent, births contain last values
+func (n *sparkplugNode) change(cli paho.Client, c state.Change) {
+	m, ok := n.metrics[c.Param]
+	if !ok {
+		log.WithField("param", c.Param).Debug("sparkplug: unknown parameter")
+		return
+	}
+
+	n.mx.Lock()
+
+	n.values[c.Param] = c
+
+	device := m.param.Connector
+	if !cli.IsConnectionOpen() || (device != "" && !n.born[device]) {
+		n.mx.Unlock()
+		return
+	}
+
+	kind := sparkplug.NDATA
+	if device != "" {
+		kind = sparkplug.DDATA
+	}
+
+	token := n.send(cli, kind, device, []sparkplug.Metric{n.metric(c.Param)})
+
+	n.mx.Unlock()
+
+	wait(token)
+}
+
+// commandDevice returns device of DCMD topic (empty for NCMD)
+func commandDevice(topic string) string {
+	if parts := strings.Split(topic, "/"); len(parts) == 5 {
+		return parts[4]
+	}
+
+	return ""
+}
+
+// command handles NCMD and DCMD (it's called by commands dispatcher worker)
+// rebirth request republishes births, other metrics are written through rpc
+func (n *sparkplugNode) command(cli paho.Client, device string, msg paho.Message) {
+	p, err := sparkplug.Unmarshal(msg.Payload())
+	if err != nil {
+		log.WithFields(log.Fields{
+			"topic": msg.Topic(),
+			"error": err,
+		}).Error("err decode sparkplug command")
+
+		return
+	}
+
+	for _, m := range p.Metrics {
+		if device == "" && m.Name == rebirthMetric {
+			if v, _ := m.Value.(bool); v {
+				n.birth(cli)
+			}
+
+			continue
+		}
+
+		n.write(device, m)
+	}
+}
+
+func (n *sparkplugNode) write(device string, m sparkplug.Metric) {
+	logger := log.WithFields(log.Fields{"device": device, "metric": m.Name})
+
+	mt, ok := n.metrics[m.Name]
+	if !ok || mt.param.Connector != device {
+		logger.Error("sparkplug: unknown metric")
+		return
+	}
+
+	if mt.param.Write == nil {
+		logger.Error("sparkplug: metric is not writable")
+		return
+	}
+
+	payload, err := mt.param.WriteRequest(m.Value)
+	if err != nil {
+		logger.WithError(err).Error("sparkplug: bad write request")
+		return
+	}
+
+	resp := n.rpc.Call(mt.param.Connector, payload)
+
+	if e := jsoniter.ConfigFastest.Get(resp, "error"); e.LastError() == nil {
+		logger.WithField("error", e.ToString()).Error("sparkplug: write failed")
+		return
+	}
+
+	logger.WithField("value", m.Value).Debug("sparkplug: written")
+}
+
+// spbClient creates new client before every connect, so last will (NDEATH)
+// of each session has own bdSeq (will of paho client can't be changed after it's created)
+// clients don't reconnect automatically, Service connects it again when connection is lost
+type spbClient struct {
+	mx  sync.RWMutex
+	cli paho.Client
+	// newClient returns client of next session
+	newClient func() paho.Client
+}
+
+func (c *spbClient) client() paho.Client {
+	c.mx.RLock()
+	defer c.mx.RUnlock()
+
+	return c.cli
+}
+
+func (c *spbClient) Connect() paho.Token {
+	cli := c.newClient()
+
+	c.mx.Lock()
+	c.cli = cli
+	c.mx.Unlock()
+
+	return cli.Connect()
+}
+
+func (c *spbClient) Disconnect(quiesce uint) {
+	if cli := c.client(); cli != nil {
+		cli.Disconnect(quiesce)
+	}
+}
+
+func (c *spbClient) IsConnected() bool {
+	cli := c.client()
+	return cli != nil && cli.IsConnected()
+}
+
+func (c *spbClient) IsConnectionOpen() bool {
+	cli := c.client()
+	return cli != nil && cli.IsConnectionOpen()
+}
+
+func (c *spbClient) Publish(topic string, qos byte, retained bool, payload interface{}) paho.Token {
+	return c.client().Publish(topic, qos, retained, payload)
+}
+
+func (c *spbClient) Subscribe(topic string, qos byte, callback paho.MessageHandler) paho.Token {
+	return c.client().Subscribe(topic, qos, callback)
+}
+
+func (c *spbClient) SubscribeMultiple(filters map[string]byte, callback paho.MessageHandler) paho.Token {
+	return c.client().SubscribeMultiple(filters, callback)
+}
+
+func (c *spbClient) Unsubscribe(topics ...string) paho.Token {
+	return c.client().Unsubscribe(topics...)
+}
+
+func (c *spbClient) AddRoute(topic string, callback paho.MessageHandler) {
+	c.client().AddRoute(topic, callback)
+}
+
+func (c *spbClient) OptionsReader() paho.ClientOptionsReader {
+	return c.client().OptionsReader()
+}
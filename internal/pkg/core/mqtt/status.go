@@ -0,0 +1,116 @@
+/**
+ * Copyright 2021 Rightech IoT. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mqtt
+
+import (
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	jsoniter "github.com/json-iterator/go"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/Rightech/ric-edge/internal/pkg/core/supervisor"
+	"github.com/Rightech/ric-edge/internal/pkg/core/ws"
+)
+
+const (
+	statusOnline  = "online"
+	statusOffline = "offline"
+)
+
+// status publishes retained birth message on connect
+// and broker publishes offline message (last will) when edge disconnected
+type status struct {
+	topic      string
+	edge       string
+	version    string
+	connectors func() []ws.ConnectorInfo
+	processes  func() []supervisor.Status
+	dropped    func() map[string]uint64
+	stats      func() Stats
+}
+
+type statusPayload struct {
+	Status     string             `json:"status"`
+	ID         string             `json:"core_id"`
+	Version    string             `json:"version,omitempty"`
+	Connectors []ws.ConnectorInfo `json:"connectors,omitempty"`
+	// connector processes started by core
+	Processes []supervisor.Status `json:"processes,omitempty"`
+	MQTT      *Stats              `json:"mqtt,omitempty"`
+	// state changes dropped by lossy state outputs
+	StateDropped map[string]uint64 `json:"state_dropped,omitempty"`
+	// unix time in milliseconds
+	TS int64 `json:"ts"`
+}
+
+func (st status) payload(s string) []byte {
+	p := statusPayload{Status: s, ID: st.edge, TS: time.Now().UnixNano() / int64(time.Millisecond)}
+
+	if s == statusOnline {
+		p.Version = st.version
+		p.Connectors = []ws.ConnectorInfo{}
+
+		if st.connectors != nil {
+			p.Connectors = st.connectors()
+		}
+
+		if st.processes != nil {
+			p.Processes = st.processes()
+		}
+
+		if st.dropped != nil {
+			p.StateDropped = st.dropped()
+		}
+
+		if st.stats != nil {
+			stats := st.stats()
+			p.MQTT = &stats
+		}
+	}
+
+	data, err := jsoniter.ConfigFastest.Marshal(p)
+	if err != nil {
+		panic(err)
+	}
+
+	return data
+}
+
+// publishOnline publishes birth message without waiting
+// (messages are sent in order so the last one is retained)
+func (st status) publishOnline(cli paho.Client) {
+	token := cli.Publish(st.topic, qos, true, st.payload(statusOnline))
+
+	go func() {
+		if token.WaitTimeout(time.Minute) && token.Error() != nil {
+			log.WithError(token.Error()).Error("err publish status")
+		}
+	}()
+}
+
+// PublishStatus publishes birth message with current connectors
+// (it should be called when connector connected or disconnected)
+// (in sparkplug format it publishes DBIRTH or DDEATH of connector)
+func (s Service) PublishStatus() {
+	if s.spb != nil {
+		s.spb.devicesChanged(s.cli)
+		return
+	}
+
+	s.status.publishOnline(s.cli)
+}
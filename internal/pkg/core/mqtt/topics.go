@@ -0,0 +1,146 @@
+/**
+ * Copyright 2021 Rightech IoT. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mqtt
+
+import (
+	"errors"
+	"strings"
+)
+
+// placeholders of topic templates
+const (
+	EdgePlaceholder      = "{edge}"
+	ConnectorPlaceholder = "{connector}"
+	ParamPlaceholder     = "{param}"
+)
+
+// Topics are templates of mqtt topics
+// {edge} replaced by edge id, {connector} by connector name and {param} by parameter id
+type Topics struct {
+	// requests to connectors, {connector} should be whole topic level
+	Command string
+	// responses of connectors
+	Response string
+	// state of all parameters
+	State string
+	// value of one parameter (see StateParam)
+	Param string
+	// edge status (birth and last will messages)
+	Status string
+}
+
+type topics struct {
+	edge string
+	// subscription filter of commands and level of connector name in it
+	command        string
+	connectorLevel int
+	response       string
+	state          string
+	param          string
+	status         string
+}
+
+func checkPlaceholders(name, tpl string, allowed ...string) error {
+	rest := tpl
+	for _, p := range allowed {
+		rest = strings.ReplaceAll(rest, p, "")
+	}
+
+	if strings.ContainsAny(rest, "{}") {
+		return errors.New("mqtt: unknown placeholder in " + name + " topic " + tpl)
+	}
+
+	return nil
+}
+
+func (t Topics) compile(edge string) (topics, error) {
+	// edge id is checked only if it's placed to topics
+	for _, tpl := range []string{t.Command, t.Response, t.State, t.Param, t.Status} {
+		if strings.Contains(tpl, EdgePlaceholder) && strings.ContainsAny(edge, "/+#") {
+			return topics{}, errors.New("mqtt: edge id can't be used in topic " + edge)
+		}
+	}
+
+	res := topics{edge: edge, connectorLevel: -1}
+
+	err := checkPlaceholders("command", t.Command, EdgePlaceholder, ConnectorPlaceholder)
+	if err != nil {
+		return topics{}, err
+	}
+
+	levels := strings.Split(strings.ReplaceAll(t.Command, EdgePlaceholder, edge), "/")
+	for i, l := range levels {
+		if l == ConnectorPlaceholder {
+			res.connectorLevel = i
+			levels[i] = "+"
+		}
+	}
+
+	if res.connectorLevel < 0 || strings.Count(t.Command, ConnectorPlaceholder) != 1 {
+		return topics{}, errors.New("mqtt: command topic should contain " + ConnectorPlaceholder + " level once")
+	}
+
+	res.command = strings.Join(levels, "/")
+
+	err = checkPlaceholders("response", t.Response, EdgePlaceholder, ConnectorPlaceholder)
+	if err != nil {
+		return topics{}, err
+	}
+
+	res.response = strings.ReplaceAll(t.Response, EdgePlaceholder, edge)
+
+	err = checkPlaceholders("state", t.State, EdgePlaceholder)
+	if err != nil {
+		return topics{}, err
+	}
+
+	res.state = strings.ReplaceAll(t.State, EdgePlaceholder, edge)
+
+	err = checkPlaceholders("param", t.Param, EdgePlaceholder, ParamPlaceholder)
+	if err != nil {
+		return topics{}, err
+	}
+
+	res.param = strings.ReplaceAll(t.Param, EdgePlaceholder, edge)
+
+	err = checkPlaceholders("status", t.Status, EdgePlaceholder)
+	if err != nil {
+		return topics{}, err
+	}
+
+	res.status = strings.ReplaceAll(t.Status, EdgePlaceholder, edge)
+
+	return res, nil
+}
+
+// connector returns connector name from command topic
+func (t topics) connector(topic string) string {
+	levels := strings.Split(topic, "/")
+	if len(levels) <= t.connectorLevel {
+		return ""
+	}
+
+	return levels[t.connectorLevel]
+}
+
+func (t topics) responseTopic(connector string) string {
+	return strings.ReplaceAll(t.response, ConnectorPlaceholder, connector)
+}
+
+func (t topics) paramTopic(param string) string {
+	return strings.ReplaceAll(t.param, ParamPlaceholder, param)
+}
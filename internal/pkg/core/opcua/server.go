@@ -0,0 +1,601 @@
+/**
+ * Copyright 2021 Rightech IoT. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package opcua implements OPC UA server embedded in core
+//
+// Only binary protocol with None security policy is supported (server is intended
+// for trusted local network), sessions live while their secure channel is open.
+package opcua
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gopcua/opcua/ua"
+	"github.com/gopcua/opcua/uacp"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/Rightech/ric-edge/internal/pkg/core/cloud"
+	"github.com/Rightech/ric-edge/pkg/store/state"
+)
+
+// Config of server
+type Config struct {
+	// Endpoint is url returned to clients, e.g. opc.tcp://192.168.1.10:4840
+	Endpoint string
+	// Addr is listener address (all interfaces and endpoint port if empty)
+	Addr string
+	// AllowAnonymous allows sessions without user
+	AllowAnonymous bool
+	// username -> password
+	Users map[string]string
+	// passwords are sent as plain text (security policy is None), so users are rejected unless allowed
+	AllowInsecure bool
+	// MaxSessions limits sessions of all clients (0 means no limit)
+	MaxSessions int
+}
+
+type rpc interface {
+	Call(string, []byte) []byte
+	Value(string) (interface{}, bool)
+}
+
+type Server struct {
+	c     Config
+	ln    net.Listener
+	sp    *space
+	rpc   rpc
+	uri   string
+	start time.Time
+	// last id of channels, sessions and subscriptions
+	lastID uint32
+
+	mx       sync.Mutex
+	times    map[string]time.Time
+	conns    map[*conn]struct{}
+	sessions int
+}
+
+const (
+	defaultPort    = "4840"
+	bufSize        = 65535
+	minBufSize     = 8192
+	maxMessageSize = 4 << 20
+	// requests received by chunks at the same time
+	maxPartialRequests = 4
+	minLifetime        = 10 * time.Second
+	maxLifetime        = time.Hour
+	helloTimeout       = 10 * time.Second
+	writeTimeout       = 10 * time.Second
+	transportProfile   = "http://opcfoundation.org/UA-Profile/Transport/uatcp-uasc-uabinary"
+)
+
+// New starts server with address space of model
+// values of parameters are read by cli, changes from in are used as values timestamps
+func New(c Config, edge string, model cloud.Model, cli rpc, in <-chan state.Change) (*Server, error) {
+	u, err := url.Parse(c.Endpoint)
+	if err != nil || u.Scheme != "opc.tcp" || u.Host == "" {
+		return nil, errors.New("opcua: endpoint should be opc.tcp://host:port")
+	}
+
+	if len(c.Users) > 0 && !c.AllowInsecure {
+		return nil, errors.New("opcua: plain text passwords not allowed (set allow_insecure)")
+	}
+
+	if c.Addr == "" {
+		port := u.Port()
+		if port == "" {
+			port = defaultPort
+		}
+
+		c.Addr = ":" + port
+	}
+
+	ln, err := net.Listen("tcp", c.Addr)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		c: c, ln: ln, rpc: cli, uri: "urn:ric-edge:" + edge, start: time.Now(),
+		times: make(map[string]time.Time),
+		conns: make(map[*conn]struct{}),
+	}
+
+	s.sp = newSpace(s, edge, model)
+
+	go s.track(in)
+	go s.accept()
+
+	log.WithFields(log.Fields{
+		"endpoint": c.Endpoint,
+		"addr":     c.Addr,
+	}).Info("opcua server ready")
+
+	return s, nil
+}
+
+func (s *Server) Close() {
+	s.ln.Close()
+
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	for c := range s.conns {
+		c.nc.Close()
+	}
+}
+
+func (s *Server) id() uint32 {
+	return atomic.AddUint32(&s.lastID, 1)
+}
+
+// track keeps timestamps of parameters changes
+func (s *Server) track(in <-chan state.Change) {
+	for c := range in {
+		s.mx.Lock()
+		s.times[c.Param] = c.Time
+		s.mx.Unlock()
+	}
+}
+
+// changed returns time of last change of model parameter id
+func (s *Server) changed(id string) time.Time {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	return s.times[state.Key(id)]
+}
+
+func (s *Server) accept() {
+	for {
+		nc, err := s.ln.Accept()
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				time.Sleep(100 * time.Millisecond)
+				continue
+			}
+
+			return
+		}
+
+		c := &conn{
+			s: s, nc: nc, lifetime: helloTimeout,
+			chunks:   make(map[uint32][]byte),
+			sessions: make(map[string]*session),
+		}
+
+		s.mx.Lock()
+		s.conns[c] = struct{}{}
+		s.mx.Unlock()
+
+		go c.serve()
+	}
+}
+
+// conn is client connection with one secure channel
+type conn struct {
+	s  *Server
+	nc net.Conn
+	// max chunk size and message size of client
+	sendBuf uint32
+	maxMsg  uint32
+
+	channel  uint32
+	token    uint32
+	lifetime time.Duration
+	// partial messages by request id
+	chunks map[uint32][]byte
+
+	wmx sync.Mutex
+	seq uint32
+
+	mx       sync.Mutex
+	sessions map[string]*session
+}
+
+func (c *conn) serve() {
+	logger := log.WithField("remote", c.nc.RemoteAddr().String())
+
+	defer c.close()
+
+	_ = c.nc.SetReadDeadline(time.Now().Add(helloTimeout))
+
+	typ, body, err := c.readFrame()
+	if err != nil {
+		return
+	}
+
+	if typ != "HELF" {
+		c.sendError(ua.StatusBadTCPMessageTypeInvalid, "hello expected")
+		return
+	}
+
+	hel := new(uacp.Hello)
+
+	_, err = hel.Decode(body)
+	if err != nil {
+		c.sendError(ua.StatusBadDecodingError, err.Error())
+		return
+	}
+
+	if hel.ReceiveBufSize < minBufSize || hel.SendBufSize < minBufSize {
+		c.sendError(ua.StatusBadTCPInternalError, "buffer size should be at least 8192")
+		return
+	}
+
+	c.sendBuf = bufSize
+	if hel.ReceiveBufSize < c.sendBuf {
+		c.sendBuf = hel.ReceiveBufSize
+	}
+
+	c.maxMsg = hel.MaxMessageSize
+
+	ack, err := (&uacp.Acknowledge{
+		ReceiveBufSize: bufSize,
+		SendBufSize:    c.sendBuf,
+		MaxMessageSize: maxMessageSize,
+	}).Encode()
+	if err != nil {
+		return
+	}
+
+	if c.writeFrame("ACKF", ack) != nil {
+		return
+	}
+
+	logger.Debug("opcua: client connected")
+
+	for {
+		_ = c.nc.SetReadDeadline(time.Now().Add(c.lifetime))
+
+		typ, body, err = c.readFrame()
+		if err == nil {
+			switch typ[:3] {
+			case "OPN":
+				err = c.open(body)
+			case "MSG":
+				err = c.message(typ[3], body)
+			case "CLO":
+				err = io.EOF
+			default:
+				c.sendError(ua.StatusBadTCPMessageTypeInvalid, "unknown message type "+typ)
+				err = ua.StatusBadTCPMessageTypeInvalid
+			}
+		}
+
+		if err != nil {
+			logger.WithError(err).Debug("opcua: client disconnected")
+			return
+		}
+	}
+}
+
+func (c *conn) close() {
+	c.nc.Close()
+
+	c.mx.Lock()
+	for _, ss := range c.sessions {
+		ss.close()
+	}
+
+	n := len(c.sessions)
+	c.sessions = nil
+	c.mx.Unlock()
+
+	c.s.mx.Lock()
+	delete(c.s.conns, c)
+	c.s.sessions -= n
+	c.s.mx.Unlock()
+}
+
+func (c *conn) readFrame() (string, []byte, error) {
+	var hdr [8]byte
+
+	_, err := io.ReadFull(c.nc, hdr[:])
+	if err != nil {
+		return "", nil, err
+	}
+
+	size := binary.LittleEndian.Uint32(hdr[4:])
+	if size < uint32(len(hdr)) || size > bufSize {
+		c.sendError(ua.StatusBadTCPMessageTooLarge, "bad message size")
+		return "", nil, ua.StatusBadTCPMessageTooLarge
+	}
+
+	body := make([]byte, size-uint32(len(hdr)))
+
+	_, err = io.ReadFull(c.nc, body)
+
+	return string(hdr[:4]), body, err
+}
+
+// writeFrame writes message with uacp header (c.wmx should be locked if channel is open)
+func (c *conn) writeFrame(typ string, parts ...[]byte) error {
+	size := 8
+	for _, p := range parts {
+		size += len(p)
+	}
+
+	buf := make([]byte, 8, size)
+	copy(buf, typ)
+	binary.LittleEndian.PutUint32(buf[4:], uint32(size))
+
+	for _, p := range parts {
+		buf = append(buf, p...)
+	}
+
+	_ = c.nc.SetWriteDeadline(time.Now().Add(writeTimeout))
+
+	_, err := c.nc.Write(buf)
+
+	return err
+}
+
+func (c *conn) sendError(code ua.StatusCode, reason string) {
+	data, err := (&uacp.Error{ErrorCode: uint32(code), Reason: reason}).Encode()
+	if err == nil {
+		c.wmx.Lock()
+		_ = c.writeFrame("ERRF", data)
+		c.wmx.Unlock()
+	}
+}
+
+func encodeService(v interface{}) ([]byte, error) {
+	typeID, err := ua.Encode(ua.NewFourByteExpandedNodeID(0, ua.ServiceTypeID(v)))
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := ua.Encode(v)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(typeID, data...), nil
+}
+
+// open issues or renews secure channel token
+func (c *conn) open(body []byte) error {
+	buf := ua.NewBuffer(body)
+	channel := buf.ReadUint32()
+	policy := buf.ReadString()
+	buf.ReadBytes()  // sender certificate
+	buf.ReadBytes()  // receiver certificate thumbprint
+	buf.ReadUint32() // sequence number
+	reqID := buf.ReadUint32()
+
+	if buf.Error() != nil {
+		return buf.Error()
+	}
+
+	if policy != ua.SecurityPolicyURINone {
+		c.sendError(ua.StatusBadSecurityPolicyRejected, "only None security policy supported")
+		return ua.StatusBadSecurityPolicyRejected
+	}
+
+	_, svc, err := ua.DecodeService(body[buf.Pos():])
+	if err != nil {
+		return err
+	}
+
+	req, ok := svc.(*ua.OpenSecureChannelRequest)
+	if !ok {
+		return errors.New("opcua: open secure channel request expected")
+	}
+
+	if req.SecurityMode != ua.MessageSecurityModeNone {
+		c.sendError(ua.StatusBadSecurityModeRejected, "only None security mode supported")
+		return ua.StatusBadSecurityModeRejected
+	}
+
+	switch {
+	case req.RequestType == ua.SecurityTokenRequestTypeIssue && c.channel == 0:
+		c.channel = c.s.id()
+	case req.RequestType == ua.SecurityTokenRequestTypeRenew && channel == c.channel && c.channel != 0:
+	default:
+		c.sendError(ua.StatusBadSecureChannelIDInvalid, "bad secure channel request")
+		return ua.StatusBadSecureChannelIDInvalid
+	}
+
+	c.token++
+
+	lifetime := time.Duration(req.RequestedLifetime) * time.Millisecond
+	if lifetime < minLifetime {
+		lifetime = minLifetime
+	}
+
+	if lifetime > maxLifetime {
+		lifetime = maxLifetime
+	}
+
+	// client renews token at 75% of lifetime
+	c.lifetime = lifetime * 5 / 4
+
+	data, err := encodeService(&ua.OpenSecureChannelResponse{
+		ResponseHeader: responseHeader(req.RequestHeader, ua.StatusOK),
+		SecurityToken: &ua.ChannelSecurityToken{
+			ChannelID:       c.channel,
+			TokenID:         c.token,
+			CreatedAt:       time.Now(),
+			RevisedLifetime: uint32(lifetime / time.Millisecond),
+		},
+		ServerNonce: []byte{},
+	})
+	if err != nil {
+		return err
+	}
+
+	c.wmx.Lock()
+	defer c.wmx.Unlock()
+
+	c.seq++
+
+	hdr := ua.NewBuffer(nil)
+	hdr.WriteUint32(c.channel)
+	hdr.WriteString(ua.SecurityPolicyURINone)
+	hdr.WriteByteString(nil)
+	hdr.WriteByteString(nil)
+	hdr.WriteUint32(c.seq)
+	hdr.WriteUint32(reqID)
+
+	return c.writeFrame("OPNF", hdr.Bytes(), data)
+}
+
+// message handles chunk of service request
+func (c *conn) message(chunk byte, body []byte) error {
+	buf := ua.NewBuffer(body)
+	channel := buf.ReadUint32()
+	buf.ReadUint32() // token id
+	buf.ReadUint32() // sequence number
+	reqID := buf.ReadUint32()
+
+	if buf.Error() != nil {
+		return buf.Error()
+	}
+
+	if c.channel == 0 || channel != c.channel {
+		c.sendError(ua.StatusBadSecureChannelIDInvalid, "secure channel is not open")
+		return ua.StatusBadSecureChannelIDInvalid
+	}
+
+	prev, ok := c.chunks[reqID]
+	if !ok && chunk == 'C' && len(c.chunks) >= maxPartialRequests {
+		c.sendError(ua.StatusBadTCPMessageTooLarge, "too many partial requests")
+		return ua.StatusBadTCPMessageTooLarge
+	}
+
+	data := append(prev, body[buf.Pos():]...)
+
+	switch chunk {
+	case 'C':
+		// all partial requests share limit of one message
+		size := len(data) - len(prev)
+		for _, d := range c.chunks {
+			size += len(d)
+		}
+
+		if size > maxMessageSize {
+			c.sendError(ua.StatusBadRequestTooLarge, "request too large")
+			return ua.StatusBadRequestTooLarge
+		}
+
+		c.chunks[reqID] = data
+
+		return nil
+	case 'A':
+		delete(c.chunks, reqID)
+		return nil
+	}
+
+	delete(c.chunks, reqID)
+
+	_, svc, err := ua.DecodeService(data)
+	if err != nil {
+		code := ua.StatusBadDecodingError
+		if err == ua.StatusBadServiceUnsupported {
+			code = ua.StatusBadServiceUnsupported
+		}
+
+		return c.send(reqID, fault(nil, code))
+	}
+
+	req, ok := svc.(ua.Request)
+	if !ok {
+		return c.send(reqID, fault(nil, ua.StatusBadServiceUnsupported))
+	}
+
+	// response of publish is sent later
+	resp := c.handle(reqID, req)
+	if resp == nil {
+		return nil
+	}
+
+	return c.send(reqID, resp)
+}
+
+// send writes response split to chunks
+func (c *conn) send(reqID uint32, resp ua.Response) error {
+	data, err := encodeService(resp)
+	if err != nil {
+		log.WithError(err).Error("opcua: encode response")
+
+		data, err = encodeService(fault(nil, ua.StatusBadEncodingError))
+		if err != nil {
+			return err
+		}
+	}
+
+	if c.maxMsg > 0 && uint32(len(data)) > c.maxMsg {
+		data, err = encodeService(fault(nil, ua.StatusBadResponseTooLarge))
+		if err != nil {
+			return err
+		}
+	}
+
+	// uacp header, channel, token and sequence header
+	max := int(c.sendBuf) - 24
+
+	c.wmx.Lock()
+	defer c.wmx.Unlock()
+
+	for {
+		n, chunk := len(data), "F"
+		if n > max {
+			n, chunk = max, "C"
+		}
+
+		c.seq++
+
+		hdr := make([]byte, 16)
+		binary.LittleEndian.PutUint32(hdr, c.channel)
+		binary.LittleEndian.PutUint32(hdr[4:], c.token)
+		binary.LittleEndian.PutUint32(hdr[8:], c.seq)
+		binary.LittleEndian.PutUint32(hdr[12:], reqID)
+
+		err := c.writeFrame("MSG"+chunk, hdr, data[:n])
+		if err != nil || chunk == "F" {
+			return err
+		}
+
+		data = data[n:]
+	}
+}
+
+func responseHeader(req *ua.RequestHeader, code ua.StatusCode) *ua.ResponseHeader {
+	h := &ua.ResponseHeader{
+		Timestamp:          time.Now(),
+		ServiceResult:      code,
+		ServiceDiagnostics: &ua.DiagnosticInfo{},
+		AdditionalHeader:   ua.NewExtensionObject(nil),
+	}
+
+	if req != nil {
+		h.RequestHandle = req.RequestHandle
+	}
+
+	return h
+}
+
+func fault(req *ua.RequestHeader, code ua.StatusCode) ua.Response {
+	return &ua.ServiceFault{ResponseHeader: responseHeader(req, code)}
+}
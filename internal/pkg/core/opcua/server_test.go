@@ -0,0 +1,499 @@
+/**
+ * Copyright 2021 Rightech IoT. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package opcua
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gopcua/opcua"
+	"github.com/gopcua/opcua/id"
+	"github.com/gopcua/opcua/ua"
+	"github.com/gopcua/opcua/uacp"
+	"github.com/gopcua/opcua/uasc"
+
+	"github.com/Rightech/ric-edge/internal/pkg/core/cloud"
+	"github.com/Rightech/ric-edge/pkg/store/state"
+)
+
+const testTimeout = 5 * time.Second
+
+// model with read only parameter temp and parameter setpoint of subsystem dev
+const testModel = `{"_id": "m", "data": {"children": [{"id": "dev", "name": "Device", "type": "subsystem",
+"active": true, "children": [{"id": "temp", "name": "Temperature", "dataType": "number", "active": true},
+{"id": "setpoint", "name": "Setpoint", "dataType": "number", "active": true}]}]}}`
+
+type testRPC struct {
+	mx     sync.Mutex
+	values map[string]interface{}
+}
+
+func (r *testRPC) Call(string, []byte) []byte {
+	return []byte(`{"jsonrpc": "2.0", "id": "1", "result": true}`)
+}
+
+func (r *testRPC) Value(id string) (interface{}, bool) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	v, ok := r.values[id]
+
+	return v, ok
+}
+
+func (r *testRPC) set(id string, v interface{}) {
+	r.mx.Lock()
+	r.values[id] = v
+	r.mx.Unlock()
+}
+
+func loadModel(t *testing.T) cloud.Model {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, testModel)
+	}))
+	defer srv.Close()
+
+	api, err := cloud.New(cloud.Config{URL: srv.URL, Token: "token"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := api.LoadModel("m")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return m
+}
+
+func newTestServer(t *testing.T, c Config, cli rpc) (*Server, string) {
+	t.Helper()
+
+	c.Endpoint = "opc.tcp://127.0.0.1:4840"
+	c.Addr = "127.0.0.1:0"
+
+	s, err := New(c, "edge", loadModel(t), cli, make(chan state.Change))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return s, "opc.tcp://" + s.ln.Addr().String()
+}
+
+// noneAuthPolicy makes client send password as is (security policy is None)
+func noneAuthPolicy(_ *uasc.Config, sc *uasc.SessionConfig) {
+	sc.AuthPolicyURI = ua.SecurityPolicyURINone
+}
+
+func connect(t *testing.T, endpoint string, opts ...opcua.Option) (*opcua.Client, error) {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+
+	opts = append(opts, opcua.RequestTimeout(testTimeout))
+
+	cli := opcua.NewClient(endpoint, opts...)
+
+	return cli, cli.Connect(ctx)
+}
+
+func writeFrame(t *testing.T, nc net.Conn, typ string, parts ...[]byte) {
+	t.Helper()
+
+	c := &conn{nc: nc}
+
+	err := c.writeFrame(typ, parts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readFrame(t *testing.T, nc net.Conn) (string, []byte) {
+	t.Helper()
+
+	_ = nc.SetReadDeadline(time.Now().Add(testTimeout))
+
+	var hdr [8]byte
+
+	_, err := io.ReadFull(nc, hdr[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := make([]byte, binary.LittleEndian.Uint32(hdr[4:])-8)
+
+	_, err = io.ReadFull(nc, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(hdr[:4]), body
+}
+
+func hello(t *testing.T, nc net.Conn, size uint32) (string, []byte) {
+	t.Helper()
+
+	data, err := (&uacp.Hello{ReceiveBufSize: size, SendBufSize: size, EndpointURL: "opc.tcp://edge"}).Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeFrame(t, nc, "HELF", data)
+
+	return readFrame(t, nc)
+}
+
+func errorCode(t *testing.T, typ string, body []byte) ua.StatusCode {
+	t.Helper()
+
+	if typ != "ERRF" {
+		t.Fatalf("got %s, want ERRF", typ)
+	}
+
+	e := new(uacp.Error)
+
+	_, err := e.Decode(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return ua.StatusCode(e.ErrorCode)
+}
+
+func TestHello(t *testing.T) {
+	s, endpoint := newTestServer(t, Config{AllowAnonymous: true}, &testRPC{})
+	defer s.Close()
+
+	addr := endpoint[len("opc.tcp://"):]
+
+	cases := []struct {
+		size uint32
+		ok   bool
+	}{
+		{1024, false},
+		{minBufSize - 1, false},
+		{minBufSize, true},
+	}
+
+	for _, c := range cases {
+		nc, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		typ, body := hello(t, nc, c.size)
+
+		if !c.ok {
+			if code := errorCode(t, typ, body); code != ua.StatusBadTCPInternalError {
+				t.Errorf("buffer %d: got %s, want BadTCPInternalError", c.size, code)
+			}
+
+			nc.Close()
+
+			continue
+		}
+
+		if typ != "ACKF" {
+			t.Fatalf("buffer %d: got %s, want ACKF", c.size, typ)
+		}
+
+		ack := new(uacp.Acknowledge)
+
+		_, err = ack.Decode(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// server chunks are not larger than client receive buffer
+		if ack.SendBufSize != c.size {
+			t.Errorf("buffer %d: got send buffer %d", c.size, ack.SendBufSize)
+		}
+
+		nc.Close()
+	}
+}
+
+// openChannel sends hello and opens secure channel, it returns channel id
+func openChannel(t *testing.T, addr string) (net.Conn, uint32) {
+	t.Helper()
+
+	nc, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if typ, _ := hello(t, nc, bufSize); typ != "ACKF" {
+		t.Fatalf("got %s, want ACKF", typ)
+	}
+
+	req, err := encodeService(&ua.OpenSecureChannelRequest{
+		RequestHeader: &ua.RequestHeader{
+			AuthenticationToken: ua.NewTwoByteNodeID(0),
+			Timestamp:           time.Now(),
+			AdditionalHeader:    ua.NewExtensionObject(nil),
+		},
+		RequestType:       ua.SecurityTokenRequestTypeIssue,
+		SecurityMode:      ua.MessageSecurityModeNone,
+		ClientNonce:       []byte{},
+		RequestedLifetime: 60000,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hdr := ua.NewBuffer(nil)
+	hdr.WriteUint32(0)
+	hdr.WriteString(ua.SecurityPolicyURINone)
+	hdr.WriteByteString(nil)
+	hdr.WriteByteString(nil)
+	hdr.WriteUint32(1)
+	hdr.WriteUint32(1)
+
+	writeFrame(t, nc, "OPNF", hdr.Bytes(), req)
+
+	typ, body := readFrame(t, nc)
+	if typ != "OPNF" {
+		t.Fatalf("got %s, want OPNF", typ)
+	}
+
+	return nc, binary.LittleEndian.Uint32(body)
+}
+
+func chunk(channel, reqID uint32, size int) []byte {
+	data := make([]byte, 16+size)
+	binary.LittleEndian.PutUint32(data, channel)
+	binary.LittleEndian.PutUint32(data[12:], reqID)
+
+	return data
+}
+
+func TestChunkLimits(t *testing.T) {
+	s, endpoint := newTestServer(t, Config{AllowAnonymous: true}, &testRPC{})
+	defer s.Close()
+
+	addr := endpoint[len("opc.tcp://"):]
+
+	t.Run("partial requests", func(t *testing.T) {
+		nc, channel := openChannel(t, addr)
+		defer nc.Close()
+
+		for reqID := uint32(1); reqID <= maxPartialRequests+1; reqID++ {
+			writeFrame(t, nc, "MSGC", chunk(channel, reqID, 100))
+		}
+
+		typ, body := readFrame(t, nc)
+		if code := errorCode(t, typ, body); code != ua.StatusBadTCPMessageTooLarge {
+			t.Errorf("got %s, want BadTCPMessageTooLarge", code)
+		}
+	})
+
+	t.Run("message size", func(t *testing.T) {
+		nc, channel := openChannel(t, addr)
+		defer nc.Close()
+
+		size := bufSize - 8 - 16
+
+		// server stops reading after error, so chunks are written while it reads
+		go func() {
+			for i := 0; i <= maxMessageSize/size; i++ {
+				c := &conn{nc: nc}
+				if c.writeFrame("MSGC", chunk(channel, 1, size)) != nil {
+					return
+				}
+			}
+		}()
+
+		typ, body := readFrame(t, nc)
+		if code := errorCode(t, typ, body); code != ua.StatusBadRequestTooLarge {
+			t.Errorf("got %s, want BadRequestTooLarge", code)
+		}
+	})
+}
+
+func TestIdentity(t *testing.T) {
+	cases := []struct {
+		name string
+		c    Config
+		opts []opcua.Option
+		ok   bool
+	}{
+		{"anonymous allowed", Config{AllowAnonymous: true}, []opcua.Option{opcua.AuthAnonymous()}, true},
+		{"anonymous rejected", Config{Users: map[string]string{"u": "p"}, AllowInsecure: true},
+			[]opcua.Option{opcua.AuthAnonymous()}, false},
+		{"unknown user", Config{AllowAnonymous: true},
+			[]opcua.Option{opcua.AuthUsername("u", "p"), noneAuthPolicy}, false},
+		{"bad password", Config{Users: map[string]string{"u": "p"}, AllowInsecure: true},
+			[]opcua.Option{opcua.AuthUsername("u", "bad"), noneAuthPolicy}, false},
+		{"user", Config{Users: map[string]string{"u": "p"}, AllowInsecure: true},
+			[]opcua.Option{opcua.AuthUsername("u", "p"), noneAuthPolicy}, true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			s, endpoint := newTestServer(t, c.c, &testRPC{})
+			defer s.Close()
+
+			cli, err := connect(t, endpoint, c.opts...)
+			if (err == nil) != c.ok {
+				t.Fatalf("connected %v, want %v (%v)", err == nil, c.ok, err)
+			}
+
+			if err == nil {
+				cli.Close()
+			}
+		})
+	}
+}
+
+func TestBrowseReadWrite(t *testing.T) {
+	cli := &testRPC{values: map[string]interface{}{"temp": 21.5}}
+
+	s, endpoint := newTestServer(t, Config{AllowAnonymous: true}, cli)
+	defer s.Close()
+
+	// write requests of parameters are prepared by cloud model from write commands
+	setpoint, _ := s.sp.node(ua.NewStringNodeID(ns, "setpoint"))
+	setpoint.param.Write = []byte(`{"jsonrpc": "2.0", "method": "write", "params": {}}`)
+	setpoint.access |= ua.AccessLevelTypeCurrentWrite
+
+	c, err := connect(t, endpoint, opcua.AuthAnonymous())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	refs, err := c.Node(ua.NewStringNodeID(ns, "dev")).References(id.Organizes, ua.BrowseDirectionForward,
+		ua.NodeClassVariable, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, r := range refs {
+		names = append(names, r.BrowseName.Name)
+	}
+
+	if len(names) != 2 || names[0] != "temp" || names[1] != "setpoint" {
+		t.Fatalf("got variables %v, want [temp setpoint]", names)
+	}
+
+	v, err := c.Node(refs[0].NodeID.NodeID).Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v.Value() != 21.5 {
+		t.Errorf("got value %v, want 21.5", v.Value())
+	}
+
+	resp, err := c.Write(&ua.WriteRequest{NodesToWrite: []*ua.WriteValue{
+		{
+			NodeID: ua.NewStringNodeID(ns, "temp"), AttributeID: ua.AttributeIDValue,
+			Value: &ua.DataValue{EncodingMask: ua.DataValueValue, Value: ua.MustVariant(1.0)},
+		},
+		{
+			NodeID: ua.NewStringNodeID(ns, "setpoint"), AttributeID: ua.AttributeIDValue,
+			Value: &ua.DataValue{EncodingMask: ua.DataValueValue, Value: ua.MustVariant("hot")},
+		},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []ua.StatusCode{ua.StatusBadNotWritable, ua.StatusBadTypeMismatch}
+	for i, code := range resp.Results {
+		if code != want[i] {
+			t.Errorf("write %d: got %s, want %s", i, code, want[i])
+		}
+	}
+}
+
+func TestSubscriptionPublish(t *testing.T) {
+	cli := &testRPC{values: map[string]interface{}{"temp": 21.5}}
+
+	s, endpoint := newTestServer(t, Config{AllowAnonymous: true}, cli)
+	defer s.Close()
+
+	c, err := connect(t, endpoint, opcua.AuthAnonymous())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	notifs := make(chan *opcua.PublishNotificationData, 10)
+
+	sub, err := c.Subscribe(&opcua.SubscriptionParameters{Interval: 50 * time.Millisecond}, notifs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	item := opcua.NewMonitoredItemCreateRequestWithDefaults(ua.NewStringNodeID(ns, "temp"), ua.AttributeIDValue, 1)
+
+	res, err := sub.Monitor(ua.TimestampsToReturnBoth, item)
+	if err != nil || res.Results[0].StatusCode != ua.StatusOK {
+		t.Fatal(err, res)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go sub.Run(ctx)
+
+	want := []float64{21.5, 22}
+	timeout := time.After(testTimeout)
+
+	for len(want) > 0 {
+		select {
+		case n := <-notifs:
+			if n.Error != nil {
+				t.Fatal(n.Error)
+			}
+
+			dc, ok := n.Value.(*ua.DataChangeNotification)
+			if !ok {
+				continue
+			}
+
+			for _, item := range dc.MonitoredItems {
+				if len(want) == 0 {
+					break
+				}
+
+				if v := item.Value.Value.Value(); v != want[0] {
+					t.Fatalf("got %v, want %v", v, want[0])
+				}
+
+				want = want[1:]
+
+				// changed value is published by next notification
+				cli.set("temp", 22.0)
+			}
+		case <-timeout:
+			t.Fatalf("values %v are not published", want)
+		}
+	}
+}
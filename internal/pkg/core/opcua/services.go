@@ -0,0 +1,661 @@
+/**
+ * Copyright 2021 Rightech IoT. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package opcua
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/binary"
+	"time"
+
+	"github.com/gopcua/opcua/id"
+	"github.com/gopcua/opcua/ua"
+	jsoniter "github.com/json-iterator/go"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	anonymousPolicy = "anonymous"
+	usernamePolicy  = "username"
+	// continuation points of browse kept by session
+	maxContinuationPoints = 10
+	defaultMaxReferences  = 1000
+)
+
+type session struct {
+	c     *conn
+	id    *ua.NodeID
+	token string
+	user  string
+	// activated session is ready for requests
+	active bool
+
+	// browse continuation points
+	cps    map[string][]*ua.ReferenceDescription
+	lastCP uint32
+
+	subs    map[uint32]*subscription
+	publish []publishRequest
+}
+
+func (ss *session) close() {
+	for _, sub := range ss.subs {
+		sub.stop()
+	}
+
+	ss.subs = nil
+}
+
+func newToken() *ua.NodeID {
+	b := make([]byte, 32)
+	_, _ = rand.Read(b)
+
+	return ua.NewByteStringNodeID(0, b)
+}
+
+func tokenKey(token *ua.NodeID) string {
+	if token == nil {
+		return ""
+	}
+
+	return token.String()
+}
+
+// handle serves request, nil response is sent later
+func (c *conn) handle(reqID uint32, r ua.Request) ua.Response {
+	hdr := r.Header()
+	if hdr == nil {
+		return fault(nil, ua.StatusBadDecodingError)
+	}
+
+	switch req := r.(type) {
+	case *ua.GetEndpointsRequest:
+		return &ua.GetEndpointsResponse{
+			ResponseHeader: responseHeader(hdr, ua.StatusOK),
+			Endpoints:      []*ua.EndpointDescription{c.s.endpoint()},
+		}
+	case *ua.FindServersRequest:
+		return &ua.FindServersResponse{
+			ResponseHeader: responseHeader(hdr, ua.StatusOK),
+			Servers:        []*ua.ApplicationDescription{c.s.application()},
+		}
+	case *ua.CreateSessionRequest:
+		return c.createSession(req)
+	case *ua.ActivateSessionRequest:
+		return c.activateSession(req)
+	}
+
+	c.mx.Lock()
+	ss, ok := c.sessions[tokenKey(hdr.AuthenticationToken)]
+	c.mx.Unlock()
+
+	if !ok || !ss.active {
+		return fault(hdr, ua.StatusBadSessionIDInvalid)
+	}
+
+	switch req := r.(type) {
+	case *ua.CloseSessionRequest:
+		c.closeSession(ss)
+		return &ua.CloseSessionResponse{ResponseHeader: responseHeader(hdr, ua.StatusOK)}
+	case *ua.BrowseRequest:
+		return c.s.sp.browse(ss, req)
+	case *ua.BrowseNextRequest:
+		return c.s.sp.browseNext(ss, req)
+	case *ua.TranslateBrowsePathsToNodeIDsRequest:
+		return c.s.sp.translate(req)
+	case *ua.ReadRequest:
+		return c.s.sp.read(req)
+	case *ua.WriteRequest:
+		return c.s.sp.write(ss, req)
+	}
+
+	return c.subscriptions(ss, reqID, r)
+}
+
+func (s *Server) application() *ua.ApplicationDescription {
+	return &ua.ApplicationDescription{
+		ApplicationURI:  s.uri,
+		ProductURI:      "urn:ric-edge",
+		ApplicationName: ua.NewLocalizedText("ric-edge"),
+		ApplicationType: ua.ApplicationTypeServer,
+		DiscoveryURLs:   []string{s.c.Endpoint},
+	}
+}
+
+func (s *Server) endpoint() *ua.EndpointDescription {
+	var tokens []*ua.UserTokenPolicy
+
+	if s.c.AllowAnonymous {
+		tokens = append(tokens, &ua.UserTokenPolicy{
+			PolicyID: anonymousPolicy, TokenType: ua.UserTokenTypeAnonymous,
+		})
+	}
+
+	if len(s.c.Users) > 0 {
+		tokens = append(tokens, &ua.UserTokenPolicy{
+			PolicyID: usernamePolicy, TokenType: ua.UserTokenTypeUserName,
+			SecurityPolicyURI: ua.SecurityPolicyURINone,
+		})
+	}
+
+	return &ua.EndpointDescription{
+		EndpointURL:         s.c.Endpoint,
+		Server:              s.application(),
+		SecurityMode:        ua.MessageSecurityModeNone,
+		SecurityPolicyURI:   ua.SecurityPolicyURINone,
+		UserIdentityTokens:  tokens,
+		TransportProfileURI: transportProfile,
+	}
+}
+
+func (c *conn) createSession(req *ua.CreateSessionRequest) ua.Response {
+	c.s.mx.Lock()
+	if c.s.c.MaxSessions > 0 && c.s.sessions >= c.s.c.MaxSessions {
+		c.s.mx.Unlock()
+		return fault(req.RequestHeader, ua.StatusBadTooManySessions)
+	}
+
+	c.s.sessions++
+	c.s.mx.Unlock()
+
+	ss := &session{
+		c: c, id: ua.NewNumericNodeID(ns, c.s.id()),
+		cps:  make(map[string][]*ua.ReferenceDescription),
+		subs: make(map[uint32]*subscription),
+	}
+
+	token := newToken()
+	ss.token = token.String()
+
+	c.mx.Lock()
+	c.sessions[ss.token] = ss
+	c.mx.Unlock()
+
+	// session lives while secure channel is open
+	return &ua.CreateSessionResponse{
+		ResponseHeader:        responseHeader(req.RequestHeader, ua.StatusOK),
+		SessionID:             ss.id,
+		AuthenticationToken:   token,
+		RevisedSessionTimeout: float64(c.lifetime / time.Millisecond),
+		ServerNonce:           make([]byte, 32),
+		ServerEndpoints:       []*ua.EndpointDescription{c.s.endpoint()},
+		ServerSignature:       &ua.SignatureData{},
+		MaxRequestMessageSize: maxMessageSize,
+	}
+}
+
+func (c *conn) activateSession(req *ua.ActivateSessionRequest) ua.Response {
+	c.mx.Lock()
+	ss, ok := c.sessions[tokenKey(req.RequestHeader.AuthenticationToken)]
+	c.mx.Unlock()
+
+	if !ok {
+		return fault(req.RequestHeader, ua.StatusBadSessionIDInvalid)
+	}
+
+	user, code := c.s.identity(req.UserIdentityToken)
+	if code != ua.StatusOK {
+		return fault(req.RequestHeader, code)
+	}
+
+	c.mx.Lock()
+	ss.user, ss.active = user, true
+	c.mx.Unlock()
+
+	log.WithFields(log.Fields{
+		"remote": c.nc.RemoteAddr().String(),
+		"user":   user,
+	}).Debug("opcua: session activated")
+
+	return &ua.ActivateSessionResponse{
+		ResponseHeader: responseHeader(req.RequestHeader, ua.StatusOK),
+		ServerNonce:    make([]byte, 32),
+	}
+}
+
+// identity checks user token and returns user name
+func (s *Server) identity(token *ua.ExtensionObject) (string, ua.StatusCode) {
+	var value interface{}
+	if token != nil {
+		value = token.Value
+	}
+
+	switch t := value.(type) {
+	case nil, *ua.AnonymousIdentityToken:
+		if !s.c.AllowAnonymous {
+			return "", ua.StatusBadIdentityTokenRejected
+		}
+
+		return "", ua.StatusOK
+	case *ua.UserNameIdentityToken:
+		if t.EncryptionAlgorithm != "" {
+			return "", ua.StatusBadIdentityTokenInvalid
+		}
+
+		if !s.c.AllowInsecure {
+			return "", ua.StatusBadIdentityTokenRejected
+		}
+
+		pass, ok := s.c.Users[t.UserName]
+		if !ok || subtle.ConstantTimeCompare([]byte(pass), t.Password) != 1 {
+			return "", ua.StatusBadUserAccessDenied
+		}
+
+		return t.UserName, ua.StatusOK
+	}
+
+	return "", ua.StatusBadIdentityTokenInvalid
+}
+
+func (c *conn) closeSession(ss *session) {
+	c.mx.Lock()
+	ss.close()
+
+	_, ok := c.sessions[ss.token]
+	delete(c.sessions, ss.token)
+	c.mx.Unlock()
+
+	if ok {
+		c.s.mx.Lock()
+		c.s.sessions--
+		c.s.mx.Unlock()
+	}
+}
+
+func (sp *space) reference(n *node, ref uint32, forward bool) *ua.ReferenceDescription {
+	return &ua.ReferenceDescription{
+		ReferenceTypeID: ua.NewNumericNodeID(0, ref),
+		IsForward:       forward,
+		NodeID:          &ua.ExpandedNodeID{NodeID: n.id},
+		BrowseName:      n.name,
+		DisplayName:     ua.NewLocalizedText(n.display),
+		NodeClass:       n.class,
+		TypeDefinition:  &ua.ExpandedNodeID{NodeID: ua.NewNumericNodeID(0, n.typeDef)},
+	}
+}
+
+// references returns references of node matched by browse description
+func (sp *space) references(n *node, d *ua.BrowseDescription) []*ua.ReferenceDescription {
+	var (
+		res     []*ua.ReferenceDescription
+		refType uint32
+	)
+
+	if d.ReferenceTypeID != nil && d.ReferenceTypeID.IntID() != 0 {
+		refType = d.ReferenceTypeID.IntID()
+	}
+
+	match := func(ref uint32, target *node) bool {
+		if refType != 0 && !isSubtype(ref, refType, d.IncludeSubtypes) {
+			return false
+		}
+
+		return d.NodeClassMask == 0 || d.NodeClassMask&uint32(target.class) != 0
+	}
+
+	if d.BrowseDirection != ua.BrowseDirectionInverse {
+		for _, cn := range n.children {
+			if match(cn.ref, cn) {
+				res = append(res, sp.reference(cn, cn.ref, true))
+			}
+		}
+
+		// type definition nodes are not in address space, so class mask is checked for it
+		if n.typeDef != 0 && (refType == 0 || isSubtype(id.HasTypeDefinition, refType, d.IncludeSubtypes)) &&
+			(d.NodeClassMask == 0 || d.NodeClassMask&uint32(typeClass(n)) != 0) {
+			res = append(res, &ua.ReferenceDescription{
+				ReferenceTypeID: ua.NewNumericNodeID(0, id.HasTypeDefinition),
+				IsForward:       true,
+				NodeID:          &ua.ExpandedNodeID{NodeID: ua.NewNumericNodeID(0, n.typeDef)},
+				BrowseName:      &ua.QualifiedName{Name: id.Name(n.typeDef)},
+				DisplayName:     ua.NewLocalizedText(id.Name(n.typeDef)),
+				NodeClass:       typeClass(n),
+				TypeDefinition:  &ua.ExpandedNodeID{NodeID: ua.NewTwoByteNodeID(0)},
+			})
+		}
+	}
+
+	if d.BrowseDirection != ua.BrowseDirectionForward && n.parent != nil && match(n.ref, n.parent) {
+		res = append(res, sp.reference(n.parent, n.ref, false))
+	}
+
+	return res
+}
+
+func typeClass(n *node) ua.NodeClass {
+	if n.class == ua.NodeClassVariable {
+		return ua.NodeClassVariableType
+	}
+
+	return ua.NodeClassObjectType
+}
+
+func (sp *space) browse(ss *session, req *ua.BrowseRequest) ua.Response {
+	max := int(req.RequestedMaxReferencesPerNode)
+	if max == 0 || max > defaultMaxReferences {
+		max = defaultMaxReferences
+	}
+
+	res := make([]*ua.BrowseResult, len(req.NodesToBrowse))
+
+	for i, d := range req.NodesToBrowse {
+		n, ok := sp.node(d.NodeID)
+		if !ok {
+			res[i] = &ua.BrowseResult{StatusCode: ua.StatusBadNodeIDUnknown}
+			continue
+		}
+
+		res[i] = sp.page(ss, sp.references(n, d), max)
+	}
+
+	return &ua.BrowseResponse{
+		ResponseHeader: responseHeader(req.RequestHeader, ua.StatusOK),
+		Results:        res,
+	}
+}
+
+// page returns first max references, the rest is saved to continuation point
+func (sp *space) page(ss *session, refs []*ua.ReferenceDescription, max int) *ua.BrowseResult {
+	if len(refs) <= max {
+		return &ua.BrowseResult{References: refs}
+	}
+
+	ss.c.mx.Lock()
+	defer ss.c.mx.Unlock()
+
+	if len(ss.cps) >= maxContinuationPoints {
+		return &ua.BrowseResult{StatusCode: ua.StatusBadNoContinuationPoints}
+	}
+
+	ss.lastCP++
+
+	cp := make([]byte, 4)
+	binary.LittleEndian.PutUint32(cp, ss.lastCP)
+
+	ss.cps[string(cp)] = refs[max:]
+
+	return &ua.BrowseResult{ContinuationPoint: cp, References: refs[:max]}
+}
+
+func (sp *space) browseNext(ss *session, req *ua.BrowseNextRequest) ua.Response {
+	res := make([]*ua.BrowseResult, len(req.ContinuationPoints))
+
+	for i, cp := range req.ContinuationPoints {
+		ss.c.mx.Lock()
+		refs, ok := ss.cps[string(cp)]
+		delete(ss.cps, string(cp))
+		ss.c.mx.Unlock()
+
+		switch {
+		case !ok:
+			res[i] = &ua.BrowseResult{StatusCode: ua.StatusBadContinuationPointInvalid}
+		case req.ReleaseContinuationPoints:
+			res[i] = &ua.BrowseResult{}
+		default:
+			res[i] = sp.page(ss, refs, defaultMaxReferences)
+		}
+	}
+
+	return &ua.BrowseNextResponse{
+		ResponseHeader: responseHeader(req.RequestHeader, ua.StatusOK),
+		Results:        res,
+	}
+}
+
+func (sp *space) translate(req *ua.TranslateBrowsePathsToNodeIDsRequest) ua.Response {
+	res := make([]*ua.BrowsePathResult, len(req.BrowsePaths))
+
+	for i, p := range req.BrowsePaths {
+		res[i] = sp.follow(p)
+	}
+
+	return &ua.TranslateBrowsePathsToNodeIDsResponse{
+		ResponseHeader: responseHeader(req.RequestHeader, ua.StatusOK),
+		Results:        res,
+	}
+}
+
+func (sp *space) follow(p *ua.BrowsePath) *ua.BrowsePathResult {
+	n, ok := sp.node(p.StartingNode)
+	if !ok {
+		return &ua.BrowsePathResult{StatusCode: ua.StatusBadNodeIDUnknown}
+	}
+
+	if p.RelativePath == nil || len(p.RelativePath.Elements) == 0 {
+		return &ua.BrowsePathResult{StatusCode: ua.StatusBadNothingToDo}
+	}
+
+	nodes := []*node{n}
+
+	for _, e := range p.RelativePath.Elements {
+		if e.TargetName == nil || e.TargetName.Name == "" {
+			return &ua.BrowsePathResult{StatusCode: ua.StatusBadBrowseNameInvalid}
+		}
+
+		var refType uint32
+		if e.ReferenceTypeID != nil {
+			refType = e.ReferenceTypeID.IntID()
+		}
+
+		var next []*node
+
+		for _, n := range nodes {
+			var candidates []*node
+			if e.IsInverse {
+				if n.parent != nil {
+					candidates = []*node{n}
+				}
+			} else {
+				candidates = n.children
+			}
+
+			for _, cn := range candidates {
+				target := cn
+				if e.IsInverse {
+					target = cn.parent
+				}
+
+				if (refType == 0 || isSubtype(cn.ref, refType, e.IncludeSubtypes)) &&
+					target.name.NamespaceIndex == e.TargetName.NamespaceIndex &&
+					target.name.Name == e.TargetName.Name {
+					next = append(next, target)
+				}
+			}
+		}
+
+		if len(next) == 0 {
+			return &ua.BrowsePathResult{StatusCode: ua.StatusBadNoMatch}
+		}
+
+		nodes = next
+	}
+
+	targets := make([]*ua.BrowsePathTarget, len(nodes))
+	for i, n := range nodes {
+		targets[i] = &ua.BrowsePathTarget{
+			TargetID:           &ua.ExpandedNodeID{NodeID: n.id},
+			RemainingPathIndex: 0xffffffff,
+		}
+	}
+
+	return &ua.BrowsePathResult{Targets: targets}
+}
+
+func (sp *space) read(req *ua.ReadRequest) ua.Response {
+	res := make([]*ua.DataValue, len(req.NodesToRead))
+
+	for i, r := range req.NodesToRead {
+		res[i] = sp.attribute(r, req.TimestampsToReturn)
+		res[i].UpdateMask()
+	}
+
+	return &ua.ReadResponse{
+		ResponseHeader: responseHeader(req.RequestHeader, ua.StatusOK),
+		Results:        res,
+	}
+}
+
+// attribute reads attribute of node
+func (sp *space) attribute(r *ua.ReadValueID, ts ua.TimestampsToReturn) *ua.DataValue {
+	n, ok := sp.node(r.NodeID)
+	if !ok {
+		return &ua.DataValue{Status: ua.StatusBadNodeIDUnknown}
+	}
+
+	if r.IndexRange != "" && r.AttributeID != ua.AttributeIDValue {
+		return &ua.DataValue{Status: ua.StatusBadIndexRangeNoData}
+	}
+
+	var v interface{}
+
+	switch r.AttributeID {
+	case ua.AttributeIDNodeID:
+		v = n.id
+	case ua.AttributeIDNodeClass:
+		v = int32(n.class)
+	case ua.AttributeIDBrowseName:
+		v = n.name
+	case ua.AttributeIDDisplayName:
+		v = ua.NewLocalizedText(n.display)
+	case ua.AttributeIDDescription:
+		v = ua.NewLocalizedText(n.display)
+	case ua.AttributeIDWriteMask, ua.AttributeIDUserWriteMask:
+		v = uint32(0)
+	case ua.AttributeIDEventNotifier:
+		if n.class != ua.NodeClassObject {
+			return &ua.DataValue{Status: ua.StatusBadAttributeIDInvalid}
+		}
+
+		v = byte(0)
+	case ua.AttributeIDValue:
+		if n.class != ua.NodeClassVariable {
+			return &ua.DataValue{Status: ua.StatusBadAttributeIDInvalid}
+		}
+
+		if r.IndexRange != "" {
+			return &ua.DataValue{Status: ua.StatusBadIndexRangeInvalid}
+		}
+
+		dv := n.value()
+		dv.ServerTimestamp = time.Now()
+
+		if ts == ua.TimestampsToReturnServer || ts == ua.TimestampsToReturnNeither {
+			dv.SourceTimestamp = time.Time{}
+		}
+
+		if ts == ua.TimestampsToReturnSource || ts == ua.TimestampsToReturnNeither {
+			dv.ServerTimestamp = time.Time{}
+		}
+
+		return dv
+	default:
+		if n.class != ua.NodeClassVariable {
+			return &ua.DataValue{Status: ua.StatusBadAttributeIDInvalid}
+		}
+
+		v, ok = variableAttribute(n, r.AttributeID)
+		if !ok {
+			return &ua.DataValue{Status: ua.StatusBadAttributeIDInvalid}
+		}
+	}
+
+	return &ua.DataValue{Value: ua.MustVariant(v)}
+}
+
+func variableAttribute(n *node, attr ua.AttributeID) (interface{}, bool) {
+	switch attr {
+	case ua.AttributeIDDataType:
+		return ua.NewNumericNodeID(0, n.dataType), true
+	case ua.AttributeIDValueRank:
+		return n.valueRank, true
+	case ua.AttributeIDArrayDimensions:
+		if n.valueRank < 1 {
+			return []uint32{}, true
+		}
+
+		return []uint32{0}, true
+	case ua.AttributeIDAccessLevel, ua.AttributeIDUserAccessLevel:
+		return byte(n.access), true
+	case ua.AttributeIDMinimumSamplingInterval:
+		return float64(0), true
+	case ua.AttributeIDHistorizing:
+		return false, true
+	}
+
+	return nil, false
+}
+
+func (sp *space) write(ss *session, req *ua.WriteRequest) ua.Response {
+	res := make([]ua.StatusCode, len(req.NodesToWrite))
+
+	for i, w := range req.NodesToWrite {
+		res[i] = sp.writeValue(ss, w)
+	}
+
+	return &ua.WriteResponse{
+		ResponseHeader: responseHeader(req.RequestHeader, ua.StatusOK),
+		Results:        res,
+	}
+}
+
+// writeValue calls write command of parameter
+func (sp *space) writeValue(ss *session, w *ua.WriteValue) ua.StatusCode {
+	n, ok := sp.node(w.NodeID)
+	if !ok {
+		return ua.StatusBadNodeIDUnknown
+	}
+
+	if w.AttributeID != ua.AttributeIDValue || n.param == nil {
+		return ua.StatusBadNotWritable
+	}
+
+	if n.param.Write == nil {
+		return ua.StatusBadNotWritable
+	}
+
+	if w.IndexRange != "" {
+		return ua.StatusBadWriteNotSupported
+	}
+
+	if w.Value == nil || w.Value.Value == nil || w.Value.Value.Value() == nil {
+		return ua.StatusBadTypeMismatch
+	}
+
+	value, ok := convert(n.dataType, w.Value.Value.Value())
+	if !ok {
+		return ua.StatusBadTypeMismatch
+	}
+
+	logger := log.WithFields(log.Fields{"param": n.param.ID, "user": ss.user})
+
+	payload, err := n.param.WriteRequest(value)
+	if err != nil {
+		logger.WithError(err).Error("opcua: bad write request")
+		return ua.StatusBadInternalError
+	}
+
+	resp := sp.s.rpc.Call(n.param.Connector, payload)
+
+	if e := jsoniter.ConfigFastest.Get(resp, "error"); e.LastError() == nil {
+		logger.WithField("error", e.ToString()).Error("opcua: write failed")
+		return ua.StatusBadCommunicationError
+	}
+
+	logger.WithField("value", value).Debug("opcua: written")
+
+	return ua.StatusOK
+}
@@ -0,0 +1,356 @@
+/**
+ * Copyright 2021 Rightech IoT. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package opcua
+
+import (
+	"encoding/json"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/gopcua/opcua/id"
+	"github.com/gopcua/opcua/ua"
+
+	"github.com/Rightech/ric-edge/internal/pkg/core/cloud"
+)
+
+// namespace of edge nodes
+const (
+	ns    = 1
+	nsURI = "urn:ric-edge:model"
+)
+
+// subtypes of used reference types
+var refParents = map[uint32]uint32{
+	id.HierarchicalReferences:    id.References,
+	id.NonHierarchicalReferences: id.References,
+	id.HasChild:                  id.HierarchicalReferences,
+	id.Organizes:                 id.HierarchicalReferences,
+	id.Aggregates:                id.HasChild,
+	id.HasComponent:              id.Aggregates,
+	id.HasProperty:               id.Aggregates,
+	id.HasTypeDefinition:         id.NonHierarchicalReferences,
+}
+
+// isSubtype checks that ref is base or (if subtypes is set) its subtype
+func isSubtype(ref, base uint32, subtypes bool) bool {
+	if ref == base {
+		return true
+	}
+
+	for subtypes {
+		parent, ok := refParents[ref]
+		if !ok {
+			return false
+		}
+
+		if parent == base {
+			return true
+		}
+
+		ref = parent
+	}
+
+	return false
+}
+
+type node struct {
+	id      *ua.NodeID
+	class   ua.NodeClass
+	name    *ua.QualifiedName
+	display string
+	typeDef uint32
+	// reference from parent
+	parent *node
+	ref    uint32
+	// forward hierarchical references
+	children []*node
+
+	// variables only
+	dataType  uint32
+	valueRank int32
+	access    ua.AccessLevelType
+	param     *cloud.Param
+	value     func() *ua.DataValue
+}
+
+// space is address space of server
+// it's built on start and not changed after
+type space struct {
+	s     *Server
+	nodes map[string]*node
+}
+
+func newSpace(s *Server, edge string, model cloud.Model) *space {
+	sp := &space{s: s, nodes: make(map[string]*node)}
+
+	root := sp.add(nil, 0, &node{
+		id: ua.NewNumericNodeID(0, id.RootFolder), class: ua.NodeClassObject,
+		name: &ua.QualifiedName{Name: "Root"}, typeDef: id.FolderType,
+	})
+
+	objects := sp.folder(root, ua.NewNumericNodeID(0, id.ObjectsFolder), 0, "Objects")
+	sp.folder(root, ua.NewNumericNodeID(0, id.TypesFolder), 0, "Types")
+	sp.folder(root, ua.NewNumericNodeID(0, id.ViewsFolder), 0, "Views")
+
+	sp.server(objects)
+
+	params := make(map[string]cloud.Param)
+	for _, p := range model.Params() {
+		params[p.ID] = p
+	}
+
+	folder := sp.folder(objects, ua.NewNumericNodeID(ns, 1), ns, edge)
+	sp.walk(folder, params, model.Data.Children)
+
+	return sp
+}
+
+func (sp *space) add(parent *node, ref uint32, n *node) *node {
+	if n.display == "" {
+		n.display = n.name.Name
+	}
+
+	if parent != nil {
+		n.parent, n.ref = parent, ref
+		parent.children = append(parent.children, n)
+	}
+
+	sp.nodes[n.id.String()] = n
+
+	return n
+}
+
+func (sp *space) folder(parent *node, nid *ua.NodeID, nsIdx uint16, name string) *node {
+	return sp.add(parent, id.Organizes, &node{
+		id: nid, class: ua.NodeClassObject, typeDef: id.FolderType,
+		name: &ua.QualifiedName{NamespaceIndex: nsIdx, Name: name},
+	})
+}
+
+func (sp *space) static(parent *node, ref, nid uint32, name string, dataType uint32,
+	valueRank int32, fn func() interface{}) {
+	typeDef := uint32(id.BaseDataVariableType)
+	if ref == id.HasProperty {
+		typeDef = id.PropertyType
+	}
+
+	sp.add(parent, ref, &node{
+		id: ua.NewNumericNodeID(0, nid), class: ua.NodeClassVariable,
+		name: &ua.QualifiedName{Name: name}, typeDef: typeDef,
+		dataType: dataType, valueRank: valueRank, access: ua.AccessLevelTypeCurrentRead,
+		value: func() *ua.DataValue {
+			return &ua.DataValue{Value: ua.MustVariant(fn()), SourceTimestamp: time.Now()}
+		},
+	})
+}
+
+// server adds Server object with mandatory variables
+func (sp *space) server(objects *node) {
+	server := sp.add(objects, id.Organizes, &node{
+		id: ua.NewNumericNodeID(0, id.Server), class: ua.NodeClassObject,
+		name: &ua.QualifiedName{Name: "Server"}, typeDef: id.ServerType,
+	})
+
+	sp.static(server, id.HasProperty, id.Server_ServerArray, "ServerArray", id.String, 1,
+		func() interface{} { return []string{sp.s.uri} })
+	sp.static(server, id.HasProperty, id.Server_NamespaceArray, "NamespaceArray", id.String, 1,
+		func() interface{} { return []string{"http://opcfoundation.org/UA/", nsURI} })
+
+	status := sp.add(server, id.HasComponent, &node{
+		id: ua.NewNumericNodeID(0, id.Server_ServerStatus), class: ua.NodeClassVariable,
+		name: &ua.QualifiedName{Name: "ServerStatus"}, typeDef: id.ServerStatusType,
+		dataType: id.ServerStatusDataType, valueRank: -1, access: ua.AccessLevelTypeCurrentRead,
+		value: func() *ua.DataValue {
+			return &ua.DataValue{
+				Value: ua.MustVariant(ua.NewExtensionObject(&ua.ServerStatusDataType{
+					StartTime:   sp.s.start,
+					CurrentTime: time.Now(),
+					State:       ua.ServerStateRunning,
+					BuildInfo: &ua.BuildInfo{
+						ProductURI:  "urn:ric-edge",
+						ProductName: "ric-edge",
+						BuildDate:   sp.s.start,
+					},
+					ShutdownReason: &ua.LocalizedText{},
+				})),
+				SourceTimestamp: time.Now(),
+			}
+		},
+	})
+
+	sp.static(status, id.HasComponent, id.Server_ServerStatus_StartTime, "StartTime", id.UtcTime, -1,
+		func() interface{} { return sp.s.start })
+	sp.static(status, id.HasComponent, id.Server_ServerStatus_CurrentTime, "CurrentTime", id.UtcTime, -1,
+		func() interface{} { return time.Now() })
+	sp.static(status, id.HasComponent, id.Server_ServerStatus_State, "State", id.ServerState, -1,
+		func() interface{} { return int32(ua.ServerStateRunning) })
+}
+
+// walk adds model nodes in the same way as cloud.Model walk finds parameters:
+// subsystems and groups are folders, parameters are variables
+func (sp *space) walk(parent *node, params map[string]cloud.Param, children []cloud.Children) {
+	for _, c := range children {
+		if !c.Active || c.Type == "action" {
+			continue
+		}
+
+		if p, ok := params[c.ID]; ok {
+			sp.variable(parent, p)
+
+			if c.Edge.Read.Command != "" || c.Edge.Write.Command != "" {
+				continue
+			}
+		}
+
+		if len(c.Children) == 0 {
+			continue
+		}
+
+		name := c.Name
+		if name == "" {
+			name = c.ID
+		}
+
+		folder := sp.folder(parent, ua.NewStringNodeID(ns, c.ID), ns, name)
+		sp.walk(folder, params, c.Children)
+	}
+}
+
+func (sp *space) variable(parent *node, p cloud.Param) {
+	n := &node{
+		id: ua.NewStringNodeID(ns, p.ID), class: ua.NodeClassVariable,
+		name: &ua.QualifiedName{NamespaceIndex: ns, Name: p.ID}, display: p.Name,
+		typeDef: id.BaseDataVariableType, dataType: dataType(p.DataType), valueRank: -1,
+		access: ua.AccessLevelTypeCurrentRead, param: &p,
+	}
+
+	if p.Write != nil {
+		n.access |= ua.AccessLevelTypeCurrentWrite
+	}
+
+	n.value = func() *ua.DataValue { return sp.paramValue(n) }
+
+	sp.add(parent, id.Organizes, n)
+}
+
+func (sp *space) paramValue(n *node) *ua.DataValue {
+	v, ok := sp.s.rpc.Value(n.param.ID)
+	if !ok || v == nil {
+		return &ua.DataValue{Value: &ua.Variant{}, Status: ua.StatusBadWaitingForInitialData}
+	}
+
+	dv := &ua.DataValue{SourceTimestamp: sp.s.changed(n.param.ID)}
+
+	val, ok := convert(n.dataType, v)
+	if !ok {
+		dv.Value, dv.Status = &ua.Variant{}, ua.StatusBadTypeMismatch
+		return dv
+	}
+
+	dv.Value = ua.MustVariant(val)
+
+	return dv
+}
+
+func (sp *space) node(nid *ua.NodeID) (*node, bool) {
+	if nid == nil {
+		return nil, false
+	}
+
+	n, ok := sp.nodes[nid.String()]
+
+	return n, ok
+}
+
+func dataType(t string) uint32 {
+	switch strings.ToLower(t) {
+	case "", "number", "double", "float":
+		return id.Double
+	case "integer", "int":
+		return id.Int64
+	case "boolean", "bool":
+		return id.Boolean
+	default:
+		return id.String
+	}
+}
+
+// convert converts state or written value to value of data type
+func convert(dataType uint32, v interface{}) (interface{}, bool) {
+	switch dataType {
+	case id.Double:
+		f, ok := number(v)
+		return f, ok
+	case id.Int64:
+		f, ok := number(v)
+		if !ok || f != math.Trunc(f) || math.Abs(f) > math.MaxInt64 {
+			return nil, false
+		}
+
+		return int64(f), true
+	case id.Boolean:
+		b, ok := v.(bool)
+		return b, ok
+	}
+
+	if s, ok := v.(string); ok {
+		return s, true
+	}
+
+	// objects and arrays are written as json
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, false
+	}
+
+	return string(data), true
+}
+
+func number(v interface{}) (float64, bool) {
+	switch vv := v.(type) {
+	case float64:
+		return vv, true
+	case float32:
+		return float64(vv), true
+	case int:
+		return float64(vv), true
+	case int8:
+		return float64(vv), true
+	case int16:
+		return float64(vv), true
+	case int32:
+		return float64(vv), true
+	case int64:
+		return float64(vv), true
+	case uint:
+		return float64(vv), true
+	case uint8:
+		return float64(vv), true
+	case uint16:
+		return float64(vv), true
+	case uint32:
+		return float64(vv), true
+	case uint64:
+		return float64(vv), true
+	case json.Number:
+		f, err := vv.Float64()
+		return f, err == nil
+	}
+
+	return 0, false
+}
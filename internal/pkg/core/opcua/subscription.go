@@ -0,0 +1,592 @@
+/**
+ * Copyright 2021 Rightech IoT. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package opcua
+
+import (
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/gopcua/opcua/id"
+	"github.com/gopcua/opcua/ua"
+)
+
+const (
+	minPublishingInterval = 100 * time.Millisecond
+	maxPublishingInterval = time.Hour
+	maxKeepAliveCount     = 1000
+	maxQueueSize          = 100
+	// queued publish requests of session
+	maxPublishRequests = 10
+	// sent messages kept for republish
+	maxRetransmission = 10
+	maxNotifications  = 1000
+)
+
+type publishRequest struct {
+	reqID  uint32
+	header *ua.RequestHeader
+	// acknowledgements results
+	results []ua.StatusCode
+}
+
+type monitoredItem struct {
+	id     uint32
+	handle uint32
+	node   *node
+	mode   ua.MonitoringMode
+	// timestamps returned with values
+	ts      ua.TimestampsToReturn
+	size    int
+	oldest  bool
+	last    *ua.DataValue
+	pending []*ua.DataValue
+}
+
+// sample adds value to queue if it's changed
+func (mi *monitoredItem) sample() {
+	if mi.mode == ua.MonitoringModeDisabled {
+		return
+	}
+
+	dv := mi.node.value()
+	if mi.last != nil && mi.last.Status == dv.Status &&
+		reflect.DeepEqual(mi.last.Value.Value(), dv.Value.Value()) {
+		return
+	}
+
+	mi.last = dv
+
+	if mi.ts == ua.TimestampsToReturnServer || mi.ts == ua.TimestampsToReturnNeither {
+		dv = &ua.DataValue{Value: dv.Value, Status: dv.Status}
+	} else {
+		dv = &ua.DataValue{Value: dv.Value, Status: dv.Status, SourceTimestamp: dv.SourceTimestamp}
+	}
+
+	if mi.ts == ua.TimestampsToReturnServer || mi.ts == ua.TimestampsToReturnBoth {
+		dv.ServerTimestamp = time.Now()
+	}
+
+	dv.UpdateMask()
+
+	if len(mi.pending) == mi.size {
+		if !mi.oldest {
+			mi.pending[len(mi.pending)-1] = dv
+			return
+		}
+
+		mi.pending = mi.pending[1:]
+	}
+
+	mi.pending = append(mi.pending, dv)
+}
+
+type subscription struct {
+	ss        *session
+	id        uint32
+	interval  time.Duration
+	lifetime  uint32
+	keepAlive uint32
+	max       uint32
+	enabled   bool
+
+	items map[uint32]*monitoredItem
+	seq   uint32
+	// ticks without notifications and without publish requests
+	idle uint32
+	late uint32
+	// first message is sent on first tick
+	sent    bool
+	retrans map[uint32]*ua.NotificationMessage
+
+	done chan struct{}
+}
+
+func (sub *subscription) revise(interval float64, lifetime, keepAlive, max uint32) {
+	sub.interval = time.Duration(interval * float64(time.Millisecond))
+	if sub.interval < minPublishingInterval {
+		sub.interval = minPublishingInterval
+	}
+
+	if sub.interval > maxPublishingInterval {
+		sub.interval = maxPublishingInterval
+	}
+
+	if keepAlive == 0 {
+		keepAlive = 10
+	}
+
+	if keepAlive > maxKeepAliveCount {
+		keepAlive = maxKeepAliveCount
+	}
+
+	// lifetime should be at least three keep alive counts
+	if lifetime < keepAlive*3 {
+		lifetime = keepAlive * 3
+	}
+
+	if max == 0 || max > maxNotifications {
+		max = maxNotifications
+	}
+
+	sub.lifetime, sub.keepAlive, sub.max = lifetime, keepAlive, max
+}
+
+// start starts publishing (c.mx should be locked)
+func (sub *subscription) start() {
+	sub.done = make(chan struct{})
+	interval := sub.interval
+
+	go func() {
+		for {
+			select {
+			case <-sub.done:
+				return
+			case <-time.After(interval):
+				// new interval of modified subscription is used after tick
+				interval = sub.tick()
+			}
+		}
+	}()
+}
+
+func (sub *subscription) stop() {
+	close(sub.done)
+}
+
+// tick samples items and sends notification or keep alive message
+// it returns current publishing interval
+func (sub *subscription) tick() time.Duration {
+	c := sub.ss.c
+
+	c.mx.Lock()
+
+	interval := sub.interval
+
+	if sub.ss.subs[sub.id] != sub {
+		c.mx.Unlock()
+		return interval
+	}
+
+	var ready bool
+
+	if sub.enabled {
+		for _, mi := range sub.items {
+			mi.sample()
+
+			ready = ready || (len(mi.pending) > 0 && mi.mode == ua.MonitoringModeReporting)
+		}
+	}
+
+	if !ready && sub.sent && sub.idle+1 < sub.keepAlive {
+		sub.idle++
+		c.mx.Unlock()
+
+		return interval
+	}
+
+	if len(sub.ss.publish) == 0 {
+		sub.late++
+		if sub.late >= sub.lifetime {
+			delete(sub.ss.subs, sub.id)
+			sub.stop()
+		}
+
+		c.mx.Unlock()
+
+		return interval
+	}
+
+	pr := sub.ss.publish[0]
+	sub.ss.publish = sub.ss.publish[1:]
+	sub.idle, sub.late, sub.sent = 0, 0, true
+
+	resp := sub.message(pr, ready)
+
+	c.mx.Unlock()
+
+	_ = c.send(pr.reqID, resp)
+
+	return interval
+}
+
+// message builds publish response (c.mx should be locked)
+func (sub *subscription) message(pr publishRequest, ready bool) *ua.PublishResponse {
+	msg := &ua.NotificationMessage{
+		SequenceNumber:   sub.seq + 1,
+		PublishTime:      time.Now(),
+		NotificationData: []*ua.ExtensionObject{},
+	}
+
+	var more bool
+
+	if ready {
+		var items []*ua.MonitoredItemNotification
+
+		for _, mi := range sub.sorted() {
+			if mi.mode != ua.MonitoringModeReporting {
+				continue
+			}
+
+			for len(mi.pending) > 0 && uint32(len(items)) < sub.max {
+				items = append(items, &ua.MonitoredItemNotification{
+					ClientHandle: mi.handle,
+					Value:        mi.pending[0],
+				})
+				mi.pending = mi.pending[1:]
+			}
+
+			more = more || len(mi.pending) > 0
+		}
+
+		msg.NotificationData = append(msg.NotificationData, &ua.ExtensionObject{
+			EncodingMask: ua.ExtensionObjectBinary,
+			TypeID:       ua.NewFourByteExpandedNodeID(0, id.DataChangeNotification_Encoding_DefaultBinary),
+			Value:        &ua.DataChangeNotification{MonitoredItems: items},
+		})
+
+		sub.seq++
+		sub.retrans[msg.SequenceNumber] = msg
+
+		// drop oldest message
+		if len(sub.retrans) > maxRetransmission {
+			delete(sub.retrans, sub.available()[0])
+		}
+	}
+
+	return &ua.PublishResponse{
+		ResponseHeader:           responseHeader(pr.header, ua.StatusOK),
+		SubscriptionID:           sub.id,
+		AvailableSequenceNumbers: sub.available(),
+		MoreNotifications:        more,
+		NotificationMessage:      msg,
+		Results:                  pr.results,
+	}
+}
+
+func (sub *subscription) sorted() []*monitoredItem {
+	items := make([]*monitoredItem, 0, len(sub.items))
+	for _, mi := range sub.items {
+		items = append(items, mi)
+	}
+
+	sort.Slice(items, func(i, j int) bool { return items[i].id < items[j].id })
+
+	return items
+}
+
+func (sub *subscription) available() []uint32 {
+	seqs := make([]uint32, 0, len(sub.retrans))
+	for seq := range sub.retrans {
+		seqs = append(seqs, seq)
+	}
+
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+
+	return seqs
+}
+
+// subscriptions serves subscription services, nil is returned for queued publish request
+func (c *conn) subscriptions(ss *session, reqID uint32, r ua.Request) ua.Response {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	switch req := r.(type) {
+	case *ua.CreateSubscriptionRequest:
+		sub := &subscription{
+			ss: ss, id: c.s.id(), enabled: req.PublishingEnabled,
+			items:   make(map[uint32]*monitoredItem),
+			retrans: make(map[uint32]*ua.NotificationMessage),
+		}
+
+		sub.revise(req.RequestedPublishingInterval, req.RequestedLifetimeCount,
+			req.RequestedMaxKeepAliveCount, req.MaxNotificationsPerPublish)
+		sub.start()
+
+		ss.subs[sub.id] = sub
+
+		return &ua.CreateSubscriptionResponse{
+			ResponseHeader:            responseHeader(req.RequestHeader, ua.StatusOK),
+			SubscriptionID:            sub.id,
+			RevisedPublishingInterval: float64(sub.interval / time.Millisecond),
+			RevisedLifetimeCount:      sub.lifetime,
+			RevisedMaxKeepAliveCount:  sub.keepAlive,
+		}
+	case *ua.ModifySubscriptionRequest:
+		sub, ok := ss.subs[req.SubscriptionID]
+		if !ok {
+			return fault(req.RequestHeader, ua.StatusBadSubscriptionIDInvalid)
+		}
+
+		sub.revise(req.RequestedPublishingInterval, req.RequestedLifetimeCount,
+			req.RequestedMaxKeepAliveCount, req.MaxNotificationsPerPublish)
+
+		return &ua.ModifySubscriptionResponse{
+			ResponseHeader:            responseHeader(req.RequestHeader, ua.StatusOK),
+			RevisedPublishingInterval: float64(sub.interval / time.Millisecond),
+			RevisedLifetimeCount:      sub.lifetime,
+			RevisedMaxKeepAliveCount:  sub.keepAlive,
+		}
+	case *ua.SetPublishingModeRequest:
+		res := make([]ua.StatusCode, len(req.SubscriptionIDs))
+
+		for i, subID := range req.SubscriptionIDs {
+			sub, ok := ss.subs[subID]
+			if !ok {
+				res[i] = ua.StatusBadSubscriptionIDInvalid
+				continue
+			}
+
+			sub.enabled = req.PublishingEnabled
+		}
+
+		return &ua.SetPublishingModeResponse{
+			ResponseHeader: responseHeader(req.RequestHeader, ua.StatusOK),
+			Results:        res,
+		}
+	case *ua.DeleteSubscriptionsRequest:
+		res := make([]ua.StatusCode, len(req.SubscriptionIDs))
+
+		for i, subID := range req.SubscriptionIDs {
+			sub, ok := ss.subs[subID]
+			if !ok {
+				res[i] = ua.StatusBadSubscriptionIDInvalid
+				continue
+			}
+
+			delete(ss.subs, subID)
+			sub.stop()
+		}
+
+		return &ua.DeleteSubscriptionsResponse{
+			ResponseHeader: responseHeader(req.RequestHeader, ua.StatusOK),
+			Results:        res,
+		}
+	case *ua.CreateMonitoredItemsRequest:
+		return c.s.sp.createItems(ss, req)
+	case *ua.ModifyMonitoredItemsRequest:
+		return modifyItems(ss, req)
+	case *ua.SetMonitoringModeRequest:
+		return setMonitoringMode(ss, req)
+	case *ua.DeleteMonitoredItemsRequest:
+		sub, ok := ss.subs[req.SubscriptionID]
+		if !ok {
+			return fault(req.RequestHeader, ua.StatusBadSubscriptionIDInvalid)
+		}
+
+		res := make([]ua.StatusCode, len(req.MonitoredItemIDs))
+
+		for i, itemID := range req.MonitoredItemIDs {
+			if _, ok := sub.items[itemID]; !ok {
+				res[i] = ua.StatusBadMonitoredItemIDInvalid
+				continue
+			}
+
+			delete(sub.items, itemID)
+		}
+
+		return &ua.DeleteMonitoredItemsResponse{
+			ResponseHeader: responseHeader(req.RequestHeader, ua.StatusOK),
+			Results:        res,
+		}
+	case *ua.PublishRequest:
+		return publish(ss, reqID, req)
+	case *ua.RepublishRequest:
+		sub, ok := ss.subs[req.SubscriptionID]
+		if !ok {
+			return fault(req.RequestHeader, ua.StatusBadSubscriptionIDInvalid)
+		}
+
+		msg, ok := sub.retrans[req.RetransmitSequenceNumber]
+		if !ok {
+			return fault(req.RequestHeader, ua.StatusBadMessageNotAvailable)
+		}
+
+		return &ua.RepublishResponse{
+			ResponseHeader:      responseHeader(req.RequestHeader, ua.StatusOK),
+			NotificationMessage: msg,
+		}
+	}
+
+	return fault(r.Header(), ua.StatusBadServiceUnsupported)
+}
+
+// publish acknowledges messages and queues request until subscription has notifications
+func publish(ss *session, reqID uint32, req *ua.PublishRequest) ua.Response {
+	if len(ss.subs) == 0 {
+		return fault(req.RequestHeader, ua.StatusBadNoSubscription)
+	}
+
+	pr := publishRequest{
+		reqID: reqID, header: req.RequestHeader,
+		results: make([]ua.StatusCode, len(req.SubscriptionAcknowledgements)),
+	}
+
+	for i, ack := range req.SubscriptionAcknowledgements {
+		sub, ok := ss.subs[ack.SubscriptionID]
+		if !ok {
+			pr.results[i] = ua.StatusBadSubscriptionIDInvalid
+			continue
+		}
+
+		if _, ok := sub.retrans[ack.SequenceNumber]; !ok {
+			pr.results[i] = ua.StatusBadSequenceNumberUnknown
+			continue
+		}
+
+		delete(sub.retrans, ack.SequenceNumber)
+	}
+
+	ss.publish = append(ss.publish, pr)
+
+	if len(ss.publish) > maxPublishRequests {
+		old := ss.publish[0]
+		ss.publish = ss.publish[1:]
+
+		go func() { _ = ss.c.send(old.reqID, fault(old.header, ua.StatusBadTooManyPublishRequests)) }()
+	}
+
+	return nil
+}
+
+func (sp *space) createItems(ss *session, req *ua.CreateMonitoredItemsRequest) ua.Response {
+	sub, ok := ss.subs[req.SubscriptionID]
+	if !ok {
+		return fault(req.RequestHeader, ua.StatusBadSubscriptionIDInvalid)
+	}
+
+	res := make([]*ua.MonitoredItemCreateResult, len(req.ItemsToCreate))
+
+	for i, r := range req.ItemsToCreate {
+		res[i] = &ua.MonitoredItemCreateResult{FilterResult: ua.NewExtensionObject(nil)}
+
+		if r.ItemToMonitor == nil || r.RequestedParameters == nil {
+			res[i].StatusCode = ua.StatusBadMonitoredItemFilterInvalid
+			continue
+		}
+
+		n, ok := sp.node(r.ItemToMonitor.NodeID)
+		if !ok {
+			res[i].StatusCode = ua.StatusBadNodeIDUnknown
+			continue
+		}
+
+		// only value changes are monitored
+		if r.ItemToMonitor.AttributeID != ua.AttributeIDValue || n.class != ua.NodeClassVariable {
+			res[i].StatusCode = ua.StatusBadAttributeIDInvalid
+			continue
+		}
+
+		if f := r.RequestedParameters.Filter; f != nil && f.Value != nil {
+			res[i].StatusCode = ua.StatusBadMonitoredItemFilterUnsupported
+			continue
+		}
+
+		mi := &monitoredItem{id: sp.s.id(), node: n, mode: r.MonitoringMode, ts: req.TimestampsToReturn}
+		mi.configure(r.RequestedParameters)
+
+		sub.items[mi.id] = mi
+
+		res[i].MonitoredItemID = mi.id
+		res[i].RevisedSamplingInterval = float64(sub.interval / time.Millisecond)
+		res[i].RevisedQueueSize = uint32(mi.size)
+	}
+
+	return &ua.CreateMonitoredItemsResponse{
+		ResponseHeader: responseHeader(req.RequestHeader, ua.StatusOK),
+		Results:        res,
+	}
+}
+
+func (mi *monitoredItem) configure(p *ua.MonitoringParameters) {
+	mi.handle, mi.oldest = p.ClientHandle, p.DiscardOldest
+
+	mi.size = int(p.QueueSize)
+	if mi.size == 0 {
+		mi.size = 1
+	}
+
+	if mi.size > maxQueueSize {
+		mi.size = maxQueueSize
+	}
+
+	if len(mi.pending) > mi.size {
+		mi.pending = mi.pending[len(mi.pending)-mi.size:]
+	}
+}
+
+func modifyItems(ss *session, req *ua.ModifyMonitoredItemsRequest) ua.Response {
+	sub, ok := ss.subs[req.SubscriptionID]
+	if !ok {
+		return fault(req.RequestHeader, ua.StatusBadSubscriptionIDInvalid)
+	}
+
+	res := make([]*ua.MonitoredItemModifyResult, len(req.ItemsToModify))
+
+	for i, r := range req.ItemsToModify {
+		res[i] = &ua.MonitoredItemModifyResult{FilterResult: ua.NewExtensionObject(nil)}
+
+		mi, ok := sub.items[r.MonitoredItemID]
+		if !ok {
+			res[i].StatusCode = ua.StatusBadMonitoredItemIDInvalid
+			continue
+		}
+
+		if r.RequestedParameters == nil {
+			res[i].StatusCode = ua.StatusBadMonitoredItemFilterInvalid
+			continue
+		}
+
+		mi.ts = req.TimestampsToReturn
+		mi.configure(r.RequestedParameters)
+
+		res[i].RevisedSamplingInterval = float64(sub.interval / time.Millisecond)
+		res[i].RevisedQueueSize = uint32(mi.size)
+	}
+
+	return &ua.ModifyMonitoredItemsResponse{
+		ResponseHeader: responseHeader(req.RequestHeader, ua.StatusOK),
+		Results:        res,
+	}
+}
+
+func setMonitoringMode(ss *session, req *ua.SetMonitoringModeRequest) ua.Response {
+	sub, ok := ss.subs[req.SubscriptionID]
+	if !ok {
+		return fault(req.RequestHeader, ua.StatusBadSubscriptionIDInvalid)
+	}
+
+	res := make([]ua.StatusCode, len(req.MonitoredItemIDs))
+
+	for i, itemID := range req.MonitoredItemIDs {
+		mi, ok := sub.items[itemID]
+		if !ok {
+			res[i] = ua.StatusBadMonitoredItemIDInvalid
+			continue
+		}
+
+		mi.mode = req.MonitoringMode
+		if mi.mode == ua.MonitoringModeDisabled {
+			mi.last, mi.pending = nil, nil
+		}
+	}
+
+	return &ua.SetMonitoringModeResponse{
+		ResponseHeader: responseHeader(req.RequestHeader, ua.StatusOK),
+		Results:        res,
+	}
+}
@@ -0,0 +1,565 @@
+/**
+ * Copyright 2021 Rightech IoT. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package slave implements Modbus TCP slave embedded in core
+//
+// Parameters are mapped to coils, discrete inputs, holding and input registers,
+// reads are served from state and writes call parameters write commands.
+package slave
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/Rightech/ric-edge/internal/pkg/core/cloud"
+	"github.com/Rightech/ric-edge/third_party/goburrow/modbus"
+)
+
+// Config of slave
+type Config struct {
+	// listener address, e.g. :502
+	Addr string
+	// UnitID is unit served by slave (0 means any unit)
+	UnitID byte
+	// Registers is register map
+	Registers []Register
+}
+
+// Register maps parameter to modbus table
+type Register struct {
+	Param string
+	// coil, discrete, holding or input
+	Table   string
+	Address uint16
+	// bool (coil and discrete), int16, uint16, int32, uint32, int64, uint64, float32 or float64
+	Type string
+	// WordOrder of multi register types: big (high word first) or little
+	WordOrder string `mapstructure:"word_order"`
+}
+
+type rpc interface {
+	Call(string, []byte) []byte
+	Value(string) (interface{}, bool)
+}
+
+const (
+	tcpHeaderSize = 7
+	maxADUSize    = 260
+	idleTimeout   = 5 * time.Minute
+
+	maxReadBits      = 2000
+	maxReadRegisters = 125
+	maxWriteBits     = 1968
+	maxWriteRegister = 123
+)
+
+// tables
+const (
+	coils = iota
+	discrete
+	holding
+	input
+)
+
+var tableNames = map[string]int{
+	"coil":     coils,
+	"discrete": discrete,
+	"holding":  holding,
+	"input":    input,
+}
+
+// registers count of types
+var typeSizes = map[string]int{
+	"bool":    1,
+	"int16":   1,
+	"uint16":  1,
+	"int32":   2,
+	"uint32":  2,
+	"float32": 2,
+	"int64":   4,
+	"uint64":  4,
+	"float64": 4,
+}
+
+// mapping is mapped parameter
+type mapping struct {
+	reg   Register
+	param cloud.Param
+	size  int
+}
+
+type Slave struct {
+	c   Config
+	ln  net.Listener
+	rpc rpc
+	// address -> mapping by table
+	tables [4]map[uint16]*mapping
+
+	mx    sync.Mutex
+	conns map[net.Conn]struct{}
+}
+
+// New validates register map and starts slave
+func New(c Config, params []cloud.Param, cli rpc) (*Slave, error) {
+	s := &Slave{c: c, rpc: cli, conns: make(map[net.Conn]struct{})}
+
+	err := s.build(params)
+	if err != nil {
+		return nil, err
+	}
+
+	s.ln, err = net.Listen("tcp", c.Addr)
+	if err != nil {
+		return nil, err
+	}
+
+	go s.accept()
+
+	log.WithFields(log.Fields{
+		"addr":      c.Addr,
+		"registers": len(c.Registers),
+	}).Info("modbus slave ready")
+
+	return s, nil
+}
+
+func (s *Slave) build(params []cloud.Param) error {
+	byID := make(map[string]cloud.Param, len(params))
+	for _, p := range params {
+		byID[p.ID] = p
+	}
+
+	for i := range s.tables {
+		s.tables[i] = make(map[uint16]*mapping)
+	}
+
+	for _, r := range s.c.Registers {
+		p, ok := byID[r.Param]
+		if !ok {
+			return fmt.Errorf("modbus slave: unknown parameter %s", r.Param)
+		}
+
+		table, ok := tableNames[r.Table]
+		if !ok {
+			return fmt.Errorf("modbus slave: %s: table should be coil, discrete, holding or input", r.Param)
+		}
+
+		if r.Type == "" {
+			r.Type = defaultType(table, p.DataType)
+		}
+
+		size, ok := typeSizes[r.Type]
+		if !ok || (table == coils || table == discrete) != (r.Type == "bool") {
+			return fmt.Errorf("modbus slave: %s: type %s is not supported by %s table", r.Param, r.Type, r.Table)
+		}
+
+		switch r.WordOrder {
+		case "":
+			r.WordOrder = "big"
+		case "big", "little":
+		default:
+			return fmt.Errorf("modbus slave: %s: word order should be big or little", r.Param)
+		}
+
+		if int(r.Address)+size > 1<<16 {
+			return fmt.Errorf("modbus slave: %s: address out of range", r.Param)
+		}
+
+		m := &mapping{reg: r, param: p, size: size}
+
+		for i := 0; i < size; i++ {
+			addr := r.Address + uint16(i)
+			if other, ok := s.tables[table][addr]; ok {
+				return fmt.Errorf("modbus slave: %s overlaps %s at %s %d",
+					r.Param, other.reg.Param, r.Table, addr)
+			}
+
+			s.tables[table][addr] = m
+		}
+	}
+
+	return nil
+}
+
+func defaultType(table int, dataType string) string {
+	if table == coils || table == discrete {
+		return "bool"
+	}
+
+	switch dataType {
+	case "integer", "int":
+		return "int32"
+	case "boolean", "bool":
+		return "uint16"
+	default:
+		return "float32"
+	}
+}
+
+func (s *Slave) Close() {
+	s.ln.Close()
+
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	for c := range s.conns {
+		c.Close()
+	}
+}
+
+func (s *Slave) accept() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				time.Sleep(100 * time.Millisecond)
+				continue
+			}
+
+			return
+		}
+
+		s.mx.Lock()
+		s.conns[conn] = struct{}{}
+		s.mx.Unlock()
+
+		go s.serve(conn)
+	}
+}
+
+// serve processes requests of master one by one
+func (s *Slave) serve(conn net.Conn) {
+	logger := log.WithField("remote", conn.RemoteAddr().String())
+
+	defer func() {
+		conn.Close()
+
+		s.mx.Lock()
+		delete(s.conns, conn)
+		s.mx.Unlock()
+	}()
+
+	var packager modbus.TCPPackager
+
+	buf := make([]byte, maxADUSize)
+
+	for {
+		_ = conn.SetReadDeadline(time.Now().Add(idleTimeout))
+
+		_, err := io.ReadFull(conn, buf[:tcpHeaderSize])
+		if err != nil {
+			return
+		}
+
+		length := int(binary.BigEndian.Uint16(buf[4:]))
+		if binary.BigEndian.Uint16(buf[2:]) != 0 || length < 2 || tcpHeaderSize-1+length > maxADUSize {
+			logger.Debug("modbus slave: bad header")
+			return
+		}
+
+		adu := buf[:tcpHeaderSize-1+length]
+
+		_, err = io.ReadFull(conn, adu[tcpHeaderSize:])
+		if err != nil {
+			return
+		}
+
+		req, err := packager.Decode(adu)
+		if err != nil {
+			logger.WithError(err).Debug("modbus slave: bad request")
+			return
+		}
+
+		unit := adu[6]
+
+		var resp *modbus.ProtocolDataUnit
+		if s.c.UnitID != 0 && unit != s.c.UnitID {
+			resp = exception(req, modbus.ExceptionCodeGatewayTargetDeviceFailedToRespond)
+		} else {
+			resp = s.handle(req)
+		}
+
+		packager.SlaveId = unit
+
+		out, err := packager.Encode(resp)
+		if err != nil {
+			return
+		}
+
+		// response has transaction id of request
+		copy(out[:2], adu[:2])
+
+		_, err = conn.Write(out)
+		if err != nil {
+			return
+		}
+	}
+}
+
+func exception(req *modbus.ProtocolDataUnit, code byte) *modbus.ProtocolDataUnit {
+	return &modbus.ProtocolDataUnit{FunctionCode: req.FunctionCode | 0x80, Data: []byte{code}}
+}
+
+// requestError is exception of request
+type requestError byte
+
+func (e requestError) Error() string {
+	return (&modbus.ModbusError{ExceptionCode: byte(e)}).Error()
+}
+
+func (s *Slave) handle(req *modbus.ProtocolDataUnit) *modbus.ProtocolDataUnit {
+	var (
+		data []byte
+		err  error
+	)
+
+	switch req.FunctionCode {
+	case modbus.FuncCodeReadCoils:
+		data, err = s.readBits(coils, req.Data)
+	case modbus.FuncCodeReadDiscreteInputs:
+		data, err = s.readBits(discrete, req.Data)
+	case modbus.FuncCodeReadHoldingRegisters:
+		data, err = s.readRegisters(holding, req.Data)
+	case modbus.FuncCodeReadInputRegisters:
+		data, err = s.readRegisters(input, req.Data)
+	case modbus.FuncCodeWriteSingleCoil:
+		data, err = s.writeSingleCoil(req.Data)
+	case modbus.FuncCodeWriteSingleRegister:
+		data, err = s.writeSingleRegister(req.Data)
+	case modbus.FuncCodeWriteMultipleCoils:
+		data, err = s.writeCoils(req.Data)
+	case modbus.FuncCodeWriteMultipleRegisters:
+		data, err = s.writeRegisters(req.Data)
+	default:
+		err = requestError(modbus.ExceptionCodeIllegalFunction)
+	}
+
+	if err != nil {
+		code := byte(modbus.ExceptionCodeServerDeviceFailure)
+
+		var re requestError
+		if errors.As(err, &re) {
+			code = byte(re)
+		}
+
+		return exception(req, code)
+	}
+
+	return &modbus.ProtocolDataUnit{FunctionCode: req.FunctionCode, Data: data}
+}
+
+// addressRange parses address and quantity of request
+func addressRange(data []byte, max int) (uint16, int, error) {
+	if len(data) < 4 {
+		return 0, 0, requestError(modbus.ExceptionCodeIllegalDataValue)
+	}
+
+	addr := binary.BigEndian.Uint16(data)
+	quantity := int(binary.BigEndian.Uint16(data[2:]))
+
+	if quantity < 1 || quantity > max {
+		return 0, 0, requestError(modbus.ExceptionCodeIllegalDataValue)
+	}
+
+	if int(addr)+quantity > 1<<16 {
+		return 0, 0, requestError(modbus.ExceptionCodeIllegalDataAddress)
+	}
+
+	return addr, quantity, nil
+}
+
+// words returns registers of mappings in address range
+// not mapped registers are zero
+func (s *Slave) words(table int, addr uint16, quantity int) []uint16 {
+	res := make([]uint16, quantity)
+	cache := make(map[*mapping][]uint16)
+
+	for i := range res {
+		m, ok := s.tables[table][addr+uint16(i)]
+		if !ok {
+			continue
+		}
+
+		w, ok := cache[m]
+		if !ok {
+			v, _ := s.rpc.Value(m.param.ID)
+			w = encode(m.reg, v)
+			cache[m] = w
+		}
+
+		res[i] = w[addr+uint16(i)-m.reg.Address]
+	}
+
+	return res
+}
+
+func (s *Slave) readBits(table int, data []byte) ([]byte, error) {
+	addr, quantity, err := addressRange(data, maxReadBits)
+	if err != nil {
+		return nil, err
+	}
+
+	bits := s.words(table, addr, quantity)
+
+	res := make([]byte, 1+(quantity+7)/8)
+	res[0] = byte(len(res) - 1)
+
+	for i, b := range bits {
+		if b != 0 {
+			res[1+i/8] |= 1 << (i % 8)
+		}
+	}
+
+	return res, nil
+}
+
+func (s *Slave) readRegisters(table int, data []byte) ([]byte, error) {
+	addr, quantity, err := addressRange(data, maxReadRegisters)
+	if err != nil {
+		return nil, err
+	}
+
+	words := s.words(table, addr, quantity)
+
+	res := make([]byte, 1+2*quantity)
+	res[0] = byte(2 * quantity)
+
+	for i, w := range words {
+		binary.BigEndian.PutUint16(res[1+2*i:], w)
+	}
+
+	return res, nil
+}
+
+// write calls write commands of mappings with new registers values
+// all registers of each mapping should be written
+func (s *Slave) write(table int, addr uint16, values []uint16) error {
+	var list []*mapping
+
+	for i := 0; i < len(values); {
+		m, ok := s.tables[table][addr+uint16(i)]
+		if !ok || m.reg.Address != addr+uint16(i) || i+m.size > len(values) {
+			return requestError(modbus.ExceptionCodeIllegalDataAddress)
+		}
+
+		if m.param.Write == nil {
+			return requestError(modbus.ExceptionCodeIllegalDataAddress)
+		}
+
+		list = append(list, m)
+		i += m.size
+	}
+
+	for _, m := range list {
+		off := int(m.reg.Address - addr)
+
+		err := s.call(m, decode(m.reg, values[off:off+m.size]))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *Slave) writeSingleCoil(data []byte) ([]byte, error) {
+	if len(data) != 4 {
+		return nil, requestError(modbus.ExceptionCodeIllegalDataValue)
+	}
+
+	var v uint16
+
+	switch binary.BigEndian.Uint16(data[2:]) {
+	case 0xff00:
+		v = 1
+	case 0:
+	default:
+		return nil, requestError(modbus.ExceptionCodeIllegalDataValue)
+	}
+
+	err := s.write(coils, binary.BigEndian.Uint16(data), []uint16{v})
+	if err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+func (s *Slave) writeSingleRegister(data []byte) ([]byte, error) {
+	if len(data) != 4 {
+		return nil, requestError(modbus.ExceptionCodeIllegalDataValue)
+	}
+
+	err := s.write(holding, binary.BigEndian.Uint16(data), []uint16{binary.BigEndian.Uint16(data[2:])})
+	if err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+func (s *Slave) writeCoils(data []byte) ([]byte, error) {
+	addr, quantity, err := addressRange(data, maxWriteBits)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < 5 || int(data[4]) != (quantity+7)/8 || len(data) != 5+int(data[4]) {
+		return nil, requestError(modbus.ExceptionCodeIllegalDataValue)
+	}
+
+	values := make([]uint16, quantity)
+	for i := range values {
+		values[i] = uint16(data[5+i/8]>>(i%8)) & 1
+	}
+
+	err = s.write(coils, addr, values)
+	if err != nil {
+		return nil, err
+	}
+
+	return data[:4], nil
+}
+
+func (s *Slave) writeRegisters(data []byte) ([]byte, error) {
+	addr, quantity, err := addressRange(data, maxWriteRegister)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < 5 || int(data[4]) != 2*quantity || len(data) != 5+2*quantity {
+		return nil, requestError(modbus.ExceptionCodeIllegalDataValue)
+	}
+
+	values := make([]uint16, quantity)
+	for i := range values {
+		values[i] = binary.BigEndian.Uint16(data[5+2*i:])
+	}
+
+	err = s.write(holding, addr, values)
+	if err != nil {
+		return nil, err
+	}
+
+	return data[:4], nil
+}
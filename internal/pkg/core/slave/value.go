@@ -0,0 +1,186 @@
+/**
+ * Copyright 2021 Rightech IoT. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package slave
+
+import (
+	"encoding/json"
+	"math"
+	"strings"
+
+	jsoniter "github.com/json-iterator/go"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/Rightech/ric-edge/third_party/goburrow/modbus"
+)
+
+// encode returns registers of value (zeros if value is not a number or boolean)
+func encode(r Register, v interface{}) []uint16 {
+	words := make([]uint16, typeSizes[r.Type])
+
+	f, ok := number(v)
+	if !ok {
+		return words
+	}
+
+	var bits uint64
+
+	switch r.Type {
+	case "bool":
+		if f != 0 {
+			bits = 1
+		}
+	case "int16":
+		bits = uint64(uint16(int16(clamp(f, math.MinInt16, math.MaxInt16))))
+	case "uint16":
+		bits = uint64(clamp(f, 0, math.MaxUint16))
+	case "int32":
+		bits = uint64(uint32(int32(clamp(f, math.MinInt32, math.MaxInt32))))
+	case "uint32":
+		bits = uint64(clamp(f, 0, math.MaxUint32))
+	case "int64":
+		bits = uint64(int64(clamp(f, math.MinInt64, math.Nextafter(math.MaxInt64, 0))))
+	case "uint64":
+		bits = uint64(clamp(f, 0, math.Nextafter(math.MaxUint64, 0)))
+	case "float32":
+		bits = uint64(math.Float32bits(float32(f)))
+	case "float64":
+		bits = math.Float64bits(f)
+	}
+
+	// high word first
+	for i := range words {
+		words[len(words)-1-i] = uint16(bits >> (16 * i))
+	}
+
+	if r.WordOrder == "little" {
+		reverse(words)
+	}
+
+	return words
+}
+
+// decode returns value of written registers
+func decode(r Register, words []uint16) interface{} {
+	if r.WordOrder == "little" {
+		words = append([]uint16(nil), words...)
+		reverse(words)
+	}
+
+	var bits uint64
+	for _, w := range words {
+		bits = bits<<16 | uint64(w)
+	}
+
+	switch r.Type {
+	case "bool":
+		return bits != 0
+	case "int16":
+		return int64(int16(bits))
+	case "int32":
+		return int64(int32(bits))
+	case "int64":
+		return int64(bits)
+	case "float32":
+		return float64(math.Float32frombits(uint32(bits)))
+	case "float64":
+		return math.Float64frombits(bits)
+	}
+
+	return bits
+}
+
+func reverse(words []uint16) {
+	for i, j := 0, len(words)-1; i < j; i, j = i+1, j-1 {
+		words[i], words[j] = words[j], words[i]
+	}
+}
+
+// clamp rounds value to nearest integer in range
+func clamp(f, min, max float64) float64 {
+	f = math.Round(f)
+
+	switch {
+	case math.IsNaN(f):
+		return 0
+	case f < min:
+		return min
+	case f > max:
+		return max
+	}
+
+	return f
+}
+
+func number(v interface{}) (float64, bool) {
+	switch vv := v.(type) {
+	case bool:
+		if vv {
+			return 1, true
+		}
+
+		return 0, true
+	case float64:
+		return vv, true
+	case float32:
+		return float64(vv), true
+	case int:
+		return float64(vv), true
+	case int32:
+		return float64(vv), true
+	case int64:
+		return float64(vv), true
+	case uint:
+		return float64(vv), true
+	case uint32:
+		return float64(vv), true
+	case uint64:
+		return float64(vv), true
+	case json.Number:
+		f, err := vv.Float64()
+		return f, err == nil
+	}
+
+	return 0, false
+}
+
+// call calls write command of parameter
+func (s *Slave) call(m *mapping, value interface{}) error {
+	logger := log.WithFields(log.Fields{"param": m.param.ID, "value": value})
+
+	switch strings.ToLower(m.param.DataType) {
+	case "boolean", "bool":
+		f, _ := number(value)
+		value = f != 0
+	}
+
+	payload, err := m.param.WriteRequest(value)
+	if err != nil {
+		logger.WithError(err).Error("modbus slave: bad write request")
+		return err
+	}
+
+	resp := s.rpc.Call(m.param.Connector, payload)
+
+	if e := jsoniter.ConfigFastest.Get(resp, "error"); e.LastError() == nil {
+		logger.WithField("error", e.ToString()).Error("modbus slave: write failed")
+		return requestError(modbus.ExceptionCodeServerDeviceFailure)
+	}
+
+	logger.Debug("modbus slave: written")
+
+	return nil
+}
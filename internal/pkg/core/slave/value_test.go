@@ -0,0 +1,54 @@
+/**
+ * Copyright 2021 Rightech IoT. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package slave
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	cases := []struct {
+		typ, order string
+		value      interface{}
+		words      []uint16
+		decoded    interface{}
+	}{
+		{"bool", "big", true, []uint16{1}, true},
+		{"int16", "big", -2, []uint16{0xFFFE}, int64(-2)},
+		{"int16", "big", 21.6, []uint16{22}, int64(22)},
+		{"uint16", "big", 70000, []uint16{0xFFFF}, uint64(0xFFFF)},
+		{"int32", "big", int64(-2), []uint16{0xFFFF, 0xFFFE}, int64(-2)},
+		{"int32", "little", 74565, []uint16{0x2345, 0x0001}, int64(74565)},
+		{"float32", "big", 1.5, []uint16{0x3FC0, 0}, 1.5},
+		{"float64", "little", 2.0, []uint16{0, 0, 0, 0x4000}, 2.0},
+		{"uint64", "big", "not a number", []uint16{0, 0, 0, 0}, uint64(0)},
+	}
+
+	for _, c := range cases {
+		r := Register{Type: c.typ, WordOrder: c.order}
+
+		words := encode(r, c.value)
+		if !reflect.DeepEqual(words, c.words) {
+			t.Errorf("encode %s %v: want %04x got %04x", c.typ, c.value, c.words, words)
+		}
+
+		if v := decode(r, c.words); v != c.decoded {
+			t.Errorf("decode %s %04x: want %v (%T) got %v (%T)", c.typ, c.words, c.decoded, c.decoded, v, v)
+		}
+	}
+}
@@ -0,0 +1,268 @@
+/**
+ * Copyright 2021 Rightech IoT. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package supervisor starts connector processes and restarts them when they exit
+package supervisor
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/Rightech/ric-edge/internal/pkg/config"
+	"github.com/Rightech/ric-edge/pkg/backoff"
+)
+
+const (
+	minRestart = time.Second
+	maxRestart = time.Minute
+	// process which works longer than this is considered healthy
+	// so next restart starts backoff from the beginning
+	healthyTime = time.Minute
+	// how long process has to exit after SIGTERM before it killed
+	stopTimeout = 5 * time.Second
+)
+
+// State of connector process
+type State string
+
+const (
+	StateStarting State = "starting"
+	StateRunning  State = "running"
+	// process exited and waits restart
+	StateExited  State = "exited"
+	StateStopped State = "stopped"
+)
+
+// Process describes connector process
+type Process struct {
+	Name string
+	Path string
+	Args []string
+	// additional environment variables (KEY=value)
+	Env []string
+}
+
+// Status of connector process
+type Status struct {
+	Name      string    `json:"name"`
+	State     State     `json:"state"`
+	PID       int       `json:"pid,omitempty"`
+	Restarts  int       `json:"restarts"`
+	LastError string    `json:"last_error,omitempty"`
+	Since     time.Time `json:"since"`
+}
+
+type Service struct {
+	procs []*process
+	stop  chan struct{}
+	wg    *sync.WaitGroup
+}
+
+// New starts all processes
+// configPath (passed as -config) and wsPort (passed as config.WSPortEnv env)
+// let connectors use the same configuration as core
+func New(list []Process, configPath string, wsPort int) Service {
+	s := Service{stop: make(chan struct{}), wg: new(sync.WaitGroup)}
+
+	env := append(os.Environ(), config.WSPortEnv+"="+strconv.Itoa(wsPort))
+
+	for _, p := range list {
+		args := p.Args
+		if configPath != "" {
+			args = append([]string{"-config", configPath}, args...)
+		}
+
+		proc := &process{
+			Process: Process{
+				Name: p.Name,
+				Path: p.Path,
+				Args: args,
+				Env:  append(append([]string{}, env...), p.Env...),
+			},
+			log:    log.WithField("connector", p.Name),
+			status: Status{Name: p.Name, State: StateStarting, Since: time.Now()},
+		}
+
+		s.procs = append(s.procs, proc)
+
+		s.wg.Add(1)
+
+		go func() {
+			defer s.wg.Done()
+			proc.supervise(s.stop)
+		}()
+	}
+
+	return s
+}
+
+// Status returns state of all processes
+func (s Service) Status() []Status {
+	res := make([]Status, len(s.procs))
+
+	for i, p := range s.procs {
+		p.mx.Lock()
+		res[i] = p.status
+		p.mx.Unlock()
+	}
+
+	return res
+}
+
+// Close stops all processes and waits their exit
+func (s Service) Close() {
+	close(s.stop)
+	s.wg.Wait()
+}
+
+type process struct {
+	Process
+	log *log.Entry
+
+	mx     sync.Mutex
+	status Status
+}
+
+func (p *process) setState(st State, pid int, err error) {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+
+	if st == StateStarting && p.status.State == StateExited {
+		p.status.Restarts++
+	}
+
+	p.status.State = st
+	p.status.PID = pid
+	p.status.Since = time.Now()
+
+	if err != nil {
+		p.status.LastError = err.Error()
+	}
+
+	p.log.WithFields(log.Fields{
+		"state":    st,
+		"pid":      pid,
+		"restarts": p.status.Restarts,
+	}).Info("connector process state changed")
+}
+
+func (p *process) supervise(stop <-chan struct{}) {
+	b := backoff.New(minRestart, maxRestart)
+
+	for {
+		started := time.Now()
+
+		err := p.run(stop)
+
+		select {
+		case <-stop:
+			p.setState(StateStopped, 0, nil)
+			return
+		default:
+		}
+
+		if time.Since(started) > healthyTime {
+			b.Reset()
+		}
+
+		p.setState(StateExited, 0, err)
+
+		delay := b.Next()
+		p.log.WithError(err).WithField("restart_in", delay.String()).Error("connector process exited")
+
+		select {
+		case <-stop:
+			p.setState(StateStopped, 0, nil)
+			return
+		case <-time.After(delay):
+		}
+	}
+}
+
+// run starts process and waits its exit (or stop)
+func (p *process) run(stop <-chan struct{}) error {
+	p.setState(StateStarting, 0, nil)
+
+	cmd := exec.Command(p.Path, p.Args...) // nolint: gosec
+	cmd.Env = p.Env
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return err
+	}
+
+	err = cmd.Start()
+	if err != nil {
+		return err
+	}
+
+	p.setState(StateRunning, cmd.Process.Pid, nil)
+
+	output := new(sync.WaitGroup)
+	output.Add(2)
+
+	go p.logOutput(stdout, "stdout", output)
+	go p.logOutput(stderr, "stderr", output)
+
+	exited := make(chan error, 1)
+
+	go func() {
+		// all output should be read before Wait
+		output.Wait()
+		exited <- cmd.Wait()
+	}()
+
+	select {
+	case err := <-exited:
+		return err
+	case <-stop:
+	}
+
+	cmd.Process.Signal(os.Interrupt) // nolint: errcheck
+
+	select {
+	case err := <-exited:
+		return err
+	case <-time.After(stopTimeout):
+		p.log.Warn("connector process not stopped in time, kill it")
+		cmd.Process.Kill() // nolint: errcheck
+
+		return <-exited
+	}
+}
+
+func (p *process) logOutput(r io.Reader, stream string, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	entry := p.log.WithField("stream", stream)
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		entry.Info(scanner.Text())
+	}
+}
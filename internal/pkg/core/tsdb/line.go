@@ -0,0 +1,124 @@
+/**
+ * Copyright 2021 Rightech IoT. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tsdb
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	jsoniter "github.com/json-iterator/go"
+
+	"github.com/Rightech/ric-edge/pkg/store/state"
+)
+
+var (
+	measurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `, "\n", `\n`)
+	keyEscaper         = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `, "\n", `\n`)
+	stringEscaper      = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+)
+
+// Line converts change to line protocol, e.g. ric_edge,connector=modbus,edge=id temp=21.5 1600000000000000000
+// field key is parameter id, tags are common and parameter tags (empty tags are skipped)
+// nil, NaN and Inf values are skipped (false returned), objects and arrays are written as json string
+func Line(measurement string, tags, paramTags map[string]string, c state.Change) ([]byte, bool) {
+	field, ok := fieldValue(c.Value)
+	if !ok {
+		return nil, false
+	}
+
+	all := make(map[string]string, len(tags)+len(paramTags))
+	for k, v := range tags {
+		all[k] = v
+	}
+
+	for k, v := range paramTags {
+		all[k] = v
+	}
+
+	keys := make([]string, 0, len(all))
+	for k, v := range all {
+		if k != "" && v != "" {
+			keys = append(keys, k)
+		}
+	}
+
+	// sorted tags are recommended for write performance
+	sort.Strings(keys)
+
+	var b strings.Builder
+
+	b.WriteString(measurementEscaper.Replace(measurement))
+
+	for _, k := range keys {
+		b.WriteByte(',')
+		b.WriteString(keyEscaper.Replace(k))
+		b.WriteByte('=')
+		b.WriteString(keyEscaper.Replace(all[k]))
+	}
+
+	b.WriteByte(' ')
+	b.WriteString(keyEscaper.Replace(c.Param))
+	b.WriteByte('=')
+	b.WriteString(field)
+	b.WriteByte(' ')
+	b.WriteString(strconv.FormatInt(c.Time.UnixNano(), 10))
+
+	return []byte(b.String()), true
+}
+
+func fieldValue(v interface{}) (string, bool) {
+	switch v := v.(type) {
+	case nil:
+		return "", false
+	case bool:
+		return strconv.FormatBool(v), true
+	// all numbers are written as float, so field type doesn't depend on value
+	// (integer field fails to write float value and vice versa)
+	case float64:
+		return floatValue(v)
+	case int:
+		return floatValue(float64(v))
+	case int64:
+		return floatValue(float64(v))
+	case int32:
+		return floatValue(float64(v))
+	case uint64:
+		return floatValue(float64(v))
+	case uint32:
+		return floatValue(float64(v))
+	case string:
+		return `"` + stringEscaper.Replace(v) + `"`, true
+	}
+
+	data, err := jsoniter.ConfigFastest.Marshal(v)
+	if err != nil {
+		return "", false
+	}
+
+	return `"` + stringEscaper.Replace(string(data)) + `"`, true
+}
+
+func floatValue(v float64) (string, bool) {
+	// line protocol has no NaN and Inf
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return "", false
+	}
+
+	return strconv.FormatFloat(v, 'f', -1, 64), true
+}
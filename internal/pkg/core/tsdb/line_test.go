@@ -0,0 +1,55 @@
+/**
+ * Copyright 2021 Rightech IoT. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tsdb
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/Rightech/ric-edge/pkg/store/state"
+)
+
+func TestLine(t *testing.T) {
+	ts := time.Unix(1600000000, 0)
+	tags := map[string]string{"edge": "e 1", "model": ""}
+	paramTags := map[string]string{"connector": "modbus", "unit": "°C"}
+
+	cases := []struct {
+		param string
+		value interface{}
+		line  string
+		ok    bool
+	}{
+		{"temp", 21.5, `ric_edge,connector=modbus,edge=e\ 1,unit=°C temp=21.5 1600000000000000000`, true},
+		{"count", int64(3), `ric_edge,connector=modbus,edge=e\ 1,unit=°C count=3 1600000000000000000`, true},
+		{"big", uint64(math.MaxUint64), `ric_edge,connector=modbus,edge=e\ 1,unit=°C big=18446744073709552000 1600000000000000000`, true},
+		{"on", true, `ric_edge,connector=modbus,edge=e\ 1,unit=°C on=true 1600000000000000000`, true},
+		{"a,b=c", `say "hi"`, `ric_edge,connector=modbus,edge=e\ 1,unit=°C a\,b\=c="say \"hi\"" 1600000000000000000`, true},
+		{"list", []interface{}{1, "x"}, `ric_edge,connector=modbus,edge=e\ 1,unit=°C list="[1,\"x\"]" 1600000000000000000`, true},
+		{"null", nil, "", false},
+		{"nan", math.NaN(), "", false},
+		{"inf", math.Inf(1), "", false},
+	}
+
+	for _, c := range cases {
+		line, ok := Line("ric_edge", tags, paramTags, state.Change{Param: c.param, Value: c.value, Time: ts})
+		if ok != c.ok || string(line) != c.line {
+			t.Errorf("%s: want %q (%v) got %q (%v)", c.param, c.line, c.ok, line, ok)
+		}
+	}
+}
@@ -0,0 +1,229 @@
+/**
+ * Copyright 2021 Rightech IoT. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package tsdb implements northbound exporter which writes state changes
+// to time-series database (InfluxDB, VictoriaMetrics) in line protocol
+package tsdb
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/Rightech/ric-edge/pkg/store/queue"
+	"github.com/Rightech/ric-edge/pkg/store/state"
+)
+
+// Config of exporter
+type Config struct {
+	Name string
+	// http(s) write endpoint with query, e.g. http://localhost:8086/write?db=edge
+	// or udp://localhost:8089
+	URL string
+	// Token is sent as "Authorization: Token <token>" (InfluxDB 2)
+	Token string
+	// basic authorization if username set
+	Username string
+	Password string
+	// credentials over http are rejected unless allowed
+	AllowInsecure bool
+	Timeout       time.Duration
+	// max lines in one write
+	BatchSize int
+	// how long not full batch waits more changes
+	FlushInterval time.Duration
+	// max udp datagram size (batch is split)
+	UDPPayload int
+	// delays between retries of failed write
+	BackoffMin time.Duration
+	BackoffMax time.Duration
+	// Measurement of all lines
+	Measurement string
+	// Tags of all lines (e.g. edge and model ids), tags of parameter are added by line
+	Tags map[string]string
+	// Params tags by change param (state.Key of parameter id, e.g. connector)
+	Params map[string]map[string]string
+	// offline buffer
+	Buffer *queue.Queue
+}
+
+// Exporter writes buffered lines in batches
+// (batch stays in buffer until it's written or rejected by database)
+type Exporter struct {
+	c   Config
+	u   *url.URL
+	cli *http.Client
+	d   *queue.Deliverer
+}
+
+// New starts exporter which writes changes from in
+func New(c Config, in <-chan state.Change) (*Exporter, error) {
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		return nil, fmt.Errorf("tsdb %s: %w", c.Name, err)
+	}
+
+	switch u.Scheme {
+	case "http":
+		if !c.AllowInsecure && (c.Token != "" || c.Username != "") {
+			return nil, errors.New("tsdb " + c.Name + ": credentials over http not allowed (set allow_insecure)")
+		}
+	case "https", "udp":
+	default:
+		return nil, errors.New("tsdb " + c.Name + ": http, https or udp url required")
+	}
+
+	if c.Measurement == "" {
+		return nil, errors.New("tsdb " + c.Name + ": measurement required")
+	}
+
+	if c.UDPPayload <= 0 {
+		c.UDPPayload = 512
+	}
+
+	e := &Exporter{c: c, u: u, cli: &http.Client{Timeout: c.Timeout}}
+
+	e.d = queue.NewDeliverer(c.Buffer, queue.Delivery{
+		BatchSize:     c.BatchSize,
+		FlushInterval: c.FlushInterval,
+		BackoffMin:    c.BackoffMin,
+		BackoffMax:    c.BackoffMax,
+		Encode:        e.encode,
+		Send:          e.write,
+		Log:           log.WithField("tsdb", c.Name),
+	}, in)
+
+	log.WithFields(log.Fields{"tsdb": c.Name, "host": u.Host}).Info("tsdb exporter ready")
+
+	return e, nil
+}
+
+// encode converts change to buffered line (not supported value is skipped)
+func (e *Exporter) encode(c state.Change) (string, []byte, error) {
+	line, ok := Line(e.c.Measurement, e.c.Tags, e.c.Params[c.Param], c)
+	if !ok {
+		log.WithFields(log.Fields{
+			"tsdb":  e.c.Name,
+			"param": c.Param,
+			"value": c.Value,
+		}).Debug("tsdb: value skipped")
+
+		return "", nil, nil
+	}
+
+	return c.Param, line, nil
+}
+
+func (e *Exporter) write(batch []queue.Item) error {
+	if e.u.Scheme == "udp" {
+		return e.writeUDP(batch)
+	}
+
+	var body bytes.Buffer
+	for _, it := range batch {
+		body.Write(it.Data)
+		body.WriteByte('\n')
+	}
+
+	req, err := http.NewRequest(http.MethodPost, e.c.URL, &body)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+
+	if e.c.Token != "" {
+		req.Header.Set("Authorization", "Token "+e.c.Token)
+	}
+
+	if e.c.Username != "" {
+		req.SetBasicAuth(e.c.Username, e.c.Password)
+	}
+
+	resp, err := e.cli.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		_, _ = io.Copy(ioutil.Discard, resp.Body)
+		return nil
+	}
+
+	msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+
+	// bad lines or too large batch can't be fixed by retry,
+	// other statuses could be temporary (e.g. 401 or 403 until credentials are fixed on server)
+	err = fmt.Errorf("tsdb: bad status %d: %s", resp.StatusCode, msg)
+
+	switch resp.StatusCode {
+	case http.StatusBadRequest, http.StatusRequestEntityTooLarge, http.StatusUnprocessableEntity:
+		return queue.Permanent(err)
+	default:
+		return err
+	}
+}
+
+// writeUDP sends lines in datagrams up to UDPPayload bytes
+// (udp has no delivery confirmation, so only send errors are retried)
+func (e *Exporter) writeUDP(batch []queue.Item) error {
+	conn, err := net.DialTimeout("udp", e.u.Host, e.c.Timeout)
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close()
+
+	var buf bytes.Buffer
+
+	flush := func() error {
+		if buf.Len() == 0 {
+			return nil
+		}
+
+		_, err := conn.Write(buf.Bytes())
+		buf.Reset()
+
+		return err
+	}
+
+	for _, it := range batch {
+		if buf.Len() > 0 && buf.Len()+len(it.Data)+1 > e.c.UDPPayload {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+
+		buf.Write(it.Data)
+		buf.WriteByte('\n')
+	}
+
+	return flush()
+}
+
+func (e *Exporter) Close() {
+	e.d.Close()
+}
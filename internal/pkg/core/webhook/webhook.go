@@ -0,0 +1,315 @@
+/**
+ * Copyright 2021 Rightech IoT. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package webhook implements northbound exporter which posts batches of state changes by http
+package webhook
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"text/template"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/Rightech/ric-edge/pkg/store/queue"
+	"github.com/Rightech/ric-edge/pkg/store/state"
+)
+
+// DefaultTemplate of request body
+const DefaultTemplate = `{"edge": {{json .Edge}}, "items": {{json .Items}}}`
+
+// Config of webhook
+type Config struct {
+	Name   string
+	URL    string
+	Method string
+	// additional request headers
+	Headers map[string]string
+	// Token is sent as bearer authorization
+	Token string
+	// basic authorization if username set
+	Username string
+	Password string
+	// CA bundle to verify server certificate (system CAs if empty)
+	CAFile             string
+	InsecureSkipVerify bool
+	// credentials over http and insecure_skip_verify are rejected unless allowed
+	AllowInsecure bool
+	Timeout       time.Duration
+	// max changes in one request
+	BatchSize int
+	// how long not full batch waits more changes
+	FlushInterval time.Duration
+	// delays between retries of failed request
+	BackoffMin time.Duration
+	BackoffMax time.Duration
+	// text/template of request body (it should render json), see Batch
+	Template string
+	// offline buffer
+	Buffer *queue.Queue
+}
+
+// Batch is data of body template
+type Batch struct {
+	Edge  string
+	Items []Item
+}
+
+// Item is state change
+type Item struct {
+	Param string   `json:"param"`
+	Value RawValue `json:"value"`
+	Unit  string   `json:"unit,omitempty"`
+	// unix time in milliseconds
+	TS int64 `json:"ts"`
+}
+
+// RawValue is json encoded value
+// (it's printed as json by template, e.g. {{.Value}})
+type RawValue []byte
+
+func (v RawValue) MarshalJSON() ([]byte, error) {
+	if len(v) == 0 {
+		return []byte("null"), nil
+	}
+
+	return v, nil
+}
+
+func (v *RawValue) UnmarshalJSON(data []byte) error {
+	*v = append((*v)[:0], data...)
+	return nil
+}
+
+func (v RawValue) String() string {
+	return string(v)
+}
+
+// Webhook posts buffered state changes in batches
+// (batch stays in buffer until it's accepted or rejected with permanent error)
+type Webhook struct {
+	c    Config
+	edge string
+	cli  *http.Client
+	tpl  *template.Template
+	d    *queue.Deliverer
+}
+
+// statusError is not successful response status
+type statusError struct {
+	code int
+	body string
+}
+
+func (e statusError) Error() string {
+	return fmt.Sprintf("webhook: bad status %d: %s", e.code, e.body)
+}
+
+// permanent reports whether batch should be dropped because retry can't fix it
+// (e.g. 401 or 403 is retried, credentials could be fixed on server)
+func (e statusError) permanent() bool {
+	switch e.code {
+	case http.StatusBadRequest, http.StatusRequestEntityTooLarge, http.StatusUnprocessableEntity:
+		return true
+	default:
+		return false
+	}
+}
+
+// New starts webhook which posts changes from in
+func New(c Config, edge string, in <-chan state.Change) (*Webhook, error) {
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		return nil, fmt.Errorf("webhook %s: %w", c.Name, err)
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, errors.New("webhook " + c.Name + ": http or https url required")
+	}
+
+	if !c.AllowInsecure {
+		if u.Scheme == "http" && (c.Token != "" || c.Username != "" || len(c.Headers) > 0) {
+			return nil, errors.New("webhook " + c.Name + ": credentials over http not allowed (set allow_insecure)")
+		}
+
+		if c.InsecureSkipVerify {
+			return nil, errors.New("webhook " + c.Name + ": insecure_skip_verify not allowed (set allow_insecure)")
+		}
+	}
+
+	if c.Method == "" {
+		c.Method = http.MethodPost
+	}
+
+	if c.Template == "" {
+		c.Template = DefaultTemplate
+	}
+
+	tpl, err := template.New(c.Name).Funcs(template.FuncMap{"json": toJSON}).Parse(c.Template)
+	if err != nil {
+		return nil, fmt.Errorf("webhook %s: template: %w", c.Name, err)
+	}
+
+	tlsConf := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: c.InsecureSkipVerify, // nolint: gosec
+	}
+
+	if c.CAFile != "" {
+		pem, err := ioutil.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("webhook %s: %w", c.Name, err)
+		}
+
+		tlsConf.RootCAs = x509.NewCertPool()
+		if !tlsConf.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, errors.New("webhook " + c.Name + ": no certificates in " + c.CAFile)
+		}
+	}
+
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	tr.TLSClientConfig = tlsConf
+
+	w := &Webhook{
+		c: c, edge: edge, tpl: tpl,
+		cli: &http.Client{Timeout: c.Timeout, Transport: tr},
+	}
+
+	w.d = queue.NewDeliverer(c.Buffer, queue.Delivery{
+		BatchSize:     c.BatchSize,
+		FlushInterval: c.FlushInterval,
+		BackoffMin:    c.BackoffMin,
+		BackoffMax:    c.BackoffMax,
+		Encode:        encode,
+		Send:          w.send,
+		Log:           log.WithField("webhook", c.Name),
+	}, in)
+
+	log.WithFields(log.Fields{"webhook": c.Name, "url": c.URL}).Info("webhook ready")
+
+	return w, nil
+}
+
+func toJSON(v interface{}) (string, error) {
+	data, err := jsoniter.ConfigFastest.Marshal(v)
+	return string(data), err
+}
+
+// encode converts change to buffered item
+// (changes of one parameter are coalesced by buffer policy)
+func encode(c state.Change) (string, []byte, error) {
+	value, err := jsoniter.ConfigFastest.Marshal(c.Value)
+	if err != nil {
+		return "", nil, err
+	}
+
+	data, err := jsoniter.ConfigFastest.Marshal(Item{
+		Param: c.Param, Value: value, Unit: c.Unit,
+		TS: c.Time.UnixNano() / int64(time.Millisecond),
+	})
+
+	return c.Param, data, err
+}
+
+func (w *Webhook) render(batch []queue.Item) ([]byte, error) {
+	data := Batch{Edge: w.edge, Items: make([]Item, 0, len(batch))}
+
+	for _, it := range batch {
+		var item Item
+
+		err := jsoniter.ConfigFastest.Unmarshal(it.Data, &item)
+		if err != nil {
+			log.WithField("webhook", w.c.Name).WithError(err).Error("drop bad buffered change")
+			continue
+		}
+
+		data.Items = append(data.Items, item)
+	}
+
+	var buf bytes.Buffer
+
+	err := w.tpl.Execute(&buf, data)
+	if err != nil {
+		return nil, err
+	}
+
+	if !jsoniter.ConfigFastest.Valid(buf.Bytes()) {
+		return nil, errors.New("webhook: template result is not valid json")
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (w *Webhook) send(batch []queue.Item) error {
+	body, err := w.render(batch)
+	if err != nil {
+		// the same batch is rendered the same way, so retry doesn't help
+		return queue.Permanent(err)
+	}
+
+	req, err := http.NewRequest(w.c.Method, w.c.URL, bytes.NewReader(body))
+	if err != nil {
+		return queue.Permanent(err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	for k, v := range w.c.Headers {
+		req.Header.Set(k, v)
+	}
+
+	if w.c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+w.c.Token)
+	}
+
+	if w.c.Username != "" {
+		req.SetBasicAuth(w.c.Username, w.c.Password)
+	}
+
+	resp, err := w.cli.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		_, _ = io.Copy(ioutil.Discard, resp.Body)
+		return nil
+	}
+
+	msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+
+	se := statusError{code: resp.StatusCode, body: string(msg)}
+	if se.permanent() {
+		return queue.Permanent(se)
+	}
+
+	return se
+}
+
+func (w *Webhook) Close() {
+	w.d.Close()
+}
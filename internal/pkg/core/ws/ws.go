@@ -21,6 +21,7 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -53,8 +54,17 @@ type conn struct {
 	*websocket.Conn
 	l         *log.Entry
 	name, sid string
+	version   string
 	rmx       *sync.Mutex
 	req       map[string]chan<- []byte
+	// true if connection closed (rmx protects it)
+	closed bool
+}
+
+// Handler process requests sent by connectors to core
+// it receives connector name and raw request and returns raw response
+type Handler interface {
+	Handle(connector string, req []byte) []byte
 }
 
 // Service represent web socket server (or http fallback server)
@@ -63,10 +73,23 @@ type Service struct {
 	srv       *http.Server
 	verConstr *semver.Constraints
 	mx        sync.RWMutex
-	conns     map[string]conn
+	conns     map[string]*conn
+	// closed and replaced by new channel when connector connected
+	connected chan struct{}
+	// how long request to disconnected connector waits its reconnect
+	grace time.Duration
+
+	done        chan struct{}
+	requestsCh  chan<- []byte
+	callHandler Handler
+	// called when connector connected or disconnected
+	onChange func()
+}
 
-	done       chan struct{}
-	requestsCh chan<- []byte
+// ConnectorInfo describes connected connector
+type ConnectorInfo struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
 }
 
 // this wrapper add logger with request id to request context
@@ -108,7 +131,9 @@ func versionToConstr(v string) (*semver.Constraints, error) {
 }
 
 // New create new WebSocket server
-func New(port int, version string, requestsCh chan<- []byte) (*Service, error) {
+// grace is how long requests to disconnected connector wait while it reconnects
+// (0 means requests fail immediately)
+func New(port int, version string, grace time.Duration, requestsCh chan<- []byte) (*Service, error) {
 	if !(1 <= port && port <= 65535) {
 		return nil, errors.New("ws.new: wrong port")
 	}
@@ -120,7 +145,9 @@ func New(port int, version string, requestsCh chan<- []byte) (*Service, error) {
 
 	ws := &Service{
 		verConstr:  vc,
-		conns:      make(map[string]conn, 10),
+		conns:      make(map[string]*conn, 10),
+		connected:  make(chan struct{}),
+		grace:      grace,
 		done:       make(chan struct{}),
 		requestsCh: requestsCh,
 	}
@@ -170,6 +197,69 @@ func (s *Service) Start() <-chan error {
 	return errCh
 }
 
+// SetHandler set handler of connectors requests
+// until handler set connectors receive method not found error
+func (s *Service) SetHandler(h Handler) {
+	s.mx.Lock()
+	s.callHandler = h
+	s.mx.Unlock()
+}
+
+// OnChange set callback which called when connector connected or disconnected
+func (s *Service) OnChange(fn func()) {
+	s.mx.Lock()
+	s.onChange = fn
+	s.mx.Unlock()
+}
+
+func (s *Service) changed() {
+	s.mx.RLock()
+	fn := s.onChange
+	s.mx.RUnlock()
+
+	if fn != nil {
+		fn()
+	}
+}
+
+// Connectors returns connected connectors sorted by name
+func (s *Service) Connectors() []ConnectorInfo {
+	s.mx.RLock()
+	res := make([]ConnectorInfo, 0, len(s.conns))
+
+	for _, c := range s.conns {
+		res = append(res, ConnectorInfo{c.name, c.version})
+	}
+	s.mx.RUnlock()
+
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+
+	return res
+}
+
+// handle process request from connector and write response back
+func (s *Service) handle(conn *conn, id jsoniter.Any, msg []byte) {
+	s.mx.RLock()
+	h := s.callHandler
+	s.mx.RUnlock()
+
+	var resp []byte
+
+	if h == nil {
+		resp = jsonrpc.BuildErrResp(id.ToString(), jsonrpc.ErrMethodNotFound)
+	} else {
+		resp = h.Handle(conn.name, msg)
+	}
+
+	conn.cmx.Lock()
+	err := conn.WriteMessage(websocket.TextMessage, resp)
+	conn.cmx.Unlock()
+
+	if err != nil {
+		conn.l.WithError(err).Error("ws.conn.write response")
+	}
+}
+
 func (s *Service) Close() error {
 	close(s.done)
 
@@ -257,34 +347,55 @@ func (s *Service) handler(w http.ResponseWriter, r *http.Request) {
 
 	logger.Info("new connection")
 
-	wsc := conn{
+	wsc := &conn{
 		Conn: c, l: logger, name: connectorType, sid: sid,
-		cmx: new(sync.Mutex),
-		rmx: new(sync.Mutex),
-		req: make(map[string]chan<- []byte, 10),
+		cmx:     new(sync.Mutex),
+		rmx:     new(sync.Mutex),
+		req:     make(map[string]chan<- []byte, 10),
+		version: r.Header.Get("x-connector-version"),
 	}
 
 	s.mx.Lock()
 	s.conns[connectorType] = wsc
+	// wake up requests which wait reconnect
+	close(s.connected)
+	s.connected = make(chan struct{})
 	s.mx.Unlock()
 
+	s.changed()
+
 	go s.listen(wsc)
 }
 
-func (s *Service) closeConnOnErr(conn conn) {
+func (s *Service) closeConnOnErr(conn *conn) {
 	conn.rmx.Lock()
+	pending := conn.req
 	conn.req = nil
+	conn.closed = true
 	conn.rmx.Unlock()
+
+	// responses never come so fail all pending requests right now
+	for id, ch := range pending {
+		ch <- jsonrpc.BuildErrResp(id, errNotAvailable.AddData("sid", conn.sid))
+	}
+
 	conn.cmx.Lock()
 	conn.Close()
 	conn.cmx.Unlock()
 
 	s.mx.Lock()
-	delete(s.conns, conn.name)
+	removed := s.conns[conn.name] == conn
+	if removed {
+		delete(s.conns, conn.name)
+	}
 	s.mx.Unlock()
+
+	if removed {
+		s.changed()
+	}
 }
 
-func (s *Service) listen(conn conn) {
+func (s *Service) listen(conn *conn) {
 	for {
 		mt, msg, err := conn.ReadMessage()
 		if err != nil {
@@ -318,14 +429,23 @@ func (s *Service) listen(conn conn) {
 
 		// check this message request or response
 		methodVal := jsoniter.ConfigFastest.Get(msg, "method")
+		idVal := jsoniter.ConfigFastest.Get(msg, "id")
+
 		if methodVal.ValueType() != jsoniter.InvalidValue {
-			// this msg is request
-			s.requestsCh <- msg
+			if idVal.ValueType() == jsoniter.InvalidValue || idVal.ValueType() == jsoniter.NilValue {
+				// this msg is notification
+				s.requestsCh <- msg
+
+				continue
+			}
+
+			// this msg is request to core
+			// it processed in separate goroutine because handler can be slow
+			go s.handle(conn, idVal, msg)
 
 			continue
 		}
 
-		idVal := jsoniter.ConfigFastest.Get(msg, "id")
 		if idVal.LastError() != nil {
 			conn.l.WithError(idVal.LastError()).Error("get id from json")
 
@@ -340,7 +460,10 @@ func (s *Service) listen(conn conn) {
 		conn.rmx.Unlock()
 
 		if !ok {
-			panic("resp chan not found")
+			// request already failed (connection closed by write error)
+			conn.l.WithField("id", id).Error("resp chan not found")
+
+			continue
 		}
 
 		ch <- msg
@@ -354,28 +477,70 @@ func (s *Service) Call(name, id string, payload []byte) <-chan []byte {
 	conn, ok := s.conns[name]
 	s.mx.RUnlock()
 
-	if !ok {
-		resp <- jsonrpc.BuildErrResp(id, errNotFound)
+	if !ok && s.grace > 0 {
+		go func() {
+			conn, ok := s.waitConn(name)
+			s.send(resp, conn, ok, id, payload)
+		}()
+
 		return resp
 	}
 
-	conn.cmx.Lock()
-	err := conn.WriteMessage(websocket.TextMessage, payload)
-	conn.cmx.Unlock()
+	s.send(resp, conn, ok, id, payload)
 
-	if err != nil {
-		s.closeConnOnErr(conn)
+	return resp
+}
 
-		conn.l.WithError(err).Error("ws.conn.write")
+// waitConn waits while connector connects (but no longer than grace period)
+func (s *Service) waitConn(name string) (*conn, bool) {
+	timer := time.NewTimer(s.grace)
+	defer timer.Stop()
 
-		resp <- jsonrpc.BuildErrResp(id, errNotAvailable.AddData("sid", conn.sid))
+	for {
+		s.mx.RLock()
+		conn, ok := s.conns[name]
+		connected := s.connected
+		s.mx.RUnlock()
 
-		return resp
+		if ok {
+			return conn, true
+		}
+
+		select {
+		case <-connected:
+		case <-timer.C:
+			return nil, false
+		case <-s.done:
+			return nil, false
+		}
 	}
+}
 
+func (s *Service) send(resp chan<- []byte, conn *conn, ok bool, id string, payload []byte) {
+	if !ok {
+		resp <- jsonrpc.BuildErrResp(id, errNotFound)
+		return
+	}
+
+	// register request before write because response can come
+	// before write returns
 	conn.rmx.Lock()
+	if conn.closed {
+		conn.rmx.Unlock()
+		resp <- jsonrpc.BuildErrResp(id, errNotAvailable.AddData("sid", conn.sid))
+
+		return
+	}
 	conn.req[id] = resp
 	conn.rmx.Unlock()
 
-	return resp
+	conn.cmx.Lock()
+	err := conn.WriteMessage(websocket.TextMessage, payload)
+	conn.cmx.Unlock()
+
+	if err != nil {
+		conn.l.WithError(err).Error("ws.conn.write")
+		// it fails all pending requests including this one
+		s.closeConnOnErr(conn)
+	}
 }
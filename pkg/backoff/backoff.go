@@ -0,0 +1,59 @@
+/**
+ * Copyright 2021 Rightech IoT. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package backoff implements exponential backoff of retries
+package backoff
+
+import "time"
+
+// Backoff returns exponentially growing delays between min and max
+// zero value is not usable, use New
+type Backoff struct {
+	min, max time.Duration
+	cur      time.Duration
+}
+
+func New(min, max time.Duration) *Backoff {
+	if min <= 0 {
+		min = time.Second
+	}
+
+	if max < min {
+		max = min
+	}
+
+	return &Backoff{min: min, max: max}
+}
+
+// Next returns delay before next attempt
+func (b *Backoff) Next() time.Duration {
+	switch {
+	case b.cur == 0:
+		b.cur = b.min
+	case b.cur < b.max:
+		b.cur *= 2
+		if b.cur > b.max {
+			b.cur = b.max
+		}
+	}
+
+	return b.cur
+}
+
+// Reset starts delays from min again (call it after successful attempt)
+func (b *Backoff) Reset() {
+	b.cur = 0
+}
@@ -0,0 +1,105 @@
+/**
+ * Copyright 2021 Rightech IoT. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package jsonrpc
+
+import (
+	"encoding/base64"
+	"errors"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// BinaryKey is the only key of json object which represents Binary value
+const BinaryKey = "$binary"
+
+// Binary is raw bytes value
+// in json it encoded as {"$binary": "<base64>"} so receiver can distinguish it
+// from ordinary string
+type Binary []byte
+
+var errNotBinary = errors.New("jsonrpc: value is not binary")
+
+func (b Binary) MarshalJSON() ([]byte, error) {
+	return []byte(`{"` + BinaryKey + `":"` + base64.StdEncoding.EncodeToString(b) + `"}`), nil
+}
+
+func (b *Binary) UnmarshalJSON(data []byte) error {
+	var v map[string]string
+
+	err := jsoniter.ConfigFastest.Unmarshal(data, &v)
+	if err != nil {
+		return err
+	}
+
+	res, ok := binaryFromMap(v)
+	if !ok {
+		return errNotBinary
+	}
+
+	*b = res
+
+	return nil
+}
+
+func binaryFromMap(m map[string]string) (Binary, bool) {
+	v, ok := m[BinaryKey]
+	if !ok || len(m) != 1 {
+		return nil, false
+	}
+
+	res, err := base64.StdEncoding.DecodeString(v)
+	if err != nil {
+		return nil, false
+	}
+
+	return res, true
+}
+
+// ParseBinary returns bytes if v is decoded Binary value
+func ParseBinary(v interface{}) ([]byte, bool) {
+	m, ok := v.(map[string]interface{})
+	if !ok || len(m) != 1 {
+		return nil, false
+	}
+
+	s, ok := m[BinaryKey].(string)
+	if !ok {
+		return nil, false
+	}
+
+	return binaryFromMap(map[string]string{BinaryKey: s})
+}
+
+// DecodeBinary replaces all Binary values in decoded json by []byte
+func DecodeBinary(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		if b, ok := ParseBinary(val); ok {
+			return []byte(b)
+		}
+
+		for k, item := range val {
+			val[k] = DecodeBinary(item)
+		}
+	case []interface{}:
+		for i, item := range val {
+			val[i] = DecodeBinary(item)
+		}
+	}
+
+	return v
+}
@@ -0,0 +1,139 @@
+/**
+ * Copyright 2021 Rightech IoT. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package jsonrpc
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+
+	jsoniter "github.com/json-iterator/go"
+
+	"github.com/Rightech/ric-edge/pkg/nanoid"
+)
+
+// ErrNotConnected returned by Call when connection to core lost
+var ErrNotConnected = errors.New("jsonrpc: not connected")
+
+// message is any incoming message (request or response)
+type message struct {
+	Request
+	Result jsoniter.RawMessage `json:"result"`
+	Error  *errorMessage       `json:"error"`
+}
+
+func (m message) isResponse() bool {
+	return m.Method == "" && (len(m.Result) != 0 || m.Error != nil)
+}
+
+type errorMessage struct {
+	Code    int                    `json:"code"`
+	Message string                 `json:"message"`
+	Data    map[string]interface{} `json:"data"`
+}
+
+// calls stores requests sent to core which wait response
+type calls struct {
+	mx sync.Mutex
+	m  map[string]chan<- message
+}
+
+func (c *calls) add(id string, ch chan<- message) {
+	c.mx.Lock()
+	c.m[id] = ch
+	c.mx.Unlock()
+}
+
+func (c *calls) remove(id string) {
+	c.mx.Lock()
+	delete(c.m, id)
+	c.mx.Unlock()
+}
+
+func (c *calls) resolve(msg message) {
+	id, err := strconv.Unquote(string(msg.ID))
+	if err != nil {
+		return
+	}
+
+	c.mx.Lock()
+	ch, ok := c.m[id]
+	delete(c.m, id)
+	c.mx.Unlock()
+
+	if ok {
+		ch <- msg
+	}
+}
+
+// failAll closes all waiting calls (connection lost so responses never come)
+func (c *calls) failAll() {
+	c.mx.Lock()
+	for id, ch := range c.m {
+		close(ch)
+		delete(c.m, id)
+	}
+	c.mx.Unlock()
+}
+
+// Call sends request to core and waits response
+// result decoded into res (if res is not nil)
+// if core returns error it returned as Error
+// NOTE: when Workers <= 1 handler should not call core while it process request
+// because response can't be read until handler returns
+func (s Service) Call(ctx context.Context, method string, params, res interface{}) error {
+	id := nanoid.New()
+	ch := make(chan message, 1)
+
+	s.calls.add(id, ch)
+	defer s.calls.remove(id)
+
+	req := struct {
+		JSONRPC string      `json:"jsonrpc"`
+		Method  string      `json:"method"`
+		ID      string      `json:"id"`
+		Params  interface{} `json:"params,omitempty"`
+	}{jsonRPCVersion, method, id, params}
+
+	s.mx.Lock()
+	err := s.writeLocked(req)
+	s.mx.Unlock()
+
+	if err != nil {
+		return ErrNotConnected
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case msg, ok := <-ch:
+		if !ok {
+			return ErrNotConnected
+		}
+
+		if msg.Error != nil {
+			return Error{code: msg.Error.Code, message: msg.Error.Message, data: msg.Error.Data}
+		}
+
+		if res == nil {
+			return nil
+		}
+
+		return jsoniter.ConfigFastest.Unmarshal(msg.Result, res)
+	}
+}
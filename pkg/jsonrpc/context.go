@@ -0,0 +1,99 @@
+/**
+ * Copyright 2021 Rightech IoT. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package jsonrpc
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// DeadlineParam is request param where core put request deadline
+// (unix time in milliseconds)
+const DeadlineParam = "_deadline"
+
+// ContextCaller is context aware variant of Caller
+// context canceled when service stops (or connection to core lost)
+// and has deadline if core sent it
+type ContextCaller interface {
+	CallContext(context.Context, Request) (interface{}, error)
+}
+
+// WithContext wraps ContextCaller to use it as Caller
+func WithContext(c ContextCaller) Caller {
+	return contextCaller{c}
+}
+
+type contextCaller struct {
+	c ContextCaller
+}
+
+func (c contextCaller) Call(req Request) (interface{}, error) {
+	return c.c.CallContext(req.Context(), req)
+}
+
+// InjectRPC pass rpc to wrapped caller (if it required)
+func (c contextCaller) InjectRPC(rpc RPC) {
+	if v, ok := c.c.(interface {
+		InjectRPC(RPC)
+	}); ok {
+		v.InjectRPC(rpc)
+	}
+}
+
+// Context returns request context (it never nil)
+func (r Request) Context() context.Context {
+	if r.ctx == nil {
+		return context.Background()
+	}
+
+	return r.ctx
+}
+
+// WithContext returns copy of request with ctx
+func (r Request) WithContext(ctx context.Context) Request {
+	r.ctx = ctx
+	return r
+}
+
+// Deadline returns deadline sent by core
+func (r Request) Deadline() (time.Time, bool) {
+	number, ok := r.Params.Get(DeadlineParam).Data().(json.Number)
+	if !ok {
+		return time.Time{}, false
+	}
+
+	ms, err := number.Int64()
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return time.Unix(0, ms*int64(time.Millisecond)), true
+}
+
+// withDeadline apply deadline sent by core to request context
+func (r Request) withDeadline() (Request, context.CancelFunc) {
+	d, ok := r.Deadline()
+	if !ok {
+		ctx, cancel := context.WithCancel(r.Context())
+		return r.WithContext(ctx), cancel
+	}
+
+	ctx, cancel := context.WithDeadline(r.Context(), d)
+
+	return r.WithContext(ctx), cancel
+}
@@ -29,6 +29,7 @@ import (
 	"github.com/stretchr/objx"
 
 	"github.com/Rightech/ric-edge/pkg/nanoid"
+	"github.com/Rightech/ric-edge/pkg/store/queue"
 )
 
 // Caller interface
@@ -40,13 +41,20 @@ type Caller interface {
 
 type RPC interface {
 	NewNotification(params objx.Map) NotificationService
+	// Call sends request to core and waits response
+	Call(ctx context.Context, method string, params, res interface{}) error
 }
 
 const (
 	jsonRPCVersion = "2.0"
 	retriesSleep   = time.Second
+	// notifications buffered while core unreachable (see Notifications)
+	defaultNotificationsSize = 1000
 )
 
+// NotificationsMethod is method which returns stats of notifications buffer
+const NotificationsMethod = "rpc-notifications"
+
 type NextWriter interface {
 	NextWriter() (io.WriteCloser, error)
 }
@@ -66,6 +74,17 @@ type Service struct {
 	// this lock required because only one encoder can exists at point of time
 	mx *sync.Mutex
 	tr Transport
+
+	workers int
+	keyFn   KeyFunc
+
+	mw []Middleware
+
+	// requests sent to core
+	calls *calls
+
+	// notifications waiting send to core
+	nq *queue.Queue
 }
 
 type Option func(*Service)
@@ -76,13 +95,44 @@ func CatchPanic(v bool) Option {
 	}
 }
 
+// Workers set number of requests processed in parallel
+// n <= 1 means requests processed one by one (default)
+func Workers(n int) Option {
+	return func(s *Service) {
+		s.workers = n
+	}
+}
+
+// Notifications set buffer of notifications
+// notifications are sent from it in order when connection to core available
+// by default it's memory buffer of 1000 notifications (the oldest dropped)
+func Notifications(q *queue.Queue) Option {
+	return func(s *Service) {
+		s.nq = q
+	}
+}
+
+// SerializeBy set function to get serialization key of request
+// it has effect only if Workers > 1
+func SerializeBy(fn KeyFunc) Option {
+	return func(s *Service) {
+		s.keyFn = fn
+	}
+}
+
 func New(tr Transport, c Caller, o ...Option) Service {
-	s := &Service{c, true, new(sync.Mutex), tr}
+	s := &Service{
+		c: c, catchPanic: true, mx: new(sync.Mutex), tr: tr, workers: 1,
+		calls: &calls{m: make(map[string]chan<- message)},
+		nq:    queue.NewMemory(defaultNotificationsSize, queue.DropOldest),
+	}
 
 	for _, f := range o {
 		f(s)
 	}
 
+	s.c = chain(s.c, s.mw)
+
 	return *s
 }
 
@@ -113,14 +163,43 @@ func newEncoder(w NextWriter) (*jsoniter.Stream, io.Closer, error) {
 }
 
 func (s Service) Serve(ctx context.Context) error {
+	// all in-flight requests canceled when connection lost
+	// because nobody waits their responses anymore
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// the same for requests sent to core
+	defer s.calls.failAll()
+
+	flushed := make(chan struct{})
+
+	go func() {
+		s.flushNotifications(ctx)
+		close(flushed)
+	}()
+
+	// only one flusher should work at point of time
+	// otherwise notification could be sent twice
+	defer func() {
+		cancel()
+		<-flushed
+	}()
+
+	var p *pool
+
+	if s.workers > 1 {
+		p = newPool(s, s.workers, s.keyFn)
+		defer p.close()
+	}
+
 	for ctx.Err() == nil {
 		decoder, err := newDecoder(s.tr) // json decoder
 		if err != nil {
 			return err
 		}
 
-		var req Request
-		err = decoder.Decode(&req)
+		var msg message
+		err = decoder.Decode(&msg)
 
 		if errors.Is(err, io.EOF) {
 			// if error is a EOF we should return error
@@ -130,23 +209,46 @@ func (s Service) Serve(ctx context.Context) error {
 			return err
 		}
 
+		if err == nil && msg.isResponse() {
+			s.calls.resolve(msg)
+			continue
+		}
+
+		req := msg.Request
+		req.ctx = ctx
+
+		if err == nil && p != nil {
+			p.push(req)
+			continue
+		}
+
 		res := s.handleMessage(req, err)
 		s.mx.Lock()
-		encoder, closer, err := newEncoder(s.tr) // json encoder
+		err = s.writeLocked(res)
+		s.mx.Unlock()
 
 		if err != nil {
-			s.mx.Unlock()
 			return err
 		}
+	}
 
-		encoder.WriteVal(res)
-		encoder.Flush()
-		closer.Close()
-		s.mx.Unlock()
+	return nil
+}
 
-		if encoder.Error != nil {
-			panic(encoder.Error)
-		}
+// write value to transport
+// s.mx should be locked by caller
+func (s Service) writeLocked(v interface{}) error {
+	encoder, closer, err := newEncoder(s.tr) // json encoder
+	if err != nil {
+		return err
+	}
+
+	encoder.WriteVal(v)
+	encoder.Flush()
+	closer.Close()
+
+	if encoder.Error != nil {
+		panic(encoder.Error)
 	}
 
 	return nil
@@ -157,6 +259,8 @@ type Request struct {
 	Method  string              `json:"method"`
 	ID      jsoniter.RawMessage `json:"id,omitempty"`
 	Params  objx.Map            `json:"params"`
+
+	ctx context.Context
 }
 
 type response struct {
@@ -169,7 +273,6 @@ type response struct {
 type NotificationService struct {
 	s             Service
 	id            string
-	sendL         *sync.Mutex
 	requestParams objx.Map
 }
 
@@ -177,7 +280,6 @@ func (s Service) NewNotification(params objx.Map) NotificationService {
 	return NotificationService{
 		s:             s,
 		id:            nanoid.New(),
-		sendL:         new(sync.Mutex),
 		requestParams: params,
 	}
 }
@@ -190,46 +292,67 @@ func (n NotificationService) ID() string {
 	return n.id
 }
 
+type notificationParams struct {
+	RequestParams objx.Map    `json:"__request_params"`
+	ProcessID     string      `json:"__process_id"`
+	Value         interface{} `json:"value"`
+}
+
 // Send message (as jsonrpc notification call) to core
+// it never blocks: message is buffered and sent when connection available
+// (it could be dropped if buffer is full)
 func (n NotificationService) Send(value interface{}) {
-	// this lock prevent multiple calls when client in reconnect state
-	n.sendL.Lock()
-	defer n.sendL.Unlock()
-
-	payload := map[string]interface{}{
-		"__request_params": n.requestParams,
-		"__process_id":     n.id,
-		"value":            value,
-	}
+	req := struct {
+		JSONRPC string             `json:"jsonrpc"`
+		Method  string             `json:"method"`
+		Params  notificationParams `json:"params"`
+	}{jsonRPCVersion, "notification", notificationParams{n.requestParams, n.id, value}}
 
-	req := Request{
-		JSONRPC: jsonRPCVersion,
-		Method:  "notification",
-		Params:  payload,
+	data, err := jsoniter.ConfigFastest.Marshal(req)
+	if err != nil {
+		log.WithError(err).WithField("process_id", n.id).Error("notification: marshal json")
+		return
 	}
 
-	for {
-		n.s.mx.Lock()
-		enc, closer, err := newEncoder(n.s.tr)
+	// process id used as key to coalesce notifications
+	err = n.s.nq.Push(n.id, data)
+	if err != nil {
+		log.WithError(err).WithField("process_id", n.id).Error("notification: buffer")
+	}
+}
 
+// flushNotifications sends buffered notifications until ctx done or connection lost
+func (s Service) flushNotifications(ctx context.Context) {
+	for ctx.Err() == nil {
+		it, ok, err := s.nq.Peek()
 		if err != nil {
-			log.Debug("cant send")
-			n.s.mx.Unlock()
-			time.Sleep(retriesSleep) // wait and try again
+			log.WithError(err).Error("notification: read buffer")
+		}
+
+		if !ok {
+			select {
+			case <-ctx.Done():
+			case <-s.nq.Pushed():
+			case <-time.After(retriesSleep): // retry after read error
+			}
 
 			continue
 		}
 
-		enc.WriteVal(req)
-		enc.Flush()
-		closer.Close()
-		n.s.mx.Unlock()
+		s.mx.Lock()
+		err = s.writeLocked(jsoniter.RawMessage(it.Data))
+		s.mx.Unlock()
 
-		if enc.Error != nil {
-			panic(enc.Error)
+		if err != nil {
+			// notification stays in buffer and will be sent after reconnect
+			log.WithError(err).Debug("notification: send")
+			return
 		}
 
-		return
+		err = s.nq.Ack(it)
+		if err != nil {
+			log.WithError(err).Error("notification: remove from buffer")
+		}
 	}
 }
 
@@ -255,6 +378,8 @@ func (s Service) call(req Request) (res interface{}, err error) {
 var (
 	errBadVer    = ErrInvalidRequest.AddData("msg", "bad jsonrpc version")
 	errBadMethod = ErrInvalidRequest.AddData("msg", "empty method")
+	errTimeout   = ErrServer.AddData("msg", "timeout")
+	errCanceled  = ErrServer.AddData("msg", "canceled")
 )
 
 func (s Service) handleMessage(req Request, err error) response {
@@ -270,6 +395,13 @@ func (s Service) handleMessage(req Request, err error) response {
 		return buildResult(req.ID, nil, errBadMethod)
 	}
 
+	if req.Method == NotificationsMethod {
+		return buildResult(req.ID, s.nq.Stats(), nil)
+	}
+
+	req, cancel := req.withDeadline()
+	defer cancel()
+
 	res, err := s.call(req)
 
 	if v, ok := res.(interface {
@@ -295,7 +427,13 @@ func buildResult(id jsoniter.RawMessage, res interface{}, e error) response {
 		res = nil
 		rerr, ok := e.(Error)
 
-		if !ok {
+		switch {
+		case ok:
+		case errors.Is(e, context.DeadlineExceeded):
+			rerr = errTimeout
+		case errors.Is(e, context.Canceled):
+			rerr = errCanceled
+		default:
 			rerr = ErrServer.AddData("msg", e.Error()).SetCode(-32098)
 		}
 
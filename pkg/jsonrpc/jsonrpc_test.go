@@ -0,0 +1,416 @@
+/**
+ * Copyright 2021 Rightech IoT. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package jsonrpc
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"testing"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+
+	"github.com/Rightech/ric-edge/pkg/store/queue"
+)
+
+type testTransport struct {
+	in  chan []byte
+	out chan []byte
+}
+
+func newTestTransport() *testTransport {
+	return &testTransport{make(chan []byte, 10), make(chan []byte, 10)}
+}
+
+func (t *testTransport) NextReader() (io.Reader, error) {
+	msg, ok := <-t.in
+	if !ok {
+		return nil, io.EOF
+	}
+
+	return bytes.NewReader(msg), nil
+}
+
+type testWriter struct {
+	bytes.Buffer
+	out chan []byte
+}
+
+func (w *testWriter) Close() error {
+	w.out <- w.Bytes()
+	return nil
+}
+
+func (t *testTransport) NextWriter() (io.WriteCloser, error) {
+	return &testWriter{out: t.out}, nil
+}
+
+func (t *testTransport) readID(tb testing.TB) string {
+	select {
+	case msg := <-t.out:
+		return jsoniter.ConfigFastest.Get(msg, "id").ToString()
+	case <-time.After(time.Second):
+		tb.Fatal("response timeout")
+	}
+
+	return ""
+}
+
+type testCaller func(Request) (interface{}, error)
+
+func (c testCaller) Call(r Request) (interface{}, error) {
+	return c(r)
+}
+
+func TestServeWorkers(t *testing.T) {
+	tr := newTestTransport()
+
+	caller := testCaller(func(r Request) (interface{}, error) {
+		if r.Method == "slow" {
+			time.Sleep(100 * time.Millisecond)
+		}
+
+		return "ok", nil
+	})
+
+	srv := New(tr, caller, Workers(4), SerializeBy(ParamKey("device")))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go srv.Serve(ctx) // nolint: errcheck
+
+	tr.in <- []byte(`{"jsonrpc":"2.0","id":"1","method":"slow","params":{"device":"a"}}`)
+	tr.in <- []byte(`{"jsonrpc":"2.0","id":"2","method":"fast","params":{"device":"a"}}`)
+	tr.in <- []byte(`{"jsonrpc":"2.0","id":"3","method":"fast","params":{"device":"b"}}`)
+
+	// request to other device should not wait slow one
+	// requests to one device should be processed in order
+	for _, id := range []string{"3", "1", "2"} {
+		if got := tr.readID(t); got != id {
+			t.Errorf("wrong response order: want %s got %s", id, got)
+		}
+	}
+
+	close(tr.in)
+}
+
+func TestServeDeadline(t *testing.T) {
+	tr := newTestTransport()
+
+	deadline := time.Now().Add(time.Minute).Truncate(time.Millisecond)
+
+	caller := WithContext(testContextCaller(func(ctx context.Context, r Request) (interface{}, error) {
+		d, ok := ctx.Deadline()
+		return ok && d.Equal(deadline), nil
+	}))
+
+	srv := New(tr, caller)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go srv.Serve(ctx) // nolint: errcheck
+
+	tr.in <- []byte(`{"jsonrpc":"2.0","id":"1","method":"m","params":{"_deadline":` +
+		strconv.FormatInt(deadline.UnixNano()/int64(time.Millisecond), 10) + `}}`)
+
+	select {
+	case msg := <-tr.out:
+		if !jsoniter.ConfigFastest.Get(msg, "result").ToBool() {
+			t.Errorf("deadline not passed to context: %s", msg)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("response timeout")
+	}
+
+	close(tr.in)
+}
+
+type testContextCaller func(context.Context, Request) (interface{}, error)
+
+func (c testContextCaller) CallContext(ctx context.Context, r Request) (interface{}, error) {
+	return c(ctx, r)
+}
+
+func TestMiddleware(t *testing.T) {
+	schemas, err := ParseSchemas([]byte(`{"m": {
+		"type": "object",
+		"required": ["address"],
+		"properties": {"address": {"type": "integer", "minimum": 0, "maximum": 65535}}
+	}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	metrics := NewMetrics()
+
+	c := chain(testCaller(func(r Request) (interface{}, error) {
+		return "ok", nil
+	}), []Middleware{metrics.Middleware(), RateLimit(map[string]float64{"m": 1}), Validate(schemas)})
+
+	params := func(s string) Request {
+		var p map[string]interface{}
+		if err := jsoniter.ConfigFastest.UnmarshalFromString(s, &p); err != nil {
+			t.Fatal(err)
+		}
+
+		return Request{Method: "m", Params: p}
+	}
+
+	if _, err := c.Call(params(`{"address": 70000}`)); err == nil {
+		t.Error("invalid params passed")
+	}
+
+	// first request consumes token
+	if _, err := c.Call(params(`{"address": 1}`)); err == nil {
+		t.Error("rate limit ignored")
+	}
+
+	stats, err := c.Call(Request{Method: MetricsMethod})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s := stats.([]MethodStats); len(s) != 1 || s[0].Count != 2 || s[0].Errors != 2 {
+		t.Errorf("wrong metrics: %+v", s)
+	}
+}
+
+func TestCall(t *testing.T) {
+	tr := newTestTransport()
+
+	srv := New(tr, testCaller(func(r Request) (interface{}, error) {
+		return "ok", nil
+	}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go srv.Serve(ctx) // nolint: errcheck
+
+	res := make(chan string, 1)
+
+	go func() {
+		var v string
+
+		params := struct {
+			Key string `json:"key"`
+		}{"temp"}
+
+		err := srv.Call(ctx, "get-state", params, &v)
+		if err != nil {
+			t.Error(err)
+		}
+
+		res <- v
+	}()
+
+	// emulate core: read request and respond
+	id := tr.readID(t)
+	tr.in <- []byte(`{"jsonrpc":"2.0","id":"` + id + `","result":"42"}`)
+
+	select {
+	case v := <-res:
+		if v != "42" {
+			t.Errorf("want 42 got %s", v)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("call timeout")
+	}
+
+	close(tr.in)
+}
+
+func TestBinary(t *testing.T) {
+	data, err := jsoniter.ConfigFastest.Marshal([]interface{}{Binary{1, 2, 3}, "AQID"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var v interface{}
+	if err := jsoniter.ConfigFastest.Unmarshal(data, &v); err != nil {
+		t.Fatal(err)
+	}
+
+	res := DecodeBinary(v).([]interface{})
+
+	if b, ok := res[0].([]byte); !ok || !bytes.Equal(b, []byte{1, 2, 3}) {
+		t.Errorf("binary not decoded: %s", data)
+	}
+
+	// strings should be untouched even if they look like base64
+	if s, ok := res[1].(string); !ok || s != "AQID" {
+		t.Errorf("string corrupted: %v", res[1])
+	}
+}
+
+func TestRouter(t *testing.T) {
+	type addr struct {
+		Address uint16 `json:"address" rpc:"required"`
+	}
+
+	type params struct {
+		addr
+		SlaveID byte     `json:"slave_id" rpc:"default=1"`
+		Mode    string   `json:"mode" rpc:"enum=a|b"`
+		Values  []uint16 `json:"values" rpc:"max=2"`
+	}
+
+	var got params
+
+	r := NewRouter().Handle("m", func(ctx context.Context, p *params) (interface{}, error) {
+		got = *p
+		return true, nil
+	})
+
+	call := func(s string) error {
+		var p map[string]interface{}
+
+		dec := jsoniter.ConfigFastest.NewDecoder(bytes.NewReader([]byte(s)))
+		dec.UseNumber()
+
+		if err := dec.Decode(&p); err != nil {
+			t.Fatal(err)
+		}
+
+		_, err := r.Call(Request{Method: "m", Params: p})
+
+		return err
+	}
+
+	if err := call(`{"address": 10, "mode": "b", "values": [1, 2]}`); err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Address != 10 || got.SlaveID != 1 || got.Mode != "b" || len(got.Values) != 2 {
+		t.Errorf("wrong binding: %+v", got)
+	}
+
+	for _, s := range []string{
+		`{}`,
+		`{"address": 70000}`,
+		`{"address": 1, "slave_id": -1}`,
+		`{"address": 1, "mode": "c"}`,
+		`{"address": 1, "values": [1, 2, 3]}`,
+		`{"address": 1, "values": [1, "2"]}`,
+	} {
+		err := call(s)
+
+		rerr, ok := err.(Error)
+		if !ok || rerr.code != ErrInvalidParams.code {
+			t.Errorf("%s: want invalid params got %v", s, err)
+		}
+	}
+
+	sc := r.Schemas()["m"]
+	if len(sc.Required) != 1 || *sc.Properties["address"].Maximum != 65535 {
+		t.Errorf("wrong schema: %+v", sc)
+	}
+}
+
+func TestStreamTransport(t *testing.T) {
+	hostR, pluginW := io.Pipe()
+	pluginR, hostW := io.Pipe()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	plugin := New(NewStreamTransport(pluginR, pluginW), testCaller(func(r Request) (interface{}, error) {
+		return fmt.Sprint(r.Method, ":", r.Params.Get("x").Data()), nil
+	}))
+
+	done := make(chan error, 1)
+
+	go func() { done <- plugin.Serve(ctx) }()
+
+	host := New(NewStreamTransport(hostR, hostW), testCaller(func(Request) (interface{}, error) {
+		return true, nil
+	}))
+
+	go host.Serve(ctx) // nolint: errcheck
+
+	for i := 0; i < 3; i++ {
+		var res string
+
+		err := host.Call(ctx, "ping", struct {
+			X int `json:"x"`
+		}{i}, &res)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if want := "ping:" + strconv.Itoa(i); res != want {
+			t.Errorf("want %s got %s", want, res)
+		}
+	}
+
+	hostW.Close()
+
+	select {
+	case err := <-done:
+		if err != io.EOF {
+			t.Errorf("want EOF got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("plugin not stopped")
+	}
+}
+
+func TestNotifications(t *testing.T) {
+	tr := newTestTransport()
+	srv := New(tr, testCaller(func(Request) (interface{}, error) {
+		return true, nil
+	}), Notifications(queue.NewMemory(2, queue.DropOldest)))
+
+	nf := srv.NewNotification(nil)
+
+	// core is not connected yet so notifications are buffered
+	for i := 0; i < 3; i++ {
+		nf.Send(i)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go srv.Serve(ctx) // nolint: errcheck
+
+	for _, want := range []int{1, 2} {
+		select {
+		case msg := <-tr.out:
+			if got := jsoniter.ConfigFastest.Get(msg, "params", "value").ToInt(); got != want {
+				t.Errorf("want %d got %d", want, got)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("notification timeout")
+		}
+	}
+
+	tr.in <- []byte(`{"jsonrpc": "2.0", "id": "1", "method": "` + NotificationsMethod + `"}`)
+
+	select {
+	case msg := <-tr.out:
+		if got := jsoniter.ConfigFastest.Get(msg, "result", "dropped").ToInt(); got != 1 {
+			t.Errorf("want 1 dropped got %s", msg)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("response timeout")
+	}
+}
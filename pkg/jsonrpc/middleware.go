@@ -0,0 +1,249 @@
+/**
+ * Copyright 2021 Rightech IoT. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package jsonrpc
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Middleware wraps Caller to add some common behavior
+// (logging, metrics, validation etc.)
+type Middleware func(next Caller) Caller
+
+// CallerFunc is an adapter to use ordinary function as Caller
+type CallerFunc func(Request) (interface{}, error)
+
+func (f CallerFunc) Call(req Request) (interface{}, error) {
+	return f(req)
+}
+
+// Use add middlewares to service
+// first middleware is outermost (it receives request first)
+func Use(mw ...Middleware) Option {
+	return func(s *Service) {
+		s.mw = append(s.mw, mw...)
+	}
+}
+
+func chain(c Caller, mw []Middleware) Caller {
+	for i := len(mw) - 1; i >= 0; i-- {
+		c = mw[i](c)
+	}
+
+	return c
+}
+
+// Logging logs every request with method, id, duration and error (if any)
+func Logging(logger log.FieldLogger) Middleware {
+	return func(next Caller) Caller {
+		return CallerFunc(func(req Request) (interface{}, error) {
+			start := time.Now()
+
+			res, err := next.Call(req)
+
+			l := logger.WithFields(log.Fields{
+				"method":   req.Method,
+				"id":       string(req.ID),
+				"duration": time.Since(start),
+			})
+
+			if err != nil {
+				l.WithError(err).Warn("request failed")
+			} else {
+				l.Debug("request done")
+			}
+
+			return res, err
+		})
+	}
+}
+
+// MetricsMethod is method which returns collected metrics
+// it is handled by Metrics middleware and never reaches handler
+const MetricsMethod = "rpc-metrics"
+
+// MethodStats is metrics of one method
+type MethodStats struct {
+	Method string `json:"method"`
+	Count  uint64 `json:"count"`
+	Errors uint64 `json:"errors"`
+	// latency in milliseconds
+	AvgLatency float64 `json:"avg_latency"`
+	MaxLatency float64 `json:"max_latency"`
+}
+
+type methodCounter struct {
+	count, errors uint64
+	total, max    time.Duration
+}
+
+// Metrics collects number of requests, errors and latency by method
+type Metrics struct {
+	mx      sync.Mutex
+	methods map[string]*methodCounter
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{methods: make(map[string]*methodCounter)}
+}
+
+func (m *Metrics) observe(method string, d time.Duration, failed bool) {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	c, ok := m.methods[method]
+	if !ok {
+		c = new(methodCounter)
+		m.methods[method] = c
+	}
+
+	c.count++
+	c.total += d
+
+	if d > c.max {
+		c.max = d
+	}
+
+	if failed {
+		c.errors++
+	}
+}
+
+// Snapshot returns current metrics sorted by method
+func (m *Metrics) Snapshot() []MethodStats {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	res := make([]MethodStats, 0, len(m.methods))
+
+	for name, c := range m.methods {
+		res = append(res, MethodStats{
+			Method:     name,
+			Count:      c.count,
+			Errors:     c.errors,
+			AvgLatency: ms(c.total) / float64(c.count),
+			MaxLatency: ms(c.max),
+		})
+	}
+
+	sort.Slice(res, func(i, j int) bool { return res[i].Method < res[j].Method })
+
+	return res
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// Middleware returns middleware which fill metrics
+// also it responds on MetricsMethod with Snapshot
+func (m *Metrics) Middleware() Middleware {
+	return func(next Caller) Caller {
+		return CallerFunc(func(req Request) (interface{}, error) {
+			if req.Method == MetricsMethod {
+				return m.Snapshot(), nil
+			}
+
+			start := time.Now()
+
+			res, err := next.Call(req)
+
+			m.observe(req.Method, time.Since(start), err != nil)
+
+			return res, err
+		})
+	}
+}
+
+var errRateLimit = ErrServer.AddData("msg", "rate limit exceeded").SetCode(-32097)
+
+// bucket is simple token bucket
+type bucket struct {
+	mx     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func (b *bucket) allow(now time.Time) bool {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+
+	b.tokens--
+
+	return true
+}
+
+// RateLimit limits number of requests per second by method
+// methods not present in limits are not limited
+// burst equals to one second of requests (but at least one request)
+func RateLimit(limits map[string]float64) Middleware {
+	buckets := make(map[string]*bucket, len(limits))
+	now := time.Now()
+
+	for method, rate := range limits {
+		if rate <= 0 {
+			continue
+		}
+
+		burst := math.Max(1, math.Ceil(rate))
+		buckets[method] = &bucket{rate: rate, burst: burst, tokens: burst, last: now}
+	}
+
+	return func(next Caller) Caller {
+		return CallerFunc(func(req Request) (interface{}, error) {
+			if b, ok := buckets[req.Method]; ok && !b.allow(time.Now()) {
+				return nil, errRateLimit.AddData("method", req.Method)
+			}
+
+			return next.Call(req)
+		})
+	}
+}
+
+// Validate checks request params by json schema of method
+// methods not present in schemas are not checked
+func Validate(schemas map[string]*Schema) Middleware {
+	return func(next Caller) Caller {
+		return CallerFunc(func(req Request) (interface{}, error) {
+			if sc, ok := schemas[req.Method]; ok {
+				err := sc.Validate(map[string]interface{}(req.Params))
+
+				var verr ValidationError
+				if errors.As(err, &verr) {
+					return nil, ErrInvalidParams.AddData("p", verr.Path).AddData("msg", verr.Msg)
+				}
+			}
+
+			return next.Call(req)
+		})
+	}
+}
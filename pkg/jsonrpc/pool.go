@@ -0,0 +1,181 @@
+/**
+ * Copyright 2021 Rightech IoT. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package jsonrpc
+
+import (
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// KeyFunc returns serialization key of request
+// requests with the same non empty key are processed one by one
+// (in order they were received) even if worker pool enabled
+type KeyFunc func(Request) string
+
+// ParamKey returns KeyFunc which use value of request param as key
+// e.g. ParamKey("device") serialize all requests to one ble device
+func ParamKey(param string) KeyFunc {
+	return func(r Request) string {
+		return r.Params.Get(param).Str()
+	}
+}
+
+// ConstKey returns KeyFunc which serialize all requests
+// (useful when all requests go through one bus but other work can be done in parallel)
+func ConstKey(key string) KeyFunc {
+	return func(Request) string {
+		return key
+	}
+}
+
+type task struct {
+	req Request
+	key string
+}
+
+// pool process requests in parallel by fixed number of workers
+// one pool lives while transport connection alive (one Serve call)
+type pool struct {
+	s     Service
+	keyFn KeyFunc
+
+	mx   sync.Mutex
+	cond *sync.Cond
+	// tasks ready to process
+	ready []task
+	// key -> tasks waiting while task with same key in progress
+	// if key present in map some task with this key in progress
+	waiting map[string][]task
+	closed  bool
+}
+
+func newPool(s Service, workers int, keyFn KeyFunc) *pool {
+	p := &pool{
+		s:       s,
+		keyFn:   keyFn,
+		waiting: make(map[string][]task),
+	}
+	p.cond = sync.NewCond(&p.mx)
+
+	for i := 0; i < workers; i++ {
+		go p.worker()
+	}
+
+	return p
+}
+
+func (p *pool) push(req Request) {
+	t := task{req: req}
+	if p.keyFn != nil {
+		t.key = p.keyFn(req)
+	}
+
+	p.mx.Lock()
+	defer p.mx.Unlock()
+
+	if t.key != "" {
+		if q, ok := p.waiting[t.key]; ok {
+			p.waiting[t.key] = append(q, t)
+			return
+		}
+
+		// mark key as in progress
+		p.waiting[t.key] = nil
+	}
+
+	p.ready = append(p.ready, t)
+	p.cond.Signal()
+}
+
+func (p *pool) next() (task, bool) {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+
+	for len(p.ready) == 0 && !p.closed {
+		p.cond.Wait()
+	}
+
+	if p.closed {
+		return task{}, false
+	}
+
+	t := p.ready[0]
+	p.ready = p.ready[1:]
+
+	return t, true
+}
+
+func (p *pool) done(t task) {
+	if t.key == "" {
+		return
+	}
+
+	p.mx.Lock()
+	defer p.mx.Unlock()
+
+	q := p.waiting[t.key]
+	if len(q) == 0 {
+		delete(p.waiting, t.key)
+		return
+	}
+
+	p.waiting[t.key] = q[1:]
+	p.ready = append(p.ready, q[0])
+	p.cond.Signal()
+}
+
+func (p *pool) worker() {
+	for {
+		t, ok := p.next()
+		if !ok {
+			return
+		}
+
+		res := p.s.handleMessage(t.req, nil)
+
+		p.s.mx.Lock()
+		p.mx.Lock()
+		closed := p.closed
+		p.mx.Unlock()
+
+		// if pool closed transport is gone (or reconnected)
+		// so core doesn't wait this response anymore
+		if !closed {
+			err := p.s.writeLocked(res)
+			if err != nil {
+				log.WithError(err).Debug("write response")
+			}
+		}
+		p.s.mx.Unlock()
+
+		p.done(t)
+	}
+}
+
+// close stops workers and drop all not started tasks
+func (p *pool) close() {
+	// s.mx required here to be sure no one write response right now
+	p.s.mx.Lock()
+	p.mx.Lock()
+	p.closed = true
+	p.ready = nil
+	p.waiting = nil
+	p.cond.Broadcast()
+	p.mx.Unlock()
+	p.s.mx.Unlock()
+}
@@ -0,0 +1,562 @@
+/**
+ * Copyright 2021 Rightech IoT. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package jsonrpc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// SchemaMethod is method which returns params schema of all router methods
+const SchemaMethod = "rpc-schema"
+
+// Router is Caller which dispatch requests to methods registered with Handle
+//
+// each method has own params struct, request params are bound to struct fields
+// by json tag (field name is used if tag missed) and validated by rpc tag:
+//
+//	required     - param should be present in request
+//	min=N, max=N - range of number (or length of string and array)
+//	enum=a|b|c   - allowed values
+//	default=V    - value used if param missed
+//
+// e.g.
+//
+//	type readParams struct {
+//		Address  uint16 `json:"address" rpc:"required"`
+//		Quantity uint16 `json:"quantity" rpc:"required,min=1,max=125"`
+//	}
+//
+// binding and validation errors returned as ErrInvalidParams
+// (with "p" - name of param and "msg" - description)
+type Router struct {
+	methods map[string]routerMethod
+}
+
+type routerMethod struct {
+	fn     reflect.Value
+	params reflect.Type
+	fields []paramField
+	schema *Schema
+}
+
+type paramField struct {
+	index    []int
+	name     string
+	required bool
+	min, max *float64
+	enum     []string
+	def      interface{}
+}
+
+var (
+	ctxType   = reflect.TypeOf((*context.Context)(nil)).Elem()
+	errorType = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+func NewRouter() *Router {
+	return &Router{methods: make(map[string]routerMethod)}
+}
+
+// Handle registers method
+// fn should be func(context.Context, *P) (interface{}, error) where P is params struct
+// it panics if fn or tags of P are invalid (it's programming error)
+func (r *Router) Handle(name string, fn interface{}) *Router {
+	v := reflect.ValueOf(fn)
+	t := v.Type()
+
+	if t.Kind() != reflect.Func || t.NumIn() != 2 || t.NumOut() != 2 ||
+		t.In(0) != ctxType || t.In(1).Kind() != reflect.Ptr ||
+		t.In(1).Elem().Kind() != reflect.Struct || t.Out(1) != errorType {
+		panic("jsonrpc: " + name + ": handler should be func(context.Context, *Struct) (T, error)")
+	}
+
+	params := t.In(1).Elem()
+
+	m := routerMethod{fn: v, params: params, fields: parseFields(name, params, nil)}
+	m.schema = buildSchema(params, m.fields)
+
+	r.methods[name] = m
+
+	return r
+}
+
+// Call implements Caller
+func (r *Router) Call(req Request) (interface{}, error) {
+	return r.CallContext(req.Context(), req)
+}
+
+type requestKey struct{}
+
+// RequestFromContext returns request processed by Router
+// (useful if handler needs raw params)
+func RequestFromContext(ctx context.Context) (Request, bool) {
+	req, ok := ctx.Value(requestKey{}).(Request)
+	return req, ok
+}
+
+// CallContext implements ContextCaller
+func (r *Router) CallContext(ctx context.Context, req Request) (interface{}, error) {
+	m, ok := r.methods[req.Method]
+	if !ok {
+		if req.Method == SchemaMethod {
+			return r.Schemas(), nil
+		}
+
+		return nil, ErrMethodNotFound.AddData("method", req.Method)
+	}
+
+	params := reflect.New(m.params)
+
+	for _, f := range m.fields {
+		err := f.bind(params.Elem().FieldByIndex(f.index), req.Params)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	ctx = context.WithValue(ctx, requestKey{}, req)
+
+	out := m.fn.Call([]reflect.Value{reflect.ValueOf(ctx), params})
+
+	err, _ := out[1].Interface().(error)
+
+	return out[0].Interface(), err
+}
+
+// Schemas returns json schema of params of all methods
+func (r *Router) Schemas() map[string]*Schema {
+	res := make(map[string]*Schema, len(r.methods))
+
+	for name, m := range r.methods {
+		res[name] = m.schema
+	}
+
+	return res
+}
+
+// Methods returns sorted names of registered methods
+func (r *Router) Methods() []string {
+	res := make([]string, 0, len(r.methods))
+
+	for name := range r.methods {
+		res = append(res, name)
+	}
+
+	sort.Strings(res)
+
+	return res
+}
+
+func fieldName(f reflect.StructField) string {
+	name := strings.Split(f.Tag.Get("json"), ",")[0]
+	if name == "" {
+		return f.Name
+	}
+
+	return name
+}
+
+func parseFields(method string, t reflect.Type, index []int) []paramField {
+	var res []paramField
+
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		idx := append(append([]int(nil), index...), i)
+
+		// fields of embedded struct are params too
+		if sf.Anonymous && sf.Type.Kind() == reflect.Struct {
+			res = append(res, parseFields(method, sf.Type, idx)...)
+			continue
+		}
+
+		if sf.PkgPath != "" || sf.Tag.Get("json") == "-" {
+			continue
+		}
+
+		f := paramField{index: idx, name: fieldName(sf)}
+
+		err := f.parseTag(sf)
+		if err != nil {
+			panic(fmt.Sprintf("jsonrpc: %s: %s: %v", method, f.name, err))
+		}
+
+		res = append(res, f)
+	}
+
+	return res
+}
+
+func (f *paramField) parseTag(sf reflect.StructField) error {
+	tag := sf.Tag.Get("rpc")
+	if tag == "" {
+		return nil
+	}
+
+	for _, opt := range strings.Split(tag, ",") {
+		kv := strings.SplitN(opt, "=", 2)
+
+		switch kv[0] {
+		case "required":
+			f.required = true
+			continue
+		case "min", "max", "enum", "default":
+		default:
+			return fmt.Errorf("unknown option %s", kv[0])
+		}
+
+		if len(kv) != 2 {
+			return fmt.Errorf("%s requires value", kv[0])
+		}
+
+		switch kv[0] {
+		case "min", "max":
+			n, err := strconv.ParseFloat(kv[1], 64)
+			if err != nil {
+				return err
+			}
+
+			if kv[0] == "min" {
+				f.min = &n
+			} else {
+				f.max = &n
+			}
+		case "enum":
+			f.enum = strings.Split(kv[1], "|")
+		case "default":
+			def, err := parseDefault(sf.Type, kv[1])
+			if err != nil {
+				return err
+			}
+
+			f.def = def
+		}
+	}
+
+	return nil
+}
+
+func parseDefault(t reflect.Type, v string) (interface{}, error) {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		_, err := strconv.ParseFloat(v, 64)
+		return json.Number(v), err
+	case reflect.Bool:
+		return strconv.ParseBool(v)
+	default:
+		return v, nil
+	}
+}
+
+func (f paramField) errorf(format string, a ...interface{}) error {
+	return ErrInvalidParams.AddData("p", f.name).AddData("msg", f.name+" "+fmt.Sprintf(format, a...))
+}
+
+func (f paramField) bind(v reflect.Value, params map[string]interface{}) error {
+	raw, ok := params[f.name]
+	if !ok || raw == nil {
+		if f.required {
+			return f.errorf("required")
+		}
+
+		if f.def == nil {
+			return nil
+		}
+
+		raw = f.def
+	}
+
+	err := setValue(v, raw)
+	if err != nil {
+		return f.errorf("%s", err.Error())
+	}
+
+	return f.validate(v)
+}
+
+func (f paramField) validate(v reflect.Value) error {
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+
+	var (
+		n    float64
+		kind = "value"
+	)
+
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n = float64(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n = float64(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		n = v.Float()
+	case reflect.String, reflect.Slice, reflect.Array, reflect.Map:
+		n = float64(v.Len())
+		kind = "length"
+	}
+
+	if f.min != nil && n < *f.min {
+		return f.errorf("%s should be >= %v", kind, *f.min)
+	}
+
+	if f.max != nil && n > *f.max {
+		return f.errorf("%s should be <= %v", kind, *f.max)
+	}
+
+	if len(f.enum) == 0 {
+		return nil
+	}
+
+	s := fmt.Sprint(v.Interface())
+	for _, e := range f.enum {
+		if e == s {
+			return nil
+		}
+	}
+
+	return f.errorf("should be one of %s", strings.Join(f.enum, ", "))
+}
+
+type bindError string
+
+func (e bindError) Error() string {
+	return string(e)
+}
+
+func toNumber(v interface{}) (json.Number, bool) {
+	switch n := v.(type) {
+	case json.Number:
+		return n, true
+	case float64:
+		return json.Number(strconv.FormatFloat(n, 'g', -1, 64)), true
+	case int:
+		return json.Number(strconv.Itoa(n)), true
+	case int64:
+		return json.Number(strconv.FormatInt(n, 10)), true
+	}
+
+	return "", false
+}
+
+// setValue set decoded json value v to field
+func setValue(field reflect.Value, v interface{}) error { // nolint: funlen, gocyclo
+	switch field.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		num, ok := toNumber(v)
+		if !ok {
+			return bindError("should be number")
+		}
+
+		i, err := num.Int64()
+		if err != nil {
+			return bindError("should be int")
+		}
+
+		if field.OverflowInt(i) {
+			return bindError("should be " + field.Type().Kind().String())
+		}
+
+		field.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		num, ok := toNumber(v)
+		if !ok {
+			return bindError("should be number")
+		}
+
+		i, err := strconv.ParseUint(num.String(), 10, 64)
+		if err != nil || field.OverflowUint(i) {
+			return bindError("should be " + field.Type().Kind().String())
+		}
+
+		field.SetUint(i)
+	case reflect.Float32, reflect.Float64:
+		num, ok := toNumber(v)
+		if !ok {
+			return bindError("should be number")
+		}
+
+		f, err := num.Float64()
+		if err != nil || field.OverflowFloat(f) {
+			return bindError("should be " + field.Type().Kind().String())
+		}
+
+		field.SetFloat(f)
+	case reflect.String:
+		s, ok := v.(string)
+		if !ok {
+			return bindError("should be string")
+		}
+
+		field.SetString(s)
+	case reflect.Bool:
+		b, ok := v.(bool)
+		if !ok {
+			return bindError("should be bool")
+		}
+
+		field.SetBool(b)
+	case reflect.Interface:
+		if v != nil {
+			field.Set(reflect.ValueOf(v))
+		}
+	case reflect.Ptr:
+		p := reflect.New(field.Type().Elem())
+
+		err := setValue(p.Elem(), v)
+		if err != nil {
+			return err
+		}
+
+		field.Set(p)
+	case reflect.Slice:
+		if field.Type().Elem().Kind() == reflect.Uint8 {
+			// bytes sent as Binary
+			b, ok := ParseBinary(v)
+			if !ok {
+				return bindError("should be binary")
+			}
+
+			field.SetBytes(b)
+
+			return nil
+		}
+
+		items, ok := v.([]interface{})
+		if !ok {
+			return bindError("should be array")
+		}
+
+		res := reflect.MakeSlice(field.Type(), len(items), len(items))
+
+		for i, item := range items {
+			err := setValue(res.Index(i), item)
+			if err != nil {
+				return bindError("[" + strconv.Itoa(i) + "] " + err.Error())
+			}
+		}
+
+		field.Set(res)
+	default:
+		// maps, structs etc. are decoded as json
+		data, err := jsoniter.ConfigFastest.Marshal(v)
+		if err != nil {
+			return err
+		}
+
+		err = jsoniter.ConfigFastest.Unmarshal(data, field.Addr().Interface())
+		if err != nil {
+			return bindError("has wrong format")
+		}
+	}
+
+	return nil
+}
+
+func buildSchema(t reflect.Type, fields []paramField) *Schema {
+	sc := &Schema{Type: "object", Properties: make(map[string]*Schema, len(fields))}
+
+	for _, f := range fields {
+		p := typeSchema(t.FieldByIndex(f.index).Type)
+
+		if f.min != nil || f.max != nil {
+			if p.Type == "string" {
+				p.MinLength, p.MaxLength = toInt(f.min), toInt(f.max)
+			} else if p.Type == "integer" || p.Type == "number" {
+				p.Minimum, p.Maximum = f.min, f.max
+			}
+		}
+
+		for _, e := range f.enum {
+			if p.Type == "integer" || p.Type == "number" {
+				p.Enum = append(p.Enum, json.Number(e))
+			} else {
+				p.Enum = append(p.Enum, e)
+			}
+		}
+
+		if f.required {
+			sc.Required = append(sc.Required, f.name)
+		}
+
+		sc.Properties[f.name] = p
+	}
+
+	return sc
+}
+
+func toInt(f *float64) *int {
+	if f == nil {
+		return nil
+	}
+
+	i := int(*f)
+
+	return &i
+}
+
+func float(f float64) *float64 {
+	return &f
+}
+
+// typeSchema returns schema of go type (with implicit ranges of integers)
+func typeSchema(t reflect.Type) *Schema {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int64:
+		return &Schema{Type: "integer"}
+	case reflect.Int8, reflect.Int16, reflect.Int32:
+		bits := uint(t.Bits())
+		return &Schema{Type: "integer",
+			Minimum: float(-math.Pow(2, float64(bits-1))), Maximum: float(math.Pow(2, float64(bits-1)) - 1)}
+	case reflect.Uint, reflect.Uint64:
+		return &Schema{Type: "integer", Minimum: float(0)}
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", Minimum: float(0), Maximum: float(math.Pow(2, float64(t.Bits())) - 1)}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Ptr:
+		return typeSchema(t.Elem())
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			// Binary
+			return &Schema{Type: "object"}
+		}
+
+		return &Schema{Type: "array", Items: typeSchema(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object"}
+	case reflect.Struct:
+		return buildSchema(t, parseFields(t.Name(), t, nil))
+	}
+
+	// interface - any value
+	return &Schema{}
+}
@@ -0,0 +1,286 @@
+/**
+ * Copyright 2021 Rightech IoT. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package jsonrpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"strings"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// Schema is a subset of json schema (draft 7) used to validate params
+// supported keywords: type, properties, required, additionalProperties,
+// items, enum, minimum, maximum, minLength, maxLength, pattern
+type Schema struct {
+	Type                 string             `json:"type,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *bool              `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+
+	re *regexp.Regexp
+}
+
+// ValidationError describes first found mismatch of value and schema
+type ValidationError struct {
+	// path to invalid value (e.g. "list.0.name")
+	Path string
+	Msg  string
+}
+
+func (e ValidationError) Error() string {
+	if e.Path == "" {
+		return e.Msg
+	}
+
+	return e.Path + ": " + e.Msg
+}
+
+// ParseSchemas parse json object where key is method and value is schema of its params
+func ParseSchemas(data []byte) (map[string]*Schema, error) {
+	var res map[string]*Schema
+
+	decoder := jsoniter.ConfigFastest.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	err := decoder.Decode(&res)
+	if err != nil {
+		return nil, err
+	}
+
+	for method, sc := range res {
+		err = sc.compile()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", method, err)
+		}
+	}
+
+	return res, nil
+}
+
+func (sc *Schema) compile() (err error) {
+	if sc == nil {
+		return nil
+	}
+
+	if sc.Pattern != "" {
+		sc.re, err = regexp.Compile(sc.Pattern)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, p := range sc.Properties {
+		err = p.compile()
+		if err != nil {
+			return err
+		}
+	}
+
+	return sc.Items.compile()
+}
+
+// Validate checks v by schema
+// v should be decoded json (numbers could be json.Number)
+// object keys started with _ are service params added by core
+// so they are not checked by additionalProperties
+func (sc *Schema) Validate(v interface{}) error {
+	return sc.validate("", v)
+}
+
+func fail(path, format string, a ...interface{}) error {
+	return ValidationError{Path: path, Msg: fmt.Sprintf(format, a...)}
+}
+
+func join(path, key string) string {
+	if path == "" {
+		return key
+	}
+
+	return path + "." + key
+}
+
+func (sc *Schema) validate(path string, v interface{}) error {
+	if sc == nil {
+		return nil
+	}
+
+	if sc.Type != "" && !isType(sc.Type, v) {
+		return fail(path, "should be %s", sc.Type)
+	}
+
+	if len(sc.Enum) != 0 && !inEnum(sc.Enum, v) {
+		return fail(path, "should be one of %v", sc.Enum)
+	}
+
+	switch val := v.(type) {
+	case map[string]interface{}:
+		return sc.validateObject(path, val)
+	case []interface{}:
+		for i, item := range val {
+			err := sc.Items.validate(join(path, fmt.Sprint(i)), item)
+			if err != nil {
+				return err
+			}
+		}
+	case string:
+		return sc.validateString(path, val)
+	default:
+		if n, ok := toFloat(v); ok {
+			return sc.validateNumber(path, n)
+		}
+	}
+
+	return nil
+}
+
+func (sc *Schema) validateObject(path string, val map[string]interface{}) error {
+	for _, key := range sc.Required {
+		if _, ok := val[key]; !ok {
+			return fail(join(path, key), "required")
+		}
+	}
+
+	for key, item := range val {
+		p, ok := sc.Properties[key]
+		if !ok {
+			if sc.AdditionalProperties != nil && !*sc.AdditionalProperties &&
+				!strings.HasPrefix(key, "_") {
+				return fail(join(path, key), "unknown property")
+			}
+
+			continue
+		}
+
+		err := p.validate(join(path, key), item)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (sc *Schema) validateString(path, val string) error {
+	length := len([]rune(val))
+
+	if sc.MinLength != nil && length < *sc.MinLength {
+		return fail(path, "should be at least %d characters", *sc.MinLength)
+	}
+
+	if sc.MaxLength != nil && length > *sc.MaxLength {
+		return fail(path, "should be at most %d characters", *sc.MaxLength)
+	}
+
+	if sc.re != nil && !sc.re.MatchString(val) {
+		return fail(path, "should match %s", sc.Pattern)
+	}
+
+	return nil
+}
+
+func (sc *Schema) validateNumber(path string, val float64) error {
+	if sc.Minimum != nil && val < *sc.Minimum {
+		return fail(path, "should be >= %v", *sc.Minimum)
+	}
+
+	if sc.Maximum != nil && val > *sc.Maximum {
+		return fail(path, "should be <= %v", *sc.Maximum)
+	}
+
+	return nil
+}
+
+func isType(typ string, v interface{}) bool {
+	switch typ {
+	case "object":
+		_, ok := v.(map[string]interface{})
+		return ok
+	case "array":
+		_, ok := v.([]interface{})
+		return ok
+	case "string":
+		_, ok := v.(string)
+		return ok
+	case "boolean":
+		_, ok := v.(bool)
+		return ok
+	case "null":
+		return v == nil
+	case "number":
+		_, ok := toFloat(v)
+		return ok
+	case "integer":
+		n, ok := toFloat(v)
+		return ok && n == math.Trunc(n)
+	}
+
+	return false
+}
+
+func inEnum(enum []interface{}, v interface{}) bool {
+	n, isNum := toFloat(v)
+
+	for _, e := range enum {
+		if isNum {
+			if en, ok := toFloat(e); ok && en == n {
+				return true
+			}
+
+			continue
+		}
+
+		if reflect.DeepEqual(e, v) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	}
+
+	return 0, false
+}
@@ -0,0 +1,92 @@
+/**
+ * Copyright 2021 Rightech IoT. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package jsonrpc
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"sync"
+)
+
+// streamTransport is Transport over pair of byte streams
+// each message is written as one line (json encoder never writes new line inside message)
+type streamTransport struct {
+	r  *bufio.Reader
+	w  io.Writer
+	mx sync.Mutex
+}
+
+// NewStreamTransport returns Transport which reads messages from r and writes them to w
+// (one message per line)
+// it used to communicate with plugin process over its stdin/stdout
+func NewStreamTransport(r io.Reader, w io.Writer) Transport {
+	return &streamTransport{r: bufio.NewReader(r), w: w}
+}
+
+func (t *streamTransport) NextReader() (io.Reader, error) {
+	for {
+		line, err := t.r.ReadBytes('\n')
+
+		line = bytes.TrimSpace(line)
+		if len(line) != 0 {
+			return bytes.NewReader(line), nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (t *streamTransport) NextWriter() (io.WriteCloser, error) {
+	return &lineWriter{t: t}, nil
+}
+
+// lineWriter buffers message and writes it with new line on Close
+type lineWriter struct {
+	bytes.Buffer
+	t *streamTransport
+}
+
+func (w *lineWriter) Close() error {
+	w.WriteByte('\n')
+
+	w.t.mx.Lock()
+	defer w.t.mx.Unlock()
+
+	_, err := w.t.w.Write(w.Bytes())
+
+	return err
+}
+
+// ServeStdio serves requests received from stdin and writes responses to stdout
+// it's entrypoint of plugin process (see common.Plugin of connectors)
+// so plugin should write logs to stderr only
+func ServeStdio(ctx context.Context, caller Caller, o ...Option) error {
+	srv := New(NewStreamTransport(os.Stdin, os.Stdout), caller, o...)
+
+	if v, ok := caller.(interface {
+		InjectRPC(RPC)
+	}); ok {
+		v.InjectRPC(srv)
+	}
+
+	return srv.Serve(ctx)
+}
@@ -140,6 +140,29 @@ func toVal(value interface{}) lua.LValue {
 		return lua.LString(val)
 	}
 
+	switch val := value.(type) {
+	case map[string]interface{}:
+		tb := &lua.LTable{Metatable: lua.LNil}
+
+		for k, v := range val {
+			if lv := toVal(v); lv != nil {
+				tb.RawSetString(k, lv)
+			}
+		}
+
+		return tb
+	case []interface{}:
+		tb := &lua.LTable{Metatable: lua.LNil}
+
+		for _, v := range val {
+			if lv := toVal(v); lv != nil {
+				tb.Append(lv)
+			}
+		}
+
+		return tb
+	}
+
 	switch val := reflect.ValueOf(value); val.Kind() {
 	case reflect.String:
 		return lua.LString(val.String())
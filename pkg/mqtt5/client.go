@@ -0,0 +1,1081 @@
+/**
+ * Copyright 2021 Rightech IoT. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package mqtt5 implements MQTT v5 client with paho.Client interface
+//
+// Only what core needs is supported: QoS 0 and 1 (QoS 2 is sent as QoS 1),
+// publish properties (response topic, correlation data, user properties, message expiry),
+// reconnect to servers list. Not acknowledged QoS 1 messages are kept in paho Store
+// (in memory if it's not set) and sent no faster than server Receive Maximum allows.
+package mqtt5
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/eclipse/paho.mqtt.golang/packets"
+	"github.com/gorilla/websocket"
+
+	"github.com/Rightech/ric-edge/pkg/backoff"
+)
+
+const (
+	disconnected = iota
+	connecting
+	connected
+	reconnecting
+)
+
+var (
+	errPingTimeout = errors.New("mqtt5: ping timeout")
+	errNoServers   = errors.New("mqtt5: no servers defined to connect to")
+	errNoIDs       = errors.New("mqtt5: no free message ids (too many messages not acknowledged)")
+	errLost        = errors.New("mqtt5: message lost from store")
+)
+
+// outboundPrefix is paho store prefix of outgoing messages keys
+// (the same keys are used, so store can count not acknowledged messages)
+const outboundPrefix = "o."
+
+func outboundKey(id uint16) string {
+	return outboundPrefix + strconv.Itoa(int(id))
+}
+
+// ReasonError is error reason code returned by server
+type ReasonError struct {
+	Code   byte
+	Reason string
+}
+
+func (e ReasonError) Error() string {
+	if e.Reason != "" {
+		return fmt.Sprintf("mqtt5: reason code 0x%02x: %s", e.Code, e.Reason)
+	}
+
+	return fmt.Sprintf("mqtt5: reason code 0x%02x", e.Code)
+}
+
+type conn interface {
+	io.ReadWriteCloser
+	SetReadDeadline(time.Time) error
+	SetWriteDeadline(time.Time) error
+}
+
+type pending struct {
+	token *token
+	// publish is true for QoS 1 message (it's kept in store until acknowledged)
+	publish bool
+	// dup is true if message could be received by server already
+	dup bool
+}
+
+// Client is MQTT v5 client
+type Client struct {
+	o paho.ClientOptions
+
+	mx       sync.Mutex
+	status   int
+	conn     conn
+	stop     chan struct{}
+	lastSent time.Time
+	lastRecv time.Time
+	pingAt   time.Time
+	keep     time.Duration
+	id       uint16
+	pending  map[uint16]pending
+	// messages sent and not acknowledged yet (in send order)
+	sent []uint16
+	// messages waiting to be sent (server receive maximum is reached or client is offline)
+	queue []uint16
+	// server receive maximum
+	receiveMax int
+	routes     map[string]paho.MessageHandler
+}
+
+// NewClient returns client configured by paho options
+// (CredentialsProvider is ignored, memory store is used if Store isn't set)
+func NewClient(o *paho.ClientOptions) *Client {
+	c := &Client{
+		o:       *o,
+		pending: make(map[uint16]pending),
+		routes:  make(map[string]paho.MessageHandler),
+	}
+
+	if c.o.Store == nil {
+		c.o.Store = paho.NewMemoryStore()
+	}
+
+	return c
+}
+
+func (c *Client) IsConnected() bool {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	return c.status == connected || (c.status == reconnecting && c.o.AutoReconnect)
+}
+
+func (c *Client) IsConnectionOpen() bool {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	return c.status == connected
+}
+
+func (c *Client) OptionsReader() paho.ClientOptionsReader {
+	return paho.ClientOptionsReader{}
+}
+
+// Connect tries servers in order
+func (c *Client) Connect() paho.Token {
+	t := newToken()
+
+	c.mx.Lock()
+	c.status = connecting
+	c.restore()
+	c.mx.Unlock()
+
+	go func() {
+		err := c.attempt()
+		if err != nil {
+			c.mx.Lock()
+			c.status = disconnected
+			c.mx.Unlock()
+		}
+
+		t.complete(err)
+	}()
+
+	return t
+}
+
+// restore opens store and queues messages left from previous session (c.mx should be locked)
+func (c *Client) restore() {
+	c.o.Store.Open()
+
+	if c.o.CleanSession {
+		c.o.Store.Reset()
+		return
+	}
+
+	ids := make([]int, 0)
+
+	for _, key := range c.o.Store.All() {
+		if !strings.HasPrefix(key, outboundPrefix) {
+			continue
+		}
+
+		id, err := strconv.ParseUint(strings.TrimPrefix(key, outboundPrefix), 10, 16)
+		if err != nil || id == 0 {
+			continue
+		}
+
+		if _, ok := c.pending[uint16(id)]; !ok {
+			ids = append(ids, int(id))
+		}
+	}
+
+	sort.Ints(ids)
+
+	for _, id := range ids {
+		c.pending[uint16(id)] = pending{token: newToken(), publish: true, dup: true}
+		c.queue = append(c.queue, uint16(id))
+		c.id = uint16(id)
+	}
+}
+
+// attempt connects to first available server
+func (c *Client) attempt() error {
+	if len(c.o.Servers) == 0 {
+		return errNoServers
+	}
+
+	var err error
+
+	for _, u := range c.o.Servers {
+		var (
+			cn conn
+			p  props
+		)
+
+		cn, p, err = c.dial(u)
+		if err == nil {
+			c.connected(cn, p)
+			return nil
+		}
+	}
+
+	return err
+}
+
+func (c *Client) dial(u *url.URL) (conn, props, error) {
+	cn, err := open(u, c.o.TLSConfig, c.o.ConnectTimeout, c.o)
+	if err != nil {
+		return nil, props{}, err
+	}
+
+	_ = cn.SetWriteDeadline(time.Now().Add(c.o.ConnectTimeout))
+	_ = cn.SetReadDeadline(time.Now().Add(c.o.ConnectTimeout))
+
+	_, err = cn.Write(c.connectPacket())
+	if err == nil {
+		var p props
+
+		p, err = readConnack(cn)
+		if err == nil {
+			_ = cn.SetReadDeadline(time.Time{})
+			_ = cn.SetWriteDeadline(time.Time{})
+
+			return cn, p, nil
+		}
+	}
+
+	cn.Close()
+
+	return nil, props{}, err
+}
+
+func open(u *url.URL, cfg *tls.Config, timeout time.Duration, o paho.ClientOptions) (conn, error) {
+	switch u.Scheme {
+	case "ws", "wss":
+		d := websocket.Dialer{
+			TLSClientConfig:  cfg,
+			HandshakeTimeout: timeout,
+			Subprotocols:     []string{"mqtt"},
+		}
+
+		ws, _, err := d.Dial(u.String(), o.HTTPHeaders)
+		if err != nil {
+			return nil, err
+		}
+
+		return &wsConn{Conn: ws}, nil
+	case "tls", "ssl", "tcps":
+		return tls.DialWithDialer(&net.Dialer{Timeout: timeout}, "tcp", u.Host, cfg)
+	default:
+		return net.DialTimeout("tcp", u.Host, timeout)
+	}
+}
+
+func (c *Client) connectPacket() []byte {
+	var w writer
+
+	w.str("MQTT")
+	w.WriteByte(5)
+
+	var flags byte
+
+	if c.o.CleanSession {
+		flags |= 0x02
+	}
+
+	if c.o.WillEnabled {
+		flags |= 0x04 | c.o.WillQos<<3
+		if c.o.WillRetained {
+			flags |= 0x20
+		}
+	}
+
+	if c.o.Username != "" {
+		flags |= 0x80
+	}
+
+	if c.o.Password != "" {
+		flags |= 0x40
+	}
+
+	w.WriteByte(flags)
+	w.u16(uint16(c.o.KeepAlive))
+
+	// session is kept forever like in v3.1.1 (if it's not clean)
+	var p writer
+	if !c.o.CleanSession {
+		p.WriteByte(propSessionExpiry)
+		p.u32(0xFFFFFFFF)
+	}
+
+	w.props(p.Bytes())
+
+	w.str(c.o.ClientID)
+
+	if c.o.WillEnabled {
+		w.props(nil)
+		w.str(c.o.WillTopic)
+		w.bin(c.o.WillPayload)
+	}
+
+	if c.o.Username != "" {
+		w.str(c.o.Username)
+	}
+
+	if c.o.Password != "" {
+		w.bin([]byte(c.o.Password))
+	}
+
+	return packet(typeConnect, 0, w.Bytes())
+}
+
+func readConnack(rd io.Reader) (props, error) {
+	typ, _, body, err := readPacket(rd)
+	if err != nil {
+		return props{}, err
+	}
+
+	if typ != typeConnack {
+		return props{}, errMalformed
+	}
+
+	r := reader{b: body}
+	r.u8() // session present
+	code := r.u8()
+	p := r.props()
+
+	if r.err != nil {
+		return props{}, r.err
+	}
+
+	if code >= 0x80 {
+		return props{}, ReasonError{code, p.reason}
+	}
+
+	return p, nil
+}
+
+// connected starts connection processing
+func (c *Client) connected(cn conn, p props) {
+	c.mx.Lock()
+
+	c.conn = cn
+	c.status = connected
+	c.stop = make(chan struct{})
+	c.lastSent = time.Now()
+	c.lastRecv = time.Now()
+	c.pingAt = time.Time{}
+
+	c.keep = time.Duration(c.o.KeepAlive) * time.Second
+	if p.hasKeepAlive {
+		c.keep = time.Duration(p.serverKeepAlive) * time.Second
+	}
+
+	c.receiveMax = 0xFFFF
+	if p.receiveMax > 0 {
+		c.receiveMax = int(p.receiveMax)
+	}
+
+	stop := c.stop
+
+	// not acknowledged messages are resent first
+	for _, id := range c.sent {
+		pd := c.pending[id]
+		pd.dup = true
+		c.pending[id] = pd
+	}
+
+	c.queue = append(c.sent, c.queue...)
+	c.sent = nil
+
+	c.flush()
+
+	c.mx.Unlock()
+
+	go c.read(cn)
+	go c.keepalive(cn, stop)
+
+	if c.o.OnConnect != nil {
+		go c.o.OnConnect(c)
+	}
+}
+
+// write sends packet (c.mx should be locked)
+func (c *Client) write(p []byte) error {
+	if c.conn == nil {
+		return paho.ErrNotConnected
+	}
+
+	timeout := c.o.WriteTimeout
+	if timeout == 0 {
+		timeout = time.Minute
+	}
+
+	_ = c.conn.SetWriteDeadline(time.Now().Add(timeout))
+
+	_, err := c.conn.Write(p)
+	if err == nil {
+		c.lastSent = time.Now()
+	}
+
+	return err
+}
+
+// flush sends queued messages while server receive maximum allows (c.mx should be locked)
+func (c *Client) flush() {
+	for c.status == connected && len(c.sent) < c.receiveMax && len(c.queue) > 0 {
+		id := c.queue[0]
+		c.queue = c.queue[1:]
+
+		pkt := c.load(id, c.pending[id].dup)
+		if pkt == nil {
+			c.pending[id].token.complete(errLost)
+			delete(c.pending, id)
+			c.o.Store.Del(outboundKey(id))
+
+			continue
+		}
+
+		// message is resent after reconnect if write failed
+		c.sent = append(c.sent, id)
+
+		if c.write(pkt) != nil {
+			return
+		}
+	}
+}
+
+// load returns stored message as MQTT v5 publish packet (c.mx should be locked)
+func (c *Client) load(id uint16, dup bool) []byte {
+	sp, ok := c.o.Store.Get(outboundKey(id)).(*packets.PublishPacket)
+	if !ok {
+		return nil
+	}
+
+	// stored payload is properties followed by message payload
+	r := reader{b: sp.Payload}
+	if r.props(); r.err != nil {
+		return nil
+	}
+
+	var w writer
+
+	w.str(sp.TopicName)
+	w.u16(id)
+	w.Write(sp.Payload)
+
+	var flags byte = 1 << 1
+	if sp.Retain {
+		flags |= 1
+	}
+
+	if dup {
+		flags |= 0x08
+	}
+
+	return packet(typePublish, flags, w.Bytes())
+}
+
+// acked removes acknowledged message from store and sends next queued one (c.mx should be locked)
+func (c *Client) acked(id uint16) {
+	c.o.Store.Del(outboundKey(id))
+
+	for i, sid := range c.sent {
+		if sid == id {
+			c.sent = append(c.sent[:i], c.sent[i+1:]...)
+			break
+		}
+	}
+
+	c.flush()
+}
+
+func (c *Client) send(p []byte) error {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	return c.write(p)
+}
+
+func (c *Client) keepalive(cn conn, stop chan struct{}) {
+	tick := time.NewTicker(time.Second)
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-tick.C:
+		}
+
+		c.mx.Lock()
+
+		var err error
+
+		switch {
+		case c.keep == 0:
+		case !c.pingAt.IsZero() && c.lastRecv.Before(c.pingAt) && time.Since(c.pingAt) > c.o.PingTimeout:
+			err = errPingTimeout
+		case time.Since(c.lastSent) >= c.keep:
+			c.pingAt = time.Now()
+			err = c.write(packet(typePingreq, 0, nil))
+		}
+
+		c.mx.Unlock()
+
+		if err != nil {
+			c.lost(cn, err)
+			return
+		}
+	}
+}
+
+func (c *Client) read(cn conn) {
+	for {
+		typ, flags, body, err := readPacket(cn)
+		if err == nil {
+			c.mx.Lock()
+			c.lastRecv = time.Now()
+			c.mx.Unlock()
+
+			err = c.handle(typ, flags, body)
+		}
+
+		if err != nil {
+			c.lost(cn, err)
+			return
+		}
+	}
+}
+
+func (c *Client) handle(typ, flags byte, body []byte) error {
+	r := reader{b: body}
+
+	switch typ {
+	case typePublish:
+		return c.received(flags, r)
+	case typePuback, typeSuback, typeUnsuback:
+		id := r.u16()
+
+		var err error
+
+		// puback without reason code is success
+		if typ == typePuback && len(r.b) > 0 {
+			code := r.u8()
+			p := r.props()
+
+			if code >= 0x80 {
+				err = ReasonError{code, p.reason}
+			}
+		}
+
+		if typ != typePuback {
+			p := r.props()
+
+			for _, code := range r.b {
+				if code >= 0x80 {
+					err = ReasonError{code, p.reason}
+				}
+			}
+		}
+
+		if r.err != nil {
+			return r.err
+		}
+
+		c.mx.Lock()
+		pd, ok := c.pending[id]
+		delete(c.pending, id)
+
+		if ok && pd.publish {
+			c.acked(id)
+		}
+
+		c.mx.Unlock()
+
+		if ok {
+			pd.token.complete(err)
+		}
+	case typeDisconnect:
+		var code byte
+		if len(r.b) > 0 {
+			code = r.u8()
+		}
+
+		return ReasonError{code, r.props().reason}
+	}
+
+	return nil
+}
+
+func (c *Client) received(flags byte, r reader) error {
+	qos := flags >> 1 & 3
+	msg := &Message{
+		topic:    r.str(),
+		qos:      qos,
+		retained: flags&1 != 0,
+		dup:      flags&8 != 0,
+		received: time.Now(),
+	}
+
+	if qos > 0 {
+		msg.id = r.u16()
+	}
+
+	msg.props = r.props().Properties
+	msg.payload = r.b
+
+	if r.err != nil {
+		return r.err
+	}
+
+	c.mx.Lock()
+
+	handlers := make([]paho.MessageHandler, 0, 1)
+
+	for filter, h := range c.routes {
+		if match(filter, msg.topic) {
+			handlers = append(handlers, h)
+		}
+	}
+
+	c.mx.Unlock()
+
+	if len(handlers) == 0 && c.o.DefaultPublishHandler != nil {
+		handlers = append(handlers, c.o.DefaultPublishHandler)
+	}
+
+	if qos > 0 {
+		var w writer
+
+		w.u16(msg.id)
+
+		if err := c.send(packet(typePuback, 0, w.Bytes())); err != nil {
+			return err
+		}
+	}
+
+	for _, h := range handlers {
+		if c.o.Order {
+			h(c, msg)
+		} else {
+			go h(c, msg)
+		}
+	}
+
+	return nil
+}
+
+// lost closes connection and starts reconnect
+func (c *Client) lost(cn conn, err error) {
+	c.mx.Lock()
+
+	if c.conn != cn {
+		c.mx.Unlock()
+		return
+	}
+
+	c.close()
+
+	c.status = disconnected
+	if c.o.AutoReconnect {
+		c.status = reconnecting
+	}
+
+	c.mx.Unlock()
+
+	if c.o.OnConnectionLost != nil {
+		go c.o.OnConnectionLost(c, err)
+	}
+
+	if c.o.AutoReconnect {
+		go c.reconnect()
+	}
+}
+
+// close closes connection, subscriptions which wait acknowledge fail (c.mx should be locked)
+func (c *Client) close() {
+	c.conn.Close()
+	c.conn = nil
+	close(c.stop)
+
+	for id, pd := range c.pending {
+		if !pd.publish {
+			pd.token.complete(paho.ErrNotConnected)
+			delete(c.pending, id)
+		}
+	}
+}
+
+func (c *Client) reconnect() {
+	b := backoff.New(time.Second, c.o.MaxReconnectInterval)
+
+	for {
+		c.mx.Lock()
+		st := c.status
+		c.mx.Unlock()
+
+		if st != reconnecting {
+			return
+		}
+
+		if c.attempt() == nil {
+			return
+		}
+
+		time.Sleep(b.Next())
+	}
+}
+
+// Disconnect sends DISCONNECT and closes connection, waiting messages fail
+// (they are kept in store and sent after next connect)
+func (c *Client) Disconnect(quiesce uint) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	if c.status == disconnected {
+		return
+	}
+
+	c.status = disconnected
+
+	if c.conn != nil {
+		_ = c.write(packet(typeDisconnect, 0, nil))
+
+		c.close()
+	}
+
+	for id, pd := range c.pending {
+		pd.token.complete(paho.ErrNotConnected)
+		delete(c.pending, id)
+	}
+
+	c.sent, c.queue = nil, nil
+
+	c.o.Store.Close()
+}
+
+// nextID returns free packet id (c.mx should be locked)
+func (c *Client) nextID() (uint16, bool) {
+	for i := 0; i <= 0xFFFF; i++ {
+		c.id++
+		if _, ok := c.pending[c.id]; !ok && c.id != 0 {
+			return c.id, true
+		}
+	}
+
+	return 0, false
+}
+
+func (c *Client) Publish(topic string, qos byte, retained bool, payload interface{}) paho.Token {
+	return c.PublishWithProperties(topic, qos, retained, payload, Properties{})
+}
+
+// PublishWithProperties publishes message with MQTT v5 properties
+func (c *Client) PublishWithProperties(topic string, qos byte, retained bool,
+	payload interface{}, p Properties) paho.Token {
+	t := newToken()
+
+	var data []byte
+
+	switch v := payload.(type) {
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		t.complete(errors.New("mqtt5: unknown payload type"))
+		return t
+	}
+
+	if qos > 1 {
+		qos = 1
+	}
+
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	if c.status == disconnected || c.status == connecting {
+		t.complete(paho.ErrNotConnected)
+		return t
+	}
+
+	var body writer
+
+	body.props(p.encode())
+	body.Write(data)
+
+	if qos == 0 {
+		// QoS 0 message isn't sent while reconnecting
+		if c.status != connected {
+			t.complete(nil)
+			return t
+		}
+
+		var w writer
+
+		w.str(topic)
+		w.Write(body.Bytes())
+
+		var flags byte
+		if retained {
+			flags |= 1
+		}
+
+		t.complete(c.write(packet(typePublish, flags, w.Bytes())))
+
+		return t
+	}
+
+	id, ok := c.nextID()
+	if !ok {
+		t.complete(errNoIDs)
+		return t
+	}
+
+	sp := packets.NewControlPacket(packets.Publish).(*packets.PublishPacket)
+	sp.TopicName = topic
+	sp.MessageID = id
+	sp.Qos = qos
+	sp.Retain = retained
+	sp.Payload = body.Bytes()
+
+	c.o.Store.Put(outboundKey(id), sp)
+
+	c.pending[id] = pending{token: t, publish: true}
+	c.queue = append(c.queue, id)
+
+	c.flush()
+
+	return t
+}
+
+func (c *Client) Subscribe(topic string, qos byte, callback paho.MessageHandler) paho.Token {
+	return c.SubscribeMultiple(map[string]byte{topic: qos}, callback)
+}
+
+func (c *Client) SubscribeMultiple(filters map[string]byte, callback paho.MessageHandler) paho.Token {
+	var w writer
+
+	return c.request(typeSubscribe, func(id uint16) {
+		w.u16(id)
+		w.props(nil)
+
+		for f, qos := range filters {
+			if callback != nil {
+				c.routes[route(f)] = callback
+			}
+
+			w.str(f)
+			w.WriteByte(qos)
+		}
+	}, &w)
+}
+
+func (c *Client) Unsubscribe(topics ...string) paho.Token {
+	var w writer
+
+	return c.request(typeUnsubscribe, func(id uint16) {
+		w.u16(id)
+		w.props(nil)
+
+		for _, f := range topics {
+			delete(c.routes, route(f))
+			w.str(f)
+		}
+	}, &w)
+}
+
+// request sends packet which waits acknowledge
+func (c *Client) request(typ byte, build func(id uint16), w *writer) paho.Token {
+	t := newToken()
+
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	if c.status != connected {
+		t.complete(paho.ErrNotConnected)
+		return t
+	}
+
+	id, ok := c.nextID()
+	if !ok {
+		t.complete(errNoIDs)
+		return t
+	}
+
+	build(id)
+
+	c.pending[id] = pending{token: t}
+
+	err := c.write(packet(typ, 0x02, w.Bytes()))
+	if err != nil {
+		delete(c.pending, id)
+		t.complete(err)
+	}
+
+	return t
+}
+
+func (c *Client) AddRoute(topic string, callback paho.MessageHandler) {
+	c.mx.Lock()
+	c.routes[route(topic)] = callback
+	c.mx.Unlock()
+}
+
+// route returns filter of shared subscription without $share/<group> prefix
+func route(filter string) string {
+	if strings.HasPrefix(filter, "$share/") {
+		if parts := strings.SplitN(filter, "/", 3); len(parts) == 3 {
+			return parts[2]
+		}
+	}
+
+	return filter
+}
+
+// match checks topic matches filter with + and # wildcards
+func match(filter, topic string) bool {
+	f := strings.Split(filter, "/")
+	t := strings.Split(topic, "/")
+
+	// wildcards don't match topics started with $
+	if strings.HasPrefix(topic, "$") && (f[0] == "+" || f[0] == "#") {
+		return false
+	}
+
+	for i, level := range f {
+		if level == "#" {
+			return true
+		}
+
+		if i >= len(t) || (level != "+" && level != t[i]) {
+			return false
+		}
+	}
+
+	return len(f) == len(t)
+}
+
+type token struct {
+	once sync.Once
+	done chan struct{}
+	err  error
+}
+
+func newToken() *token {
+	return &token{done: make(chan struct{})}
+}
+
+func (t *token) complete(err error) {
+	t.once.Do(func() {
+		t.err = err
+		close(t.done)
+	})
+}
+
+func (t *token) Wait() bool {
+	<-t.done
+	return true
+}
+
+func (t *token) WaitTimeout(d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-t.done:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+func (t *token) Error() error {
+	select {
+	case <-t.done:
+		return t.err
+	default:
+		return nil
+	}
+}
+
+// Message is received message, it implements paho.Message
+type Message struct {
+	topic    string
+	payload  []byte
+	qos      byte
+	retained bool
+	dup      bool
+	id       uint16
+	props    Properties
+	received time.Time
+}
+
+func (m *Message) Duplicate() bool        { return m.dup }
+func (m *Message) Qos() byte              { return m.qos }
+func (m *Message) Retained() bool         { return m.retained }
+func (m *Message) Topic() string          { return m.topic }
+func (m *Message) MessageID() uint16      { return m.id }
+func (m *Message) Payload() []byte        { return m.payload }
+func (m *Message) Ack()                   {}
+func (m *Message) Properties() Properties { return m.props }
+
+// Expires returns time when message expires (zero if it doesn't)
+func (m *Message) Expires() time.Time {
+	if m.props.MessageExpiry == 0 {
+		return time.Time{}
+	}
+
+	return m.received.Add(time.Duration(m.props.MessageExpiry) * time.Second)
+}
+
+// wsConn is websocket connection with binary messages stream
+type wsConn struct {
+	*websocket.Conn
+	r io.Reader
+}
+
+func (c *wsConn) Read(p []byte) (int, error) {
+	for {
+		if c.r == nil {
+			_, r, err := c.NextReader()
+			if err != nil {
+				return 0, err
+			}
+
+			c.r = r
+		}
+
+		n, err := c.r.Read(p)
+		if err == io.EOF {
+			c.r = nil
+
+			if n > 0 {
+				return n, nil
+			}
+
+			continue
+		}
+
+		return n, err
+	}
+}
+
+func (c *wsConn) Write(p []byte) (int, error) {
+	err := c.WriteMessage(websocket.BinaryMessage, p)
+	if err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
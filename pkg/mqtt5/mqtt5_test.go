@@ -0,0 +1,288 @@
+/**
+ * Copyright 2021 Rightech IoT. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mqtt5
+
+import (
+	"bytes"
+	"net"
+	"runtime"
+	"testing"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+)
+
+func TestMatch(t *testing.T) {
+	cases := []struct {
+		filter, topic string
+		ok            bool
+	}{
+		{"a/b", "a/b", true},
+		{"a/+", "a/b", true},
+		{"a/+", "a/b/c", false},
+		{"a/#", "a", true},
+		{"#", "$SYS/a", false},
+		{"a/+/c", "a/b/d", false},
+	}
+
+	for _, c := range cases {
+		if match(c.filter, c.topic) != c.ok {
+			t.Errorf("match(%s, %s) should be %v", c.filter, c.topic, c.ok)
+		}
+	}
+}
+
+// broker is fake server side of one connection
+// (it runs in own goroutine so it stops by Goexit on error)
+type broker struct {
+	t *testing.T
+	c net.Conn
+}
+
+func (b broker) expect(typ byte) reader {
+	b.t.Helper()
+
+	got, _, body, err := readPacket(b.c)
+	if err != nil {
+		b.t.Error(err)
+		runtime.Goexit()
+	}
+
+	if got != typ {
+		b.t.Errorf("want packet %d got %d", typ, got)
+		runtime.Goexit()
+	}
+
+	return reader{b: body}
+}
+
+func (b broker) send(typ, flags byte, w writer) {
+	if _, err := b.c.Write(packet(typ, flags, w.Bytes())); err != nil {
+		b.t.Error(err)
+		runtime.Goexit()
+	}
+}
+
+func TestRequestResponse(t *testing.T) { // nolint: funlen
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	errCh := make(chan error, 1)
+
+	go func() {
+		c, err := ln.Accept()
+		if err != nil {
+			errCh <- err
+			return
+		}
+		defer c.Close()
+
+		b := broker{t, c}
+
+		r := b.expect(typeConnect)
+		if r.str() != "MQTT" || r.u8() != 5 {
+			t.Error("wrong protocol")
+		}
+
+		var w writer
+		w.Write([]byte{0, 0})
+		w.props(nil)
+		b.send(typeConnack, 0, w)
+
+		r = b.expect(typeSubscribe)
+		id := r.u16()
+
+		w = writer{}
+		w.u16(id)
+		w.props(nil)
+		w.WriteByte(1)
+		b.send(typeSuback, 0, w)
+
+		w = writer{}
+		w.str("cmd/modbus")
+		w.u16(7)
+		w.props(Properties{
+			MessageExpiry: 10, ResponseTopic: "resp/1", CorrelationData: []byte{1, 2},
+			User: []UserProperty{{"trace", "abc"}},
+		}.encode())
+		w.WriteString("request")
+		b.send(typePublish, 1<<1, w)
+
+		if r = b.expect(typePuback); r.u16() != 7 {
+			t.Error("wrong puback id")
+		}
+
+		r = b.expect(typePublish)
+		topic := r.str()
+		id = r.u16()
+		p := r.props()
+
+		if topic != "resp/1" || !bytes.Equal(p.CorrelationData, []byte{1, 2}) ||
+			len(p.User) != 1 || string(r.b) != "response" {
+			t.Errorf("wrong response %s %+v %s", topic, p, r.b)
+		}
+
+		w = writer{}
+		w.u16(id)
+		b.send(typePuback, 0, w)
+
+		errCh <- nil
+	}()
+
+	opts := paho.NewClientOptions().AddBroker("tcp://" + ln.Addr().String()).SetClientID("edge")
+	cli := NewClient(opts)
+
+	if token := cli.Connect(); token.Wait() && token.Error() != nil {
+		t.Fatal(token.Error())
+	}
+
+	done := make(chan paho.Token, 1)
+
+	token := cli.Subscribe("cmd/+", 1, func(c paho.Client, msg paho.Message) {
+		m := msg.(*Message)
+
+		if m.Expires().IsZero() || m.Properties().ResponseTopic != "resp/1" {
+			t.Errorf("wrong properties %+v", m.Properties())
+		}
+
+		done <- cli.PublishWithProperties(m.Properties().ResponseTopic, 1, false, "response", Properties{
+			CorrelationData: m.Properties().CorrelationData,
+			User:            m.Properties().User,
+		})
+	})
+	if token.Wait() && token.Error() != nil {
+		t.Fatal(token.Error())
+	}
+
+	select {
+	case token = <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("message not received")
+	}
+
+	if !token.WaitTimeout(5*time.Second) || token.Error() != nil {
+		t.Fatal("response not acknowledged", token.Error())
+	}
+
+	select {
+	case err := <-errCh:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("broker not finished")
+	}
+
+	cli.Disconnect(0)
+}
+
+func TestReceiveMaximum(t *testing.T) { // nolint: funlen
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	store := paho.NewMemoryStore()
+	errCh := make(chan error, 1)
+
+	go func() {
+		c, err := ln.Accept()
+		if err != nil {
+			errCh <- err
+			return
+		}
+		defer c.Close()
+
+		b := broker{t, c}
+
+		b.expect(typeConnect)
+
+		var p writer
+		p.WriteByte(propReceiveMaximum)
+		p.u16(1)
+
+		var w writer
+		w.Write([]byte{0, 0})
+		w.props(p.Bytes())
+		b.send(typeConnack, 0, w)
+
+		for i, payload := range []string{"a", "b"} {
+			r := b.expect(typePublish)
+			r.str()
+			id := r.u16()
+			r.props()
+
+			if string(r.b) != payload {
+				t.Errorf("want payload %s got %s", payload, r.b)
+			}
+
+			// second message waits acknowledge of first one
+			c.SetReadDeadline(time.Now().Add(100 * time.Millisecond)) // nolint: errcheck
+
+			if _, _, _, err := readPacket(c); err == nil {
+				t.Error("receive maximum exceeded")
+			}
+
+			c.SetReadDeadline(time.Time{}) // nolint: errcheck
+
+			if len(store.All()) != 2-i {
+				t.Errorf("wrong stored messages %v", store.All())
+			}
+
+			w = writer{}
+			w.u16(id)
+			b.send(typePuback, 0, w)
+		}
+
+		errCh <- nil
+	}()
+
+	opts := paho.NewClientOptions().AddBroker("tcp://" + ln.Addr().String()).
+		SetClientID("edge").SetStore(store)
+	cli := NewClient(opts)
+
+	if token := cli.Connect(); token.Wait() && token.Error() != nil {
+		t.Fatal(token.Error())
+	}
+
+	tokens := []paho.Token{cli.Publish("a", 1, false, "a"), cli.Publish("b", 1, false, "b")}
+
+	for _, token := range tokens {
+		if !token.WaitTimeout(5*time.Second) || token.Error() != nil {
+			t.Fatal("message not acknowledged", token.Error())
+		}
+	}
+
+	select {
+	case err := <-errCh:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("broker not finished")
+	}
+
+	if keys := store.All(); len(keys) != 0 {
+		t.Errorf("acknowledged messages should be removed from store %v", keys)
+	}
+
+	cli.Disconnect(0)
+}
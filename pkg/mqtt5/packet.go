@@ -0,0 +1,335 @@
+/**
+ * Copyright 2021 Rightech IoT. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mqtt5
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// packet types
+const (
+	typeConnect     = 1
+	typeConnack     = 2
+	typePublish     = 3
+	typePuback      = 4
+	typeSubscribe   = 8
+	typeSuback      = 9
+	typeUnsubscribe = 10
+	typeUnsuback    = 11
+	typePingreq     = 12
+	typePingresp    = 13
+	typeDisconnect  = 14
+)
+
+// property identifiers
+const (
+	propPayloadFormat   = 0x01
+	propMessageExpiry   = 0x02
+	propContentType     = 0x03
+	propResponseTopic   = 0x08
+	propCorrelationData = 0x09
+	propSessionExpiry   = 0x11
+	propServerKeepAlive = 0x13
+	propReceiveMaximum  = 0x21
+	propReasonString    = 0x1F
+	propUser            = 0x26
+)
+
+// maxPacketSize limits incoming packets
+const maxPacketSize = 16 << 20
+
+var errMalformed = errors.New("mqtt5: malformed packet")
+
+// UserProperty is name-value pair of user property
+type UserProperty struct {
+	Key   string
+	Value string
+}
+
+// Properties of PUBLISH packet
+type Properties struct {
+	// MessageExpiry in seconds (0 means message doesn't expire)
+	MessageExpiry   uint32
+	ContentType     string
+	ResponseTopic   string
+	CorrelationData []byte
+	User            []UserProperty
+}
+
+// props are all properties client understands
+type props struct {
+	Properties
+	sessionExpiry   uint32
+	serverKeepAlive uint16
+	hasKeepAlive    bool
+	receiveMax      uint16
+	reason          string
+}
+
+type writer struct {
+	bytes.Buffer
+}
+
+func (w *writer) u16(v uint16) {
+	var b [2]byte
+
+	binary.BigEndian.PutUint16(b[:], v)
+	w.Write(b[:])
+}
+
+func (w *writer) u32(v uint32) {
+	var b [4]byte
+
+	binary.BigEndian.PutUint32(b[:], v)
+	w.Write(b[:])
+}
+
+func (w *writer) varint(v int) {
+	for {
+		b := byte(v % 128)
+		v /= 128
+
+		if v > 0 {
+			b |= 0x80
+		}
+
+		w.WriteByte(b)
+
+		if v == 0 {
+			return
+		}
+	}
+}
+
+func (w *writer) str(s string) {
+	w.u16(uint16(len(s)))
+	w.WriteString(s)
+}
+
+func (w *writer) bin(b []byte) {
+	w.u16(uint16(len(b)))
+	w.Write(b)
+}
+
+// props writes properties block
+func (w *writer) props(p []byte) {
+	w.varint(len(p))
+	w.Write(p)
+}
+
+func (p Properties) encode() []byte {
+	var w writer
+
+	if p.MessageExpiry > 0 {
+		w.WriteByte(propMessageExpiry)
+		w.u32(p.MessageExpiry)
+	}
+
+	if p.ContentType != "" {
+		w.WriteByte(propContentType)
+		w.str(p.ContentType)
+	}
+
+	if p.ResponseTopic != "" {
+		w.WriteByte(propResponseTopic)
+		w.str(p.ResponseTopic)
+	}
+
+	if p.CorrelationData != nil {
+		w.WriteByte(propCorrelationData)
+		w.bin(p.CorrelationData)
+	}
+
+	for _, u := range p.User {
+		w.WriteByte(propUser)
+		w.str(u.Key)
+		w.str(u.Value)
+	}
+
+	return w.Bytes()
+}
+
+// packet builds packet with fixed header
+func packet(typ, flags byte, body []byte) []byte {
+	var w writer
+
+	w.WriteByte(typ<<4 | flags)
+	w.varint(len(body))
+	w.Write(body)
+
+	return w.Bytes()
+}
+
+type reader struct {
+	b   []byte
+	err error
+}
+
+func (r *reader) take(n int) []byte {
+	if r.err != nil || n > len(r.b) {
+		r.err = errMalformed
+		return nil
+	}
+
+	v := r.b[:n]
+	r.b = r.b[n:]
+
+	return v
+}
+
+func (r *reader) u8() byte {
+	if b := r.take(1); b != nil {
+		return b[0]
+	}
+
+	return 0
+}
+
+func (r *reader) u16() uint16 {
+	if b := r.take(2); b != nil {
+		return binary.BigEndian.Uint16(b)
+	}
+
+	return 0
+}
+
+func (r *reader) u32() uint32 {
+	if b := r.take(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+
+	return 0
+}
+
+func (r *reader) varint() int {
+	var v, mul int
+
+	for i := 0; i < 4; i++ {
+		b := r.u8()
+		v += int(b&0x7F) << mul
+		mul += 7
+
+		if b&0x80 == 0 {
+			return v
+		}
+	}
+
+	r.err = errMalformed
+
+	return 0
+}
+
+func (r *reader) bin() []byte {
+	return r.take(int(r.u16()))
+}
+
+func (r *reader) str() string {
+	return string(r.bin())
+}
+
+// props reads properties block (unknown properties are skipped)
+func (r *reader) props() props { // nolint: gocyclo
+	var p props
+
+	pr := reader{b: r.take(r.varint())}
+
+	for pr.err == nil && len(pr.b) > 0 {
+		switch id := pr.varint(); id {
+		case propMessageExpiry:
+			p.MessageExpiry = pr.u32()
+		case propContentType:
+			p.ContentType = pr.str()
+		case propResponseTopic:
+			p.ResponseTopic = pr.str()
+		case propCorrelationData:
+			p.CorrelationData = append([]byte(nil), pr.bin()...)
+		case propUser:
+			p.User = append(p.User, UserProperty{pr.str(), pr.str()})
+		case propSessionExpiry:
+			p.sessionExpiry = pr.u32()
+		case propServerKeepAlive:
+			p.serverKeepAlive = pr.u16()
+			p.hasKeepAlive = true
+		case propReceiveMaximum:
+			p.receiveMax = pr.u16()
+		case propReasonString:
+			p.reason = pr.str()
+		// skip others by type
+		case propPayloadFormat, 0x17, 0x19, 0x24, 0x25, 0x28, 0x29, 0x2A:
+			pr.u8()
+		case 0x22, 0x23:
+			pr.u16()
+		case 0x18, 0x27:
+			pr.u32()
+		case 0x0B:
+			pr.varint()
+		case 0x12, 0x15, 0x1A, 0x1C, 0x16:
+			pr.bin()
+		default:
+			pr.err = errMalformed
+		}
+	}
+
+	if pr.err != nil && r.err == nil {
+		r.err = pr.err
+	}
+
+	return p
+}
+
+// readPacket reads packet type, flags and body
+func readPacket(rd io.Reader) (byte, byte, []byte, error) {
+	var h [1]byte
+
+	if _, err := io.ReadFull(rd, h[:]); err != nil {
+		return 0, 0, nil, err
+	}
+
+	var l, mul int
+
+	for i := 0; ; i++ {
+		if i == 4 {
+			return 0, 0, nil, errMalformed
+		}
+
+		var b [1]byte
+		if _, err := io.ReadFull(rd, b[:]); err != nil {
+			return 0, 0, nil, err
+		}
+
+		l += int(b[0]&0x7F) << mul
+		mul += 7
+
+		if b[0]&0x80 == 0 {
+			break
+		}
+	}
+
+	if l > maxPacketSize {
+		return 0, 0, nil, errMalformed
+	}
+
+	body := make([]byte, l)
+	if _, err := io.ReadFull(rd, body); err != nil {
+		return 0, 0, nil, err
+	}
+
+	return h[0] >> 4, h[0] & 0x0F, body, nil
+}
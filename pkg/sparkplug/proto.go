@@ -0,0 +1,336 @@
+/**
+ * Copyright 2021 Rightech IoT. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sparkplug
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// protobuf wire types
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// Payload fields
+const (
+	fieldTimestamp = 1
+	fieldMetrics   = 2
+	fieldSeq       = 3
+)
+
+// Metric fields
+const (
+	fieldName        = 1
+	fieldMTimestamp  = 3
+	fieldDataType    = 4
+	fieldIsNull      = 7
+	fieldIntValue    = 10
+	fieldLongValue   = 11
+	fieldFloatValue  = 12
+	fieldDoubleValue = 13
+	fieldBoolValue   = 14
+	fieldStringValue = 15
+	fieldBytesValue  = 16
+)
+
+var errTruncated = errors.New("sparkplug: truncated payload")
+
+type encoder []byte
+
+func (e *encoder) tag(field, wire int) {
+	e.varint(uint64(field<<3 | wire))
+}
+
+func (e *encoder) varint(v uint64) {
+	var buf [binary.MaxVarintLen64]byte
+
+	n := binary.PutUvarint(buf[:], v)
+	*e = append(*e, buf[:n]...)
+}
+
+func (e *encoder) uint(field int, v uint64) {
+	e.tag(field, wireVarint)
+	e.varint(v)
+}
+
+func (e *encoder) bytes(field int, b []byte) {
+	e.tag(field, wireBytes)
+	e.varint(uint64(len(b)))
+	*e = append(*e, b...)
+}
+
+// Marshal encodes payload to protobuf
+func Marshal(p Payload) ([]byte, error) {
+	var e encoder
+
+	e.uint(fieldTimestamp, p.Timestamp)
+
+	for _, m := range p.Metrics {
+		data, err := marshalMetric(m)
+		if err != nil {
+			return nil, fmt.Errorf("metric %s: %w", m.Name, err)
+		}
+
+		e.bytes(fieldMetrics, data)
+	}
+
+	if p.HasSeq {
+		e.uint(fieldSeq, p.Seq)
+	}
+
+	return e, nil
+}
+
+func marshalMetric(m Metric) ([]byte, error) {
+	var e encoder
+
+	e.bytes(fieldName, []byte(m.Name))
+
+	if m.Timestamp != 0 {
+		e.uint(fieldMTimestamp, m.Timestamp)
+	}
+
+	e.uint(fieldDataType, uint64(m.DataType))
+
+	if m.IsNull || m.Value == nil {
+		e.uint(fieldIsNull, 1)
+		return e, nil
+	}
+
+	return e, e.value(m.DataType, m.Value)
+}
+
+func (e *encoder) value(dt DataType, v interface{}) error { // nolint: gocyclo
+	switch dt {
+	case Int8, Int16, Int32:
+		n, err := toInt(v)
+		if err != nil {
+			return err
+		}
+
+		e.uint(fieldIntValue, uint64(uint32(int32(n))))
+	case UInt8, UInt16, UInt32:
+		n, err := toInt(v)
+		if err != nil {
+			return err
+		}
+
+		e.uint(fieldIntValue, uint64(uint32(n)))
+	case Int64, UInt64, DateTime:
+		n, err := toInt(v)
+		if err != nil {
+			return err
+		}
+
+		e.uint(fieldLongValue, uint64(n))
+	case Float:
+		f, err := toFloat(v)
+		if err != nil {
+			return err
+		}
+
+		e.tag(fieldFloatValue, wireFixed32)
+		*e = append(*e, 0, 0, 0, 0)
+		binary.LittleEndian.PutUint32((*e)[len(*e)-4:], math.Float32bits(float32(f)))
+	case Double:
+		f, err := toFloat(v)
+		if err != nil {
+			return err
+		}
+
+		e.tag(fieldDoubleValue, wireFixed64)
+		*e = append(*e, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.LittleEndian.PutUint64((*e)[len(*e)-8:], math.Float64bits(f))
+	case Boolean:
+		b, err := toBool(v)
+		if err != nil {
+			return err
+		}
+
+		var n uint64
+		if b {
+			n = 1
+		}
+
+		e.uint(fieldBoolValue, n)
+	case String, Text, UUID:
+		e.bytes(fieldStringValue, []byte(toString(v)))
+	case Bytes:
+		b, ok := v.([]byte)
+		if !ok {
+			b = []byte(toString(v))
+		}
+
+		e.bytes(fieldBytesValue, b)
+	default:
+		return fmt.Errorf("sparkplug: unsupported data type %d", dt)
+	}
+
+	return nil
+}
+
+type decoder struct {
+	data []byte
+}
+
+func (d *decoder) varint() (uint64, error) {
+	v, n := binary.Uvarint(d.data)
+	if n <= 0 {
+		return 0, errTruncated
+	}
+
+	d.data = d.data[n:]
+
+	return v, nil
+}
+
+func (d *decoder) fixed(n int) ([]byte, error) {
+	if len(d.data) < n {
+		return nil, errTruncated
+	}
+
+	b := d.data[:n]
+	d.data = d.data[n:]
+
+	return b, nil
+}
+
+// next reads field tag and value
+// (varint value for varint fields, raw bytes for others)
+func (d *decoder) next() (field, wire int, v uint64, b []byte, err error) {
+	t, err := d.varint()
+	if err != nil {
+		return
+	}
+
+	field, wire = int(t>>3), int(t&7)
+
+	switch wire {
+	case wireVarint:
+		v, err = d.varint()
+	case wireFixed64:
+		b, err = d.fixed(8)
+	case wireFixed32:
+		b, err = d.fixed(4)
+	case wireBytes:
+		var l uint64
+
+		l, err = d.varint()
+		if err == nil {
+			if l > uint64(len(d.data)) {
+				err = errTruncated
+				return
+			}
+
+			b, err = d.fixed(int(l))
+		}
+	default:
+		err = fmt.Errorf("sparkplug: unsupported wire type %d", wire)
+	}
+
+	return
+}
+
+// Unmarshal decodes protobuf payload
+func Unmarshal(data []byte) (Payload, error) {
+	var p Payload
+
+	d := decoder{data}
+
+	for len(d.data) > 0 {
+		field, _, v, b, err := d.next()
+		if err != nil {
+			return Payload{}, err
+		}
+
+		switch field {
+		case fieldTimestamp:
+			p.Timestamp = v
+		case fieldSeq:
+			p.Seq = v
+			p.HasSeq = true
+		case fieldMetrics:
+			m, err := unmarshalMetric(b)
+			if err != nil {
+				return Payload{}, err
+			}
+
+			p.Metrics = append(p.Metrics, m)
+		}
+	}
+
+	return p, nil
+}
+
+func unmarshalMetric(data []byte) (Metric, error) { // nolint: gocyclo
+	var m Metric
+
+	d := decoder{data}
+
+	for len(d.data) > 0 {
+		field, _, v, b, err := d.next()
+		if err != nil {
+			return Metric{}, err
+		}
+
+		switch field {
+		case fieldName:
+			m.Name = string(b)
+		case fieldMTimestamp:
+			m.Timestamp = v
+		case fieldDataType:
+			m.DataType = DataType(v)
+		case fieldIsNull:
+			m.IsNull = v != 0
+		case fieldIntValue:
+			switch m.DataType {
+			case Int8, Int16, Int32:
+				m.Value = int64(int32(uint32(v)))
+			default:
+				m.Value = uint64(uint32(v))
+			}
+		case fieldLongValue:
+			if m.DataType == Int64 {
+				m.Value = int64(v)
+			} else {
+				m.Value = v
+			}
+		case fieldFloatValue:
+			if len(b) == 4 {
+				m.Value = math.Float32frombits(binary.LittleEndian.Uint32(b))
+			}
+		case fieldDoubleValue:
+			if len(b) == 8 {
+				m.Value = math.Float64frombits(binary.LittleEndian.Uint64(b))
+			}
+		case fieldBoolValue:
+			m.Value = v != 0
+		case fieldStringValue:
+			m.Value = string(b)
+		case fieldBytesValue:
+			m.Value = append([]byte(nil), b...)
+		}
+	}
+
+	return m, nil
+}
@@ -0,0 +1,168 @@
+/**
+ * Copyright 2021 Rightech IoT. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package sparkplug implements Sparkplug B payload encoding
+// (protobuf org.eclipse.tahu.protobuf.Payload, templates and datasets are not supported)
+package sparkplug
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// DataType is Sparkplug B metric data type
+type DataType uint32
+
+const (
+	Unknown DataType = iota
+	Int8
+	Int16
+	Int32
+	Int64
+	UInt8
+	UInt16
+	UInt32
+	UInt64
+	Float
+	Double
+	Boolean
+	String
+	DateTime
+	Text
+	UUID
+	DataSet
+	Bytes
+)
+
+// Namespace is first topic level of Sparkplug B topics
+const Namespace = "spBv1.0"
+
+// Message types (third topic level)
+const (
+	NBIRTH = "NBIRTH"
+	NDEATH = "NDEATH"
+	NDATA  = "NDATA"
+	NCMD   = "NCMD"
+	DBIRTH = "DBIRTH"
+	DDEATH = "DDEATH"
+	DDATA  = "DDATA"
+	DCMD   = "DCMD"
+)
+
+// Metric of payload
+//
+// Value is converted to DataType on encode.
+// Decoded value is int64 (Int*), uint64 (UInt*, DateTime), float32, float64,
+// bool, string or []byte
+type Metric struct {
+	Name      string
+	Timestamp uint64
+	DataType  DataType
+	IsNull    bool
+	Value     interface{}
+}
+
+// Payload of Sparkplug B message
+type Payload struct {
+	Timestamp uint64
+	Metrics   []Metric
+	// NDEATH has no sequence number
+	HasSeq bool
+	Seq    uint64
+}
+
+var errNotNumber = errors.New("sparkplug: value is not a number")
+
+func toFloat(v interface{}) (float64, error) {
+	switch vv := v.(type) {
+	case float64:
+		return vv, nil
+	case float32:
+		return float64(vv), nil
+	case int:
+		return float64(vv), nil
+	case int8:
+		return float64(vv), nil
+	case int16:
+		return float64(vv), nil
+	case int32:
+		return float64(vv), nil
+	case int64:
+		return float64(vv), nil
+	case uint:
+		return float64(vv), nil
+	case uint8:
+		return float64(vv), nil
+	case uint16:
+		return float64(vv), nil
+	case uint32:
+		return float64(vv), nil
+	case uint64:
+		return float64(vv), nil
+	case bool:
+		if vv {
+			return 1, nil
+		}
+
+		return 0, nil
+	case string:
+		return strconv.ParseFloat(vv, 64)
+	default:
+		return 0, errNotNumber
+	}
+}
+
+func toInt(v interface{}) (int64, error) {
+	switch vv := v.(type) {
+	case int64:
+		return vv, nil
+	case uint64:
+		return int64(vv), nil
+	case int:
+		return int64(vv), nil
+	case string:
+		return strconv.ParseInt(vv, 10, 64)
+	}
+
+	f, err := toFloat(v)
+
+	return int64(f), err
+}
+
+func toBool(v interface{}) (bool, error) {
+	switch vv := v.(type) {
+	case bool:
+		return vv, nil
+	case string:
+		return strconv.ParseBool(vv)
+	}
+
+	f, err := toFloat(v)
+
+	return f != 0, err
+}
+
+func toString(v interface{}) string {
+	switch vv := v.(type) {
+	case string:
+		return vv
+	case []byte:
+		return string(vv)
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,106 @@
+/**
+ * Copyright 2021 Rightech IoT. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sparkplug
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	in := Payload{
+		Timestamp: 1600000000000,
+		HasSeq:    true,
+		Seq:       255,
+		Metrics: []Metric{
+			{Name: "i8", DataType: Int8, Value: -5},
+			{Name: "u32", DataType: UInt32, Value: float64(4000000000)},
+			{Name: "i64", DataType: Int64, Value: "-9000000000"},
+			{Name: "f", DataType: Float, Value: 1.5},
+			{Name: "d", DataType: Double, Value: 2},
+			{Name: "b", DataType: Boolean, Value: true},
+			{Name: "s", DataType: String, Value: 42},
+			{Name: "bytes", DataType: Bytes, Value: []byte{1, 2}},
+			{Name: "null", DataType: Double, Timestamp: 1},
+		},
+	}
+
+	data, err := Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := Unmarshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if out.Timestamp != in.Timestamp || !out.HasSeq || out.Seq != in.Seq {
+		t.Fatalf("wrong payload header %+v", out)
+	}
+
+	want := []interface{}{
+		int64(-5), uint64(4000000000), int64(-9000000000), float32(1.5), float64(2), true, "42",
+		[]byte{1, 2}, nil,
+	}
+
+	if len(out.Metrics) != len(want) {
+		t.Fatalf("want %d metrics got %d", len(want), len(out.Metrics))
+	}
+
+	for i, m := range out.Metrics {
+		if m.Name != in.Metrics[i].Name || m.DataType != in.Metrics[i].DataType {
+			t.Errorf("%d: wrong metric %+v", i, m)
+		}
+
+		if b, ok := m.Value.([]byte); ok {
+			if !bytes.Equal(b, want[i].([]byte)) {
+				t.Errorf("%s: want %v got %v", m.Name, want[i], b)
+			}
+
+			continue
+		}
+
+		if m.Value != want[i] {
+			t.Errorf("%s: want %v (%T) got %v (%T)", m.Name, want[i], want[i], m.Value, m.Value)
+		}
+	}
+
+	if !out.Metrics[8].IsNull || out.Metrics[8].Timestamp != 1 {
+		t.Errorf("null metric expected %+v", out.Metrics[8])
+	}
+}
+
+func TestNoSeq(t *testing.T) {
+	data, err := Marshal(Payload{Metrics: []Metric{{Name: "bdSeq", DataType: UInt64, Value: uint64(3)}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := Unmarshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p.HasSeq || p.Metrics[0].Value != uint64(3) {
+		t.Errorf("wrong payload %+v", p)
+	}
+
+	if _, err := Unmarshal(data[:len(data)-1]); err == nil {
+		t.Error("truncated payload decoded")
+	}
+}
@@ -35,6 +35,8 @@ type Service struct {
 
 const (
 	bucketName = "mqtt"
+	// paho prefix of outgoing messages keys
+	outboundPrefix = "o."
 )
 
 func NewStore(db DB) Service {
@@ -153,3 +155,28 @@ func (s Service) Reset() {
 		log.WithError(err).Error("bolt.Reset")
 	}
 }
+
+// Queued returns count of outgoing messages not acknowledged by broker yet
+func (s Service) Queued() int {
+	var n int
+
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		bk := tx.Bucket([]byte(bucketName))
+		if bk == nil {
+			return nil
+		}
+
+		return bk.ForEach(func(k, _ []byte) error {
+			if bytes.HasPrefix(k, []byte(outboundPrefix)) {
+				n++
+			}
+
+			return nil
+		})
+	})
+	if err != nil {
+		log.WithError(err).Error("bolt.Queued")
+	}
+
+	return n
+}
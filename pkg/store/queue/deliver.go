@@ -0,0 +1,190 @@
+/**
+ * Copyright 2021 Rightech IoT. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package queue
+
+import (
+	"errors"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/Rightech/ric-edge/pkg/backoff"
+	"github.com/Rightech/ric-edge/pkg/store/state"
+)
+
+// Encoder converts change to message of queue (nil data skips change)
+// key is used by Coalesce policy
+type Encoder func(c state.Change) (key string, data []byte, err error)
+
+// Sender sends batch of messages in order
+// batch is retried on error unless error is Permanent
+type Sender func(batch []Item) error
+
+// PermanentError is error which can't be fixed by retry (batch is dropped)
+type PermanentError struct {
+	Err error
+}
+
+func (e PermanentError) Error() string {
+	return e.Err.Error()
+}
+
+func (e PermanentError) Unwrap() error {
+	return e.Err
+}
+
+// Permanent marks error of batch which can't be fixed by retry
+func Permanent(err error) error {
+	return PermanentError{err}
+}
+
+// Delivery configures Deliverer
+type Delivery struct {
+	// max messages in one batch
+	BatchSize int
+	// how long not full batch waits more messages
+	FlushInterval time.Duration
+	// delays between retries of failed batch
+	BackoffMin time.Duration
+	BackoffMax time.Duration
+	Encode     Encoder
+	Send       Sender
+	// Log is entry with exporter fields
+	Log *log.Entry
+}
+
+// Deliverer puts changes to queue and sends them in batches
+// batch stays in queue until it's sent (or dropped on permanent error),
+// so messages are delivered in order after receiver is reachable again
+type Deliverer struct {
+	c    Delivery
+	q    *Queue
+	done chan struct{}
+}
+
+// NewDeliverer starts delivery of changes from in through q
+func NewDeliverer(q *Queue, c Delivery, in <-chan state.Change) *Deliverer {
+	if c.BatchSize <= 0 {
+		c.BatchSize = 1
+	}
+
+	if c.Log == nil {
+		c.Log = log.NewEntry(log.StandardLogger())
+	}
+
+	d := &Deliverer{c: c, q: q, done: make(chan struct{})}
+
+	go d.consume(in)
+	go d.deliver()
+
+	return d
+}
+
+// consume encodes changes and puts them to queue
+func (d *Deliverer) consume(in <-chan state.Change) {
+	for c := range in {
+		key, data, err := d.c.Encode(c)
+		if err == nil && data != nil {
+			err = d.q.Push(key, data)
+		}
+
+		if err != nil {
+			d.c.Log.WithFields(log.Fields{
+				"param": c.Param,
+				"error": err,
+			}).Error("err buffer change")
+		}
+	}
+}
+
+// fill waits until batch is full or flush interval elapsed
+// it returns false if deliverer closed
+func (d *Deliverer) fill() bool {
+	timer := time.NewTimer(d.c.FlushInterval)
+	defer timer.Stop()
+
+	for d.q.Stats().Len < d.c.BatchSize {
+		select {
+		case <-d.q.Pushed():
+		case <-timer.C:
+			return true
+		case <-d.done:
+			return false
+		}
+	}
+
+	return true
+}
+
+// deliver sends queued messages in order
+func (d *Deliverer) deliver() {
+	b := backoff.New(d.c.BackoffMin, d.c.BackoffMax)
+
+	for {
+		if d.q.Stats().Len == 0 {
+			select {
+			case <-d.q.Pushed():
+				continue
+			case <-d.done:
+				return
+			}
+		}
+
+		if !d.fill() {
+			return
+		}
+
+		batch, err := d.q.PeekN(d.c.BatchSize)
+		if err == nil {
+			err = d.c.Send(batch)
+		}
+
+		var pe PermanentError
+		if errors.As(err, &pe) {
+			d.c.Log.WithFields(log.Fields{
+				"items": len(batch),
+				"error": err,
+			}).Error("batch rejected, dropped")
+
+			err = nil
+		}
+
+		if err != nil {
+			d.c.Log.WithError(err).Warn("batch not delivered")
+
+			select {
+			case <-time.After(b.Next()):
+				continue
+			case <-d.done:
+				return
+			}
+		}
+
+		b.Reset()
+
+		for _, it := range batch {
+			if err := d.q.Ack(it); err != nil {
+				d.c.Log.WithError(err).Error("err ack message")
+			}
+		}
+	}
+}
+
+// Close stops delivery (not delivered messages are kept in queue)
+func (d *Deliverer) Close() {
+	close(d.done)
+}
@@ -0,0 +1,80 @@
+/**
+ * Copyright 2021 Rightech IoT. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package queue
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Rightech/ric-edge/pkg/store/state"
+)
+
+func TestDeliverer(t *testing.T) {
+	q := NewMemory(10, DropOldest)
+	in := make(chan state.Change)
+	sent := make(chan []string, 10)
+	calls := 0
+
+	d := NewDeliverer(q, Delivery{
+		BatchSize:     2,
+		FlushInterval: time.Minute,
+		BackoffMin:    time.Millisecond,
+		BackoffMax:    time.Millisecond,
+		Encode: func(c state.Change) (string, []byte, error) {
+			if c.Value == nil {
+				return "", nil, nil
+			}
+
+			return c.Param, []byte(c.Value.(string)), nil
+		},
+		Send: func(batch []Item) error {
+			calls++
+
+			switch calls {
+			case 1:
+				return errors.New("temporary")
+			case 2:
+				return Permanent(errors.New("bad batch"))
+			}
+
+			res := make([]string, len(batch))
+			for i, it := range batch {
+				res[i] = string(it.Data)
+			}
+
+			sent <- res
+
+			return nil
+		},
+	}, in)
+	defer d.Close()
+
+	// first batch is retried once and then dropped, nil value is skipped
+	for _, v := range []interface{}{"a", nil, "b", "c", "d"} {
+		in <- state.Change{Param: "p", Value: v}
+	}
+
+	select {
+	case got := <-sent:
+		if !equal(got, []string{"c", "d"}) {
+			t.Errorf("want [c d] got %v", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("batch not sent")
+	}
+}
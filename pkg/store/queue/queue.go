@@ -0,0 +1,388 @@
+/**
+ * Copyright 2021 Rightech IoT. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package queue implements bounded FIFO queue of messages stored in memory or bbolt
+// it used to buffer messages while receiver is unreachable
+package queue
+
+import (
+	"container/list"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+
+	"go.etcd.io/bbolt"
+)
+
+// Policy defines what queue does when it's full
+type Policy string
+
+const (
+	// DropOldest removes the oldest message to add new one
+	DropOldest Policy = "drop-oldest"
+	// DropLatest rejects new message
+	DropLatest Policy = "drop-latest"
+	// Coalesce keeps only the latest message of each key
+	// (if there is no message with the same key the oldest message is dropped)
+	Coalesce Policy = "coalesce"
+)
+
+// ParsePolicy returns policy by name (empty name means DropOldest)
+func ParsePolicy(name string) (Policy, error) {
+	switch p := Policy(name); p {
+	case "":
+		return DropOldest, nil
+	case DropOldest, DropLatest, Coalesce:
+		return p, nil
+	default:
+		return "", fmt.Errorf("queue: unknown policy %q", name)
+	}
+}
+
+type DB interface {
+	Update(func(tx *bbolt.Tx) error) error
+	View(func(tx *bbolt.Tx) error) error
+}
+
+// Item is message in queue
+type Item struct {
+	Seq  uint64
+	Key  string
+	Data []byte
+}
+
+// Stats of queue
+type Stats struct {
+	Len       int    `json:"len"`
+	Dropped   uint64 `json:"dropped"`
+	Coalesced uint64 `json:"coalesced"`
+}
+
+// storage keeps messages data (order and keys are kept in memory by Queue)
+type storage interface {
+	put(Item) error
+	get(seq uint64) ([]byte, error)
+	delete(seq uint64) error
+}
+
+type Queue struct {
+	mx     sync.Mutex
+	st     storage
+	size   int
+	policy Policy
+	items  *list.List // of Item without data
+	keys   map[string]*list.Element
+	seq    uint64
+	stats  Stats
+	pushed chan struct{}
+	// seq of removed messages which data should be deleted from storage
+	garbage []uint64
+}
+
+func newQueue(st storage, size int, policy Policy) *Queue {
+	if size <= 0 {
+		size = 1
+	}
+
+	return &Queue{
+		st: st, size: size, policy: policy,
+		items: list.New(), keys: make(map[string]*list.Element),
+		pushed: make(chan struct{}, 1),
+	}
+}
+
+// NewMemory returns queue stored in memory
+func NewMemory(size int, policy Policy) *Queue {
+	return newQueue(memory{}, size, policy)
+}
+
+// NewBolt returns queue stored in bucket of bbolt db
+// messages left in bucket from previous run are loaded
+func NewBolt(db DB, bucket string, size int, policy Policy) (*Queue, error) {
+	st := bolt{db: db, bucket: []byte(bucket)}
+	q := newQueue(st, size, policy)
+
+	err := db.Update(func(tx *bbolt.Tx) error {
+		bk, err := tx.CreateBucketIfNotExists(st.bucket)
+		if err != nil {
+			return err
+		}
+
+		return bk.ForEach(func(k, v []byte) error {
+			key, _, err := decode(v)
+			if err != nil {
+				return err
+			}
+
+			q.seq = binary.BigEndian.Uint64(k)
+			q.add(Item{Seq: q.seq, Key: key})
+
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// size could be decreased since previous run
+	for q.items.Len() > q.size {
+		q.discard(q.items.Front())
+		q.stats.Dropped++
+	}
+
+	return q, q.collect()
+}
+
+func (q *Queue) add(it Item) {
+	e := q.items.PushBack(Item{Seq: it.Seq, Key: it.Key})
+
+	if q.policy == Coalesce && it.Key != "" {
+		q.keys[it.Key] = e
+	}
+}
+
+// unlink removes element from list (q.mx should be locked)
+func (q *Queue) unlink(e *list.Element) Item {
+	it := q.items.Remove(e).(Item)
+
+	if k, ok := q.keys[it.Key]; ok && k == e {
+		delete(q.keys, it.Key)
+	}
+
+	return it
+}
+
+// discard removes element and marks its data as garbage
+func (q *Queue) discard(e *list.Element) {
+	q.garbage = append(q.garbage, q.unlink(e).Seq)
+}
+
+// collect deletes data of discarded messages from storage
+func (q *Queue) collect() error {
+	var err error
+
+	for _, seq := range q.garbage {
+		if e := q.st.delete(seq); e != nil {
+			err = e
+		}
+	}
+
+	q.garbage = q.garbage[:0]
+
+	return err
+}
+
+// Push adds message to the end of queue
+// if queue is full message is dropped according to policy
+func (q *Queue) Push(key string, data []byte) error {
+	q.mx.Lock()
+	defer q.mx.Unlock()
+
+	if q.policy == Coalesce {
+		if e, ok := q.keys[key]; ok {
+			q.discard(e)
+			q.stats.Coalesced++
+		}
+	}
+
+	if q.items.Len() >= q.size {
+		if q.policy == DropLatest {
+			q.stats.Dropped++
+			return nil
+		}
+
+		q.discard(q.items.Front())
+		q.stats.Dropped++
+	}
+
+	q.seq++
+	it := Item{Seq: q.seq, Key: key, Data: data}
+
+	err := q.st.put(it)
+	if err != nil {
+		return err
+	}
+
+	q.add(it)
+
+	select {
+	case q.pushed <- struct{}{}:
+	default:
+	}
+
+	return q.collect()
+}
+
+// Peek returns the oldest message (message stays in queue until Ack)
+func (q *Queue) Peek() (Item, bool, error) {
+	q.mx.Lock()
+	defer q.mx.Unlock()
+
+	e := q.items.Front()
+	if e == nil {
+		return Item{}, false, nil
+	}
+
+	it := e.Value.(Item)
+
+	data, err := q.st.get(it.Seq)
+	if err != nil {
+		return Item{}, false, err
+	}
+
+	it.Data = data
+
+	return it, true, nil
+}
+
+// PeekN returns up to n oldest messages in order (messages stay in queue until Ack)
+func (q *Queue) PeekN(n int) ([]Item, error) {
+	q.mx.Lock()
+	defer q.mx.Unlock()
+
+	res := make([]Item, 0, n)
+
+	for e := q.items.Front(); e != nil && len(res) < n; e = e.Next() {
+		it := e.Value.(Item)
+
+		data, err := q.st.get(it.Seq)
+		if err != nil {
+			return nil, err
+		}
+
+		it.Data = data
+		res = append(res, it)
+	}
+
+	return res, nil
+}
+
+// Ack removes message returned by Peek (messages returned by PeekN should be acked in order)
+// (it does nothing if message already dropped or coalesced)
+func (q *Queue) Ack(it Item) error {
+	q.mx.Lock()
+	defer q.mx.Unlock()
+
+	e := q.items.Front()
+	if e == nil || e.Value.(Item).Seq != it.Seq {
+		return nil
+	}
+
+	q.unlink(e)
+
+	return q.st.delete(it.Seq)
+}
+
+// Pushed returns channel which receives value when new message pushed
+func (q *Queue) Pushed() <-chan struct{} {
+	return q.pushed
+}
+
+func (q *Queue) Stats() Stats {
+	q.mx.Lock()
+	defer q.mx.Unlock()
+
+	st := q.stats
+	st.Len = q.items.Len()
+
+	return st
+}
+
+var errNotFound = errors.New("queue: message not found")
+
+type memory map[uint64][]byte
+
+func (m memory) put(it Item) error {
+	m[it.Seq] = it.Data
+	return nil
+}
+
+func (m memory) get(seq uint64) ([]byte, error) {
+	data, ok := m[seq]
+	if !ok {
+		return nil, errNotFound
+	}
+
+	return data, nil
+}
+
+func (m memory) delete(seq uint64) error {
+	delete(m, seq)
+	return nil
+}
+
+type bolt struct {
+	db     DB
+	bucket []byte
+}
+
+func seqKey(seq uint64) []byte {
+	k := make([]byte, 8)
+	binary.BigEndian.PutUint64(k, seq)
+
+	return k
+}
+
+// encode stores key and data in one value (key required to restore coalescing)
+func encode(key string, data []byte) []byte {
+	buf := make([]byte, binary.MaxVarintLen64, binary.MaxVarintLen64+len(key)+len(data))
+	n := binary.PutUvarint(buf, uint64(len(key)))
+
+	buf = append(buf[:n], key...)
+
+	return append(buf, data...)
+}
+
+func decode(v []byte) (string, []byte, error) {
+	l, n := binary.Uvarint(v)
+	if n <= 0 || uint64(len(v)-n) < l {
+		return "", nil, errors.New("queue: bad stored message")
+	}
+
+	return string(v[n : n+int(l)]), v[n+int(l):], nil
+}
+
+func (b bolt) put(it Item) error {
+	return b.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(b.bucket).Put(seqKey(it.Seq), encode(it.Key, it.Data))
+	})
+}
+
+func (b bolt) get(seq uint64) ([]byte, error) {
+	var data []byte
+
+	err := b.db.View(func(tx *bbolt.Tx) error {
+		v := tx.Bucket(b.bucket).Get(seqKey(seq))
+		if v == nil {
+			return errNotFound
+		}
+
+		_, d, err := decode(v)
+		// value is valid only inside transaction
+		data = append([]byte(nil), d...)
+
+		return err
+	})
+
+	return data, err
+}
+
+func (b bolt) delete(seq uint64) error {
+	return b.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(b.bucket).Delete(seqKey(seq))
+	})
+}
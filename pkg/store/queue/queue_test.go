@@ -0,0 +1,175 @@
+/**
+ * Copyright 2021 Rightech IoT. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package queue
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.etcd.io/bbolt"
+)
+
+func drain(t *testing.T, q *Queue) []string {
+	t.Helper()
+
+	var res []string
+
+	for {
+		it, ok, err := q.Peek()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !ok {
+			return res
+		}
+
+		res = append(res, string(it.Data))
+
+		if err := q.Ack(it); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func TestPolicies(t *testing.T) {
+	cases := []struct {
+		policy  Policy
+		want    []string
+		dropped uint64
+	}{
+		{DropOldest, []string{"b1", "a2", "b2"}, 1},
+		{DropLatest, []string{"a1", "b1", "a2"}, 1},
+		{Coalesce, []string{"a2", "b2"}, 0},
+	}
+
+	for _, c := range cases {
+		q := NewMemory(3, c.policy)
+
+		for _, v := range []string{"a1", "b1", "a2", "b2"} {
+			if err := q.Push(v[:1], []byte(v)); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if st := q.Stats(); st.Dropped != c.dropped {
+			t.Errorf("%s: want %d dropped got %+v", c.policy, c.dropped, st)
+		}
+
+		if got := drain(t, q); !equal(got, c.want) {
+			t.Errorf("%s: want %v got %v", c.policy, c.want, got)
+		}
+	}
+}
+
+func TestBolt(t *testing.T) {
+	dir, err := ioutil.TempDir("", "queue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "queue.db")
+
+	db, err := bbolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	q, err := NewBolt(db, "q", 10, Coalesce)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, v := range []string{"a1", "b1", "a2"} {
+		if err := q.Push(v[:1], []byte(v)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	db.Close()
+
+	db, err = bbolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// reopened with smaller size
+	q, err = NewBolt(db, "q", 1, Coalesce)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := q.Push("b", []byte("b2")); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := drain(t, q); !equal(got, []string{"b2"}) {
+		t.Errorf("want [b2] got %v", got)
+	}
+}
+
+func TestPeekN(t *testing.T) {
+	q := NewMemory(10, Coalesce)
+
+	for _, v := range []string{"a1", "b1", "c1"} {
+		if err := q.Push(v[:1], []byte(v)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	batch, err := q.PeekN(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(batch) != 2 || string(batch[0].Data) != "a1" || string(batch[1].Data) != "b1" {
+		t.Fatalf("wrong batch %v", batch)
+	}
+
+	// b1 is coalesced while batch is processed
+	if err := q.Push("b", []byte("b2")); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, it := range batch {
+		if err := q.Ack(it); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got := drain(t, q); !equal(got, []string{"c1", "b2"}) {
+		t.Errorf("want [c1 b2] got %v", got)
+	}
+}
@@ -0,0 +1,166 @@
+/**
+ * Copyright 2021 Rightech IoT. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package state
+
+import (
+	"strings"
+	"sync/atomic"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/objx"
+)
+
+// Change of parameter value (it's published by northbound services, e.g. mqtt)
+type Change struct {
+	// parameter id (path in state)
+	Param string
+	Value interface{}
+	// unit of parameter from model (if any)
+	Unit string
+	Time time.Time
+}
+
+// Key returns change param for model parameter id
+// (parameters are placed under "edge." in model, but state has no such prefix)
+func Key(id string) string {
+	return strings.TrimPrefix(id, "edge.")
+}
+
+// Document returns json document where value placed by parameter path
+// (e.g. {"a": {"b": 1}} for parameter a.b)
+func (c Change) Document() ([]byte, error) {
+	data := make(objx.Map, 1)
+	data.Set(c.Param, c.Value)
+
+	return jsoniter.ConfigFastest.Marshal(data)
+}
+
+// FanoutBuffer is how many changes are kept for lossy output of Fanout
+const FanoutBuffer = 1000
+
+// dropLogInterval limits warnings about dropped changes of one output
+const dropLogInterval = time.Minute
+
+// Output of Fanout
+type Output struct {
+	Name string
+	Ch   chan<- Change
+	// Lossy output is fed by own goroutine, so it doesn't block others
+	// (its oldest changes are dropped if it's FanoutBuffer changes behind),
+	// not lossy output blocks fanout (and so connectors) until it takes change
+	Lossy bool
+}
+
+type output struct {
+	Output
+	buf     chan Change
+	dropped uint64
+	// when drop was logged last time (used by fanout goroutine only)
+	logged time.Time
+}
+
+// Fanout sends every change to each of outputs
+type Fanout struct {
+	outs []*output
+}
+
+func NewFanout(outs ...Output) *Fanout {
+	f := &Fanout{outs: make([]*output, len(outs))}
+
+	for i, o := range outs {
+		f.outs[i] = &output{Output: o}
+	}
+
+	return f
+}
+
+// Run sends changes from in until it's closed, then outputs are closed
+func (f *Fanout) Run(in <-chan Change) {
+	for _, o := range f.outs {
+		if o.Lossy {
+			o.buf = make(chan Change, FanoutBuffer)
+
+			go forward(o.buf, o.Ch)
+		}
+	}
+
+	for c := range in {
+		for _, o := range f.outs {
+			if !o.Lossy {
+				o.Ch <- c
+				continue
+			}
+
+			select {
+			case o.buf <- c:
+			default:
+				// only this goroutine sends to buf, so there is room after drop
+				select {
+				case <-o.buf:
+					o.drop()
+				default:
+				}
+
+				o.buf <- c
+			}
+		}
+	}
+
+	for _, o := range f.outs {
+		if o.Lossy {
+			close(o.buf)
+		} else {
+			close(o.Ch)
+		}
+	}
+}
+
+func (o *output) drop() {
+	n := atomic.AddUint64(&o.dropped, 1)
+
+	if time.Since(o.logged) >= dropLogInterval {
+		o.logged = time.Now()
+
+		log.WithFields(log.Fields{
+			"output":  o.Name,
+			"dropped": n,
+		}).Warn("state output is too slow, oldest changes dropped")
+	}
+}
+
+// Dropped returns count of dropped changes by output name (lossy outputs only)
+func (f *Fanout) Dropped() map[string]uint64 {
+	res := make(map[string]uint64)
+
+	for _, o := range f.outs {
+		if o.Lossy {
+			res[o.Name] = atomic.LoadUint64(&o.dropped)
+		}
+	}
+
+	return res
+}
+
+func forward(buf <-chan Change, out chan<- Change) {
+	for c := range buf {
+		out <- c
+	}
+
+	close(out)
+}